@@ -1,12 +1,17 @@
 package auth
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"errors"
 	"time"
 
 	"habit-tracker/server/db"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -14,18 +19,36 @@ var (
 	ErrInvalidCredentials = errors.New("invalid credentials")
 	ErrInvalidToken       = errors.New("invalid token")
 	ErrExpiredToken       = errors.New("token is expired")
+	ErrRevokedToken       = errors.New("token has been revoked")
+	ErrTokenReused        = errors.New("refresh token reuse detected")
 	ErrEmailInUse         = errors.New("email already in use")
 	ErrUsernameInUse      = errors.New("username already in use")
 )
 
+const (
+	DefaultAccessTokenExpiry  = 15 * time.Minute
+	DefaultRefreshTokenExpiry = 30 * 24 * time.Hour
+)
+
 // AuthService provides authentication functionality
 type AuthService struct {
-	database    db.Database
-	jwtSecret   []byte
-	tokenExpiry time.Duration
+	database           db.Database
+	jwtSecret          []byte
+	tokenExpiry        time.Duration
+	refreshTokenExpiry time.Duration
+}
+
+// TokenPair is the access and refresh token issued for a session
+type TokenPair struct {
+	AccessToken  string
+	RefreshToken string
+	// ExpiresIn is the access token lifetime in seconds
+	ExpiresIn int64
+	SessionID string
 }
 
-// NewAuthService creates a new authentication service
+// NewAuthService creates a new authentication service. tokenExpiry is the
+// lifetime of access tokens; refresh tokens use DefaultRefreshTokenExpiry.
 func NewAuthService(database db.Database, jwtSecret string, tokenExpiry time.Duration) *AuthService {
 	if database == nil {
 		panic("database cannot be nil")
@@ -38,12 +61,18 @@ func NewAuthService(database db.Database, jwtSecret string, tokenExpiry time.Dur
 	}
 
 	return &AuthService{
-		database:    database,
-		jwtSecret:   []byte(jwtSecret),
-		tokenExpiry: tokenExpiry,
+		database:           database,
+		jwtSecret:          []byte(jwtSecret),
+		tokenExpiry:        tokenExpiry,
+		refreshTokenExpiry: DefaultRefreshTokenExpiry,
 	}
 }
 
+// SetRefreshTokenExpiry changes the lifetime of newly issued refresh tokens
+func (s *AuthService) SetRefreshTokenExpiry(expiry time.Duration) {
+	s.refreshTokenExpiry = expiry
+}
+
 // HashPassword creates a bcrypt hash from a plain-text password
 func (s *AuthService) HashPassword(password string) (string, error) {
 	hashedBytes, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
@@ -60,6 +89,14 @@ func (s *AuthService) VerifyPassword(hashedPassword, providedPassword string) er
 
 // Register creates a new user with the provided credentials
 func (s *AuthService) Register(email, username, password string) (*db.User, error) {
+	return s.RegisterAccount(RegisterRequest{Email: email, Username: username, Password: password})
+}
+
+// RegisterAccount creates a new user with the credentials and calendar
+// preferences in req. The user is stored with its preferences in one write.
+func (s *AuthService) RegisterAccount(req RegisterRequest) (*db.User, error) {
+	email, username, password := req.Email, req.Username, req.Password
+
 	// Validate input
 	if email == "" {
 		return nil, errors.New("email is required")
@@ -71,6 +108,13 @@ func (s *AuthService) Register(email, username, password string) (*db.User, erro
 		return nil, errors.New("password is required")
 	}
 
+	if err := db.ValidateTimezone(req.Timezone); err != nil {
+		return nil, err
+	}
+	if err := db.ValidateWeekStart(req.WeekStart); err != nil {
+		return nil, err
+	}
+
 	// Check if user already exists by email
 	_, err := s.database.GetUserByEmail(email)
 	if err == nil {
@@ -91,6 +135,8 @@ func (s *AuthService) Register(email, username, password string) (*db.User, erro
 		Email:        email,
 		Username:     username,
 		PasswordHash: hashedPassword,
+		Timezone:     req.Timezone,
+		WeekStart:    req.WeekStart,
 		CreatedAt:    time.Now(),
 		UpdatedAt:    time.Now(),
 	}
@@ -103,39 +149,196 @@ func (s *AuthService) Register(email, username, password string) (*db.User, erro
 	return user, nil
 }
 
-// Login authenticates a user and returns a JWT token
-func (s *AuthService) Login(email, password string) (string, *db.User, error) {
+// UpdatePreferences sets the user's time zone, week start and quiet hours.
+// Nil values are left unchanged; everything is validated before anything is
+// saved, with quiet hours checked as the start and end they end up as.
+func (s *AuthService) UpdatePreferences(user *db.User, prefs UpdateProfileRequest) error {
+	if prefs.Timezone != nil {
+		if err := db.ValidateTimezone(*prefs.Timezone); err != nil {
+			return err
+		}
+	}
+	if prefs.WeekStart != nil {
+		if err := db.ValidateWeekStart(*prefs.WeekStart); err != nil {
+			return err
+		}
+	}
+	if prefs.Timezone == nil && prefs.WeekStart == nil && prefs.QuietHoursStart == nil && prefs.QuietHoursEnd == nil {
+		return nil
+	}
+
+	updated := *user
+	if prefs.Timezone != nil {
+		updated.Timezone = *prefs.Timezone
+	}
+	if prefs.WeekStart != nil {
+		updated.WeekStart = *prefs.WeekStart
+	}
+	if prefs.QuietHoursStart != nil {
+		updated.QuietHoursStart = *prefs.QuietHoursStart
+	}
+	if prefs.QuietHoursEnd != nil {
+		updated.QuietHoursEnd = *prefs.QuietHoursEnd
+	}
+	if err := db.ValidateQuietHours(updated.QuietHoursStart, updated.QuietHoursEnd); err != nil {
+		return err
+	}
+
+	updated.UpdatedAt = time.Now()
+	if err := s.database.UpdateUser(&updated); err != nil {
+		return err
+	}
+	*user = updated
+	return nil
+}
+
+// Login authenticates a user and starts a new session, returning its tokens
+func (s *AuthService) Login(email, password string) (*TokenPair, *db.User, error) {
 	// Get the user from the database
 	user, err := s.database.GetUserByEmail(email)
 	if err != nil {
 		if errors.Is(err, db.ErrNotFound) {
-			return "", nil, ErrInvalidCredentials
+			return nil, nil, ErrInvalidCredentials
 		}
-		return "", nil, err
+		return nil, nil, err
 	}
 
 	// Verify the password
 	if err := s.VerifyPassword(user.PasswordHash, password); err != nil {
-		return "", nil, ErrInvalidCredentials
+		return nil, nil, ErrInvalidCredentials
 	}
 
-	// Generate a JWT token
-	token, err := s.generateToken(user)
+	// Start a new refresh token family for this login
+	familyID := uuid.New().String()
+	refreshToken, err := s.issueRefreshToken(user.ID, familyID, "")
 	if err != nil {
-		return "", nil, err
+		return nil, nil, err
 	}
 
-	return token, user, nil
+	tokens, err := s.newTokenPair(user, familyID, refreshToken)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return tokens, user, nil
+}
+
+// Refresh exchanges a refresh token for a new token pair. The presented token
+// is revoked; presenting an already rotated token revokes the whole session.
+func (s *AuthService) Refresh(refreshToken string) (*TokenPair, error) {
+	stored, err := s.database.GetRefreshTokenByHash(hashRefreshToken(refreshToken))
+	if err != nil {
+		if errors.Is(err, db.ErrNotFound) {
+			return nil, ErrInvalidToken
+		}
+		return nil, err
+	}
+
+	if stored.RevokedAt != nil {
+		// A rotated token is being replayed, so assume it was stolen
+		if err := s.database.RevokeRefreshTokenFamily(stored.FamilyID); err != nil {
+			return nil, err
+		}
+		return nil, ErrTokenReused
+	}
+
+	if time.Now().After(stored.ExpiresAt) {
+		return nil, ErrExpiredToken
+	}
+
+	user, err := s.database.GetUserByID(stored.UserID)
+	if err != nil {
+		if errors.Is(err, db.ErrNotFound) {
+			return nil, ErrInvalidToken
+		}
+		return nil, err
+	}
+
+	newRefreshToken, err := s.issueRefreshToken(user.ID, stored.FamilyID, stored.ID)
+	if err != nil {
+		if errors.Is(err, db.ErrNotFound) {
+			// Lost a race with a concurrent refresh using the same token
+			if revokeErr := s.database.RevokeRefreshTokenFamily(stored.FamilyID); revokeErr != nil {
+				return nil, revokeErr
+			}
+			return nil, ErrTokenReused
+		}
+		return nil, err
+	}
+
+	return s.newTokenPair(user, stored.FamilyID, newRefreshToken)
+}
+
+// Logout revokes every refresh token of the session
+func (s *AuthService) Logout(sessionID string) error {
+	if sessionID == "" {
+		return ErrInvalidToken
+	}
+	return s.database.RevokeRefreshTokenFamily(sessionID)
+}
+
+// issueRefreshToken stores a new refresh token in the given family. When
+// replacesID is set the previous token is rotated out in the same operation.
+func (s *AuthService) issueRefreshToken(userID, familyID, replacesID string) (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	plain := base64.RawURLEncoding.EncodeToString(raw)
+
+	now := time.Now()
+	token := &db.RefreshToken{
+		ID:        uuid.New().String(),
+		UserID:    userID,
+		FamilyID:  familyID,
+		TokenHash: hashRefreshToken(plain),
+		ExpiresAt: now.Add(s.refreshTokenExpiry),
+		CreatedAt: now,
+	}
+
+	var err error
+	if replacesID == "" {
+		err = s.database.CreateRefreshToken(token)
+	} else {
+		err = s.database.RotateRefreshToken(replacesID, token)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return plain, nil
+}
+
+// newTokenPair signs an access token bound to the session
+func (s *AuthService) newTokenPair(user *db.User, sessionID, refreshToken string) (*TokenPair, error) {
+	accessToken, err := s.generateToken(user, sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int64(s.tokenExpiry / time.Second),
+		SessionID:    sessionID,
+	}, nil
+}
+
+// hashRefreshToken returns the hex SHA-256 digest stored in place of the token
+func hashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
 }
 
 // generateToken creates a new JWT token for a user
-func (s *AuthService) generateToken(user *db.User) (string, error) {
+func (s *AuthService) generateToken(user *db.User, sessionID string) (string, error) {
 	// Set the expiration time
 	expirationTime := time.Now().Add(s.tokenExpiry)
 
 	// Create the JWT claims
 	claims := jwt.MapClaims{
 		"sub":      user.ID,               // subject (user ID)
+		"sid":      sessionID,             // session (refresh token family)
 		"email":    user.Email,            // custom claim
 		"username": user.Username,         // custom claim
 		"exp":      expirationTime.Unix(), // expiration time
@@ -182,20 +385,38 @@ func (s *AuthService) ValidateToken(tokenString string) (jwt.MapClaims, error) {
 
 // GetUserFromToken extracts user information from a valid token
 func (s *AuthService) GetUserFromToken(tokenString string) (*db.User, error) {
+	user, _, err := s.authenticate(tokenString)
+	return user, err
+}
+
+// authenticate validates the token, checks that its session has not been
+// revoked and loads the user. It also returns the token's session ID.
+func (s *AuthService) authenticate(tokenString string) (*db.User, string, error) {
 	claims, err := s.ValidateToken(tokenString)
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 
 	userID, ok := claims["sub"].(string)
 	if !ok {
-		return nil, ErrInvalidToken
+		return nil, "", ErrInvalidToken
+	}
+
+	sessionID, _ := claims["sid"].(string)
+	if sessionID != "" {
+		active, err := s.database.IsRefreshTokenFamilyActive(sessionID)
+		if err != nil {
+			return nil, "", err
+		}
+		if !active {
+			return nil, "", ErrRevokedToken
+		}
 	}
 
 	user, err := s.database.GetUserByID(userID)
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 
-	return user, nil
+	return user, sessionID, nil
 }
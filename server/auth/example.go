@@ -4,9 +4,9 @@ import (
 	"log"
 	"net/http"
 	"os"
-	"time"
 
 	"habit-tracker/server/db"
+	"habit-tracker/server/problem"
 )
 
 // Example shows how to integrate authentication with your habit tracker
@@ -24,8 +24,8 @@ func Example() {
 		log.Println("Warning: Using default JWT secret. Set JWT_SECRET environment variable for production.")
 	}
 
-	// Create auth service with 24-hour token expiry
-	authService := NewAuthService(database, jwtSecret, 24*time.Hour)
+	// Create auth service with short-lived access tokens
+	authService := NewAuthService(database, jwtSecret, DefaultAccessTokenExpiry)
 
 	// Create HTTP mux
 	mux := http.NewServeMux()
@@ -33,15 +33,18 @@ func Example() {
 	// Public routes (no authentication required)
 	mux.HandleFunc("/auth/register", authService.RegisterHandler)
 	mux.HandleFunc("/auth/login", authService.LoginHandler)
+	mux.HandleFunc("/auth/refresh", authService.RefreshHandler)
 
 	// Protected routes (authentication required)
 	protectedMux := http.NewServeMux()
 	protectedMux.HandleFunc("/auth/profile", authService.ProfileHandler)
 	protectedMux.HandleFunc("/auth/validate", authService.ValidateTokenHandler)
+	protectedMux.HandleFunc("/auth/logout", authService.LogoutHandler)
 
 	// Apply auth middleware to protected routes
 	mux.Handle("/auth/profile", authService.AuthMiddleware(protectedMux))
 	mux.Handle("/auth/validate", authService.AuthMiddleware(protectedMux))
+	mux.Handle("/auth/logout", authService.AuthMiddleware(protectedMux))
 
 	// Example of how to protect your existing habit routes
 	// mux.Handle("/habits", authService.AuthMiddleware(http.HandlerFunc(yourHabitHandler)))
@@ -50,6 +53,8 @@ func Example() {
 	log.Println("Try these endpoints:")
 	log.Println("POST /auth/register - Register a new user")
 	log.Println("POST /auth/login - Login and get JWT token")
+	log.Println("POST /auth/refresh - Exchange a refresh token for new tokens")
+	log.Println("POST /auth/logout - Revoke the current session (requires Bearer token)")
 	log.Println("GET /auth/profile - Get user profile (requires Bearer token)")
 	log.Println("GET /auth/validate - Validate JWT token")
 
@@ -62,7 +67,7 @@ func ExampleProtectedHandler(authService *AuthService) http.HandlerFunc {
 		// Get user from context
 		user, ok := GetUserFromRequest(r)
 		if !ok {
-			http.Error(w, "User not found in context", http.StatusInternalServerError)
+			problem.Write(w, r, http.StatusInternalServerError, problem.CodeInternal, "User not found in context")
 			return
 		}
 
@@ -7,13 +7,16 @@ import (
 	"strings"
 
 	"habit-tracker/server/db"
+	"habit-tracker/server/problem"
 )
 
 // RegisterRequest represents the registration payload
 type RegisterRequest struct {
-	Email    string `json:"email"`
-	Username string `json:"username"`
-	Password string `json:"password"`
+	Email     string `json:"email"`
+	Username  string `json:"username"`
+	Password  string `json:"password"`
+	Timezone  string `json:"timezone,omitempty"`
+	WeekStart string `json:"weekStart,omitempty"`
 }
 
 // RegisterResponse contains the user data after successful registration
@@ -30,21 +33,44 @@ type LoginRequest struct {
 
 // LoginResponse contains the JWT token after successful login
 type LoginResponse struct {
-	Token   string  `json:"token"`
-	User    db.User `json:"user"`
-	Message string  `json:"message"`
+	Token        string  `json:"token"`
+	RefreshToken string  `json:"refreshToken"`
+	ExpiresIn    int64   `json:"expiresIn"`
+	User         db.User `json:"user"`
+	Message      string  `json:"message"`
+}
+
+// RefreshRequest represents the token refresh payload
+type RefreshRequest struct {
+	RefreshToken string `json:"refreshToken"`
+}
+
+// RefreshResponse contains the rotated token pair
+type RefreshResponse struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refreshToken"`
+	ExpiresIn    int64  `json:"expiresIn"`
 }
 
 // UserResponse represents user data for API responses
 type UserResponse struct {
-	ID       string `json:"id"`
-	Email    string `json:"email"`
-	Username string `json:"username"`
+	ID              string `json:"id"`
+	Email           string `json:"email"`
+	Username        string `json:"username"`
+	Timezone        string `json:"timezone,omitempty"`
+	WeekStart       string `json:"weekStart,omitempty"`
+	QuietHoursStart string `json:"quietHoursStart,omitempty"`
+	QuietHoursEnd   string `json:"quietHoursEnd,omitempty"`
 }
 
-// ErrorResponse represents error responses
-type ErrorResponse struct {
-	Error string `json:"error"`
+// UpdateProfileRequest represents the profile update payload. Omitted fields
+// are left unchanged and empty strings reset them to the defaults. Quiet hours
+// are HH:MM times; set both to turn them on and clear both to turn them off.
+type UpdateProfileRequest struct {
+	Timezone        *string `json:"timezone"`
+	WeekStart       *string `json:"weekStart"`
+	QuietHoursStart *string `json:"quietHoursStart"`
+	QuietHoursEnd   *string `json:"quietHoursEnd"`
 }
 
 // ProfileResponse contains user profile data
@@ -61,54 +87,42 @@ type ValidateResponse struct {
 // RegisterHandler handles user registration
 func (s *AuthService) RegisterHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		problem.Write(w, r, http.StatusMethodNotAllowed, problem.CodeMethodNotAllowed, "Method not allowed")
 		return
 	}
 
 	// Parse the request body
 	var req RegisterRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(ErrorResponse{Error: "Invalid JSON"})
+	if err := problem.DecodeJSON(w, r, &req); err != nil {
+		problem.BadBody(w, r, err)
 		return
 	}
 
 	// Validate input
-	if err := validateRegisterRequest(req); err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(ErrorResponse{Error: err.Error()})
+	if fields := validateRegisterRequest(req); len(fields) > 0 {
+		problem.Invalid(w, r, fields[0].Message, fields...)
 		return
 	}
 
 	// Call the auth service to register the user
-	user, err := s.Register(req.Email, req.Username, req.Password)
+	user, err := s.RegisterAccount(req)
 	if err != nil {
 		switch {
 		case errors.Is(err, ErrEmailInUse):
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusConflict)
-			json.NewEncoder(w).Encode(ErrorResponse{Error: "Email already exists"})
+			problem.Write(w, r, http.StatusConflict, problem.CodeEmailInUse, "Email already exists")
 			return
 		case errors.Is(err, ErrUsernameInUse):
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusConflict)
-			json.NewEncoder(w).Encode(ErrorResponse{Error: "Username already exists"})
+			problem.Write(w, r, http.StatusConflict, problem.CodeUsernameInUse, "Username already exists")
 			return
 		default:
-			http.Error(w, "Error creating user", http.StatusInternalServerError)
+			problem.Write(w, r, http.StatusInternalServerError, problem.CodeInternal, "Error creating user")
 		}
 		return
 	}
 
 	// Return the created user (without sensitive data)
 	response := RegisterResponse{
-		User: UserResponse{
-			ID:       user.ID,
-			Email:    user.Email,
-			Username: user.Username,
-		},
+		User:    newUserResponse(user),
 		Message: "User registered successfully",
 	}
 
@@ -120,38 +134,37 @@ func (s *AuthService) RegisterHandler(w http.ResponseWriter, r *http.Request) {
 // LoginHandler handles user login
 func (s *AuthService) LoginHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		problem.Write(w, r, http.StatusMethodNotAllowed, problem.CodeMethodNotAllowed, "Method not allowed")
 		return
 	}
 
 	// Parse the request body
 	var req LoginRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(ErrorResponse{Error: "Invalid JSON"})
+	if err := problem.DecodeJSON(w, r, &req); err != nil {
+		problem.BadBody(w, r, err)
 		return
 	}
 
 	// Validate input
 	if req.Email == "" || req.Password == "" {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(ErrorResponse{Error: "Email and password are required"})
+		var fields []problem.FieldError
+		if req.Email == "" {
+			fields = append(fields, problem.FieldError{Field: "email", Message: "email is required"})
+		}
+		if req.Password == "" {
+			fields = append(fields, problem.FieldError{Field: "password", Message: "password is required"})
+		}
+		problem.Invalid(w, r, "Email and password are required", fields...)
 		return
 	}
 
 	// Attempt to login
-	token, user, err := s.Login(req.Email, req.Password)
+	tokens, user, err := s.Login(req.Email, req.Password)
 	if err != nil {
 		if errors.Is(err, ErrInvalidCredentials) {
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusUnauthorized)
-			json.NewEncoder(w).Encode(ErrorResponse{Error: "Invalid credentials"})
+			problem.Write(w, r, http.StatusUnauthorized, problem.CodeInvalidCredentials, "Invalid credentials")
 		} else {
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusInternalServerError)
-			json.NewEncoder(w).Encode(ErrorResponse{Error: "Internal server error"})
+			problem.Write(w, r, http.StatusInternalServerError, problem.CodeInternal, "Internal server error")
 		}
 		return
 	}
@@ -167,48 +180,143 @@ func (s *AuthService) LoginHandler(w http.ResponseWriter, r *http.Request) {
 
 	// Return the token and user info
 	response := LoginResponse{
-		Token:   token,
-		User:    userResponse,
-		Message: "Login successful",
+		Token:        tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+		ExpiresIn:    tokens.ExpiresIn,
+		User:         userResponse,
+		Message:      "Login successful",
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// RefreshHandler rotates a refresh token and issues a new access token
+func (s *AuthService) RefreshHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		problem.Write(w, r, http.StatusMethodNotAllowed, problem.CodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	// Parse the request body
+	var req RefreshRequest
+	if err := problem.DecodeJSON(w, r, &req); err != nil {
+		problem.BadBody(w, r, err)
+		return
+	}
+
+	if req.RefreshToken == "" {
+		problem.Invalid(w, r, "Refresh token is required",
+			problem.FieldError{Field: "refreshToken", Message: "refresh token is required"})
+		return
+	}
+
+	tokens, err := s.Refresh(req.RefreshToken)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrTokenReused):
+			problem.Write(w, r, http.StatusUnauthorized, problem.CodeRefreshTokenReused, "Refresh token reuse detected, session revoked")
+		case errors.Is(err, ErrExpiredToken):
+			problem.Write(w, r, http.StatusUnauthorized, problem.CodeTokenExpired, "Refresh token has expired")
+		case errors.Is(err, ErrInvalidToken):
+			problem.Write(w, r, http.StatusUnauthorized, problem.CodeInvalidToken, "Invalid refresh token")
+		default:
+			problem.Write(w, r, http.StatusInternalServerError, problem.CodeInternal, "Internal server error")
+		}
+		return
+	}
+
+	response := RefreshResponse{
+		Token:        tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+		ExpiresIn:    tokens.ExpiresIn,
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 }
 
+// LogoutHandler revokes the session of the authenticated access token
+func (s *AuthService) LogoutHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		problem.Write(w, r, http.StatusMethodNotAllowed, problem.CodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	// Get session from request context (set by auth middleware)
+	sessionID := GetSessionIDFromContext(r.Context())
+	if sessionID == "" {
+		problem.Write(w, r, http.StatusUnauthorized, problem.CodeUnauthorized, "Session not found in context")
+		return
+	}
+
+	if err := s.Logout(sessionID); err != nil {
+		problem.Write(w, r, http.StatusInternalServerError, problem.CodeInternal, "Internal server error")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
 // ProfileHandler returns the authenticated user's profile
 func (s *AuthService) ProfileHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		problem.Write(w, r, http.StatusMethodNotAllowed, problem.CodeMethodNotAllowed, "Method not allowed")
 		return
 	}
 
 	// Get user from request context (set by auth middleware)
 	user := GetUserFromContext(r.Context())
 	if user == nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusUnauthorized)
-		json.NewEncoder(w).Encode(ErrorResponse{Error: "User not found in context"})
+		problem.Write(w, r, http.StatusUnauthorized, problem.CodeUnauthorized, "User not found in context")
 		return
 	}
 
 	// Return user profile (excluding sensitive data)
 	response := ProfileResponse{
-		User: UserResponse{
-			ID:       user.ID,
-			Email:    user.Email,
-			Username: user.Username,
-		},
+		User: newUserResponse(user),
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 }
 
+// UpdateProfileHandler updates the authenticated user's time zone and week start
+func (s *AuthService) UpdateProfileHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPatch {
+		problem.Write(w, r, http.StatusMethodNotAllowed, problem.CodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	user := GetUserFromContext(r.Context())
+	if user == nil {
+		problem.Write(w, r, http.StatusUnauthorized, problem.CodeUnauthorized, "User not found in context")
+		return
+	}
+
+	var req UpdateProfileRequest
+	if err := problem.DecodeJSON(w, r, &req); err != nil {
+		problem.BadBody(w, r, err)
+		return
+	}
+
+	if err := s.UpdatePreferences(user, req); err != nil {
+		if fields := preferenceFields(err); len(fields) > 0 {
+			problem.Invalid(w, r, err.Error(), fields...)
+			return
+		}
+		problem.Write(w, r, http.StatusInternalServerError, problem.CodeInternal, "Error updating user")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ProfileResponse{User: newUserResponse(user)})
+}
+
 // ValidateTokenHandler checks if a token is valid
 func (s *AuthService) ValidateTokenHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		problem.Write(w, r, http.StatusMethodNotAllowed, problem.CodeMethodNotAllowed, "Method not allowed")
 		return
 	}
 
@@ -241,49 +349,84 @@ func (s *AuthService) ValidateTokenHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	userResponse := &UserResponse{
-		ID:       user.ID,
-		Email:    user.Email,
-		Username: user.Username,
-	}
+	userResponse := newUserResponse(user)
 
 	response := ValidateResponse{
 		Valid: true,
-		User:  userResponse,
+		User:  &userResponse,
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 }
 
-// validateRegisterRequest validates the registration request
-func validateRegisterRequest(req RegisterRequest) error {
+// validateRegisterRequest lists the invalid fields of a registration request
+func validateRegisterRequest(req RegisterRequest) []problem.FieldError {
+	var fields []problem.FieldError
+	invalid := func(field, message string) {
+		fields = append(fields, problem.FieldError{Field: field, Message: message})
+	}
+
+	// Basic email format validation
 	if req.Email == "" {
-		return errors.New("email is required")
+		invalid("email", "email is required")
+	} else if !strings.Contains(req.Email, "@") || !strings.Contains(req.Email, ".") {
+		invalid("email", "invalid email format")
 	}
+
+	// Basic username validation
 	if req.Username == "" {
-		return errors.New("username is required")
+		invalid("username", "username is required")
+	} else if len(req.Username) < 3 {
+		invalid("username", "username must be at least 3 characters long")
 	}
+
+	// Basic password strength validation
 	if req.Password == "" {
-		return errors.New("password is required")
+		invalid("password", "password is required")
+	} else if len(req.Password) < 6 {
+		invalid("password", "password must be at least 6 characters long")
 	}
 
-	// Basic email format validation
-	if !strings.Contains(req.Email, "@") || !strings.Contains(req.Email, ".") {
-		return errors.New("invalid email format")
+	if err := db.ValidateTimezone(req.Timezone); err != nil {
+		invalid("timezone", err.Error())
+	}
+	if err := db.ValidateWeekStart(req.WeekStart); err != nil {
+		invalid("weekStart", err.Error())
 	}
+	return fields
+}
 
-	// Basic password strength validation
-	if len(req.Password) < 6 {
-		return errors.New("password must be at least 6 characters long")
+// preferenceFields names the fields a rejected profile update was about
+func preferenceFields(err error) []problem.FieldError {
+	var names []string
+	switch {
+	case errors.Is(err, db.ErrInvalidTimezone):
+		names = []string{"timezone"}
+	case errors.Is(err, db.ErrInvalidWeekStart):
+		names = []string{"weekStart"}
+	case errors.Is(err, db.ErrInvalidQuietHours):
+		names = []string{"quietHoursStart", "quietHoursEnd"}
 	}
 
-	// Basic username validation
-	if len(req.Username) < 3 {
-		return errors.New("username must be at least 3 characters long")
+	fields := make([]problem.FieldError, 0, len(names))
+	for _, name := range names {
+		fields = append(fields, problem.FieldError{Field: name, Message: err.Error()})
 	}
+	return fields
+}
 
-	return nil
+// newUserResponse copies the public fields of a user
+func newUserResponse(user *db.User) UserResponse {
+	return UserResponse{
+		ID:              user.ID,
+		Email:           user.Email,
+		Username:        user.Username,
+		Timezone:        user.Timezone,
+		WeekStart:       user.WeekStart,
+		QuietHoursStart: user.QuietHoursStart,
+		QuietHoursEnd:   user.QuietHoursEnd,
+	}
 }
 
 // Standalone handler functions for testing and easier integration
@@ -298,11 +441,26 @@ func LoginHandler(authService *AuthService) http.HandlerFunc {
 	return http.HandlerFunc(authService.LoginHandler)
 }
 
+// RefreshHandler creates a handler function for token refresh
+func RefreshHandler(authService *AuthService) http.HandlerFunc {
+	return http.HandlerFunc(authService.RefreshHandler)
+}
+
+// LogoutHandler creates a handler function for session logout
+func LogoutHandler(authService *AuthService) http.HandlerFunc {
+	return http.HandlerFunc(authService.LogoutHandler)
+}
+
 // ProfileHandler creates a handler function for user profile
 func ProfileHandler(authService *AuthService) http.HandlerFunc {
 	return http.HandlerFunc(authService.ProfileHandler)
 }
 
+// UpdateProfileHandler creates a handler function for profile updates
+func UpdateProfileHandler(authService *AuthService) http.HandlerFunc {
+	return http.HandlerFunc(authService.UpdateProfileHandler)
+}
+
 // ValidateHandler creates a handler function for token validation
 func ValidateHandler(authService *AuthService) http.HandlerFunc {
 	return http.HandlerFunc(authService.ValidateTokenHandler)
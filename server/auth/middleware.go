@@ -3,6 +3,7 @@ package auth
 import (
 	"context"
 	"habit-tracker/server/db"
+	"habit-tracker/server/problem"
 	"net/http"
 	"strings"
 )
@@ -15,6 +16,8 @@ const (
 	UserContextKey ContextKey = "user"
 	// UserIDContextKey is the key for user ID in the request context
 	UserIDContextKey ContextKey = "userID"
+	// SessionIDContextKey is the key for the token's session ID in the request context
+	SessionIDContextKey ContextKey = "sessionID"
 )
 
 // AuthMiddleware creates a middleware function for validating JWT tokens
@@ -33,29 +36,31 @@ func (s *AuthService) AuthMiddleware(next http.Handler) http.Handler {
 		// Extract token from Authorization header
 		authHeader := r.Header.Get("Authorization")
 		if authHeader == "" {
-			http.Error(w, "Authorization header required", http.StatusUnauthorized)
+			problem.Write(w, r, http.StatusUnauthorized, problem.CodeUnauthorized, "Authorization header required")
 			return
 		}
 
 		// Check Bearer token format
 		parts := strings.Split(authHeader, " ")
 		if len(parts) != 2 || strings.ToLower(parts[0]) != "bearer" {
-			http.Error(w, "Invalid authorization format. Use: Bearer <token>", http.StatusUnauthorized)
+			problem.Write(w, r, http.StatusUnauthorized, problem.CodeUnauthorized, "Invalid authorization format. Use: Bearer <token>")
 			return
 		}
 
 		tokenString := parts[1]
 
 		// Validate the token and get user
-		user, err := s.GetUserFromToken(tokenString)
+		user, sessionID, err := s.authenticate(tokenString)
 		if err != nil {
 			switch err {
 			case ErrExpiredToken:
-				http.Error(w, "Token has expired", http.StatusUnauthorized)
+				problem.Write(w, r, http.StatusUnauthorized, problem.CodeTokenExpired, "Token has expired")
+			case ErrRevokedToken:
+				problem.Write(w, r, http.StatusUnauthorized, problem.CodeTokenRevoked, "Token has been revoked")
 			case ErrInvalidToken:
-				http.Error(w, "Invalid token", http.StatusUnauthorized)
+				problem.Write(w, r, http.StatusUnauthorized, problem.CodeInvalidToken, "Invalid token")
 			default:
-				http.Error(w, "Authentication failed", http.StatusUnauthorized)
+				problem.Write(w, r, http.StatusUnauthorized, problem.CodeUnauthorized, "Authentication failed")
 			}
 			return
 		}
@@ -63,6 +68,7 @@ func (s *AuthService) AuthMiddleware(next http.Handler) http.Handler {
 		// Add user to request context
 		ctx := context.WithValue(r.Context(), UserContextKey, user)
 		ctx = context.WithValue(ctx, UserIDContextKey, user.ID)
+		ctx = context.WithValue(ctx, SessionIDContextKey, sessionID)
 
 		// Call the next handler with the enhanced context
 		next.ServeHTTP(w, r.WithContext(ctx))
@@ -81,11 +87,12 @@ func (s *AuthService) OptionalAuthMiddleware(next http.Handler) http.Handler {
 				tokenString := parts[1]
 
 				// Try to validate the token and get user
-				user, err := s.GetUserFromToken(tokenString)
+				user, sessionID, err := s.authenticate(tokenString)
 				if err == nil {
 					// Add user to request context
 					ctx := context.WithValue(r.Context(), UserContextKey, user)
 					ctx = context.WithValue(ctx, UserIDContextKey, user.ID)
+					ctx = context.WithValue(ctx, SessionIDContextKey, sessionID)
 					r = r.WithContext(ctx)
 				}
 			}
@@ -114,6 +121,15 @@ func GetUserIDFromContext(ctx context.Context) string {
 	return userID
 }
 
+// GetSessionIDFromContext extracts the session ID from the request context
+func GetSessionIDFromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	sessionID, _ := ctx.Value(SessionIDContextKey).(string)
+	return sessionID
+}
+
 // SetUserInContext adds a user to the context
 func SetUserInContext(ctx context.Context, user *db.User) context.Context {
 	ctx = context.WithValue(ctx, UserContextKey, user)
@@ -0,0 +1,103 @@
+package db
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Channel is a way of delivering a habit's reminders
+type Channel string
+
+const (
+	ChannelWebSocket Channel = "websocket"
+	ChannelEmail     Channel = "email"
+	ChannelWebhook   Channel = "webhook"
+	ChannelLog       Channel = "log"
+)
+
+var validChannels = map[Channel]bool{
+	ChannelWebSocket: true,
+	ChannelEmail:     true,
+	ChannelWebhook:   true,
+	ChannelLog:       true,
+}
+
+// DefaultChannels is used by habits that have not chosen any channels
+var DefaultChannels = []Channel{ChannelWebSocket}
+
+func (c Channel) IsValid() bool {
+	return validChannels[c]
+}
+
+// ValidateChannels accepts a list of distinct known channels
+func ValidateChannels(channels []Channel) error {
+	seen := make(map[Channel]bool, len(channels))
+	for _, channel := range channels {
+		if !channel.IsValid() {
+			return fmt.Errorf("%w: %s", ErrInvalidChannel, channel)
+		}
+		if seen[channel] {
+			return fmt.Errorf("%w: %s listed twice", ErrInvalidChannel, channel)
+		}
+		seen[channel] = true
+	}
+	return nil
+}
+
+// ValidateFallbackChannel accepts the empty string and any known channel other
+// than the WebSocket, whose failures the fallback covers
+func ValidateFallbackChannel(channel string) error {
+	if channel == "" {
+		return nil
+	}
+	if channel == string(ChannelWebSocket) || !Channel(channel).IsValid() {
+		return fmt.Errorf("%w: %s cannot be a fallback", ErrInvalidChannel, channel)
+	}
+	return nil
+}
+
+// ChannelsFromValue converts a decoded JSON array of channel names
+func ChannelsFromValue(value interface{}) ([]Channel, error) {
+	items, ok := value.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%w: channels must be an array", ErrInvalidChannel)
+	}
+
+	channels := make([]Channel, 0, len(items))
+	for _, item := range items {
+		name, ok := item.(string)
+		if !ok {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidChannel, item)
+		}
+		channels = append(channels, Channel(name))
+	}
+	if err := ValidateChannels(channels); err != nil {
+		return nil, err
+	}
+	return channels, nil
+}
+
+// DeliveryChannels returns the channels the habit's reminders are sent on
+func (h *Habit) DeliveryChannels() []Channel {
+	if len(h.Channels) == 0 {
+		return DefaultChannels
+	}
+	return h.Channels
+}
+
+// joinChannels and splitChannels store a channel list as comma-separated text
+func joinChannels(channels []Channel) string {
+	names := make([]string, len(channels))
+	for i, channel := range channels {
+		names[i] = string(channel)
+	}
+	return strings.Join(names, ",")
+}
+
+func splitChannels(value string) []Channel {
+	var channels []Channel
+	for _, name := range ParseCSV(value) {
+		channels = append(channels, Channel(name))
+	}
+	return channels
+}
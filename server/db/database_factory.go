@@ -11,11 +11,24 @@ type DatabaseConfig struct {
 	Driver string
 	// SQLite specific
 	SQLitePath string
+	// MigrateTo is the schema version to migrate to before exiting, or -1 to start normally
+	MigrateTo int
+	// ShowSchemaVersion prints the current schema version and exits
+	ShowSchemaVersion bool
+}
+
+// IsMigrationCommand reports whether the flags asked for a schema operation
+// instead of starting the server
+func (c DatabaseConfig) IsMigrationCommand() bool {
+	return c.ShowSchemaVersion || c.MigrateTo >= 0
 }
 
 func NewDatabaseFromConfig() (Database, error) {
-	config := parseFlags()
+	return NewDatabase(ParseConfig())
+}
 
+// NewDatabase creates the database selected by config
+func NewDatabase(config DatabaseConfig) (Database, error) {
 	switch config.Driver {
 	case "memory":
 		log.Println("Using in-memory database")
@@ -28,7 +41,36 @@ func NewDatabaseFromConfig() (Database, error) {
 	}
 }
 
-func parseFlags() DatabaseConfig {
+// RunMigrationCommand migrates the SQLite database to config.MigrateTo and/or
+// reports its schema version
+func RunMigrationCommand(config DatabaseConfig) error {
+	if config.Driver != "sqlite" {
+		return fmt.Errorf("schema migrations require the sqlite driver, got: %s", config.Driver)
+	}
+
+	database, err := OpenSQLiteDatabase(config.SQLitePath)
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	if config.MigrateTo >= 0 {
+		if err := database.MigrateTo(config.MigrateTo); err != nil {
+			return err
+		}
+	}
+
+	version, err := database.SchemaVersion()
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Schema version: %d (latest: %d)", version, LatestSchemaVersion())
+	return nil
+}
+
+// ParseConfig reads the database configuration from flags and environment variables
+func ParseConfig() DatabaseConfig {
 	var config DatabaseConfig
 
 	// Check for environment variables first
@@ -45,6 +87,8 @@ func parseFlags() DatabaseConfig {
 
 	flag.StringVar(&config.Driver, "db-driver", defaultDriver, "Database driver to use (memory, sqlite)")
 	flag.StringVar(&config.SQLitePath, "sqlite-path", defaultSQLitePath, "Path to SQLite database file")
+	flag.IntVar(&config.MigrateTo, "migrate-to", -1, "Migrate the SQLite schema to this version and exit")
+	flag.BoolVar(&config.ShowSchemaVersion, "schema-version", false, "Print the SQLite schema version and exit")
 
 	flag.Parse()
 
@@ -1,22 +1,47 @@
 package db
 
 import (
+	"sort"
+	"sync"
 	"time"
 )
 
+// MapDatabase keeps everything in memory. It is safe for concurrent use: the
+// HTTP handlers, WebSocket connections and reminder service share one.
 type MapDatabase struct {
-	habits    map[string]*Habit
-	tracking  map[string]*TrackingEntry
-	reminders map[string]*Reminder
-	users     map[string]*User
+	// mu guards every field below
+	mu sync.RWMutex
+
+	habits        map[string]*Habit
+	tracking      map[string]*TrackingEntry
+	reminders     map[string]*Reminder
+	users         map[string]*User
+	refreshTokens map[string]*RefreshToken
+	notifications map[string]*Notification
+	// reminderActions are kept in the order they were recorded
+	reminderActions  []*ReminderAction
+	reminderListener ReminderListener
+	// reminderSends are keyed by habit ID and due time
+	reminderSends map[string]*ReminderSend
+	leases        map[string]*lease
+}
+
+// lease is a named lease held until expiresAt
+type lease struct {
+	holder    string
+	expiresAt time.Time
 }
 
 func NewMapDatabase() *MapDatabase {
 	return &MapDatabase{
-		habits:    make(map[string]*Habit),
-		tracking:  make(map[string]*TrackingEntry),
-		reminders: make(map[string]*Reminder),
-		users:     make(map[string]*User),
+		habits:        make(map[string]*Habit),
+		tracking:      make(map[string]*TrackingEntry),
+		reminders:     make(map[string]*Reminder),
+		users:         make(map[string]*User),
+		refreshTokens: make(map[string]*RefreshToken),
+		notifications: make(map[string]*Notification),
+		reminderSends: make(map[string]*ReminderSend),
+		leases:        make(map[string]*lease),
 	}
 }
 
@@ -25,13 +50,64 @@ func (db *MapDatabase) Ping() error {
 	return nil
 }
 
+func (db *MapDatabase) SetReminderListener(listener ReminderListener) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.reminderListener = listener
+}
+
+// reschedule recomputes a reminder's next-fire time and tells the listener
+func (db *MapDatabase) reschedule(reminder *Reminder) {
+	habit, exists := db.habits[reminder.HabitID]
+	if !exists {
+		return
+	}
+
+	next := reminderSchedule(habit, db.users[habit.UserID], reminder.LastReminder, reminder.SnoozedUntil)
+	reminder.NextReminder = formatSchedule(next)
+	if db.reminderListener != nil && !next.IsZero() {
+		db.reminderListener(next)
+	}
+}
+
+// rescheduleHabit reschedules the habit's reminder, if it has one
+func (db *MapDatabase) rescheduleHabit(habitID string) {
+	if reminder, exists := db.reminders[habitID]; exists {
+		db.reschedule(reminder)
+	}
+}
+
+// rescheduleUser reschedules the reminders of every habit the user owns
+func (db *MapDatabase) rescheduleUser(userID string) {
+	for habitID, reminder := range db.reminders {
+		if habit, exists := db.habits[habitID]; exists && habit.UserID == userID {
+			db.reschedule(reminder)
+		}
+	}
+}
+
+// ownedHabit returns the stored habit if it exists and belongs to userID
+func (db *MapDatabase) ownedHabit(userID, habitID string) (*Habit, bool) {
+	habit, exists := db.habits[habitID]
+	if !exists || habit.UserID != userID {
+		return nil, false
+	}
+	return habit, true
+}
+
 func (db *MapDatabase) CreateHabit(habit *Habit) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
 	if _, exists := db.habits[habit.ID]; exists {
 		return ErrDuplicate
 	}
 
-	habitCopy := *habit
-	db.habits[habit.ID] = &habitCopy
+	habit.Version, habit.UpdatedAt = 1, time.Now().UTC().Format(time.RFC3339Nano)
+	habitCopy := copyHabit(habit)
+	habitCopy.Status = habitCopy.Status.orActive()
+	db.habits[habit.ID] = habitCopy
 
 	reminder := &Reminder{
 		ID:           habit.ID + "-reminder",
@@ -39,50 +115,80 @@ func (db *MapDatabase) CreateHabit(habit *Habit) error {
 		LastReminder: time.Now().Format(time.RFC3339),
 	}
 	db.reminders[habit.ID] = reminder
+	db.reschedule(reminder)
 
 	return nil
 }
 
-func (db *MapDatabase) GetHabit(id string) (*Habit, error) {
-	habit, exists := db.habits[id]
+func (db *MapDatabase) GetHabit(userID, id string) (*Habit, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	habit, exists := db.ownedHabit(userID, id)
 	if !exists {
 		return nil, ErrNotFound
 	}
 
-	habitCopy := *habit
-	return &habitCopy, nil
+	habitCopy := copyHabit(habit)
+	habitCopy.refreshStatus(db.calendar(userID).Now())
+	return habitCopy, nil
 }
 
-func (db *MapDatabase) GetAllHabits() ([]*Habit, error) {
+func (db *MapDatabase) GetAllHabits(userID string) ([]*Habit, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	now := db.calendar(userID).Now()
 	habits := make([]*Habit, 0, len(db.habits))
 	for _, habit := range db.habits {
-		habitCopy := *habit
-		habits = append(habits, &habitCopy)
+		if habit.UserID != userID {
+			continue
+		}
+		habitCopy := copyHabit(habit)
+		habitCopy.refreshStatus(now)
+		habits = append(habits, habitCopy)
 	}
 	return habits, nil
 }
 
 func (db *MapDatabase) UpdateHabit(habit *Habit) error {
-	if _, exists := db.habits[habit.ID]; !exists {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	existing, exists := db.ownedHabit(habit.UserID, habit.ID)
+	if !exists {
 		return ErrNotFound
 	}
 
-	habitCopy := *habit
-	db.habits[habit.ID] = &habitCopy
+	habitCopy := copyHabit(habit)
+	habitCopy.Version, habitCopy.UpdatedAt = existing.Version+1, time.Now().UTC().Format(time.RFC3339Nano)
+	db.habits[habit.ID] = habitCopy
+	db.rescheduleHabit(habit.ID)
 	return nil
 }
 
-func (db *MapDatabase) UpdateHabitPartial(id string, updates map[string]interface{}) (*Habit, error) {
-	existing, exists := db.habits[id]
+func (db *MapDatabase) UpdateHabitPartial(userID, id string, updates map[string]interface{}) (*Habit, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	existing, exists := db.ownedHabit(userID, id)
 	if !exists {
 		return nil, ErrNotFound
 	}
+	if version, ok := updates["version"].(float64); ok && int64(version) != existing.Version {
+		return nil, ErrVersionConflict
+	}
 
 	// Create a copy of the existing habit
-	updated := *existing
+	updated := copyHabit(existing)
+	changed, err := updated.applyStatusUpdates(updates, db.calendar(userID).Now())
+	if err != nil {
+		return nil, err
+	}
 
 	// Apply updates
 	for field, value := range updates {
+		changed = changed || isHabitField(field)
 		switch field {
 		case "name":
 			if name, ok := value.(string); ok {
@@ -103,28 +209,105 @@ func (db *MapDatabase) UpdateHabitPartial(id string, updates map[string]interfac
 			if startDate, ok := value.(string); ok {
 				updated.StartDate = startDate
 			}
+		case "target":
+			if target, ok := value.(float64); ok {
+				if err := ValidateTarget(target); err != nil {
+					return nil, err
+				}
+				updated.Target = target
+			}
+		case "unit":
+			if unit, ok := value.(string); ok {
+				updated.Unit = unit
+			}
+		case "aggregation":
+			if aggregation, ok := value.(string); ok {
+				if err := ValidateAggregation(aggregation); err != nil {
+					return nil, err
+				}
+				updated.Aggregation = Aggregation(aggregation)
+			}
+		case "schedule":
+			if schedule, ok := value.(string); ok {
+				if err := ValidateSchedule(schedule); err != nil {
+					return nil, err
+				}
+				updated.Schedule = schedule
+			}
+		case "channels":
+			channels, err := ChannelsFromValue(value)
+			if err != nil {
+				return nil, err
+			}
+			updated.Channels = channels
+		case "reminderTimes":
+			times, err := ReminderTimesFromValue(value)
+			if err != nil {
+				return nil, err
+			}
+			updated.ReminderTimes = times
+		case "fallbackChannel":
+			if fallback, ok := value.(string); ok {
+				if err := ValidateFallbackChannel(fallback); err != nil {
+					return nil, err
+				}
+				updated.FallbackChannel = Channel(fallback)
+			}
 		}
 	}
 
+	if !changed {
+		return updated, nil
+	}
+
 	// Store the updated habit
-	db.habits[id] = &updated
+	updated.Version++
+	updated.UpdatedAt = time.Now().UTC().Format(time.RFC3339Nano)
+	db.habits[id] = copyHabit(updated)
+	db.rescheduleHabit(id)
 
 	// Return a copy
-	result := updated
-	return &result, nil
+	return updated, nil
 }
 
-func (db *MapDatabase) DeleteHabit(id string) error {
-	if _, exists := db.habits[id]; !exists {
+func (db *MapDatabase) DeleteHabit(userID, id string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if _, exists := db.ownedHabit(userID, id); !exists {
 		return ErrNotFound
 	}
 
 	delete(db.habits, id)
 	delete(db.reminders, id)
+	for key, send := range db.reminderSends {
+		if send.HabitID == id {
+			delete(db.reminderSends, key)
+		}
+	}
+	actions := db.reminderActions[:0]
+	for _, action := range db.reminderActions {
+		if action.HabitID != id {
+			actions = append(actions, action)
+		}
+	}
+	db.reminderActions = actions
+	for entryID, entry := range db.tracking {
+		if entry.HabitID == id {
+			delete(db.tracking, entryID)
+		}
+	}
 	return nil
 }
 
-func (db *MapDatabase) CreateTrackingEntry(entry *TrackingEntry) error {
+func (db *MapDatabase) CreateTrackingEntry(userID string, entry *TrackingEntry) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if _, exists := db.ownedHabit(userID, entry.HabitID); !exists {
+		return ErrNotFound
+	}
+
 	if _, exists := db.tracking[entry.ID]; exists {
 		return ErrDuplicate
 	}
@@ -134,8 +317,23 @@ func (db *MapDatabase) CreateTrackingEntry(entry *TrackingEntry) error {
 	return nil
 }
 
-func (db *MapDatabase) GetTrackingEntry(id string) (*TrackingEntry, error) {
+// ownedEntry returns the stored entry if it exists and its habit belongs to userID
+func (db *MapDatabase) ownedEntry(userID, id string) (*TrackingEntry, bool) {
 	entry, exists := db.tracking[id]
+	if !exists {
+		return nil, false
+	}
+	if _, owned := db.ownedHabit(userID, entry.HabitID); !owned {
+		return nil, false
+	}
+	return entry, true
+}
+
+func (db *MapDatabase) GetTrackingEntry(userID, id string) (*TrackingEntry, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	entry, exists := db.ownedEntry(userID, id)
 	if !exists {
 		return nil, ErrNotFound
 	}
@@ -144,7 +342,14 @@ func (db *MapDatabase) GetTrackingEntry(id string) (*TrackingEntry, error) {
 	return &entryCopy, nil
 }
 
-func (db *MapDatabase) GetTrackingEntriesByHabitID(habitID string) ([]*TrackingEntry, error) {
+func (db *MapDatabase) GetTrackingEntriesByHabitID(userID, habitID string) ([]*TrackingEntry, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if _, exists := db.ownedHabit(userID, habitID); !exists {
+		return nil, ErrNotFound
+	}
+
 	var entries []*TrackingEntry
 	for _, entry := range db.tracking {
 		if entry.HabitID == habitID {
@@ -155,26 +360,114 @@ func (db *MapDatabase) GetTrackingEntriesByHabitID(habitID string) ([]*TrackingE
 	return entries, nil
 }
 
-func (db *MapDatabase) DeleteTrackingEntry(id string) error {
-	if _, exists := db.tracking[id]; !exists {
+func (db *MapDatabase) UpdateTrackingEntryPartial(userID, id string, updates map[string]interface{}) (*TrackingEntry, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	existing, exists := db.ownedEntry(userID, id)
+	if !exists {
+		return nil, ErrNotFound
+	}
+
+	updated := *existing
+	for field, value := range updates {
+		switch field {
+		case "timestamp":
+			if timestamp, ok := value.(string); ok {
+				if err := ValidateTimestamp(timestamp); err != nil {
+					return nil, err
+				}
+				updated.Timestamp = timestamp
+			}
+		case "note":
+			if note, ok := value.(string); ok {
+				updated.Note = note
+			}
+		case "value":
+			if entryValue, ok := value.(float64); ok {
+				if err := ValidateValue(entryValue); err != nil {
+					return nil, err
+				}
+				updated.Value = entryValue
+			}
+		}
+	}
+
+	db.tracking[id] = &updated
+	if _, exists := updates["timestamp"]; exists {
+		db.refreshLastReminder(updated.HabitID)
+	}
+
+	result := updated
+	return &result, nil
+}
+
+func (db *MapDatabase) DeleteTrackingEntry(userID, id string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	entry, exists := db.ownedEntry(userID, id)
+	if !exists {
 		return ErrNotFound
 	}
 
 	delete(db.tracking, id)
+	db.refreshLastReminder(entry.HabitID)
 	return nil
 }
 
-func (db *MapDatabase) CreateReminder(reminder *Reminder) error {
+// refreshLastReminder points a habit's reminder at its last activity after
+// its entries changed, and reschedules it
+func (db *MapDatabase) refreshLastReminder(habitID string) {
+	habit, habitExists := db.habits[habitID]
+	reminder, reminderExists := db.reminders[habitID]
+	if !habitExists || !reminderExists {
+		return
+	}
+
+	var checkIns []string
+	for _, entry := range db.tracking {
+		if entry.HabitID == habitID {
+			checkIns = append(checkIns, entry.Timestamp)
+		}
+	}
+	var sent []time.Time
+	for _, send := range db.reminderSends {
+		if send.HabitID == habitID && !send.SentAt.IsZero() {
+			sent = append(sent, send.SentAt)
+		}
+	}
+
+	reminder.LastReminder = lastActivity(habit.StartDate, checkIns, sent).Format(time.RFC3339)
+	db.reschedule(reminder)
+}
+
+func (db *MapDatabase) CreateReminder(userID string, reminder *Reminder) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if _, exists := db.ownedHabit(userID, reminder.HabitID); !exists {
+		return ErrNotFound
+	}
+
 	if _, exists := db.reminders[reminder.HabitID]; exists {
 		return ErrDuplicate
 	}
 
 	reminderCopy := *reminder
 	db.reminders[reminder.HabitID] = &reminderCopy
+	db.reschedule(&reminderCopy)
 	return nil
 }
 
-func (db *MapDatabase) GetReminder(habitID string) (*Reminder, error) {
+func (db *MapDatabase) GetReminder(userID, habitID string) (*Reminder, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if _, exists := db.ownedHabit(userID, habitID); !exists {
+		return nil, ErrNotFound
+	}
+
 	reminder, exists := db.reminders[habitID]
 	if !exists {
 		return nil, ErrNotFound
@@ -184,42 +477,109 @@ func (db *MapDatabase) GetReminder(habitID string) (*Reminder, error) {
 	return &reminderCopy, nil
 }
 
-func (db *MapDatabase) UpdateReminderLastReminder(habitID string, lastReminder string) error {
+func (db *MapDatabase) GetReminderByID(userID, id string) (*Reminder, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	for habitID, reminder := range db.reminders {
+		if _, owned := db.ownedHabit(userID, habitID); owned && reminder.ID == id {
+			reminderCopy := *reminder
+			return &reminderCopy, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (db *MapDatabase) UpdateReminderLastReminder(userID, habitID string, lastReminder string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if _, exists := db.ownedHabit(userID, habitID); !exists {
+		return ErrNotFound
+	}
+
 	reminder, exists := db.reminders[habitID]
 	if !exists {
 		return ErrNotFound
 	}
 
 	reminder.LastReminder = lastReminder
+	reminder.SnoozedUntil = ""
+	db.reschedule(reminder)
 	return nil
 }
 
-func (db *MapDatabase) GetHabitsNeedingReminders() ([]*Habit, error) {
-	var needingReminders []*Habit
-	now := time.Now()
+func (db *MapDatabase) SnoozeReminder(userID, habitID string, until time.Time) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
 
-	for habitID, reminder := range db.reminders {
-		habit, exists := db.habits[habitID]
-		if !exists {
-			continue
+	if _, exists := db.ownedHabit(userID, habitID); !exists {
+		return ErrNotFound
+	}
+
+	reminder, exists := db.reminders[habitID]
+	if !exists {
+		return ErrNotFound
+	}
+
+	reminder.SnoozedUntil = until.Format(time.RFC3339)
+	db.reschedule(reminder)
+	return nil
+}
+
+func (db *MapDatabase) GetHabitsNeedingReminders() ([]*Habit, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	now := formatSchedule(time.Now())
+	var due []*Reminder
+	for _, reminder := range db.reminders {
+		if reminder.NextReminder != "" && reminder.NextReminder <= now {
+			due = append(due, reminder)
 		}
+	}
+	sort.Slice(due, func(i, j int) bool {
+		return due[i].NextReminder < due[j].NextReminder
+	})
 
-		lastReminder, err := time.Parse(time.RFC3339, reminder.LastReminder)
-		if err != nil {
-			continue
+	var needingReminders []*Habit
+	for _, reminder := range due {
+		if habit, exists := db.habits[reminder.HabitID]; exists {
+			needingReminders = append(needingReminders, copyHabit(habit))
 		}
+	}
+	return needingReminders, nil
+}
+
+func (db *MapDatabase) NextReminderDue() (time.Time, bool, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
 
-		nextReminderTime := CalculateNextReminderTime(lastReminder, habit.Frequency)
-		if now.After(nextReminderTime) {
-			habitCopy := *habit
-			needingReminders = append(needingReminders, &habitCopy)
+	var next string
+	for _, reminder := range db.reminders {
+		if reminder.NextReminder != "" && (next == "" || reminder.NextReminder < next) {
+			next = reminder.NextReminder
 		}
 	}
+	if next == "" {
+		return time.Time{}, false, nil
+	}
 
-	return needingReminders, nil
+	due, err := time.Parse(scheduleLayout, next)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	return due, true, nil
 }
 
-func (db *MapDatabase) DeleteReminder(habitID string) error {
+func (db *MapDatabase) DeleteReminder(userID, habitID string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if _, exists := db.ownedHabit(userID, habitID); !exists {
+		return ErrNotFound
+	}
+
 	if _, exists := db.reminders[habitID]; !exists {
 		return ErrNotFound
 	}
@@ -230,127 +590,311 @@ func (db *MapDatabase) DeleteReminder(habitID string) error {
 
 // Statistics and Analytics Methods for MapDatabase
 
-func (db *MapDatabase) GetHabitStats(habitID string) (*HabitStats, error) {
-	habit, err := db.GetHabit(habitID)
-	if err != nil {
-		return nil, err
-	}
+func (db *MapDatabase) GetHabitStats(userID, habitID string) (*HabitStats, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
 
-	stats := &HabitStats{
-		HabitID:   habitID,
-		HabitName: habit.Name,
-		Frequency: habit.Frequency,
-		StartDate: habit.StartDate,
+	habit, exists := db.ownedHabit(userID, habitID)
+	if !exists {
+		return nil, ErrNotFound
 	}
 
-	// Count total entries for this habit
-	totalEntries := 0
-	var lastCompleted string
-	for _, entry := range db.tracking {
-		if entry.HabitID == habitID {
-			totalEntries++
-			if entry.Timestamp > lastCompleted {
-				lastCompleted = entry.Timestamp
-			}
-		}
+	return buildHabitStats(habit, db.userTrackingEntries(userID, habitID), db.calendar(userID), time.Now()), nil
+}
+
+func (db *MapDatabase) GetHabitProgress(userID, habitID string, days int) ([]*ProgressPoint, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if _, exists := db.ownedHabit(userID, habitID); !exists {
+		return nil, ErrNotFound
 	}
 
-	stats.TotalEntries = totalEntries
-	stats.LastCompleted = lastCompleted
+	return buildHabitProgress(db.userTrackingEntries(userID, habitID), days, db.calendar(userID), time.Now()), nil
+}
+
+func (db *MapDatabase) GetOverallStats(userID string) (*OverallStats, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	return buildOverallStats(db.userHabits(userID), db.userTrackingEntries(userID, ""), db.calendar(userID), time.Now()), nil
+}
+
+func (db *MapDatabase) GetHabitCompletionRates(userID string, days int) ([]*HabitCompletionRate, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	return buildCompletionRates(db.userHabits(userID), db.userTrackingEntries(userID, ""), days, db.calendar(userID), time.Now()), nil
+}
+
+func (db *MapDatabase) GetDailyCompletions(userID string, days int) ([]*DailyCompletion, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	return buildDailyCompletions(db.userTrackingEntries(userID, ""), days, db.calendar(userID), time.Now()), nil
+}
+
+// calendar returns the time zone and week start of userID
+func (db *MapDatabase) calendar(userID string) Calendar {
+	return db.users[userID].Calendar()
+}
 
-	// For simplicity in in-memory implementation, set basic values
-	stats.CurrentStreak = 0    // Would need more complex logic
-	stats.LongestStreak = 0    // Would need more complex logic
-	stats.CompletionRate = 0.0 // Would need more complex logic
+// isHabitField reports whether a partial update of field changes the habit
+func isHabitField(field string) bool {
+	switch field {
+	case "name", "description", "frequency", "startDate", "target", "unit", "aggregation", "schedule",
+		"channels", "reminderTimes", "fallbackChannel":
+		return true
+	}
+	return false
+}
 
-	return stats, nil
+// copyHabit returns a copy of habit that shares no slices with it
+func copyHabit(habit *Habit) *Habit {
+	habitCopy := *habit
+	habitCopy.Pauses = append([]Pause(nil), habit.Pauses...)
+	habitCopy.Channels = append([]Channel(nil), habit.Channels...)
+	habitCopy.ReminderTimes = append([]string(nil), habit.ReminderTimes...)
+	return &habitCopy
 }
 
-func (db *MapDatabase) GetHabitProgress(habitID string, days int) ([]*ProgressPoint, error) {
-	// Simple implementation - in a real scenario would need date parsing and filtering
-	progress := []*ProgressPoint{}
+// userHabits returns the habits owned by userID
+func (db *MapDatabase) userHabits(userID string) []*Habit {
+	var habits []*Habit
+	for _, habit := range db.habits {
+		if habit.UserID == userID {
+			habits = append(habits, habit)
+		}
+	}
+	return habits
+}
 
-	dateCount := make(map[string]int)
+// userTrackingEntries returns the tracking entries of habits owned by userID,
+// limited to a single habit when habitID is not empty
+func (db *MapDatabase) userTrackingEntries(userID, habitID string) []*TrackingEntry {
+	var entries []*TrackingEntry
 	for _, entry := range db.tracking {
-		if entry.HabitID == habitID {
-			// Extract date part from timestamp (simplified)
-			date := entry.Timestamp[:10] // Assumes RFC3339 format
-			dateCount[date]++
+		if habitID != "" && entry.HabitID != habitID {
+			continue
+		}
+		if _, owned := db.ownedHabit(userID, entry.HabitID); owned {
+			entries = append(entries, entry)
 		}
 	}
+	return entries
+}
 
-	for date, count := range dateCount {
-		progress = append(progress, &ProgressPoint{
-			Date:  date,
-			Count: count,
-		})
+// Reminder Action Methods for MapDatabase
+
+func (db *MapDatabase) CreateReminderAction(action *ReminderAction) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if _, exists := db.ownedHabit(action.UserID, action.HabitID); !exists {
+		return ErrNotFound
+	}
+	if action.ID == "" {
+		action.ID = generateUUID()
 	}
 
-	return progress, nil
+	actionCopy := *action
+	db.reminderActions = append(db.reminderActions, &actionCopy)
+	return nil
 }
 
-func (db *MapDatabase) GetOverallStats() (*OverallStats, error) {
-	stats := &OverallStats{
-		TotalHabits:      len(db.habits),
-		TotalEntries:     len(db.tracking),
-		EntriesToday:     0,   // Would need date filtering
-		EntriesThisWeek:  0,   // Would need date filtering
-		AvgEntriesPerDay: 0.0, // Would need date calculations
+func (db *MapDatabase) GetReminderActions(userID, habitID string) ([]*ReminderAction, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if _, exists := db.ownedHabit(userID, habitID); !exists {
+		return nil, ErrNotFound
 	}
 
-	return stats, nil
+	actions := []*ReminderAction{}
+	for i := len(db.reminderActions) - 1; i >= 0; i-- {
+		if action := db.reminderActions[i]; action.HabitID == habitID {
+			actionCopy := *action
+			actions = append(actions, &actionCopy)
+		}
+	}
+	return actions, nil
 }
 
-func (db *MapDatabase) GetHabitCompletionRates(days int) ([]*HabitCompletionRate, error) {
-	var rates []*HabitCompletionRate
+// Reminder Send Methods for MapDatabase
 
-	for _, habit := range db.habits {
-		rate := &HabitCompletionRate{
-			HabitID:             habit.ID,
-			HabitName:           habit.Name,
-			Frequency:           habit.Frequency,
-			StartDate:           habit.StartDate,
-			ActualCompletions:   0,
-			ExpectedCompletions: 0,
-			CompletionRate:      0.0,
+func (db *MapDatabase) ClaimReminderSend(send *ReminderSend, staleBefore time.Time) (bool, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	key := send.HabitID + "|" + send.DueAt.UTC().Format(time.RFC3339Nano)
+	existing, exists := db.reminderSends[key]
+	if !exists {
+		if send.ID == "" {
+			send.ID = generateUUID()
+		}
+		if send.NotificationID == "" {
+			send.NotificationID = generateUUID()
 		}
+		sendCopy := *send
+		db.reminderSends[key] = &sendCopy
+		return true, nil
+	}
 
-		// Count actual completions for this habit
-		for _, entry := range db.tracking {
-			if entry.HabitID == habit.ID {
-				rate.ActualCompletions++
-			}
+	// Pending sends are taken over from workers that claimed them too long ago
+	if !existing.SentAt.IsZero() || (existing.Worker != send.Worker && existing.ClaimedAt.After(staleBefore)) {
+		send.SentAt = existing.SentAt
+		return false, nil
+	}
+	existing.Worker, existing.ClaimedAt = send.Worker, send.ClaimedAt
+	send.ID, send.NotificationID = existing.ID, existing.NotificationID
+	return true, nil
+}
+
+func (db *MapDatabase) CompleteReminderSend(send *ReminderSend, sentAt time.Time) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	var stored *ReminderSend
+	for _, candidate := range db.reminderSends {
+		if candidate.ID == send.ID {
+			stored = candidate
 		}
+	}
+	if stored == nil || !stored.SentAt.IsZero() {
+		return ErrNotFound
+	}
 
-		rates = append(rates, rate)
+	stored.SentAt = sentAt
+	if reminder, exists := db.reminders[send.HabitID]; exists {
+		reminder.LastReminder = sentAt.Format(time.RFC3339)
+		reminder.SnoozedUntil = ""
+		db.reschedule(reminder)
 	}
+	return nil
+}
+
+// Lease Methods for MapDatabase
 
-	return rates, nil
+func (db *MapDatabase) AcquireLease(name, holder string, ttl time.Duration) (bool, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	now := time.Now()
+	if current, exists := db.leases[name]; exists && current.holder != holder && now.Before(current.expiresAt) {
+		return false, nil
+	}
+	db.leases[name] = &lease{holder: holder, expiresAt: now.Add(ttl)}
+	return true, nil
 }
 
-func (db *MapDatabase) GetDailyCompletions(days int) ([]*DailyCompletion, error) {
-	dateCount := make(map[string]int)
+func (db *MapDatabase) ReleaseLease(name, holder string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
 
-	for _, entry := range db.tracking {
-		// Extract date part from timestamp (simplified)
-		date := entry.Timestamp[:10] // Assumes RFC3339 format
-		dateCount[date]++
+	if current, exists := db.leases[name]; exists && current.holder == holder {
+		delete(db.leases, name)
+	}
+	return nil
+}
+
+// Notification Methods for MapDatabase
+
+func (db *MapDatabase) CreateNotification(notification *Notification) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if notification.ID == "" {
+		notification.ID = generateUUID()
+	}
+	if _, exists := db.notifications[notification.ID]; exists {
+		return ErrDuplicate
+	}
+
+	notificationCopy := *notification
+	db.notifications[notification.ID] = &notificationCopy
+	return nil
+}
+
+func (db *MapDatabase) GetNotification(userID, id string) (*Notification, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	notification, exists := db.notifications[id]
+	if !exists || notification.UserID != userID {
+		return nil, ErrNotFound
+	}
+
+	notificationCopy := *notification
+	return &notificationCopy, nil
+}
+
+func (db *MapDatabase) GetNotifications(userID string, unreadOnly bool) ([]*Notification, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	notifications := []*Notification{}
+	for _, notification := range db.notifications {
+		if notification.UserID != userID || notification.Dismissed || (unreadOnly && notification.Read) {
+			continue
+		}
+		notificationCopy := *notification
+		notifications = append(notifications, &notificationCopy)
+	}
+
+	sort.Slice(notifications, func(i, j int) bool {
+		return notifications[i].CreatedAt.After(notifications[j].CreatedAt)
+	})
+	return notifications, nil
+}
+
+func (db *MapDatabase) UpdateNotificationPartial(userID, id string, updates map[string]interface{}) (*Notification, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	stored, exists := db.notifications[id]
+	if !exists || stored.UserID != userID {
+		return nil, ErrNotFound
 	}
 
-	var completions []*DailyCompletion
-	for date, count := range dateCount {
-		completions = append(completions, &DailyCompletion{
-			Date:        date,
-			Completions: count,
-		})
+	existing := *stored
+	for field, value := range updates {
+		flag, ok := value.(bool)
+		if !ok {
+			continue
+		}
+		switch field {
+		case "read":
+			existing.Read = flag
+		case "dismissed":
+			existing.Dismissed = flag
+		}
 	}
 
-	return completions, nil
+	notificationCopy := existing
+	db.notifications[id] = &notificationCopy
+	return &existing, nil
+}
+
+func (db *MapDatabase) MarkAllNotificationsRead(userID string) (int, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	marked := 0
+	for _, notification := range db.notifications {
+		if notification.UserID == userID && !notification.Dismissed && !notification.Read {
+			notification.Read = true
+			marked++
+		}
+	}
+	return marked, nil
 }
 
 // User Management Methods for MapDatabase
 
 func (db *MapDatabase) CreateUser(user *User) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
 	// Generate UUID for user if not provided
 	if user.ID == "" {
 		user.ID = generateUUID()
@@ -369,10 +913,14 @@ func (db *MapDatabase) CreateUser(user *User) error {
 	// Create a copy to store
 	userCopy := *user
 	db.users[user.ID] = &userCopy
+	db.rescheduleUser(user.ID)
 	return nil
 }
 
 func (db *MapDatabase) GetUserByEmail(email string) (*User, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
 	for _, user := range db.users {
 		if user.Email == email {
 			userCopy := *user
@@ -383,6 +931,9 @@ func (db *MapDatabase) GetUserByEmail(email string) (*User, error) {
 }
 
 func (db *MapDatabase) GetUserByID(id string) (*User, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
 	user, exists := db.users[id]
 	if !exists {
 		return nil, ErrNotFound
@@ -393,6 +944,9 @@ func (db *MapDatabase) GetUserByID(id string) (*User, error) {
 }
 
 func (db *MapDatabase) UpdateUser(user *User) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
 	if _, exists := db.users[user.ID]; !exists {
 		return ErrNotFound
 	}
@@ -400,10 +954,14 @@ func (db *MapDatabase) UpdateUser(user *User) error {
 	// Create a copy to store
 	userCopy := *user
 	db.users[user.ID] = &userCopy
+	db.rescheduleUser(user.ID)
 	return nil
 }
 
 func (db *MapDatabase) DeleteUser(id string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
 	if _, exists := db.users[id]; !exists {
 		return ErrNotFound
 	}
@@ -411,3 +969,85 @@ func (db *MapDatabase) DeleteUser(id string) error {
 	delete(db.users, id)
 	return nil
 }
+
+// Refresh Token Methods for MapDatabase
+
+func (db *MapDatabase) CreateRefreshToken(token *RefreshToken) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	return db.createRefreshToken(token)
+}
+
+// createRefreshToken stores a token; the caller holds the write lock
+func (db *MapDatabase) createRefreshToken(token *RefreshToken) error {
+	if token.ID == "" {
+		token.ID = generateUUID()
+	}
+
+	if _, exists := db.refreshTokens[token.ID]; exists {
+		return ErrDuplicate
+	}
+
+	tokenCopy := *token
+	db.refreshTokens[token.ID] = &tokenCopy
+	return nil
+}
+
+func (db *MapDatabase) GetRefreshTokenByHash(tokenHash string) (*RefreshToken, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	for _, token := range db.refreshTokens {
+		if token.TokenHash == tokenHash {
+			tokenCopy := *token
+			return &tokenCopy, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (db *MapDatabase) RotateRefreshToken(oldID string, next *RefreshToken) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	old, exists := db.refreshTokens[oldID]
+	if !exists || old.RevokedAt != nil {
+		return ErrNotFound
+	}
+
+	if err := db.createRefreshToken(next); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	old.RevokedAt = &now
+	old.ReplacedBy = next.ID
+	return nil
+}
+
+func (db *MapDatabase) RevokeRefreshTokenFamily(familyID string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	now := time.Now()
+	for _, token := range db.refreshTokens {
+		if token.FamilyID == familyID && token.RevokedAt == nil {
+			token.RevokedAt = &now
+		}
+	}
+	return nil
+}
+
+func (db *MapDatabase) IsRefreshTokenFamilyActive(familyID string) (bool, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	now := time.Now()
+	for _, token := range db.refreshTokens {
+		if token.FamilyID == familyID && token.RevokedAt == nil && token.ExpiresAt.After(now) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,430 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+var ErrUnknownSchemaVersion = errors.New("unknown schema version")
+
+// Migration is a numbered, reversible schema change. Up and Down run inside
+// the same transaction that records the version in schema_migrations.
+type Migration struct {
+	Version     int
+	Description string
+	Up          func(tx *sql.Tx) error
+	Down        func(tx *sql.Tx) error
+}
+
+// migrations lists every schema change in order. Append new migrations to the
+// end; never edit or renumber one that has shipped.
+var migrations = []Migration{
+	{
+		Version:     1,
+		Description: "baseline schema",
+		Up:          migrateBaselineUp,
+		Down: execStatements(
+			`DROP TABLE IF EXISTS refresh_tokens`,
+			`DROP TABLE IF EXISTS reminders`,
+			`DROP TABLE IF EXISTS tracking_entries`,
+			`DROP TABLE IF EXISTS habits`,
+			`DROP TABLE IF EXISTS users`,
+		),
+	},
+	{
+		Version:     2,
+		Description: "quantitative habit targets and entry values",
+		Up: execStatements(
+			`ALTER TABLE habits ADD COLUMN target REAL NOT NULL DEFAULT 0`,
+			`ALTER TABLE habits ADD COLUMN unit TEXT NOT NULL DEFAULT ''`,
+			`ALTER TABLE habits ADD COLUMN aggregation TEXT NOT NULL DEFAULT ''`,
+			`ALTER TABLE tracking_entries ADD COLUMN value REAL NOT NULL DEFAULT 0`,
+		),
+		Down: execStatements(
+			`ALTER TABLE tracking_entries DROP COLUMN value`,
+			`ALTER TABLE habits DROP COLUMN aggregation`,
+			`ALTER TABLE habits DROP COLUMN unit`,
+			`ALTER TABLE habits DROP COLUMN target`,
+		),
+	},
+	{
+		Version:     3,
+		Description: "custom habit schedules",
+		Up:          execStatements(`ALTER TABLE habits ADD COLUMN schedule TEXT NOT NULL DEFAULT ''`),
+		Down:        execStatements(`ALTER TABLE habits DROP COLUMN schedule`),
+	},
+	{
+		Version:     4,
+		Description: "habit status and pause history",
+		Up: execStatements(
+			`ALTER TABLE habits ADD COLUMN status TEXT NOT NULL DEFAULT 'active'`,
+			`ALTER TABLE habits ADD COLUMN resume_date TEXT NOT NULL DEFAULT ''`,
+			`CREATE TABLE habit_pauses (
+				habit_id TEXT NOT NULL,
+				start_date TEXT NOT NULL,
+				end_date TEXT NOT NULL DEFAULT '',
+				FOREIGN KEY (habit_id) REFERENCES habits(id) ON DELETE CASCADE
+			)`,
+			`CREATE INDEX idx_habit_pauses_habit_id ON habit_pauses(habit_id)`,
+		),
+		Down: execStatements(
+			`DROP TABLE habit_pauses`,
+			`ALTER TABLE habits DROP COLUMN resume_date`,
+			`ALTER TABLE habits DROP COLUMN status`,
+		),
+	},
+	{
+		Version:     5,
+		Description: "user timezone and week start",
+		Up: execStatements(
+			`ALTER TABLE users ADD COLUMN timezone TEXT NOT NULL DEFAULT ''`,
+			`ALTER TABLE users ADD COLUMN week_start TEXT NOT NULL DEFAULT ''`,
+		),
+		Down: execStatements(
+			`ALTER TABLE users DROP COLUMN week_start`,
+			`ALTER TABLE users DROP COLUMN timezone`,
+		),
+	},
+	{
+		Version:     6,
+		Description: "reminder delivery channels",
+		Up: execStatements(
+			`ALTER TABLE habits ADD COLUMN channels TEXT NOT NULL DEFAULT ''`,
+			`ALTER TABLE habits ADD COLUMN fallback_channel TEXT NOT NULL DEFAULT ''`,
+		),
+		Down: execStatements(
+			`ALTER TABLE habits DROP COLUMN fallback_channel`,
+			`ALTER TABLE habits DROP COLUMN channels`,
+		),
+	},
+	{
+		Version:     7,
+		Description: "notification inbox",
+		Up: execStatements(
+			`CREATE TABLE notifications (
+				id TEXT PRIMARY KEY,
+				user_id TEXT NOT NULL,
+				habit_id TEXT NOT NULL DEFAULT '',
+				type TEXT NOT NULL,
+				subject TEXT NOT NULL DEFAULT '',
+				body TEXT NOT NULL DEFAULT '',
+				data TEXT NOT NULL DEFAULT '',
+				read INTEGER NOT NULL DEFAULT 0,
+				dismissed INTEGER NOT NULL DEFAULT 0,
+				created_at TEXT NOT NULL,
+				FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+			)`,
+			`CREATE INDEX idx_notifications_user_id ON notifications(user_id, dismissed, read)`,
+		),
+		Down: execStatements(`DROP TABLE notifications`),
+	},
+	{
+		Version:     8,
+		Description: "reminder snoozes and history",
+		Up: execStatements(
+			`ALTER TABLE reminders ADD COLUMN snoozed_until TEXT NOT NULL DEFAULT ''`,
+			`CREATE TABLE reminder_actions (
+				id TEXT PRIMARY KEY,
+				user_id TEXT NOT NULL,
+				habit_id TEXT NOT NULL,
+				notification_id TEXT NOT NULL DEFAULT '',
+				action TEXT NOT NULL,
+				until TEXT NOT NULL,
+				created_at TEXT NOT NULL,
+				FOREIGN KEY (habit_id) REFERENCES habits(id) ON DELETE CASCADE
+			)`,
+			`CREATE INDEX idx_reminder_actions_habit_id ON reminder_actions(habit_id, created_at)`,
+		),
+		Down: execStatements(
+			`DROP TABLE reminder_actions`,
+			`ALTER TABLE reminders DROP COLUMN snoozed_until`,
+		),
+	},
+	{
+		Version:     9,
+		Description: "reminder times and quiet hours",
+		Up: execStatements(
+			`ALTER TABLE habits ADD COLUMN reminder_times TEXT NOT NULL DEFAULT ''`,
+			`ALTER TABLE users ADD COLUMN quiet_hours_start TEXT NOT NULL DEFAULT ''`,
+			`ALTER TABLE users ADD COLUMN quiet_hours_end TEXT NOT NULL DEFAULT ''`,
+		),
+		Down: execStatements(
+			`ALTER TABLE users DROP COLUMN quiet_hours_end`,
+			`ALTER TABLE users DROP COLUMN quiet_hours_start`,
+			`ALTER TABLE habits DROP COLUMN reminder_times`,
+		),
+	},
+	{
+		// Existing reminders are left NULL and scheduled when the database is opened
+		Version:     10,
+		Description: "reminder next-fire times",
+		Up: execStatements(
+			`ALTER TABLE reminders ADD COLUMN next_reminder TEXT`,
+			`CREATE INDEX idx_reminders_next_reminder ON reminders(next_reminder)`,
+		),
+		Down: execStatements(
+			`DROP INDEX idx_reminders_next_reminder`,
+			`ALTER TABLE reminders DROP COLUMN next_reminder`,
+		),
+	},
+	{
+		Version:     11,
+		Description: "reminder worker lease and send records",
+		Up: execStatements(
+			`CREATE TABLE leases (
+				name TEXT PRIMARY KEY,
+				holder TEXT NOT NULL,
+				expires_at TEXT NOT NULL
+			)`,
+			`CREATE TABLE reminder_sends (
+				id TEXT PRIMARY KEY,
+				user_id TEXT NOT NULL,
+				habit_id TEXT NOT NULL,
+				due_at TEXT NOT NULL,
+				notification_id TEXT NOT NULL,
+				worker TEXT NOT NULL,
+				claimed_at TEXT NOT NULL,
+				sent_at TEXT NOT NULL DEFAULT '',
+				UNIQUE (habit_id, due_at),
+				FOREIGN KEY (habit_id) REFERENCES habits(id) ON DELETE CASCADE
+			)`,
+		),
+		Down: execStatements(
+			`DROP TABLE reminder_sends`,
+			`DROP TABLE leases`,
+		),
+	},
+	{
+		// Existing habits start at version 1 with no recorded update time
+		Version:     12,
+		Description: "habit versions",
+		Up: execStatements(
+			`ALTER TABLE habits ADD COLUMN version INTEGER NOT NULL DEFAULT 1`,
+			`ALTER TABLE habits ADD COLUMN updated_at TEXT NOT NULL DEFAULT ''`,
+		),
+		Down: execStatements(
+			`ALTER TABLE habits DROP COLUMN updated_at`,
+			`ALTER TABLE habits DROP COLUMN version`,
+		),
+	},
+}
+
+// LatestSchemaVersion returns the version of the newest known migration
+func LatestSchemaVersion() int {
+	return migrations[len(migrations)-1].Version
+}
+
+// execStatements returns a migration step that runs each statement in order
+func execStatements(statements ...string) func(tx *sql.Tx) error {
+	return func(tx *sql.Tx) error {
+		for _, statement := range statements {
+			if _, err := tx.Exec(statement); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// columnExists reports whether table has a column with the given name
+func columnExists(tx *sql.Tx, table, column string) (bool, error) {
+	rows, err := tx.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cid          int
+			name, ctype  string
+			notNull, pk  int
+			defaultValue sql.NullString
+		)
+		if err := rows.Scan(&cid, &name, &ctype, &notNull, &defaultValue, &pk); err != nil {
+			return false, err
+		}
+		if name == column {
+			return true, nil
+		}
+	}
+	return false, rows.Err()
+}
+
+// migrateBaselineUp creates the original schema. Tables are created only if
+// missing so databases built before migrations existed are adopted as-is;
+// habits tables from before per-user ownership gain an empty user_id.
+func migrateBaselineUp(tx *sql.Tx) error {
+	err := execStatements(`
+		CREATE TABLE IF NOT EXISTS users (
+			id TEXT PRIMARY KEY,
+			email TEXT UNIQUE NOT NULL,
+			username TEXT UNIQUE NOT NULL,
+			password_hash TEXT NOT NULL,
+			created_at TEXT NOT NULL,
+			updated_at TEXT NOT NULL
+		)`, `
+		CREATE TABLE IF NOT EXISTS habits (
+			id TEXT PRIMARY KEY,
+			user_id TEXT NOT NULL,
+			name TEXT NOT NULL,
+			description TEXT,
+			frequency TEXT,
+			start_date TEXT,
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+		)`, `
+		CREATE TABLE IF NOT EXISTS tracking_entries (
+			id TEXT PRIMARY KEY,
+			habit_id TEXT NOT NULL,
+			timestamp TEXT NOT NULL,
+			note TEXT,
+			FOREIGN KEY (habit_id) REFERENCES habits(id) ON DELETE CASCADE
+		)`, `
+		CREATE TABLE IF NOT EXISTS reminders (
+			id TEXT PRIMARY KEY,
+			habit_id TEXT NOT NULL UNIQUE,
+			last_reminder TEXT NOT NULL,
+			FOREIGN KEY (habit_id) REFERENCES habits(id) ON DELETE CASCADE
+		)`, `
+		CREATE TABLE IF NOT EXISTS refresh_tokens (
+			id TEXT PRIMARY KEY,
+			user_id TEXT NOT NULL,
+			family_id TEXT NOT NULL,
+			token_hash TEXT NOT NULL UNIQUE,
+			expires_at TEXT NOT NULL,
+			created_at TEXT NOT NULL,
+			revoked_at TEXT,
+			replaced_by TEXT,
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+		)`,
+	)(tx)
+	if err != nil {
+		return err
+	}
+
+	hasUserID, err := columnExists(tx, "habits", "user_id")
+	if err != nil {
+		return err
+	}
+	if !hasUserID {
+		if _, err := tx.Exec(`ALTER TABLE habits ADD COLUMN user_id TEXT NOT NULL DEFAULT ''`); err != nil {
+			return err
+		}
+	}
+
+	return execStatements(
+		`CREATE INDEX IF NOT EXISTS idx_habits_user_id ON habits(user_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_refresh_tokens_family_id ON refresh_tokens(family_id)`,
+	)(tx)
+}
+
+// ensureMigrationsTable creates the table that records applied migrations
+func (db *SQLiteDatabase) ensureMigrationsTable() error {
+	query := `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			description TEXT NOT NULL,
+			applied_at TEXT NOT NULL
+		)
+	`
+	if _, err := db.db.Exec(query); err != nil {
+		return fmt.Errorf("failed to create schema_migrations table: %w", err)
+	}
+	return nil
+}
+
+// SchemaVersion returns the highest applied migration version, or 0 for an empty database
+func (db *SQLiteDatabase) SchemaVersion() (int, error) {
+	if err := db.ensureMigrationsTable(); err != nil {
+		return 0, err
+	}
+
+	var version sql.NullInt64
+	if err := db.db.QueryRow(`SELECT MAX(version) FROM schema_migrations`).Scan(&version); err != nil {
+		return 0, fmt.Errorf("failed to get schema version: %w", err)
+	}
+
+	return int(version.Int64), nil
+}
+
+// Migrate applies every pending migration
+func (db *SQLiteDatabase) Migrate() error {
+	return db.MigrateTo(LatestSchemaVersion())
+}
+
+// MigrateTo applies up or down migrations until the schema is at target.
+// Each migration runs in its own transaction, so a failure leaves the schema
+// at the last version that applied cleanly.
+func (db *SQLiteDatabase) MigrateTo(target int) error {
+	if target < 0 || target > LatestSchemaVersion() {
+		return fmt.Errorf("%w: %d", ErrUnknownSchemaVersion, target)
+	}
+
+	current, err := db.SchemaVersion()
+	if err != nil {
+		return err
+	}
+	if current > LatestSchemaVersion() {
+		return fmt.Errorf("%w: database is at version %d but the newest known migration is %d",
+			ErrUnknownSchemaVersion, current, LatestSchemaVersion())
+	}
+
+	for _, migration := range migrations {
+		if migration.Version > current && migration.Version <= target {
+			if err := db.applyMigration(migration, true); err != nil {
+				return err
+			}
+		}
+	}
+
+	for i := len(migrations) - 1; i >= 0; i-- {
+		migration := migrations[i]
+		if migration.Version <= current && migration.Version > target {
+			if err := db.applyMigration(migration, false); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// applyMigration runs one migration in either direction and records the result
+func (db *SQLiteDatabase) applyMigration(migration Migration, up bool) error {
+	direction := "down"
+	step := migration.Down
+	if up {
+		direction = "up"
+		step = migration.Up
+	}
+
+	tx, err := db.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := step(tx); err != nil {
+		return fmt.Errorf("failed to migrate %s to version %d (%s): %w", direction, migration.Version, migration.Description, err)
+	}
+
+	if up {
+		_, err = tx.Exec(`INSERT INTO schema_migrations (version, description, applied_at) VALUES (?, ?, ?)`,
+			migration.Version, migration.Description, time.Now().UTC().Format(time.RFC3339))
+	} else {
+		_, err = tx.Exec(`DELETE FROM schema_migrations WHERE version = ?`, migration.Version)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to record migration %d: %w", migration.Version, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit migration %d: %w", migration.Version, err)
+	}
+
+	log.Printf("Migrated database %s to version %d: %s", direction, migration.Version, migration.Description)
+	return nil
+}
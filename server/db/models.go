@@ -1,15 +1,32 @@
 package db
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"time"
+
+	"habit-tracker/server/stats"
 )
 
 var (
-	ErrNotFound         = errors.New("record not found")
-	ErrDuplicate        = errors.New("record already exists")
-	ErrInvalidFrequency = errors.New("invalid frequency")
+	ErrNotFound            = errors.New("record not found")
+	ErrDuplicate           = errors.New("record already exists")
+	ErrInvalidFrequency    = errors.New("invalid frequency")
+	ErrInvalidAggregation  = errors.New("invalid aggregation")
+	ErrInvalidTarget       = errors.New("invalid target")
+	ErrInvalidSchedule     = errors.New("invalid schedule")
+	ErrInvalidTimestamp    = errors.New("invalid timestamp")
+	ErrInvalidValue        = errors.New("invalid value")
+	ErrInvalidStatus       = errors.New("invalid status")
+	ErrInvalidResumeDate   = errors.New("invalid resume date")
+	ErrInvalidTimezone     = errors.New("invalid timezone")
+	ErrInvalidWeekStart    = errors.New("invalid week start")
+	ErrInvalidChannel      = errors.New("invalid channel")
+	ErrInvalidReminderTime = errors.New("invalid reminder time")
+	ErrInvalidQuietHours   = errors.New("invalid quiet hours")
+	ErrValidation          = errors.New("validation failed")
+	ErrVersionConflict     = errors.New("record was changed by another request")
 )
 
 type Frequency string
@@ -49,25 +66,195 @@ func ValidateFrequency(freq string) error {
 	return nil
 }
 
+// Aggregation decides how a quantitative habit's entry values are combined
+// within a period before they are compared with its target
+type Aggregation = stats.Aggregation
+
+const (
+	AggregationSum   = stats.AggregationSum
+	AggregationCount = stats.AggregationCount
+	AggregationMax   = stats.AggregationMax
+)
+
+// ValidateAggregation accepts the known aggregations and the empty string,
+// which means sum
+func ValidateAggregation(aggregation string) error {
+	if aggregation != "" && !Aggregation(aggregation).IsValid() {
+		return fmt.Errorf("%w: %s", ErrInvalidAggregation, aggregation)
+	}
+	return nil
+}
+
+// ValidateTimestamp accepts any layout ParseTimestamp understands
+func ValidateTimestamp(timestamp string) error {
+	if _, ok := ParseTimestamp(timestamp); !ok {
+		return fmt.Errorf("%w: %s", ErrInvalidTimestamp, timestamp)
+	}
+	return nil
+}
+
+// ValidateValue rejects negative entry values
+func ValidateValue(value float64) error {
+	if value < 0 {
+		return fmt.Errorf("%w: %v", ErrInvalidValue, value)
+	}
+	return nil
+}
+
+// ValidateTarget rejects negative targets; zero means the habit has no target
+func ValidateTarget(target float64) error {
+	if target < 0 {
+		return fmt.Errorf("%w: %v", ErrInvalidTarget, target)
+	}
+	return nil
+}
+
 type Habit struct {
-	ID          string    `json:"id"`
-	Name        string    `json:"name"`
-	Description string    `json:"description"`
-	Frequency   Frequency `json:"frequency"`
-	StartDate   string    `json:"startDate"`
+	ID          string    `json:"id" validate:"max=64"`
+	UserID      string    `json:"userId"`
+	Name        string    `json:"name" validate:"required,max=100"`
+	Description string    `json:"description" validate:"max=1000"`
+	Frequency   Frequency `json:"frequency" validate:"required,frequency"`
+	StartDate   string    `json:"startDate" validate:"required,date"`
+	// Quantitative habits are done for a period once the aggregated entry
+	// values reach Target. A zero Target means any entry completes the period.
+	Target      float64     `json:"target,omitempty" validate:"min=0"`
+	Unit        string      `json:"unit,omitempty" validate:"max=32"`
+	Aggregation Aggregation `json:"aggregation,omitempty" validate:"aggregation"`
+	// Schedule optionally narrows when the habit is due with an RRULE such as
+	// "FREQ=WEEKLY;BYDAY=MO,WE,FR". It takes precedence over Frequency.
+	Schedule string `json:"schedule,omitempty" validate:"schedule"`
+	// Paused habits resume by themselves once ResumeDate passes, if one is
+	// set. Pauses records every paused or archived stretch so statistics can
+	// leave them out.
+	Status     HabitStatus `json:"status,omitempty" validate:"status"`
+	ResumeDate string      `json:"resumeDate,omitempty"`
+	Pauses     []Pause     `json:"pauses,omitempty"`
+	// Reminders are sent on every channel in Channels, or the WebSocket when
+	// none are chosen. FallbackChannel is tried when WebSocket delivery fails.
+	Channels        []Channel `json:"channels,omitempty" validate:"channels"`
+	FallbackChannel Channel   `json:"fallbackChannel,omitempty" validate:"fallback"`
+	// ReminderTimes are the times of day, as HH:MM in the owner's time zone,
+	// at which the habit is reminded on the days it is due. Without them the
+	// habit is reminded a full period after the last reminder or check-in.
+	ReminderTimes []string `json:"reminderTimes,omitempty" validate:"clocks"`
+	// Version starts at 1 and goes up with every update, so clients can tell
+	// whether the habit changed since they read it
+	Version   int64  `json:"version"`
+	UpdatedAt string `json:"updatedAt,omitempty"`
+}
+
+// ETag identifies the current representation of the habit. Besides the stored
+// version it covers the status, which changes by itself when a pause ends.
+func (h *Habit) ETag() string {
+	return fmt.Sprintf(`"%d-%s"`, h.Version, h.Status.orActive())
+}
+
+// ParsedSchedule returns the habit's schedule anchored at its start date, or
+// nil when the habit has no valid schedule
+func (h *Habit) ParsedSchedule() *Schedule {
+	if h.Schedule == "" {
+		return nil
+	}
+	schedule, err := ParseSchedule(h.Schedule)
+	if err != nil {
+		return nil
+	}
+	if start, ok := ParseTimestamp(h.StartDate); ok {
+		schedule.Start = start
+	}
+	return schedule
+}
+
+// Cadence returns the periods the habit is expected to be completed in, with
+// weeks laid out by cal. Period boundaries fall in the location of the times
+// passed to the cadence.
+func (h *Habit) Cadence(cal Calendar) stats.Cadence {
+	if schedule := h.ParsedSchedule(); schedule != nil {
+		return schedule.withCalendar(cal)
+	}
+	return cal.Cadence(h.Frequency)
+}
+
+// Recurrence returns when the habit is next due, for reminders
+func (h *Habit) Recurrence(cal Calendar) Recurrence {
+	if schedule := h.ParsedSchedule(); schedule != nil {
+		return schedule.withCalendar(cal)
+	}
+	return h.Frequency
 }
 
 type TrackingEntry struct {
-	ID        string `json:"id"`
-	HabitID   string `json:"habitId"`
-	Timestamp string `json:"timestamp"`
-	Note      string `json:"note"`
+	ID        string  `json:"id" validate:"max=64"`
+	HabitID   string  `json:"habitId"`
+	Timestamp string  `json:"timestamp" validate:"required,timestamp"`
+	Note      string  `json:"note" validate:"max=1000"`
+	Value     float64 `json:"value,omitempty" validate:"min=0"`
 }
 
+// Reminder tracks when a habit was last reminded. While SnoozedUntil is set
+// the habit is reminded at that time instead of on its usual schedule.
+// NextReminder is when the reminder next fires, kept up to date by every write
+// that affects it; it is empty for reminders that will not fire.
 type Reminder struct {
 	ID           string `json:"id"`
 	HabitID      string `json:"habitId"`
 	LastReminder string `json:"lastReminder"`
+	SnoozedUntil string `json:"snoozedUntil,omitempty"`
+	NextReminder string `json:"nextReminder,omitempty"`
+}
+
+// ReminderActionType is something a user did with a reminder
+type ReminderActionType string
+
+const (
+	ReminderSnoozed   ReminderActionType = "snoozed"
+	ReminderDismissed ReminderActionType = "dismissed"
+)
+
+// ReminderAction is an entry in a habit's reminder history. Until is when the
+// habit will next be reminded. NotificationID is the inbox entry acted on, if any.
+type ReminderAction struct {
+	ID             string             `json:"id"`
+	UserID         string             `json:"userId"`
+	HabitID        string             `json:"habitId"`
+	NotificationID string             `json:"notificationId,omitempty"`
+	Action         ReminderActionType `json:"action"`
+	Until          time.Time          `json:"until"`
+	CreatedAt      time.Time          `json:"createdAt"`
+}
+
+// ReminderSend records one firing of a habit's reminder, keyed by the habit
+// and the time the reminder was due. A send is claimed by a worker before the
+// reminder goes out and completed once it has, so a worker that crashes in
+// between leaves it for the next one to finish. NotificationID names the inbox
+// entry, so finishing a send never stores the reminder twice.
+type ReminderSend struct {
+	ID             string    `json:"id"`
+	UserID         string    `json:"userId"`
+	HabitID        string    `json:"habitId"`
+	DueAt          time.Time `json:"dueAt"`
+	NotificationID string    `json:"notificationId"`
+	Worker         string    `json:"worker"`
+	ClaimedAt      time.Time `json:"claimedAt"`
+	// SentAt is zero until the send is completed
+	SentAt time.Time `json:"sentAt,omitempty"`
+}
+
+// Notification is an entry in a user's inbox. Reminders are stored here as
+// well as delivered, so users who were offline can catch up on them.
+// Dismissed notifications are kept but no longer listed.
+type Notification struct {
+	ID        string          `json:"id"`
+	UserID    string          `json:"userId"`
+	HabitID   string          `json:"habitId,omitempty"`
+	Type      string          `json:"type"`
+	Subject   string          `json:"subject"`
+	Body      string          `json:"body"`
+	Data      json.RawMessage `json:"data,omitempty"`
+	Read      bool            `json:"read"`
+	Dismissed bool            `json:"dismissed"`
+	CreatedAt time.Time       `json:"createdAt"`
 }
 
 // Statistics and Analytics Structures
@@ -85,8 +272,9 @@ type HabitStats struct {
 }
 
 type ProgressPoint struct {
-	Date  string `json:"date"`
-	Count int    `json:"count"`
+	Date  string  `json:"date"`
+	Count int     `json:"count"`
+	Value float64 `json:"value"`
 }
 
 type OverallStats struct {
@@ -112,43 +300,160 @@ type DailyCompletion struct {
 	Completions int    `json:"completions"`
 }
 
-// User represents a user in the system
+// User represents a user in the system. Timezone is an IANA zone name and
+// WeekStart a lowercase weekday; days, weeks and months in the user's
+// statistics and reminders follow them, and empty values fall back to
+// DefaultCalendar.
 type User struct {
-	ID           string    `json:"id"`
-	Email        string    `json:"email"`
-	Username     string    `json:"username"`
-	PasswordHash string    `json:"-"` // "-" excludes this field from JSON serialization
-	CreatedAt    time.Time `json:"createdAt"`
-	UpdatedAt    time.Time `json:"updatedAt"`
+	ID           string `json:"id"`
+	Email        string `json:"email"`
+	Username     string `json:"username"`
+	PasswordHash string `json:"-"` // "-" excludes this field from JSON serialization
+	Timezone     string `json:"timezone,omitempty"`
+	WeekStart    string `json:"weekStart,omitempty"`
+	// Reminders due between QuietHoursStart and QuietHoursEnd (HH:MM, which
+	// may wrap past midnight) wait until the quiet hours end
+	QuietHoursStart string    `json:"quietHoursStart,omitempty"`
+	QuietHoursEnd   string    `json:"quietHoursEnd,omitempty"`
+	CreatedAt       time.Time `json:"createdAt"`
+	UpdatedAt       time.Time `json:"updatedAt"`
+}
+
+var weekdaysByName = map[string]time.Weekday{
+	"sunday":    time.Sunday,
+	"monday":    time.Monday,
+	"tuesday":   time.Tuesday,
+	"wednesday": time.Wednesday,
+	"thursday":  time.Thursday,
+	"friday":    time.Friday,
+	"saturday":  time.Saturday,
+}
+
+// ValidateTimezone accepts IANA zone names and the empty string
+func ValidateTimezone(timezone string) error {
+	if timezone == "" {
+		return nil
+	}
+	if _, err := time.LoadLocation(timezone); err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidTimezone, timezone)
+	}
+	return nil
+}
+
+// ValidateWeekStart accepts lowercase weekday names and the empty string
+func ValidateWeekStart(weekStart string) error {
+	if _, ok := weekdaysByName[weekStart]; weekStart != "" && !ok {
+		return fmt.Errorf("%w: %s", ErrInvalidWeekStart, weekStart)
+	}
+	return nil
+}
+
+// Calendar returns the user's time zone and week start. Unknown or missing
+// preferences fall back to DefaultCalendar.
+func (u *User) Calendar() Calendar {
+	cal := DefaultCalendar
+	if u == nil {
+		return cal
+	}
+	if loc, err := time.LoadLocation(u.Timezone); err == nil && u.Timezone != "" {
+		cal.Location = loc
+	}
+	if weekStart, ok := weekdaysByName[u.WeekStart]; ok {
+		cal.WeekStart = weekStart
+	}
+	return cal
+}
+
+// RefreshToken is a single-use refresh token stored by its SHA-256 hash. Every
+// token issued from the same login shares a FamilyID, which identifies the session.
+type RefreshToken struct {
+	ID         string     `json:"id"`
+	UserID     string     `json:"userId"`
+	FamilyID   string     `json:"familyId"`
+	TokenHash  string     `json:"-"`
+	ExpiresAt  time.Time  `json:"expiresAt"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	RevokedAt  *time.Time `json:"revokedAt,omitempty"`
+	ReplacedBy string     `json:"replacedBy,omitempty"`
 }
 
 type Database interface {
 	Ping() error
 
+	// Habit, tracking, reminder and statistics methods are scoped to the owning
+	// user. Records belonging to another user are reported as ErrNotFound.
 	CreateHabit(habit *Habit) error
-	GetHabit(id string) (*Habit, error)
-	GetAllHabits() ([]*Habit, error)
+	GetHabit(userID, id string) (*Habit, error)
+	GetAllHabits(userID string) ([]*Habit, error)
 	UpdateHabit(habit *Habit) error
-	UpdateHabitPartial(id string, updates map[string]interface{}) (*Habit, error)
-	DeleteHabit(id string) error
+	// UpdateHabitPartial applies the updates keyed by JSON field name. A
+	// "version" key makes the update conditional: it fails with
+	// ErrVersionConflict unless the habit still has that version.
+	UpdateHabitPartial(userID, id string, updates map[string]interface{}) (*Habit, error)
+	DeleteHabit(userID, id string) error
 
-	CreateTrackingEntry(entry *TrackingEntry) error
-	GetTrackingEntry(id string) (*TrackingEntry, error)
-	GetTrackingEntriesByHabitID(habitID string) ([]*TrackingEntry, error)
-	DeleteTrackingEntry(id string) error
+	CreateTrackingEntry(userID string, entry *TrackingEntry) error
+	GetTrackingEntry(userID, id string) (*TrackingEntry, error)
+	GetTrackingEntriesByHabitID(userID, habitID string) ([]*TrackingEntry, error)
+	// Editing an entry's timestamp or deleting an entry points the habit's
+	// reminder at its latest remaining check-in or sent reminder
+	UpdateTrackingEntryPartial(userID, id string, updates map[string]interface{}) (*TrackingEntry, error)
+	DeleteTrackingEntry(userID, id string) error
 
-	CreateReminder(reminder *Reminder) error
-	GetReminder(habitID string) (*Reminder, error)
-	UpdateReminderLastReminder(habitID string, lastReminder string) error
+	CreateReminder(userID string, reminder *Reminder) error
+	GetReminder(userID, habitID string) (*Reminder, error)
+	// GetReminderByID finds a reminder by its own ID rather than its habit's
+	GetReminderByID(userID, id string) (*Reminder, error)
+	// UpdateReminderLastReminder also ends any snooze, since the habit has
+	// been reminded or completed
+	UpdateReminderLastReminder(userID, habitID string, lastReminder string) error
+	SnoozeReminder(userID, habitID string, until time.Time) error
+	// GetHabitsNeedingReminders spans all users so the reminder service can
+	// route each reminder to the habit's owner. It returns the habits whose
+	// next-fire time has passed, soonest first.
 	GetHabitsNeedingReminders() ([]*Habit, error)
-	DeleteReminder(habitID string) error
+	// NextReminderDue returns the earliest next-fire time of any reminder, and
+	// false if no reminder is scheduled
+	NextReminderDue() (time.Time, bool, error)
+	// SetReminderListener registers a function told about every rescheduled
+	// reminder
+	SetReminderListener(listener ReminderListener)
+	DeleteReminder(userID, habitID string) error
+
+	// ClaimReminderSend records that send.Worker is sending the reminder due at
+	// send.DueAt. It returns false if the send was already completed, filling
+	// in its SentAt, or is held by another worker that claimed it after
+	// staleBefore. Otherwise the send is claimed, or taken over, and filled in
+	// with the stored ID and NotificationID.
+	ClaimReminderSend(send *ReminderSend, staleBefore time.Time) (bool, error)
+	// CompleteReminderSend marks a claimed send as sent and records sentAt as
+	// the habit's last reminder, together
+	CompleteReminderSend(send *ReminderSend, sentAt time.Time) error
+
+	// AcquireLease takes or renews the named lease for holder until ttl from
+	// now. It returns false while another holder's lease is unexpired.
+	AcquireLease(name, holder string, ttl time.Duration) (bool, error)
+	// ReleaseLease gives up a lease early; it is a no-op for other holders
+	ReleaseLease(name, holder string) error
+
+	// Reminder actions are listed newest first
+	CreateReminderAction(action *ReminderAction) error
+	GetReminderActions(userID, habitID string) ([]*ReminderAction, error)
+
+	// Notifications are listed newest first and never include dismissed ones
+	CreateNotification(notification *Notification) error
+	GetNotification(userID, id string) (*Notification, error)
+	GetNotifications(userID string, unreadOnly bool) ([]*Notification, error)
+	UpdateNotificationPartial(userID, id string, updates map[string]interface{}) (*Notification, error)
+	// MarkAllNotificationsRead returns how many notifications were marked
+	MarkAllNotificationsRead(userID string) (int, error)
 
 	// Statistics and Analytics Methods
-	GetHabitStats(habitID string) (*HabitStats, error)
-	GetHabitProgress(habitID string, days int) ([]*ProgressPoint, error)
-	GetOverallStats() (*OverallStats, error)
-	GetHabitCompletionRates(days int) ([]*HabitCompletionRate, error)
-	GetDailyCompletions(days int) ([]*DailyCompletion, error)
+	GetHabitStats(userID, habitID string) (*HabitStats, error)
+	GetHabitProgress(userID, habitID string, days int) ([]*ProgressPoint, error)
+	GetOverallStats(userID string) (*OverallStats, error)
+	GetHabitCompletionRates(userID string, days int) ([]*HabitCompletionRate, error)
+	GetDailyCompletions(userID string, days int) ([]*DailyCompletion, error)
 
 	// User Management Methods
 	CreateUser(user *User) error
@@ -156,4 +461,15 @@ type Database interface {
 	GetUserByID(id string) (*User, error)
 	UpdateUser(user *User) error
 	DeleteUser(id string) error
+
+	// Refresh Token Methods
+	CreateRefreshToken(token *RefreshToken) error
+	GetRefreshTokenByHash(tokenHash string) (*RefreshToken, error)
+	// RotateRefreshToken revokes the token oldID, marks it as replaced by next and
+	// stores next. It returns ErrNotFound if oldID is unknown or already revoked.
+	RotateRefreshToken(oldID string, next *RefreshToken) error
+	RevokeRefreshTokenFamily(familyID string) error
+	// IsRefreshTokenFamilyActive reports whether the family still has an
+	// unrevoked, unexpired token, i.e. whether the session is still live.
+	IsRefreshTokenFamilyActive(familyID string) (bool, error)
 }
@@ -0,0 +1,150 @@
+package db
+
+import (
+	"math"
+	"time"
+
+	"habit-tracker/server/stats"
+)
+
+// biweeklyEpoch anchors two-week periods so every biweekly habit shares the
+// same boundaries. It is a Monday.
+var biweeklyEpoch = time.Date(1970, time.January, 5, 0, 0, 0, 0, time.UTC)
+
+// timestampLayouts are the formats accepted for tracking entry timestamps
+var timestampLayouts = []string{
+	time.RFC3339Nano,
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+}
+
+// ParseTimestamp parses a stored timestamp in any of the accepted layouts.
+// Timestamps without a zone are taken as UTC.
+func ParseTimestamp(value string) (time.Time, bool) {
+	return ParseTimestampIn(value, time.UTC)
+}
+
+// ParseTimestampIn parses a stored timestamp in any of the accepted layouts,
+// reading timestamps without a zone, such as plain dates, as local to loc
+func ParseTimestampIn(value string, loc *time.Location) (time.Time, bool) {
+	for _, layout := range timestampLayouts {
+		if t, err := time.ParseInLocation(layout, value, loc); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// Calendar is how a user divides time: the zone their days start in and the
+// day their weeks start on
+type Calendar struct {
+	Location  *time.Location
+	WeekStart time.Weekday
+}
+
+// DefaultCalendar applies to users without preferences
+var DefaultCalendar = Calendar{Location: time.UTC, WeekStart: time.Monday}
+
+// Now returns the current time in the calendar's zone
+func (c Calendar) Now() time.Time {
+	return time.Now().In(c.Location)
+}
+
+// Cadence returns the periods of f with weeks starting on the calendar's week start
+func (c Calendar) Cadence(f Frequency) stats.Cadence {
+	return calendarFrequency{Frequency: f, weekStart: c.WeekStart}
+}
+
+// calendarFrequency is a Frequency whose weeks start on a chosen day
+type calendarFrequency struct {
+	Frequency
+	weekStart time.Weekday
+}
+
+func (c calendarFrequency) PeriodStart(t time.Time) time.Time {
+	return c.Frequency.periodStart(t, c.weekStart)
+}
+
+// PeriodStart returns the start of the frequency period containing t, in t's
+// location. Weeks start on Monday.
+func (f Frequency) PeriodStart(t time.Time) time.Time {
+	return f.periodStart(t, time.Monday)
+}
+
+func (f Frequency) periodStart(t time.Time, weekStart time.Weekday) time.Time {
+	year, month, day := t.Date()
+	loc := t.Location()
+
+	switch f {
+	case FrequencyHourly:
+		return time.Date(year, month, day, t.Hour(), 0, 0, 0, loc)
+	case FrequencyWeekly:
+		offset := (int(t.Weekday()-weekStart) + 7) % 7
+		return time.Date(year, month, day-offset, 0, 0, 0, 0, loc)
+	case FrequencyBiweekly:
+		start := FrequencyWeekly.periodStart(t, weekStart)
+		// Anchor to the week start on or before the Monday epoch
+		epochOffset := (int(time.Monday-weekStart) + 7) % 7
+		epoch := time.Date(biweeklyEpoch.Year(), biweeklyEpoch.Month(), biweeklyEpoch.Day()-epochOffset, 0, 0, 0, 0, loc)
+		days := int(math.Round(start.Sub(epoch).Hours() / 24))
+		if (days/7)%2 != 0 {
+			start = start.AddDate(0, 0, -7)
+		}
+		return start
+	case FrequencyMonthly:
+		return time.Date(year, month, 1, 0, 0, 0, 0, loc)
+	case FrequencyQuarterly:
+		quarterMonth := time.Month((int(month)-1)/3*3 + 1)
+		return time.Date(year, quarterMonth, 1, 0, 0, 0, 0, loc)
+	case FrequencyYearly:
+		return time.Date(year, time.January, 1, 0, 0, 0, 0, loc)
+	default:
+		return time.Date(year, month, day, 0, 0, 0, 0, loc)
+	}
+}
+
+// NextPeriodStart returns the start of the period following the one that
+// begins at periodStart
+func (f Frequency) NextPeriodStart(periodStart time.Time) time.Time {
+	switch f {
+	case FrequencyHourly:
+		return periodStart.Add(time.Hour)
+	case FrequencyWeekly:
+		return periodStart.AddDate(0, 0, 7)
+	case FrequencyBiweekly:
+		return periodStart.AddDate(0, 0, 14)
+	case FrequencyMonthly:
+		return periodStart.AddDate(0, 1, 0)
+	case FrequencyQuarterly:
+		return periodStart.AddDate(0, 3, 0)
+	case FrequencyYearly:
+		return periodStart.AddDate(1, 0, 0)
+	default:
+		return periodStart.AddDate(0, 0, 1)
+	}
+}
+
+// NextOccurrence returns after advanced by one frequency interval. Unknown
+// frequencies advance by a day.
+func (f Frequency) NextOccurrence(after time.Time) time.Time {
+	switch f {
+	case FrequencyHourly:
+		return after.Add(time.Hour)
+	case FrequencyDaily:
+		return after.AddDate(0, 0, 1)
+	case FrequencyWeekly:
+		return after.AddDate(0, 0, 7)
+	case FrequencyBiweekly:
+		return after.AddDate(0, 0, 14)
+	case FrequencyMonthly:
+		return after.AddDate(0, 1, 0)
+	case FrequencyQuarterly:
+		return after.AddDate(0, 3, 0)
+	case FrequencyYearly:
+		return after.AddDate(1, 0, 0)
+	default:
+		return after.AddDate(0, 0, 1) // Default to daily
+	}
+}
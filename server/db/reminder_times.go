@@ -0,0 +1,176 @@
+package db
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// clockLayout is the HH:MM form of reminder times and quiet hours
+const clockLayout = "15:04"
+
+// parseClock returns the minutes after midnight of an HH:MM time of day
+func parseClock(value string) (int, bool) {
+	parsed, err := time.Parse(clockLayout, value)
+	if err != nil || len(value) != len(clockLayout) {
+		return 0, false
+	}
+	return parsed.Hour()*60 + parsed.Minute(), true
+}
+
+// atClock returns the time minutes after midnight on t's day, in t's location
+func atClock(t time.Time, minutes int) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), minutes/60, minutes%60, 0, 0, t.Location())
+}
+
+// ValidateReminderTimes accepts a list of distinct HH:MM times of day
+func ValidateReminderTimes(times []string) error {
+	seen := make(map[string]bool, len(times))
+	for _, value := range times {
+		if _, ok := parseClock(value); !ok {
+			return fmt.Errorf("%w: %s", ErrInvalidReminderTime, value)
+		}
+		if seen[value] {
+			return fmt.Errorf("%w: %s listed twice", ErrInvalidReminderTime, value)
+		}
+		seen[value] = true
+	}
+	return nil
+}
+
+// ReminderTimesFromValue converts a decoded JSON array of times, returning
+// them in order
+func ReminderTimesFromValue(value interface{}) ([]string, error) {
+	items, ok := value.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%w: reminder times must be an array", ErrInvalidReminderTime)
+	}
+
+	times := make([]string, 0, len(items))
+	for _, item := range items {
+		text, ok := item.(string)
+		if !ok {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidReminderTime, item)
+		}
+		times = append(times, text)
+	}
+	if err := ValidateReminderTimes(times); err != nil {
+		return nil, err
+	}
+	sort.Strings(times)
+	return times, nil
+}
+
+// joinReminderTimes and splitReminderTimes store reminder times as
+// comma-separated text
+func joinReminderTimes(times []string) string {
+	return strings.Join(times, ",")
+}
+
+func splitReminderTimes(value string) []string {
+	if value == "" {
+		return nil
+	}
+	return ParseCSV(value)
+}
+
+// ValidateQuietHours accepts a start and end in HH:MM, or neither
+func ValidateQuietHours(start, end string) error {
+	if start == "" && end == "" {
+		return nil
+	}
+	startMinutes, ok := parseClock(start)
+	if !ok {
+		return fmt.Errorf("%w: start must be HH:MM", ErrInvalidQuietHours)
+	}
+	endMinutes, ok := parseClock(end)
+	if !ok {
+		return fmt.Errorf("%w: end must be HH:MM", ErrInvalidQuietHours)
+	}
+	if startMinutes == endMinutes {
+		return fmt.Errorf("%w: start and end must differ", ErrInvalidQuietHours)
+	}
+	return nil
+}
+
+// QuietHours is a daily window in which reminders are held back. A window
+// whose end is before its start runs past midnight.
+type QuietHours struct {
+	Start, End int // minutes after midnight
+}
+
+// QuietHours returns the user's quiet hours, if they have set valid ones
+func (u *User) QuietHours() (QuietHours, bool) {
+	if u == nil || ValidateQuietHours(u.QuietHoursStart, u.QuietHoursEnd) != nil || u.QuietHoursStart == "" {
+		return QuietHours{}, false
+	}
+	start, _ := parseClock(u.QuietHoursStart)
+	end, _ := parseClock(u.QuietHoursEnd)
+	return QuietHours{Start: start, End: end}, true
+}
+
+// Defer returns t, or the end of the quiet hours if t falls inside them. The
+// window is laid out in t's location.
+func (q QuietHours) Defer(t time.Time) time.Time {
+	minutes := t.Hour()*60 + t.Minute()
+	switch {
+	case q.Start < q.End && minutes >= q.Start && minutes < q.End:
+		return atClock(t, q.End)
+	case q.Start > q.End && minutes >= q.Start:
+		return atClock(t.AddDate(0, 0, 1), q.End)
+	case q.Start > q.End && minutes < q.End:
+		return atClock(t, q.End)
+	}
+	return t
+}
+
+// NextReminderTime returns when habit should next be reminded after its last
+// reminder or check-in, in its owner's time zone. Habits with reminder times
+// are reminded at those times on the days they are due: daily and hourly
+// habits at the next listed time, others on the day their next period is due.
+// Reminders that land in the owner's quiet hours wait for them to end.
+func NextReminderTime(habit *Habit, owner *User, lastReminder time.Time) time.Time {
+	cal := owner.Calendar()
+	last := lastReminder.In(cal.Location)
+	next := CalculateNextReminderTime(last, habit.Recurrence(cal))
+
+	if len(habit.ReminderTimes) > 0 {
+		floor := last
+		if habit.ParsedSchedule() != nil || (habit.Frequency != FrequencyDaily && habit.Frequency != FrequencyHourly) {
+			floor = atClock(next, 0)
+		}
+		next = nextReminderSlot(habit.ReminderTimes, last, floor)
+	}
+
+	if quiet, ok := owner.QuietHours(); ok {
+		next = quiet.Defer(next)
+	}
+	return next
+}
+
+// nextReminderSlot returns the earliest of the times of day that is after
+// last and no earlier than floor
+func nextReminderSlot(times []string, last, floor time.Time) time.Time {
+	var clocks []int
+	for _, value := range times {
+		if minutes, ok := parseClock(value); ok {
+			clocks = append(clocks, minutes)
+		}
+	}
+	if len(clocks) == 0 {
+		return floor
+	}
+	sort.Ints(clocks)
+
+	day := atClock(floor, 0)
+	for {
+		for _, minutes := range clocks {
+			slot := atClock(day, minutes)
+			if slot.After(last) && !slot.Before(floor) {
+				return slot
+			}
+		}
+		day = day.AddDate(0, 0, 1)
+	}
+}
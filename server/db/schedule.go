@@ -0,0 +1,388 @@
+package db
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule is a recurring set of days a habit is due, written as a subset of
+// the iCalendar RRULE syntax:
+//
+//	FREQ=DAILY;INTERVAL=3          every third day
+//	FREQ=WEEKLY;BYDAY=MO,WE,FR     Monday, Wednesday and Friday
+//	FREQ=MONTHLY;BYDAY=1SU         the first Sunday of every month
+//	FREQ=MONTHLY;BYMONTHDAY=1,-1   the first and last day of every month
+//
+// Intervals are counted from Start, the habit's start date, and weekly
+// intervals in weeks beginning on WeekStart (WKST). Each scheduled day
+// opens a period that lasts until the next scheduled day, so days that are not
+// scheduled are never counted as misses.
+type Schedule struct {
+	Freq       string
+	Interval   int
+	ByDay      []ScheduleDay
+	ByMonthDay []int
+	Start      time.Time
+	WeekStart  time.Weekday
+
+	// weekStartSet records an explicit WKST, which user preferences don't override
+	weekStartSet bool
+}
+
+// ScheduleDay is a BYDAY entry. Ordinal selects the nth (or, when negative,
+// nth from last) matching weekday of the month; zero matches every one.
+type ScheduleDay struct {
+	Weekday time.Weekday
+	Ordinal int
+}
+
+const (
+	ScheduleDaily   = "DAILY"
+	ScheduleWeekly  = "WEEKLY"
+	ScheduleMonthly = "MONTHLY"
+)
+
+// MaxScheduleInterval is the largest INTERVAL a schedule may use
+const MaxScheduleInterval = 366
+
+// maxScheduleSearchMonths bounds the search for a scheduled day of a monthly
+// rule, counted in scheduled months, so that rules which never match (e.g.
+// BYMONTHDAY=30 every twelfth February) terminate
+const maxScheduleSearchMonths = 48
+
+var scheduleWeekdays = map[string]time.Weekday{
+	"SU": time.Sunday,
+	"MO": time.Monday,
+	"TU": time.Tuesday,
+	"WE": time.Wednesday,
+	"TH": time.Thursday,
+	"FR": time.Friday,
+	"SA": time.Saturday,
+}
+
+// ParseSchedule parses an RRULE subset. Supported parts are FREQ (DAILY,
+// WEEKLY or MONTHLY), INTERVAL, BYDAY, WKST and, for monthly rules, BYMONTHDAY.
+func ParseSchedule(rule string) (*Schedule, error) {
+	schedule := &Schedule{Interval: 1, WeekStart: time.Monday}
+	rule = strings.TrimPrefix(strings.TrimSpace(rule), "RRULE:")
+
+	for _, part := range strings.Split(rule, ";") {
+		key, value, found := strings.Cut(part, "=")
+		if !found || value == "" {
+			return nil, fmt.Errorf("%w: malformed part %q", ErrInvalidSchedule, part)
+		}
+
+		switch strings.ToUpper(key) {
+		case "FREQ":
+			schedule.Freq = strings.ToUpper(value)
+		case "INTERVAL":
+			interval, err := strconv.Atoi(value)
+			if err != nil || interval < 1 || interval > MaxScheduleInterval {
+				return nil, fmt.Errorf("%w: interval must be an integer from 1 to %d", ErrInvalidSchedule, MaxScheduleInterval)
+			}
+			schedule.Interval = interval
+		case "BYDAY":
+			for _, day := range strings.Split(strings.ToUpper(value), ",") {
+				scheduleDay, err := parseScheduleDay(day)
+				if err != nil {
+					return nil, err
+				}
+				schedule.ByDay = append(schedule.ByDay, scheduleDay)
+			}
+		case "BYMONTHDAY":
+			for _, day := range strings.Split(value, ",") {
+				monthDay, err := strconv.Atoi(day)
+				if err != nil || monthDay == 0 || monthDay < -31 || monthDay > 31 {
+					return nil, fmt.Errorf("%w: invalid month day %q", ErrInvalidSchedule, day)
+				}
+				schedule.ByMonthDay = append(schedule.ByMonthDay, monthDay)
+			}
+		case "WKST":
+			weekday, ok := scheduleWeekdays[strings.ToUpper(value)]
+			if !ok {
+				return nil, fmt.Errorf("%w: invalid week start %q", ErrInvalidSchedule, value)
+			}
+			schedule.WeekStart = weekday
+			schedule.weekStartSet = true
+		default:
+			return nil, fmt.Errorf("%w: unsupported part %q", ErrInvalidSchedule, key)
+		}
+	}
+
+	switch schedule.Freq {
+	case ScheduleDaily:
+		if len(schedule.ByDay) > 0 || len(schedule.ByMonthDay) > 0 {
+			return nil, fmt.Errorf("%w: daily schedules cannot use BYDAY or BYMONTHDAY", ErrInvalidSchedule)
+		}
+	case ScheduleWeekly:
+		if len(schedule.ByMonthDay) > 0 {
+			return nil, fmt.Errorf("%w: weekly schedules cannot use BYMONTHDAY", ErrInvalidSchedule)
+		}
+		for _, day := range schedule.ByDay {
+			if day.Ordinal != 0 {
+				return nil, fmt.Errorf("%w: weekly schedules cannot use BYDAY ordinals", ErrInvalidSchedule)
+			}
+		}
+	case ScheduleMonthly:
+	case "":
+		return nil, fmt.Errorf("%w: FREQ is required", ErrInvalidSchedule)
+	default:
+		return nil, fmt.Errorf("%w: unsupported FREQ %q", ErrInvalidSchedule, schedule.Freq)
+	}
+
+	return schedule, nil
+}
+
+func parseScheduleDay(value string) (ScheduleDay, error) {
+	if len(value) < 2 {
+		return ScheduleDay{}, fmt.Errorf("%w: invalid day %q", ErrInvalidSchedule, value)
+	}
+
+	weekday, ok := scheduleWeekdays[value[len(value)-2:]]
+	if !ok {
+		return ScheduleDay{}, fmt.Errorf("%w: invalid day %q", ErrInvalidSchedule, value)
+	}
+
+	day := ScheduleDay{Weekday: weekday}
+	if prefix := value[:len(value)-2]; prefix != "" {
+		ordinal, err := strconv.Atoi(prefix)
+		if err != nil || ordinal == 0 || ordinal < -5 || ordinal > 5 {
+			return ScheduleDay{}, fmt.Errorf("%w: invalid day %q", ErrInvalidSchedule, value)
+		}
+		day.Ordinal = ordinal
+	}
+	return day, nil
+}
+
+// ValidateSchedule accepts a supported RRULE or the empty string
+func ValidateSchedule(rule string) error {
+	if rule == "" {
+		return nil
+	}
+	_, err := ParseSchedule(rule)
+	return err
+}
+
+// withCalendar returns the schedule with weeks starting on the calendar's
+// week start, unless the rule sets WKST itself
+func (s *Schedule) withCalendar(cal Calendar) *Schedule {
+	if !s.weekStartSet {
+		s.WeekStart = cal.WeekStart
+	}
+	return s
+}
+
+// Frequency returns the fixed frequency closest to the schedule
+func (s *Schedule) Frequency() Frequency {
+	switch s.Freq {
+	case ScheduleWeekly:
+		return FrequencyWeekly
+	case ScheduleMonthly:
+		return FrequencyMonthly
+	default:
+		return FrequencyDaily
+	}
+}
+
+// Occurs reports whether the calendar day containing t is scheduled. Weekly
+// and monthly rules without BYDAY or BYMONTHDAY recur on the day of Start, so
+// without a Start they never occur.
+func (s *Schedule) Occurs(t time.Time) bool {
+	year, month, day := t.Date()
+	// The start is a calendar date, so it is compared as one in any location
+	startYear, startMonth, startDay := s.Start.Date()
+	if s.Start.IsZero() {
+		if s.Freq != ScheduleDaily && len(s.ByDay) == 0 && len(s.ByMonthDay) == 0 {
+			return false
+		}
+		startYear, startMonth, startDay = year, month, day
+	}
+
+	switch s.Freq {
+	case ScheduleDaily:
+		return floorMod(civilDays(year, month, day)-civilDays(startYear, startMonth, startDay), s.Interval) == 0
+
+	case ScheduleWeekly:
+		weekday := t.Weekday()
+		if len(s.ByDay) == 0 {
+			if weekday != time.Date(startYear, startMonth, startDay, 0, 0, 0, 0, time.UTC).Weekday() {
+				return false
+			}
+		} else if !s.matchesWeekday(weekday) {
+			return false
+		}
+		weeks := (s.weekStartOf(year, month, day) - s.weekStartOf(startYear, startMonth, startDay)) / 7
+		return floorMod(weeks, s.Interval) == 0
+
+	case ScheduleMonthly:
+		months := (year-startYear)*12 + int(month-startMonth)
+		if floorMod(months, s.Interval) != 0 {
+			return false
+		}
+		if len(s.ByDay) == 0 && len(s.ByMonthDay) == 0 {
+			return day == startDay
+		}
+		daysInMonth := time.Date(year, month+1, 0, 0, 0, 0, 0, time.UTC).Day()
+		for _, monthDay := range s.ByMonthDay {
+			if monthDay == day || (monthDay < 0 && daysInMonth+monthDay+1 == day) {
+				return true
+			}
+		}
+		for _, byDay := range s.ByDay {
+			if byDay.Weekday != t.Weekday() {
+				continue
+			}
+			switch {
+			case byDay.Ordinal == 0,
+				byDay.Ordinal > 0 && (day-1)/7+1 == byDay.Ordinal,
+				byDay.Ordinal < 0 && (daysInMonth-day)/7+1 == -byDay.Ordinal:
+				return true
+			}
+		}
+		return false
+	}
+
+	return false
+}
+
+func (s *Schedule) matchesWeekday(weekday time.Weekday) bool {
+	for _, day := range s.ByDay {
+		if day.Weekday == weekday {
+			return true
+		}
+	}
+	return false
+}
+
+// PeriodStart returns the start of the latest scheduled day at or before t
+func (s *Schedule) PeriodStart(t time.Time) time.Time {
+	day := startOfDay(t)
+	if found, ok := s.search(day, -1); ok {
+		return found
+	}
+	return day
+}
+
+// NextPeriodStart returns the start of the first scheduled day after periodStart
+func (s *Schedule) NextPeriodStart(periodStart time.Time) time.Time {
+	day := startOfDay(periodStart).AddDate(0, 0, 1)
+	if found, ok := s.search(day, 1); ok {
+		return found
+	}
+	return day
+}
+
+// search returns the first scheduled day from day onwards, or backwards when
+// step is -1. Daily and weekly rules jump straight to the right day or week;
+// monthly rules are searched a scheduled month at a time.
+func (s *Schedule) search(day time.Time, step int) (time.Time, bool) {
+	year, month, dayOfMonth := day.Date()
+	startYear, startMonth, startDay := s.Start.Date()
+	if s.Start.IsZero() {
+		startYear, startMonth, startDay = year, month, dayOfMonth
+	}
+
+	switch s.Freq {
+	case ScheduleDaily:
+		offset := floorMod(civilDays(year, month, dayOfMonth)-civilDays(startYear, startMonth, startDay), s.Interval)
+		if offset == 0 {
+			return day, true
+		}
+		if step < 0 {
+			return day.AddDate(0, 0, -offset), true
+		}
+		return day.AddDate(0, 0, s.Interval-offset), true
+
+	case ScheduleWeekly:
+		// Scan the rest of this week if it is scheduled, then the nearest
+		// scheduled week in the direction of the search
+		weekStart := day.AddDate(0, 0, s.weekStartOf(year, month, dayOfMonth)-civilDays(year, month, dayOfMonth))
+		weeks := (s.weekStartOf(year, month, dayOfMonth) - s.weekStartOf(startYear, startMonth, startDay)) / 7
+		offset := floorMod(weeks, s.Interval)
+		if offset == 0 {
+			for d := day; !d.Before(weekStart) && d.Before(weekStart.AddDate(0, 0, 7)); d = d.AddDate(0, 0, step) {
+				if s.Occurs(d) {
+					return d, true
+				}
+			}
+		}
+		jump := s.Interval - offset
+		if step < 0 {
+			jump = -offset
+			if offset == 0 {
+				jump = -s.Interval
+			}
+		}
+		week := weekStart.AddDate(0, 0, 7*jump)
+		for i := 0; i < 7; i++ {
+			d := week.AddDate(0, 0, i)
+			if step < 0 {
+				d = week.AddDate(0, 0, 6-i)
+			}
+			if s.Occurs(d) {
+				return d, true
+			}
+		}
+		return time.Time{}, false
+
+	case ScheduleMonthly:
+		// Scan the rest of this month if it is scheduled, then whole
+		// scheduled months in the direction of the search
+		monthStart := time.Date(year, month, 1, 0, 0, 0, 0, day.Location())
+		offset := floorMod((year-startYear)*12+int(month-startMonth), s.Interval)
+		if offset != 0 {
+			jump := s.Interval - offset
+			if step < 0 {
+				jump = -offset
+			}
+			monthStart = monthStart.AddDate(0, jump, 0)
+			day = monthStart
+			if step < 0 {
+				day = monthStart.AddDate(0, 1, -1)
+			}
+		}
+		for i := 0; i < maxScheduleSearchMonths; i++ {
+			for d := day; d.Month() == monthStart.Month(); d = d.AddDate(0, 0, step) {
+				if s.Occurs(d) {
+					return d, true
+				}
+			}
+			monthStart = monthStart.AddDate(0, step*s.Interval, 0)
+			day = monthStart
+			if step < 0 {
+				day = monthStart.AddDate(0, 1, -1)
+			}
+		}
+	}
+	return time.Time{}, false
+}
+
+// NextOccurrence returns the same time of day as after on the next scheduled day
+func (s *Schedule) NextOccurrence(after time.Time) time.Time {
+	next := s.NextPeriodStart(after)
+	return time.Date(next.Year(), next.Month(), next.Day(), after.Hour(), after.Minute(), after.Second(), after.Nanosecond(), after.Location())
+}
+
+func startOfDay(t time.Time) time.Time {
+	year, month, day := t.Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, t.Location())
+}
+
+// civilDays counts days since the Unix epoch for a calendar date, ignoring
+// time zones and daylight saving changes
+func civilDays(year int, month time.Month, day int) int {
+	return int(time.Date(year, month, day, 0, 0, 0, 0, time.UTC).Unix() / 86400)
+}
+
+// weekStartOf returns the civil day number of the first day of the date's week
+func (s *Schedule) weekStartOf(year int, month time.Month, day int) int {
+	days := civilDays(year, month, day)
+	weekday := time.Date(year, month, day, 0, 0, 0, 0, time.UTC).Weekday()
+	return days - (int(weekday-s.WeekStart)+7)%7
+}
+
+func floorMod(a, b int) int {
+	return ((a % b) + b) % b
+}
@@ -0,0 +1,138 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// ReminderListener is told a reminder's next-fire time whenever a write
+// reschedules it, so the reminder service can wake up for it. It is called
+// after the write and must not block.
+type ReminderListener func(next time.Time)
+
+// scheduleLayout stores next-fire times in UTC, so they sort as text
+const scheduleLayout = "2006-01-02T15:04:05Z"
+
+// formatSchedule returns the stored form of a next-fire time; reminders that
+// never fire are stored as the empty string
+func formatSchedule(next time.Time) string {
+	if next.IsZero() {
+		return ""
+	}
+	return next.UTC().Format(scheduleLayout)
+}
+
+// reminderSchedule returns when a reminder next fires, or the zero time if it
+// never will. A snooze decides alone, though like any other reminder it waits
+// for the owner's quiet hours to end. Paused habits are not reminded before
+// their resume date, and archived ones, like reminders whose last reminder
+// cannot be read, never are.
+func reminderSchedule(habit *Habit, owner *User, lastReminder, snoozedUntil string) time.Time {
+	var next time.Time
+	if until, err := time.Parse(time.RFC3339, snoozedUntil); err == nil {
+		next = until.In(owner.Calendar().Location)
+		if quiet, ok := owner.QuietHours(); ok {
+			next = quiet.Defer(next)
+		}
+	} else if last, err := time.Parse(time.RFC3339, lastReminder); err == nil {
+		next = NextReminderTime(habit, owner, last)
+	} else {
+		return time.Time{}
+	}
+
+	switch habit.Status.orActive() {
+	case StatusArchived:
+		return time.Time{}
+	case StatusPaused:
+		resume, ok := ParseTimestampIn(habit.ResumeDate, owner.Calendar().Location)
+		if !ok {
+			return time.Time{}
+		}
+		if resume.After(next) {
+			next = resume
+		}
+	}
+	return next
+}
+
+// lastActivity returns the time a habit's reminder counts from once its
+// entries change: the latest remaining check-in or sent reminder, or the start
+// date for a habit with neither. Without a readable start date it is now.
+func lastActivity(startDate string, checkIns []string, sent []time.Time) time.Time {
+	latest, found := ParseTimestamp(startDate)
+	if !found {
+		latest = time.Now()
+	}
+	found = false
+	for _, checkIn := range checkIns {
+		if at, ok := ParseTimestamp(checkIn); ok && (!found || at.After(latest)) {
+			latest, found = at, true
+		}
+	}
+	for _, at := range sent {
+		if !found || at.After(latest) {
+			latest, found = at, true
+		}
+	}
+	return latest
+}
+
+// earliest returns the earlier of two next-fire times, ignoring zero ones
+func earliest(a, b time.Time) time.Time {
+	if a.IsZero() || (!b.IsZero() && b.Before(a)) {
+		return b
+	}
+	return a
+}
+
+// sqlExecutor is satisfied by both *sql.DB and *sql.Tx
+type sqlExecutor interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// reschedule recomputes the next-fire time of the reminders whose habits match
+// where, a condition on the habits h, reminders r and owners u. It returns the
+// earliest of the new times.
+func reschedule(q sqlExecutor, where string, args ...interface{}) (time.Time, error) {
+	rows, err := q.Query(`
+		SELECT `+habitColumns+`, r.last_reminder, r.snoozed_until, COALESCE(u.timezone, ''), COALESCE(u.week_start, ''),
+			COALESCE(u.quiet_hours_start, ''), COALESCE(u.quiet_hours_end, '')
+		FROM habits h
+		JOIN reminders r ON h.id = r.habit_id
+		LEFT JOIN users u ON u.id = h.user_id
+		WHERE `+where, args...)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to query reminders to schedule: %w", err)
+	}
+
+	schedule := make(map[string]time.Time)
+	for rows.Next() {
+		var lastReminder, snoozedUntil string
+		owner := &User{}
+		habit, err := scanHabit(rows, &lastReminder, &snoozedUntil, &owner.Timezone, &owner.WeekStart,
+			&owner.QuietHoursStart, &owner.QuietHoursEnd)
+		if err != nil {
+			rows.Close()
+			return time.Time{}, fmt.Errorf("failed to scan reminder: %w", err)
+		}
+		schedule[habit.ID] = reminderSchedule(habit, owner, lastReminder, snoozedUntil)
+	}
+	if err := rows.Close(); err != nil {
+		return time.Time{}, err
+	}
+	if err := rows.Err(); err != nil {
+		return time.Time{}, fmt.Errorf("error iterating reminders: %w", err)
+	}
+
+	// Rows are read in full first, since a transaction has a single connection
+	var first time.Time
+	for habitID, next := range schedule {
+		if _, err := q.Exec(`UPDATE reminders SET next_reminder = ? WHERE habit_id = ?`, formatSchedule(next), habitID); err != nil {
+			return time.Time{}, fmt.Errorf("failed to schedule reminder: %w", err)
+		}
+		first = earliest(first, next)
+	}
+	return first, nil
+}
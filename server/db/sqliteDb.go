@@ -2,96 +2,80 @@ package db
 
 import (
 	"database/sql"
+	"encoding/json"
 	"fmt"
+	"strings"
 	"time"
 
 	_ "github.com/mattn/go-sqlite3"
 )
 
 type SQLiteDatabase struct {
-	db *sql.DB
+	db               *sql.DB
+	reminderListener ReminderListener
 }
 
+// NewSQLiteDatabase opens the database at dbPath and migrates it to the latest schema version
 func NewSQLiteDatabase(dbPath string) (*SQLiteDatabase, error) {
-	db, err := sql.Open("sqlite3", dbPath)
+	sqliteDB, err := OpenSQLiteDatabase(dbPath)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open database: %w", err)
+		return nil, err
 	}
 
-	sqliteDB := &SQLiteDatabase{db: db}
+	if err := sqliteDB.Migrate(); err != nil {
+		sqliteDB.Close()
+		return nil, fmt.Errorf("failed to migrate database: %w", err)
+	}
 
-	if err := sqliteDB.createTables(); err != nil {
-		db.Close()
-		return nil, fmt.Errorf("failed to create tables: %w", err)
+	// Reminders from before next-fire times were stored are scheduled once
+	if _, err := reschedule(sqliteDB.db, "r.next_reminder IS NULL"); err != nil {
+		sqliteDB.Close()
+		return nil, err
 	}
 
 	return sqliteDB, nil
 }
 
-func (db *SQLiteDatabase) createTables() error {
-	createUsersTable := `
-		CREATE TABLE IF NOT EXISTS users (
-			id TEXT PRIMARY KEY,
-			email TEXT UNIQUE NOT NULL,
-			username TEXT UNIQUE NOT NULL,
-			password_hash TEXT NOT NULL,
-			created_at TEXT NOT NULL,
-			updated_at TEXT NOT NULL
-		);
-	`
-
-	createHabitsTable := `
-		CREATE TABLE IF NOT EXISTS habits (
-			id TEXT PRIMARY KEY,
-			name TEXT NOT NULL,
-			description TEXT,
-			frequency TEXT,
-			start_date TEXT
-		);
-	`
+// OpenSQLiteDatabase opens the database at dbPath without applying migrations
+func OpenSQLiteDatabase(dbPath string) (*SQLiteDatabase, error) {
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
 
-	createTrackingTable := `
-		CREATE TABLE IF NOT EXISTS tracking_entries (
-			id TEXT PRIMARY KEY,
-			habit_id TEXT NOT NULL,
-			timestamp TEXT NOT NULL,
-			note TEXT,
-			FOREIGN KEY (habit_id) REFERENCES habits(id) ON DELETE CASCADE
-		);
-	`
+	return &SQLiteDatabase{db: db}, nil
+}
 
-	createRemindersTable := `
-		CREATE TABLE IF NOT EXISTS reminders (
-			id TEXT PRIMARY KEY,
-			habit_id TEXT NOT NULL UNIQUE,
-			last_reminder TEXT NOT NULL,
-			FOREIGN KEY (habit_id) REFERENCES habits(id) ON DELETE CASCADE
-		);
-	`
+func (db *SQLiteDatabase) Close() error {
+	return db.db.Close()
+}
 
-	if _, err := db.db.Exec(createUsersTable); err != nil {
-		return fmt.Errorf("failed to create users table: %w", err)
-	}
+func (db *SQLiteDatabase) Ping() error {
+	return db.db.Ping()
+}
 
-	if _, err := db.db.Exec(createHabitsTable); err != nil {
-		return fmt.Errorf("failed to create habits table: %w", err)
-	}
+func (db *SQLiteDatabase) SetReminderListener(listener ReminderListener) {
+	db.reminderListener = listener
+}
 
-	if _, err := db.db.Exec(createTrackingTable); err != nil {
-		return fmt.Errorf("failed to create tracking_entries table: %w", err)
+// notifyReminder tells the listener about a rescheduled reminder
+func (db *SQLiteDatabase) notifyReminder(next time.Time) {
+	if db.reminderListener != nil && !next.IsZero() {
+		db.reminderListener(next)
 	}
+}
 
-	if _, err := db.db.Exec(createRemindersTable); err != nil {
-		return fmt.Errorf("failed to create reminders table: %w", err)
+// rescheduleReminders reschedules the reminders matching where outside a
+// transaction and tells the listener
+func (db *SQLiteDatabase) rescheduleReminders(where string, args ...interface{}) error {
+	next, err := reschedule(db.db, where, args...)
+	if err != nil {
+		return err
 	}
-
+	db.notifyReminder(next)
 	return nil
 }
 
-func (db *SQLiteDatabase) Ping() error {
-	return db.db.Ping()
-}
-
 func (db *SQLiteDatabase) CreateHabit(habit *Habit) error {
 	tx, err := db.db.Begin()
 	if err != nil {
@@ -99,12 +83,18 @@ func (db *SQLiteDatabase) CreateHabit(habit *Habit) error {
 	}
 	defer tx.Rollback()
 
+	habit.Version, habit.UpdatedAt = 1, time.Now().UTC().Format(time.RFC3339Nano)
+
 	habitQuery := `
-		INSERT INTO habits (id, name, description, frequency, start_date)
-		VALUES (?, ?, ?, ?, ?)
+		INSERT INTO habits (id, user_id, name, description, frequency, start_date, target, unit, aggregation, schedule,
+			status, resume_date, channels, fallback_channel, reminder_times, version, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
 
-	_, err = tx.Exec(habitQuery, habit.ID, habit.Name, habit.Description, habit.Frequency, habit.StartDate)
+	_, err = tx.Exec(habitQuery, habit.ID, habit.UserID, habit.Name, habit.Description, habit.Frequency, habit.StartDate,
+		habit.Target, habit.Unit, habit.Aggregation, habit.Schedule, habit.Status.orActive(), habit.ResumeDate,
+		joinChannels(habit.Channels), habit.FallbackChannel, joinReminderTimes(habit.ReminderTimes),
+		habit.Version, habit.UpdatedAt)
 	if err != nil {
 		if sqliteError, ok := err.(interface{ Error() string }); ok {
 			if ContainsString(sqliteError.Error(), "UNIQUE constraint failed") {
@@ -114,6 +104,10 @@ func (db *SQLiteDatabase) CreateHabit(habit *Habit) error {
 		return fmt.Errorf("failed to create habit: %w", err)
 	}
 
+	if err := replacePauses(tx, habit.ID, habit.Pauses); err != nil {
+		return err
+	}
+
 	reminderQuery := `
 		INSERT INTO reminders (id, habit_id, last_reminder)
 		VALUES (?, ?, ?)
@@ -125,18 +119,100 @@ func (db *SQLiteDatabase) CreateHabit(habit *Habit) error {
 		return fmt.Errorf("failed to create reminder: %w", err)
 	}
 
-	return tx.Commit()
+	next, err := reschedule(tx, "h.id = ?", habit.ID)
+	if err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	db.notifyReminder(next)
+	return nil
 }
 
-func (db *SQLiteDatabase) GetHabit(id string) (*Habit, error) {
-	query := `SELECT id, name, description, frequency, start_date FROM habits WHERE id = ?`
+// habitColumns lists the habit columns read by scanHabit, qualified with the h alias
+const habitColumns = `h.id, h.user_id, h.name, h.description, h.frequency, h.start_date, h.target, h.unit, h.aggregation, h.schedule,
+	h.status, h.resume_date, h.channels, h.fallback_channel, h.reminder_times, h.version, h.updated_at`
 
+// scanHabit reads a row selected with habitColumns, followed by any extra destinations
+func scanHabit(row interface{ Scan(...interface{}) error }, extra ...interface{}) (*Habit, error) {
 	habit := &Habit{}
-	var frequencyStr string
-	err := db.db.QueryRow(query, id).Scan(
-		&habit.ID, &habit.Name, &habit.Description, &frequencyStr, &habit.StartDate,
-	)
+	var frequencyStr, aggregationStr, statusStr, channelsStr, fallbackStr, reminderTimesStr string
+	dest := []interface{}{
+		&habit.ID, &habit.UserID, &habit.Name, &habit.Description, &frequencyStr, &habit.StartDate,
+		&habit.Target, &habit.Unit, &aggregationStr, &habit.Schedule, &statusStr, &habit.ResumeDate,
+		&channelsStr, &fallbackStr, &reminderTimesStr, &habit.Version, &habit.UpdatedAt,
+	}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return nil, err
+	}
+
+	habit.Frequency = Frequency(frequencyStr)
+	habit.Aggregation = Aggregation(aggregationStr)
+	habit.Status = HabitStatus(statusStr)
+	habit.Channels = splitChannels(channelsStr)
+	habit.FallbackChannel = Channel(fallbackStr)
+	habit.ReminderTimes = splitReminderTimes(reminderTimesStr)
+	return habit, nil
+}
+
+// loadPauses fills in the pause history of habits
+func (db *SQLiteDatabase) loadPauses(habits ...*Habit) error {
+	if len(habits) == 0 {
+		return nil
+	}
+
+	byID := make(map[string]*Habit, len(habits))
+	placeholders := make([]string, 0, len(habits))
+	args := make([]interface{}, 0, len(habits))
+	for _, habit := range habits {
+		byID[habit.ID] = habit
+		placeholders = append(placeholders, "?")
+		args = append(args, habit.ID)
+	}
+
+	query := `SELECT habit_id, start_date, end_date FROM habit_pauses WHERE habit_id IN (` +
+		strings.Join(placeholders, ", ") + `) ORDER BY start_date`
+
+	rows, err := db.db.Query(query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to query habit pauses: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var habitID string
+		var pause Pause
+		if err := rows.Scan(&habitID, &pause.Start, &pause.End); err != nil {
+			return fmt.Errorf("failed to scan habit pause: %w", err)
+		}
+		if habit, ok := byID[habitID]; ok {
+			habit.Pauses = append(habit.Pauses, pause)
+		}
+	}
+
+	return rows.Err()
+}
+
+// replacePauses stores pauses as the complete pause history of a habit
+func replacePauses(tx *sql.Tx, habitID string, pauses []Pause) error {
+	if _, err := tx.Exec(`DELETE FROM habit_pauses WHERE habit_id = ?`, habitID); err != nil {
+		return fmt.Errorf("failed to clear habit pauses: %w", err)
+	}
+	for _, pause := range pauses {
+		_, err := tx.Exec(`INSERT INTO habit_pauses (habit_id, start_date, end_date) VALUES (?, ?, ?)`,
+			habitID, pause.Start, pause.End)
+		if err != nil {
+			return fmt.Errorf("failed to store habit pause: %w", err)
+		}
+	}
+	return nil
+}
+
+func (db *SQLiteDatabase) GetHabit(userID, id string) (*Habit, error) {
+	query := `SELECT ` + habitColumns + ` FROM habits h WHERE h.id = ? AND h.user_id = ?`
 
+	habit, err := scanHabit(db.db.QueryRow(query, id, userID))
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, ErrNotFound
@@ -144,14 +220,23 @@ func (db *SQLiteDatabase) GetHabit(id string) (*Habit, error) {
 		return nil, fmt.Errorf("failed to get habit: %w", err)
 	}
 
-	habit.Frequency = Frequency(frequencyStr)
+	cal, err := db.calendar(userID)
+	if err != nil {
+		return nil, err
+	}
+	habit.refreshStatus(cal.Now())
+
+	if err := db.loadPauses(habit); err != nil {
+		return nil, err
+	}
+
 	return habit, nil
 }
 
-func (db *SQLiteDatabase) GetAllHabits() ([]*Habit, error) {
-	query := `SELECT id, name, description, frequency, start_date FROM habits`
+func (db *SQLiteDatabase) GetAllHabits(userID string) ([]*Habit, error) {
+	query := `SELECT ` + habitColumns + ` FROM habits h WHERE h.user_id = ?`
 
-	rows, err := db.db.Query(query)
+	rows, err := db.db.Query(query, userID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query habits: %w", err)
 	}
@@ -159,13 +244,10 @@ func (db *SQLiteDatabase) GetAllHabits() ([]*Habit, error) {
 
 	var habits []*Habit
 	for rows.Next() {
-		habit := &Habit{}
-		var frequencyStr string
-		err := rows.Scan(&habit.ID, &habit.Name, &habit.Description, &frequencyStr, &habit.StartDate)
+		habit, err := scanHabit(rows)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan habit: %w", err)
 		}
-		habit.Frequency = Frequency(frequencyStr)
 		habits = append(habits, habit)
 	}
 
@@ -173,17 +255,40 @@ func (db *SQLiteDatabase) GetAllHabits() ([]*Habit, error) {
 		return nil, fmt.Errorf("error iterating habits: %w", err)
 	}
 
+	cal, err := db.calendar(userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, habit := range habits {
+		habit.refreshStatus(cal.Now())
+	}
+
+	if err := db.loadPauses(habits...); err != nil {
+		return nil, err
+	}
+
 	return habits, nil
 }
 
 func (db *SQLiteDatabase) UpdateHabit(habit *Habit) error {
+	tx, err := db.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
 	query := `
 		UPDATE habits 
-		SET name = ?, description = ?, frequency = ?, start_date = ?
-		WHERE id = ?
+		SET name = ?, description = ?, frequency = ?, start_date = ?, target = ?, unit = ?, aggregation = ?, schedule = ?,
+			status = ?, resume_date = ?, channels = ?, fallback_channel = ?, reminder_times = ?,
+			version = version + 1, updated_at = ?
+		WHERE id = ? AND user_id = ?
 	`
 
-	result, err := db.db.Exec(query, habit.Name, habit.Description, habit.Frequency, habit.StartDate, habit.ID)
+	result, err := tx.Exec(query, habit.Name, habit.Description, habit.Frequency, habit.StartDate,
+		habit.Target, habit.Unit, habit.Aggregation, habit.Schedule, habit.Status.orActive(), habit.ResumeDate,
+		joinChannels(habit.Channels), habit.FallbackChannel, joinReminderTimes(habit.ReminderTimes),
+		time.Now().UTC().Format(time.RFC3339Nano), habit.ID, habit.UserID)
 	if err != nil {
 		return fmt.Errorf("failed to update habit: %w", err)
 	}
@@ -197,26 +302,80 @@ func (db *SQLiteDatabase) UpdateHabit(habit *Habit) error {
 		return ErrNotFound
 	}
 
+	if err := replacePauses(tx, habit.ID, habit.Pauses); err != nil {
+		return err
+	}
+
+	next, err := reschedule(tx, "h.id = ?", habit.ID)
+	if err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	db.notifyReminder(next)
 	return nil
 }
 
-func (db *SQLiteDatabase) UpdateHabitPartial(id string, updates map[string]interface{}) (*Habit, error) {
+func (db *SQLiteDatabase) UpdateHabitPartial(userID, id string, updates map[string]interface{}) (*Habit, error) {
 	// First check if habit exists
-	existing, err := db.GetHabit(id)
+	existing, err := db.GetHabit(userID, id)
 	if err != nil {
 		return nil, err
 	}
+	version, conditional := updates["version"].(float64)
+	if conditional && int64(version) != existing.Version {
+		return nil, ErrVersionConflict
+	}
 
 	// Build dynamic update query
 	setParts := []string{}
 	args := []interface{}{}
 
+	// Status changes also rewrite the pause history
+	cal, err := db.calendar(userID)
+	if err != nil {
+		return nil, err
+	}
+	updated := *existing
+	statusChanged, err := updated.applyStatusUpdates(updates, cal.Now())
+	if err != nil {
+		return nil, err
+	}
+	if statusChanged {
+		setParts = append(setParts, "status = ?", "resume_date = ?")
+		args = append(args, updated.Status, updated.ResumeDate)
+	}
+
+	// Channel lists and reminder times are stored as comma-separated text
+	if value, exists := updates["channels"]; exists {
+		channels, err := ChannelsFromValue(value)
+		if err != nil {
+			return nil, err
+		}
+		setParts = append(setParts, "channels = ?")
+		args = append(args, joinChannels(channels))
+	}
+	if value, exists := updates["reminderTimes"]; exists {
+		times, err := ReminderTimesFromValue(value)
+		if err != nil {
+			return nil, err
+		}
+		setParts = append(setParts, "reminder_times = ?")
+		args = append(args, joinReminderTimes(times))
+	}
+
 	// Map JSON field names to database column names
 	fieldMap := map[string]string{
-		"name":        "name",
-		"description": "description",
-		"frequency":   "frequency",
-		"startDate":   "start_date",
+		"name":            "name",
+		"description":     "description",
+		"frequency":       "frequency",
+		"startDate":       "start_date",
+		"target":          "target",
+		"unit":            "unit",
+		"aggregation":     "aggregation",
+		"schedule":        "schedule",
+		"fallbackChannel": "fallback_channel",
 	}
 
 	for jsonField, value := range updates {
@@ -229,6 +388,34 @@ func (db *SQLiteDatabase) UpdateHabitPartial(id string, updates map[string]inter
 					}
 				}
 			}
+			if jsonField == "aggregation" {
+				if aggregationStr, ok := value.(string); ok {
+					if err := ValidateAggregation(aggregationStr); err != nil {
+						return nil, err
+					}
+				}
+			}
+			if jsonField == "target" {
+				if target, ok := value.(float64); ok {
+					if err := ValidateTarget(target); err != nil {
+						return nil, err
+					}
+				}
+			}
+			if jsonField == "schedule" {
+				if schedule, ok := value.(string); ok {
+					if err := ValidateSchedule(schedule); err != nil {
+						return nil, err
+					}
+				}
+			}
+			if jsonField == "fallbackChannel" {
+				if fallback, ok := value.(string); ok {
+					if err := ValidateFallbackChannel(fallback); err != nil {
+						return nil, err
+					}
+				}
+			}
 			setParts = append(setParts, dbField+" = ?")
 			args = append(args, value)
 		}
@@ -239,8 +426,18 @@ func (db *SQLiteDatabase) UpdateHabitPartial(id string, updates map[string]inter
 		return existing, nil
 	}
 
-	// Add the ID parameter for the WHERE clause
-	args = append(args, id)
+	setParts = append(setParts, "version = version + 1", "updated_at = ?")
+	args = append(args, time.Now().UTC().Format(time.RFC3339Nano))
+
+	// Add the ID and owner parameters for the WHERE clause. Conditional
+	// updates also check the version again, so an update committed since the
+	// habit was read is not overwritten.
+	where := "id = ? AND user_id = ?"
+	args = append(args, id, userID)
+	if conditional {
+		where += " AND version = ?"
+		args = append(args, existing.Version)
+	}
 
 	// Build the query by joining the SET parts
 	setClause := ""
@@ -251,9 +448,15 @@ func (db *SQLiteDatabase) UpdateHabitPartial(id string, updates map[string]inter
 		setClause += part
 	}
 
-	query := fmt.Sprintf("UPDATE habits SET %s WHERE id = ?", setClause)
+	query := fmt.Sprintf("UPDATE habits SET %s WHERE %s", setClause, where)
+
+	tx, err := db.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
 
-	result, err := db.db.Exec(query, args...)
+	result, err := tx.Exec(query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to update habit: %w", err)
 	}
@@ -263,18 +466,47 @@ func (db *SQLiteDatabase) UpdateHabitPartial(id string, updates map[string]inter
 		return nil, fmt.Errorf("failed to get rows affected: %w", err)
 	}
 
+	if rowsAffected == 0 && conditional {
+		return nil, ErrVersionConflict
+	}
 	if rowsAffected == 0 {
 		return nil, ErrNotFound
 	}
 
+	if statusChanged {
+		if err := replacePauses(tx, id, updated.Pauses); err != nil {
+			return nil, err
+		}
+	}
+
+	next, err := reschedule(tx, "h.id = ?", id)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit habit update: %w", err)
+	}
+	db.notifyReminder(next)
+
 	// Return the updated habit
-	return db.GetHabit(id)
+	return db.GetHabit(userID, id)
 }
 
-func (db *SQLiteDatabase) DeleteHabit(id string) error {
-	query := `DELETE FROM habits WHERE id = ?`
+func (db *SQLiteDatabase) DeleteHabit(userID, id string) error {
+	tx, err := db.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Foreign keys are not enforced, so the schema's cascade does not remove
+	// the reminder. It is deleted here so that it is never left scheduled.
+	_, err = tx.Exec(`DELETE FROM reminders WHERE habit_id IN (SELECT id FROM habits WHERE id = ? AND user_id = ?)`, id, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete reminder: %w", err)
+	}
 
-	result, err := db.db.Exec(query, id)
+	result, err := tx.Exec(`DELETE FROM habits WHERE id = ? AND user_id = ?`, id, userID)
 	if err != nil {
 		return fmt.Errorf("failed to delete habit: %w", err)
 	}
@@ -288,16 +520,18 @@ func (db *SQLiteDatabase) DeleteHabit(id string) error {
 		return ErrNotFound
 	}
 
-	return nil
+	return tx.Commit()
 }
 
-func (db *SQLiteDatabase) CreateTrackingEntry(entry *TrackingEntry) error {
+func (db *SQLiteDatabase) CreateTrackingEntry(userID string, entry *TrackingEntry) error {
+	// Inserting through a SELECT on habits only writes the row when the habit
+	// belongs to userID
 	query := `
-		INSERT INTO tracking_entries (id, habit_id, timestamp, note)
-		VALUES (?, ?, ?, ?)
+		INSERT INTO tracking_entries (id, habit_id, timestamp, note, value)
+		SELECT ?, id, ?, ?, ? FROM habits WHERE id = ? AND user_id = ?
 	`
 
-	_, err := db.db.Exec(query, entry.ID, entry.HabitID, entry.Timestamp, entry.Note)
+	result, err := db.db.Exec(query, entry.ID, entry.Timestamp, entry.Note, entry.Value, entry.HabitID, userID)
 	if err != nil {
 		if sqliteError, ok := err.(interface{ Error() string }); ok {
 			if ContainsString(sqliteError.Error(), "UNIQUE constraint failed") {
@@ -307,15 +541,29 @@ func (db *SQLiteDatabase) CreateTrackingEntry(entry *TrackingEntry) error {
 		return fmt.Errorf("failed to create tracking entry: %w", err)
 	}
 
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+
 	return nil
 }
 
-func (db *SQLiteDatabase) GetTrackingEntry(id string) (*TrackingEntry, error) {
-	query := `SELECT id, habit_id, timestamp, note FROM tracking_entries WHERE id = ?`
+func (db *SQLiteDatabase) GetTrackingEntry(userID, id string) (*TrackingEntry, error) {
+	query := `
+		SELECT te.id, te.habit_id, te.timestamp, te.note, te.value
+		FROM tracking_entries te
+		JOIN habits h ON h.id = te.habit_id
+		WHERE te.id = ? AND h.user_id = ?
+	`
 
 	entry := &TrackingEntry{}
-	err := db.db.QueryRow(query, id).Scan(
-		&entry.ID, &entry.HabitID, &entry.Timestamp, &entry.Note,
+	err := db.db.QueryRow(query, id, userID).Scan(
+		&entry.ID, &entry.HabitID, &entry.Timestamp, &entry.Note, &entry.Value,
 	)
 
 	if err != nil {
@@ -328,8 +576,12 @@ func (db *SQLiteDatabase) GetTrackingEntry(id string) (*TrackingEntry, error) {
 	return entry, nil
 }
 
-func (db *SQLiteDatabase) GetTrackingEntriesByHabitID(habitID string) ([]*TrackingEntry, error) {
-	query := `SELECT id, habit_id, timestamp, note FROM tracking_entries WHERE habit_id = ? ORDER BY timestamp DESC`
+func (db *SQLiteDatabase) GetTrackingEntriesByHabitID(userID, habitID string) ([]*TrackingEntry, error) {
+	if err := db.checkHabitOwner(userID, habitID); err != nil {
+		return nil, err
+	}
+
+	query := `SELECT id, habit_id, timestamp, note, value FROM tracking_entries WHERE habit_id = ? ORDER BY timestamp DESC`
 
 	rows, err := db.db.Query(query, habitID)
 	if err != nil {
@@ -340,7 +592,7 @@ func (db *SQLiteDatabase) GetTrackingEntriesByHabitID(habitID string) ([]*Tracki
 	var entries []*TrackingEntry
 	for rows.Next() {
 		entry := &TrackingEntry{}
-		err := rows.Scan(&entry.ID, &entry.HabitID, &entry.Timestamp, &entry.Note)
+		err := rows.Scan(&entry.ID, &entry.HabitID, &entry.Timestamp, &entry.Note, &entry.Value)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan tracking entry: %w", err)
 		}
@@ -354,69 +606,100 @@ func (db *SQLiteDatabase) GetTrackingEntriesByHabitID(habitID string) ([]*Tracki
 	return entries, nil
 }
 
-func (db *SQLiteDatabase) DeleteTrackingEntry(id string) error {
-	query := `DELETE FROM tracking_entries WHERE id = ?`
-
-	result, err := db.db.Exec(query, id)
+func (db *SQLiteDatabase) UpdateTrackingEntryPartial(userID, id string, updates map[string]interface{}) (*TrackingEntry, error) {
+	existing, err := db.GetTrackingEntry(userID, id)
 	if err != nil {
-		return fmt.Errorf("failed to delete tracking entry: %w", err)
+		return nil, err
 	}
 
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
-		return fmt.Errorf("failed to get rows affected: %w", err)
+	setParts := []string{}
+	args := []interface{}{}
+
+	fieldMap := map[string]string{
+		"timestamp": "timestamp",
+		"note":      "note",
+		"value":     "value",
 	}
 
-	if rowsAffected == 0 {
-		return ErrNotFound
+	for jsonField, value := range updates {
+		if dbField, ok := fieldMap[jsonField]; ok {
+			if jsonField == "timestamp" {
+				if timestamp, ok := value.(string); ok {
+					if err := ValidateTimestamp(timestamp); err != nil {
+						return nil, err
+					}
+				}
+			}
+			if jsonField == "value" {
+				if entryValue, ok := value.(float64); ok {
+					if err := ValidateValue(entryValue); err != nil {
+						return nil, err
+					}
+				}
+			}
+			setParts = append(setParts, dbField+" = ?")
+			args = append(args, value)
+		}
 	}
 
-	return nil
-}
+	if len(setParts) == 0 {
+		return existing, nil
+	}
 
-func (db *SQLiteDatabase) CreateReminder(reminder *Reminder) error {
-	query := `
-		INSERT INTO reminders (id, habit_id, last_reminder)
-		VALUES (?, ?, ?)
-	`
+	// GetTrackingEntry has already checked ownership
+	args = append(args, id)
+	query := fmt.Sprintf("UPDATE tracking_entries SET %s WHERE id = ?", strings.Join(setParts, ", "))
 
-	_, err := db.db.Exec(query, reminder.ID, reminder.HabitID, reminder.LastReminder)
+	tx, err := db.db.Begin()
 	if err != nil {
-		if sqliteError, ok := err.(interface{ Error() string }); ok {
-			if ContainsString(sqliteError.Error(), "UNIQUE constraint failed") {
-				return ErrDuplicate
-			}
-		}
-		return fmt.Errorf("failed to create reminder: %w", err)
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
 	}
+	defer tx.Rollback()
 
-	return nil
-}
+	result, err := tx.Exec(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update tracking entry: %w", err)
+	}
 
-func (db *SQLiteDatabase) GetReminder(habitID string) (*Reminder, error) {
-	query := `SELECT id, habit_id, last_reminder FROM reminders WHERE habit_id = ?`
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get rows affected: %w", err)
+	}
 
-	reminder := &Reminder{}
-	err := db.db.QueryRow(query, habitID).Scan(
-		&reminder.ID, &reminder.HabitID, &reminder.LastReminder,
-	)
+	if rowsAffected == 0 {
+		return nil, ErrNotFound
+	}
 
-	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil, ErrNotFound
+	var next time.Time
+	if _, exists := updates["timestamp"]; exists {
+		if next, err = refreshLastReminder(tx, existing.HabitID); err != nil {
+			return nil, err
 		}
-		return nil, fmt.Errorf("failed to get reminder: %w", err)
 	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit tracking entry update: %w", err)
+	}
+	db.notifyReminder(next)
 
-	return reminder, nil
+	return db.GetTrackingEntry(userID, id)
 }
 
-func (db *SQLiteDatabase) UpdateReminderLastReminder(habitID string, lastReminder string) error {
-	query := `UPDATE reminders SET last_reminder = ? WHERE habit_id = ?`
+func (db *SQLiteDatabase) DeleteTrackingEntry(userID, id string) error {
+	entry, err := db.GetTrackingEntry(userID, id)
+	if err != nil {
+		return err
+	}
 
-	result, err := db.db.Exec(query, lastReminder, habitID)
+	tx, err := db.db.Begin()
 	if err != nil {
-		return fmt.Errorf("failed to update reminder: %w", err)
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// GetTrackingEntry has already checked ownership
+	result, err := tx.Exec(`DELETE FROM tracking_entries WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete tracking entry: %w", err)
 	}
 
 	rowsAffected, err := result.RowsAffected()
@@ -428,44 +711,215 @@ func (db *SQLiteDatabase) UpdateReminderLastReminder(habitID string, lastReminde
 		return ErrNotFound
 	}
 
+	next, err := refreshLastReminder(tx, entry.HabitID)
+	if err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit tracking entry deletion: %w", err)
+	}
+	db.notifyReminder(next)
 	return nil
 }
 
-func (db *SQLiteDatabase) GetHabitsNeedingReminders() ([]*Habit, error) {
-	query := `
-		SELECT h.id, h.name, h.description, h.frequency, h.start_date, r.last_reminder
-		FROM habits h
-		JOIN reminders r ON h.id = r.habit_id
-	`
+// refreshLastReminder points a habit's reminder at its last activity after
+// its entries changed, and reschedules it
+func refreshLastReminder(tx *sql.Tx, habitID string) (time.Time, error) {
+	var startDate sql.NullString
+	if err := tx.QueryRow(`SELECT start_date FROM habits WHERE id = ?`, habitID).Scan(&startDate); err != nil {
+		return time.Time{}, fmt.Errorf("failed to get habit start date: %w", err)
+	}
 
-	rows, err := db.db.Query(query)
+	var checkIns []string
+	rows, err := tx.Query(`SELECT timestamp FROM tracking_entries WHERE habit_id = ?`, habitID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to query habits with reminders: %w", err)
+		return time.Time{}, fmt.Errorf("failed to query tracking entries: %w", err)
 	}
 	defer rows.Close()
-
-	var needingReminders []*Habit
-	now := time.Now()
-
 	for rows.Next() {
-		habit := &Habit{}
-		var frequencyStr, lastReminderStr string
-		err := rows.Scan(&habit.ID, &habit.Name, &habit.Description, &frequencyStr, &habit.StartDate, &lastReminderStr)
-		if err != nil {
-			return nil, fmt.Errorf("failed to scan habit: %w", err)
+		var timestamp string
+		if err := rows.Scan(&timestamp); err != nil {
+			return time.Time{}, fmt.Errorf("failed to scan tracking entry: %w", err)
 		}
+		checkIns = append(checkIns, timestamp)
+	}
+	if err := rows.Err(); err != nil {
+		return time.Time{}, fmt.Errorf("error iterating tracking entries: %w", err)
+	}
+	rows.Close()
 
-		habit.Frequency = Frequency(frequencyStr)
+	var sent []time.Time
+	sends, err := tx.Query(`SELECT sent_at FROM reminder_sends WHERE habit_id = ? AND sent_at != ''`, habitID)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to query reminder sends: %w", err)
+	}
+	defer sends.Close()
+	for sends.Next() {
+		var sentAt string
+		if err := sends.Scan(&sentAt); err != nil {
+			return time.Time{}, fmt.Errorf("failed to scan reminder send: %w", err)
+		}
+		if at, err := time.Parse(notificationTimeFormat, sentAt); err == nil {
+			sent = append(sent, at)
+		}
+	}
+	if err := sends.Err(); err != nil {
+		return time.Time{}, fmt.Errorf("error iterating reminder sends: %w", err)
+	}
+	sends.Close()
 
-		lastReminder, err := time.Parse(time.RFC3339, lastReminderStr)
-		if err != nil {
-			continue
+	last := lastActivity(startDate.String, checkIns, sent)
+	_, err = tx.Exec(`UPDATE reminders SET last_reminder = ? WHERE habit_id = ?`, last.Format(time.RFC3339), habitID)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to update reminder: %w", err)
+	}
+	return reschedule(tx, "h.id = ?", habitID)
+}
+
+func (db *SQLiteDatabase) CreateReminder(userID string, reminder *Reminder) error {
+	query := `
+		INSERT INTO reminders (id, habit_id, last_reminder)
+		SELECT ?, id, ? FROM habits WHERE id = ? AND user_id = ?
+	`
+
+	result, err := db.db.Exec(query, reminder.ID, reminder.LastReminder, reminder.HabitID, userID)
+	if err != nil {
+		if sqliteError, ok := err.(interface{ Error() string }); ok {
+			if ContainsString(sqliteError.Error(), "UNIQUE constraint failed") {
+				return ErrDuplicate
+			}
+		}
+		return fmt.Errorf("failed to create reminder: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	return db.rescheduleReminders("h.id = ?", reminder.HabitID)
+}
+
+func (db *SQLiteDatabase) GetReminder(userID, habitID string) (*Reminder, error) {
+	query := `
+		SELECT r.id, r.habit_id, r.last_reminder, r.snoozed_until, COALESCE(r.next_reminder, '')
+		FROM reminders r
+		JOIN habits h ON h.id = r.habit_id
+		WHERE r.habit_id = ? AND h.user_id = ?
+	`
+
+	reminder := &Reminder{}
+	err := db.db.QueryRow(query, habitID, userID).Scan(
+		&reminder.ID, &reminder.HabitID, &reminder.LastReminder, &reminder.SnoozedUntil, &reminder.NextReminder,
+	)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrNotFound
 		}
+		return nil, fmt.Errorf("failed to get reminder: %w", err)
+	}
 
-		nextReminderTime := CalculateNextReminderTime(lastReminder, habit.Frequency)
-		if now.After(nextReminderTime) {
-			needingReminders = append(needingReminders, habit)
+	return reminder, nil
+}
+
+func (db *SQLiteDatabase) GetReminderByID(userID, id string) (*Reminder, error) {
+	query := `
+		SELECT r.id, r.habit_id, r.last_reminder, r.snoozed_until, COALESCE(r.next_reminder, '')
+		FROM reminders r
+		JOIN habits h ON h.id = r.habit_id
+		WHERE r.id = ? AND h.user_id = ?
+	`
+
+	reminder := &Reminder{}
+	err := db.db.QueryRow(query, id, userID).Scan(
+		&reminder.ID, &reminder.HabitID, &reminder.LastReminder, &reminder.SnoozedUntil, &reminder.NextReminder,
+	)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrNotFound
 		}
+		return nil, fmt.Errorf("failed to get reminder: %w", err)
+	}
+
+	return reminder, nil
+}
+
+func (db *SQLiteDatabase) UpdateReminderLastReminder(userID, habitID string, lastReminder string) error {
+	query := `
+		UPDATE reminders SET last_reminder = ?, snoozed_until = ''
+		WHERE habit_id = ? AND habit_id IN (SELECT id FROM habits WHERE user_id = ?)
+	`
+
+	result, err := db.db.Exec(query, lastReminder, habitID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to update reminder: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	return db.rescheduleReminders("h.id = ?", habitID)
+}
+
+func (db *SQLiteDatabase) SnoozeReminder(userID, habitID string, until time.Time) error {
+	query := `
+		UPDATE reminders SET snoozed_until = ?
+		WHERE habit_id = ? AND habit_id IN (SELECT id FROM habits WHERE user_id = ?)
+	`
+
+	result, err := db.db.Exec(query, until.Format(time.RFC3339), habitID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to snooze reminder: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	return db.rescheduleReminders("h.id = ?", habitID)
+}
+
+// GetHabitsNeedingReminders reads only the reminders that are due, through
+// the next_reminder index
+func (db *SQLiteDatabase) GetHabitsNeedingReminders() ([]*Habit, error) {
+	query := `
+		SELECT ` + habitColumns + `
+		FROM reminders r
+		JOIN habits h ON h.id = r.habit_id
+		WHERE r.next_reminder != '' AND r.next_reminder <= ?
+		ORDER BY r.next_reminder
+	`
+
+	rows, err := db.db.Query(query, formatSchedule(time.Now()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query habits with reminders: %w", err)
+	}
+	defer rows.Close()
+
+	var needingReminders []*Habit
+	for rows.Next() {
+		habit, err := scanHabit(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan habit: %w", err)
+		}
+		needingReminders = append(needingReminders, habit)
 	}
 
 	if err = rows.Err(); err != nil {
@@ -475,10 +929,33 @@ func (db *SQLiteDatabase) GetHabitsNeedingReminders() ([]*Habit, error) {
 	return needingReminders, nil
 }
 
-func (db *SQLiteDatabase) DeleteReminder(habitID string) error {
-	query := `DELETE FROM reminders WHERE habit_id = ?`
+func (db *SQLiteDatabase) NextReminderDue() (time.Time, bool, error) {
+	var next sql.NullString
+	err := db.db.QueryRow(`
+		SELECT MIN(r.next_reminder) FROM reminders r JOIN habits h ON h.id = r.habit_id
+		WHERE r.next_reminder != ''
+	`).Scan(&next)
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("failed to get next reminder: %w", err)
+	}
+	if !next.Valid {
+		return time.Time{}, false, nil
+	}
 
-	result, err := db.db.Exec(query, habitID)
+	due, err := time.Parse(scheduleLayout, next.String)
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("failed to parse next reminder: %w", err)
+	}
+	return due, true, nil
+}
+
+func (db *SQLiteDatabase) DeleteReminder(userID, habitID string) error {
+	query := `
+		DELETE FROM reminders
+		WHERE habit_id = ? AND habit_id IN (SELECT id FROM habits WHERE user_id = ?)
+	`
+
+	result, err := db.db.Exec(query, habitID, userID)
 	if err != nil {
 		return fmt.Errorf("failed to delete reminder: %w", err)
 	}
@@ -497,335 +974,477 @@ func (db *SQLiteDatabase) DeleteReminder(habitID string) error {
 
 // Statistics and Analytics Methods
 
-func (db *SQLiteDatabase) GetHabitStats(habitID string) (*HabitStats, error) {
-	// Get basic habit info
-	habit, err := db.GetHabit(habitID)
+func (db *SQLiteDatabase) GetHabitStats(userID, habitID string) (*HabitStats, error) {
+	habit, err := db.GetHabit(userID, habitID)
 	if err != nil {
 		return nil, err
 	}
 
-	stats := &HabitStats{
-		HabitID:   habitID,
-		HabitName: habit.Name,
-		Frequency: habit.Frequency,
-		StartDate: habit.StartDate,
+	entries, err := db.GetTrackingEntriesByHabitID(userID, habitID)
+	if err != nil {
+		return nil, err
 	}
 
-	// Get total entries count
-	countQuery := `SELECT COUNT(*) FROM tracking_entries WHERE habit_id = ?`
-	err = db.db.QueryRow(countQuery, habitID).Scan(&stats.TotalEntries)
+	cal, err := db.calendar(userID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get total entries: %w", err)
+		return nil, err
 	}
 
-	// Get current streak
-	stats.CurrentStreak = db.calculateCurrentStreak(habitID, habit.Frequency)
-
-	// Get longest streak
-	stats.LongestStreak = db.calculateLongestStreak(habitID, habit.Frequency)
+	return buildHabitStats(habit, entries, cal, time.Now()), nil
+}
 
-	// Get completion rate
-	stats.CompletionRate = db.calculateCompletionRate(habitID, habit.Frequency, habit.StartDate)
+func (db *SQLiteDatabase) GetHabitProgress(userID, habitID string, days int) ([]*ProgressPoint, error) {
+	entries, err := db.GetTrackingEntriesByHabitID(userID, habitID)
+	if err != nil {
+		return nil, err
+	}
 
-	// Get last completed date
-	lastQuery := `SELECT MAX(timestamp) FROM tracking_entries WHERE habit_id = ?`
-	var lastCompleted sql.NullString
-	err = db.db.QueryRow(lastQuery, habitID).Scan(&lastCompleted)
-	if err == nil && lastCompleted.Valid {
-		stats.LastCompleted = lastCompleted.String
+	cal, err := db.calendar(userID)
+	if err != nil {
+		return nil, err
 	}
 
-	return stats, nil
+	return buildHabitProgress(entries, days, cal, time.Now()), nil
 }
 
-func (db *SQLiteDatabase) GetHabitProgress(habitID string, days int) ([]*ProgressPoint, error) {
-	startDate := time.Now().AddDate(0, 0, -days).Format("2006-01-02")
-
-	query := `
-		SELECT DATE(timestamp) as date, COUNT(*) as count
-		FROM tracking_entries 
-		WHERE habit_id = ? AND DATE(timestamp) >= ?
-		GROUP BY DATE(timestamp)
-		ORDER BY DATE(timestamp)
-	`
+func (db *SQLiteDatabase) GetOverallStats(userID string) (*OverallStats, error) {
+	habits, err := db.GetAllHabits(userID)
+	if err != nil {
+		return nil, err
+	}
 
-	rows, err := db.db.Query(query, habitID, startDate)
+	entries, err := db.getUserTrackingEntries(userID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to query progress: %w", err)
+		return nil, err
 	}
-	defer rows.Close()
 
-	var progress []*ProgressPoint
-	for rows.Next() {
-		point := &ProgressPoint{}
-		err := rows.Scan(&point.Date, &point.Count)
-		if err != nil {
-			return nil, fmt.Errorf("failed to scan progress point: %w", err)
-		}
-		progress = append(progress, point)
+	cal, err := db.calendar(userID)
+	if err != nil {
+		return nil, err
 	}
 
-	return progress, nil
+	return buildOverallStats(habits, entries, cal, time.Now()), nil
 }
 
-func (db *SQLiteDatabase) GetOverallStats() (*OverallStats, error) {
-	stats := &OverallStats{}
-
-	// Total habits
-	habitsQuery := `SELECT COUNT(*) FROM habits`
-	err := db.db.QueryRow(habitsQuery).Scan(&stats.TotalHabits)
+func (db *SQLiteDatabase) GetHabitCompletionRates(userID string, days int) ([]*HabitCompletionRate, error) {
+	habits, err := db.GetAllHabits(userID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get total habits: %w", err)
+		return nil, err
 	}
 
-	// Total entries
-	entriesQuery := `SELECT COUNT(*) FROM tracking_entries`
-	err = db.db.QueryRow(entriesQuery).Scan(&stats.TotalEntries)
+	entries, err := db.getUserTrackingEntries(userID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get total entries: %w", err)
+		return nil, err
 	}
 
-	// Entries today
-	todayQuery := `SELECT COUNT(*) FROM tracking_entries WHERE DATE(timestamp) = DATE('now')`
-	err = db.db.QueryRow(todayQuery).Scan(&stats.EntriesToday)
+	cal, err := db.calendar(userID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get today's entries: %w", err)
+		return nil, err
 	}
 
-	// Entries this week
-	weekQuery := `
-		SELECT COUNT(*) FROM tracking_entries 
-		WHERE DATE(timestamp) >= DATE('now', '-6 days')
-	`
-	err = db.db.QueryRow(weekQuery).Scan(&stats.EntriesThisWeek)
+	return buildCompletionRates(habits, entries, days, cal, time.Now()), nil
+}
+
+func (db *SQLiteDatabase) GetDailyCompletions(userID string, days int) ([]*DailyCompletion, error) {
+	entries, err := db.getUserTrackingEntries(userID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get this week's entries: %w", err)
+		return nil, err
 	}
 
-	// Average entries per day (last 30 days)
-	avgQuery := `
-		SELECT CAST(COUNT(*) AS FLOAT) / 30 FROM tracking_entries 
-		WHERE DATE(timestamp) >= DATE('now', '-30 days')
-	`
-	err = db.db.QueryRow(avgQuery).Scan(&stats.AvgEntriesPerDay)
+	cal, err := db.calendar(userID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get average entries: %w", err)
+		return nil, err
 	}
 
-	return stats, nil
+	return buildDailyCompletions(entries, days, cal, time.Now()), nil
+}
+
+// Helper methods for calculations
+
+// calendar returns the time zone and week start of userID. Users without a
+// stored profile get DefaultCalendar.
+func (db *SQLiteDatabase) calendar(userID string) (Calendar, error) {
+	user := &User{}
+	err := db.db.QueryRow(`SELECT timezone, week_start FROM users WHERE id = ?`, userID).Scan(&user.Timezone, &user.WeekStart)
+	if err == sql.ErrNoRows {
+		return DefaultCalendar, nil
+	}
+	if err != nil {
+		return Calendar{}, fmt.Errorf("failed to get user calendar: %w", err)
+	}
+	return user.Calendar(), nil
 }
 
-func (db *SQLiteDatabase) GetHabitCompletionRates(days int) ([]*HabitCompletionRate, error) {
-	startDate := time.Now().AddDate(0, 0, -days).Format("2006-01-02")
+// checkHabitOwner returns ErrNotFound unless the habit exists and belongs to userID
+func (db *SQLiteDatabase) checkHabitOwner(userID, habitID string) error {
+	var exists int
+	err := db.db.QueryRow(`SELECT 1 FROM habits WHERE id = ? AND user_id = ?`, habitID, userID).Scan(&exists)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return ErrNotFound
+		}
+		return fmt.Errorf("failed to check habit owner: %w", err)
+	}
+	return nil
+}
 
+// getUserTrackingEntries returns the tracking entries of every habit owned by userID
+func (db *SQLiteDatabase) getUserTrackingEntries(userID string) ([]*TrackingEntry, error) {
 	query := `
-		SELECT h.id, h.name, h.frequency, h.start_date,
-			   COUNT(te.id) as actual_completions
-		FROM habits h
-		LEFT JOIN tracking_entries te ON h.id = te.habit_id 
-			AND DATE(te.timestamp) >= ?
-		GROUP BY h.id, h.name, h.frequency, h.start_date
-		ORDER BY h.name
+		SELECT te.id, te.habit_id, te.timestamp, te.note, te.value
+		FROM tracking_entries te
+		JOIN habits h ON h.id = te.habit_id
+		WHERE h.user_id = ?
 	`
 
-	rows, err := db.db.Query(query, startDate)
+	rows, err := db.db.Query(query, userID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to query completion rates: %w", err)
+		return nil, fmt.Errorf("failed to query tracking entries: %w", err)
 	}
 	defer rows.Close()
 
-	var rates []*HabitCompletionRate
+	var entries []*TrackingEntry
 	for rows.Next() {
-		rate := &HabitCompletionRate{}
-		var frequencyStr string
-		err := rows.Scan(&rate.HabitID, &rate.HabitName, &frequencyStr, &rate.StartDate, &rate.ActualCompletions)
+		entry := &TrackingEntry{}
+		err := rows.Scan(&entry.ID, &entry.HabitID, &entry.Timestamp, &entry.Note, &entry.Value)
 		if err != nil {
-			return nil, fmt.Errorf("failed to scan completion rate: %w", err)
+			return nil, fmt.Errorf("failed to scan tracking entry: %w", err)
 		}
+		entries = append(entries, entry)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating tracking entries: %w", err)
+	}
+
+	return entries, nil
+}
+
+// Reminder Action Methods
 
-		rate.Frequency = Frequency(frequencyStr)
-		rate.ExpectedCompletions = db.calculateExpectedCompletions(Frequency(frequencyStr), days)
+func (db *SQLiteDatabase) CreateReminderAction(action *ReminderAction) error {
+	if action.ID == "" {
+		action.ID = generateUUID()
+	}
+
+	// Only habits owned by the user can have actions recorded
+	query := `
+		INSERT INTO reminder_actions (id, user_id, habit_id, notification_id, action, until, created_at)
+		SELECT ?, user_id, id, ?, ?, ?, ? FROM habits WHERE id = ? AND user_id = ?
+	`
 
-		if rate.ExpectedCompletions > 0 {
-			rate.CompletionRate = float64(rate.ActualCompletions) / float64(rate.ExpectedCompletions)
+	result, err := db.db.Exec(query, action.ID, action.NotificationID, string(action.Action),
+		action.Until.UTC().Format(notificationTimeFormat), action.CreatedAt.UTC().Format(notificationTimeFormat),
+		action.HabitID, action.UserID)
+	if err != nil {
+		if ContainsString(err.Error(), "UNIQUE constraint failed") {
+			return ErrDuplicate
 		}
+		return fmt.Errorf("failed to create reminder action: %w", err)
+	}
 
-		rates = append(rates, rate)
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return ErrNotFound
 	}
 
-	return rates, nil
+	return nil
 }
 
-func (db *SQLiteDatabase) GetDailyCompletions(days int) ([]*DailyCompletion, error) {
-	startDate := time.Now().AddDate(0, 0, -days).Format("2006-01-02")
+func (db *SQLiteDatabase) GetReminderActions(userID, habitID string) ([]*ReminderAction, error) {
+	if _, err := db.GetHabit(userID, habitID); err != nil {
+		return nil, err
+	}
 
 	query := `
-		SELECT DATE(timestamp) as date, COUNT(*) as completions
-		FROM tracking_entries 
-		WHERE DATE(timestamp) >= ?
-		GROUP BY DATE(timestamp)
-		ORDER BY DATE(timestamp)
+		SELECT id, user_id, habit_id, notification_id, action, until, created_at
+		FROM reminder_actions
+		WHERE habit_id = ? AND user_id = ?
+		ORDER BY created_at DESC, rowid DESC
 	`
 
-	rows, err := db.db.Query(query, startDate)
+	rows, err := db.db.Query(query, habitID, userID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to query daily completions: %w", err)
+		return nil, fmt.Errorf("failed to get reminder actions: %w", err)
 	}
 	defer rows.Close()
 
-	var completions []*DailyCompletion
+	actions := []*ReminderAction{}
 	for rows.Next() {
-		completion := &DailyCompletion{}
-		err := rows.Scan(&completion.Date, &completion.Completions)
-		if err != nil {
-			return nil, fmt.Errorf("failed to scan daily completion: %w", err)
+		action := &ReminderAction{}
+		var untilStr, createdAtStr string
+		if err := rows.Scan(&action.ID, &action.UserID, &action.HabitID, &action.NotificationID, &action.Action,
+			&untilStr, &createdAtStr); err != nil {
+			return nil, fmt.Errorf("failed to scan reminder action: %w", err)
+		}
+		if action.Until, err = time.Parse(time.RFC3339Nano, untilStr); err != nil {
+			return nil, fmt.Errorf("failed to parse until: %w", err)
+		}
+		if action.CreatedAt, err = time.Parse(time.RFC3339Nano, createdAtStr); err != nil {
+			return nil, fmt.Errorf("failed to parse created_at: %w", err)
 		}
-		completions = append(completions, completion)
+		actions = append(actions, action)
 	}
 
-	return completions, nil
+	return actions, rows.Err()
 }
 
-// Helper methods for calculations
+// Reminder Send Methods
+
+func (db *SQLiteDatabase) ClaimReminderSend(send *ReminderSend, staleBefore time.Time) (bool, error) {
+	if send.ID == "" {
+		send.ID = generateUUID()
+	}
+	if send.NotificationID == "" {
+		send.NotificationID = generateUUID()
+	}
+	dueAt := send.DueAt.UTC().Format(notificationTimeFormat)
 
-func (db *SQLiteDatabase) calculateCurrentStreak(habitID string, frequency Frequency) int {
-	// Implementation depends on frequency - for now, let's do daily streaks
+	// Pending sends are taken over from workers that claimed them too long ago
 	query := `
-		SELECT DATE(timestamp) FROM tracking_entries 
-		WHERE habit_id = ? 
-		ORDER BY timestamp DESC
+		INSERT INTO reminder_sends (id, user_id, habit_id, due_at, notification_id, worker, claimed_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (habit_id, due_at) DO UPDATE SET worker = excluded.worker, claimed_at = excluded.claimed_at
+		WHERE reminder_sends.sent_at = ''
+			AND (reminder_sends.worker = excluded.worker OR reminder_sends.claimed_at <= ?)
 	`
 
-	rows, err := db.db.Query(query, habitID)
+	result, err := db.db.Exec(query, send.ID, send.UserID, send.HabitID, dueAt, send.NotificationID, send.Worker,
+		send.ClaimedAt.UTC().Format(notificationTimeFormat), staleBefore.UTC().Format(notificationTimeFormat))
 	if err != nil {
-		return 0
+		return false, fmt.Errorf("failed to claim reminder send: %w", err)
 	}
-	defer rows.Close()
 
-	var dates []string
-	for rows.Next() {
-		var date string
-		if err := rows.Scan(&date); err == nil {
-			dates = append(dates, date)
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		var sentAt string
+		err := db.db.QueryRow(`SELECT sent_at FROM reminder_sends WHERE habit_id = ? AND due_at = ?`,
+			send.HabitID, dueAt).Scan(&sentAt)
+		if err != nil {
+			return false, fmt.Errorf("failed to read reminder send: %w", err)
+		}
+		if sentAt != "" {
+			if send.SentAt, err = time.Parse(notificationTimeFormat, sentAt); err != nil {
+				return false, fmt.Errorf("failed to parse sent time: %w", err)
+			}
 		}
+		return false, nil
+	}
+
+	// A send that was taken over keeps its ID and inbox entry
+	err = db.db.QueryRow(`SELECT id, notification_id FROM reminder_sends WHERE habit_id = ? AND due_at = ?`,
+		send.HabitID, dueAt).Scan(&send.ID, &send.NotificationID)
+	if err != nil {
+		return false, fmt.Errorf("failed to read reminder send: %w", err)
+	}
+
+	return true, nil
+}
+
+func (db *SQLiteDatabase) CompleteReminderSend(send *ReminderSend, sentAt time.Time) error {
+	tx, err := db.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
 	}
+	defer tx.Rollback()
 
-	if len(dates) == 0 {
-		return 0
+	result, err := tx.Exec(`UPDATE reminder_sends SET sent_at = ? WHERE id = ? AND sent_at = ''`,
+		sentAt.UTC().Format(notificationTimeFormat), send.ID)
+	if err != nil {
+		return fmt.Errorf("failed to complete reminder send: %w", err)
 	}
 
-	// Remove duplicates and sort
-	uniqueDates := make(map[string]bool)
-	for _, date := range dates {
-		uniqueDates[date] = true
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
 	}
 
-	today := time.Now().Format("2006-01-02")
-	currentDate, _ := time.Parse("2006-01-02", today)
-	streak := 0
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
 
-	for {
-		dateStr := currentDate.Format("2006-01-02")
-		if uniqueDates[dateStr] {
-			streak++
-			currentDate = currentDate.AddDate(0, 0, -1)
-		} else {
-			break
-		}
+	_, err = tx.Exec(`UPDATE reminders SET last_reminder = ?, snoozed_until = '' WHERE habit_id = ?`,
+		sentAt.Format(time.RFC3339), send.HabitID)
+	if err != nil {
+		return fmt.Errorf("failed to update reminder: %w", err)
 	}
 
-	return streak
+	next, err := reschedule(tx, "h.id = ?", send.HabitID)
+	if err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	db.notifyReminder(next)
+	return nil
 }
 
-func (db *SQLiteDatabase) calculateLongestStreak(habitID string, frequency Frequency) int {
-	// Simplified implementation - can be enhanced based on frequency
+// Lease Methods
+
+func (db *SQLiteDatabase) AcquireLease(name, holder string, ttl time.Duration) (bool, error) {
+	now := time.Now()
+
+	// The holder renews its own lease; anyone may take over an expired one
 	query := `
-		SELECT DISTINCT DATE(timestamp) FROM tracking_entries 
-		WHERE habit_id = ? 
-		ORDER BY DATE(timestamp)
+		INSERT INTO leases (name, holder, expires_at) VALUES (?, ?, ?)
+		ON CONFLICT (name) DO UPDATE SET holder = excluded.holder, expires_at = excluded.expires_at
+		WHERE leases.holder = excluded.holder OR leases.expires_at <= ?
 	`
 
-	rows, err := db.db.Query(query, habitID)
+	result, err := db.db.Exec(query, name, holder, now.Add(ttl).UTC().Format(notificationTimeFormat),
+		now.UTC().Format(notificationTimeFormat))
 	if err != nil {
-		return 0
+		return false, fmt.Errorf("failed to acquire lease: %w", err)
 	}
-	defer rows.Close()
 
-	var dates []time.Time
-	for rows.Next() {
-		var dateStr string
-		if err := rows.Scan(&dateStr); err == nil {
-			if date, err := time.Parse("2006-01-02", dateStr); err == nil {
-				dates = append(dates, date)
-			}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	return rowsAffected > 0, nil
+}
+
+func (db *SQLiteDatabase) ReleaseLease(name, holder string) error {
+	if _, err := db.db.Exec(`DELETE FROM leases WHERE name = ? AND holder = ?`, name, holder); err != nil {
+		return fmt.Errorf("failed to release lease: %w", err)
+	}
+
+	return nil
+}
+
+// Notification Methods
+
+const notificationColumns = `id, user_id, habit_id, type, subject, body, data, read, dismissed, created_at`
+
+// notificationTimeFormat has fixed-width fractions so created_at sorts as text
+const notificationTimeFormat = "2006-01-02T15:04:05.000000000Z07:00"
+
+func scanNotification(row interface{ Scan(...interface{}) error }) (*Notification, error) {
+	notification := &Notification{}
+	var data, createdAtStr string
+	err := row.Scan(&notification.ID, &notification.UserID, &notification.HabitID, &notification.Type,
+		&notification.Subject, &notification.Body, &data, &notification.Read, &notification.Dismissed, &createdAtStr)
+	if err != nil {
+		return nil, err
+	}
+
+	if data != "" {
+		notification.Data = json.RawMessage(data)
+	}
+	if notification.CreatedAt, err = time.Parse(time.RFC3339Nano, createdAtStr); err != nil {
+		return nil, fmt.Errorf("failed to parse created_at: %w", err)
+	}
+	return notification, nil
+}
+
+func (db *SQLiteDatabase) CreateNotification(notification *Notification) error {
+	if notification.ID == "" {
+		notification.ID = generateUUID()
+	}
+
+	query := `INSERT INTO notifications (` + notificationColumns + `) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+	_, err := db.db.Exec(query, notification.ID, notification.UserID, notification.HabitID, notification.Type,
+		notification.Subject, notification.Body, string(notification.Data), notification.Read, notification.Dismissed,
+		notification.CreatedAt.UTC().Format(notificationTimeFormat))
+	if err != nil {
+		if ContainsString(err.Error(), "UNIQUE constraint failed") {
+			return ErrDuplicate
 		}
+		return fmt.Errorf("failed to create notification: %w", err)
 	}
 
-	if len(dates) == 0 {
-		return 0
+	return nil
+}
+
+func (db *SQLiteDatabase) GetNotification(userID, id string) (*Notification, error) {
+	query := `SELECT ` + notificationColumns + ` FROM notifications WHERE id = ? AND user_id = ?`
+
+	notification, err := scanNotification(db.db.QueryRow(query, id, userID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to get notification: %w", err)
 	}
 
-	maxStreak := 1
-	currentStreak := 1
+	return notification, nil
+}
 
-	for i := 1; i < len(dates); i++ {
-		if dates[i].Sub(dates[i-1]).Hours() == 24 {
-			currentStreak++
-			if currentStreak > maxStreak {
-				maxStreak = currentStreak
-			}
-		} else {
-			currentStreak = 1
+func (db *SQLiteDatabase) GetNotifications(userID string, unreadOnly bool) ([]*Notification, error) {
+	query := `SELECT ` + notificationColumns + ` FROM notifications WHERE user_id = ? AND dismissed = 0`
+	if unreadOnly {
+		query += ` AND read = 0`
+	}
+	query += ` ORDER BY created_at DESC, rowid DESC`
+
+	rows, err := db.db.Query(query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get notifications: %w", err)
+	}
+	defer rows.Close()
+
+	notifications := []*Notification{}
+	for rows.Next() {
+		notification, err := scanNotification(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan notification: %w", err)
 		}
+		notifications = append(notifications, notification)
 	}
 
-	return maxStreak
+	return notifications, rows.Err()
 }
 
-func (db *SQLiteDatabase) calculateCompletionRate(habitID string, frequency Frequency, startDate string) float64 {
-	start, err := time.Parse("2006-01-02", startDate[:10])
+func (db *SQLiteDatabase) UpdateNotificationPartial(userID, id string, updates map[string]interface{}) (*Notification, error) {
+	existing, err := db.GetNotification(userID, id)
 	if err != nil {
-		return 0.0
+		return nil, err
 	}
 
-	daysSinceStart := int(time.Since(start).Hours() / 24)
-	if daysSinceStart <= 0 {
-		return 0.0
+	setParts := []string{}
+	args := []interface{}{}
+	for _, field := range []string{"read", "dismissed"} {
+		if flag, ok := updates[field].(bool); ok {
+			setParts = append(setParts, field+" = ?")
+			args = append(args, flag)
+		}
 	}
 
-	query := `SELECT COUNT(*) FROM tracking_entries WHERE habit_id = ?`
-	var actualCompletions int
-	if err := db.db.QueryRow(query, habitID).Scan(&actualCompletions); err != nil {
-		return 0.0
+	if len(setParts) == 0 {
+		return existing, nil
 	}
 
-	expectedCompletions := db.calculateExpectedCompletions(frequency, daysSinceStart)
-	if expectedCompletions == 0 {
-		return 0.0
+	args = append(args, id, userID)
+	query := fmt.Sprintf("UPDATE notifications SET %s WHERE id = ? AND user_id = ?", strings.Join(setParts, ", "))
+	if _, err := db.db.Exec(query, args...); err != nil {
+		return nil, fmt.Errorf("failed to update notification: %w", err)
 	}
 
-	return float64(actualCompletions) / float64(expectedCompletions)
+	return db.GetNotification(userID, id)
 }
 
-func (db *SQLiteDatabase) calculateExpectedCompletions(frequency Frequency, days int) int {
-	switch frequency {
-	case FrequencyDaily:
-		return days
-	case FrequencyWeekly:
-		return days / 7
-	case FrequencyBiweekly:
-		return days / 14
-	case FrequencyMonthly:
-		return days / 30
-	case FrequencyQuarterly:
-		return days / 90
-	case FrequencyYearly:
-		return days / 365
-	case FrequencyHourly:
-		return days * 24 // Assuming once per hour per day
-	default:
-		return days // Default to daily
+func (db *SQLiteDatabase) MarkAllNotificationsRead(userID string) (int, error) {
+	result, err := db.db.Exec(`UPDATE notifications SET read = 1 WHERE user_id = ? AND dismissed = 0 AND read = 0`, userID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to mark notifications read: %w", err)
+	}
+
+	marked, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get rows affected: %w", err)
 	}
+	return int(marked), nil
 }
 
 // User Management Methods
@@ -837,12 +1456,13 @@ func (db *SQLiteDatabase) CreateUser(user *User) error {
 	}
 
 	query := `
-		INSERT INTO users (id, email, username, password_hash, created_at, updated_at)
-		VALUES (?, ?, ?, ?, ?, ?)
+		INSERT INTO users (id, email, username, password_hash, timezone, week_start, quiet_hours_start, quiet_hours_end,
+			created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
 
-	_, err := db.db.Exec(query, user.ID, user.Email, user.Username, user.PasswordHash,
-		user.CreatedAt.Format(time.RFC3339), user.UpdatedAt.Format(time.RFC3339))
+	_, err := db.db.Exec(query, user.ID, user.Email, user.Username, user.PasswordHash, user.Timezone, user.WeekStart,
+		user.QuietHoursStart, user.QuietHoursEnd, user.CreatedAt.Format(time.RFC3339), user.UpdatedAt.Format(time.RFC3339))
 	if err != nil {
 		if sqliteError, ok := err.(interface{ Error() string }); ok {
 			errorMsg := sqliteError.Error()
@@ -859,16 +1479,19 @@ func (db *SQLiteDatabase) CreateUser(user *User) error {
 		return fmt.Errorf("failed to create user: %w", err)
 	}
 
-	return nil
+	// Habits keep to their owner's time zone and quiet hours
+	return db.rescheduleReminders("h.user_id = ?", user.ID)
 }
 
 func (db *SQLiteDatabase) GetUserByEmail(email string) (*User, error) {
-	query := `SELECT id, email, username, password_hash, created_at, updated_at FROM users WHERE email = ?`
+	query := `SELECT id, email, username, password_hash, timezone, week_start, quiet_hours_start, quiet_hours_end,
+		created_at, updated_at FROM users WHERE email = ?`
 
 	user := &User{}
 	var createdAtStr, updatedAtStr string
 	err := db.db.QueryRow(query, email).Scan(
-		&user.ID, &user.Email, &user.Username, &user.PasswordHash, &createdAtStr, &updatedAtStr,
+		&user.ID, &user.Email, &user.Username, &user.PasswordHash, &user.Timezone, &user.WeekStart,
+		&user.QuietHoursStart, &user.QuietHoursEnd, &createdAtStr, &updatedAtStr,
 	)
 
 	if err != nil {
@@ -890,12 +1513,14 @@ func (db *SQLiteDatabase) GetUserByEmail(email string) (*User, error) {
 }
 
 func (db *SQLiteDatabase) GetUserByID(id string) (*User, error) {
-	query := `SELECT id, email, username, password_hash, created_at, updated_at FROM users WHERE id = ?`
+	query := `SELECT id, email, username, password_hash, timezone, week_start, quiet_hours_start, quiet_hours_end,
+		created_at, updated_at FROM users WHERE id = ?`
 
 	user := &User{}
 	var createdAtStr, updatedAtStr string
 	err := db.db.QueryRow(query, id).Scan(
-		&user.ID, &user.Email, &user.Username, &user.PasswordHash, &createdAtStr, &updatedAtStr,
+		&user.ID, &user.Email, &user.Username, &user.PasswordHash, &user.Timezone, &user.WeekStart,
+		&user.QuietHoursStart, &user.QuietHoursEnd, &createdAtStr, &updatedAtStr,
 	)
 
 	if err != nil {
@@ -921,12 +1546,13 @@ func (db *SQLiteDatabase) UpdateUser(user *User) error {
 
 	query := `
 		UPDATE users 
-		SET email = ?, username = ?, password_hash = ?, updated_at = ?
+		SET email = ?, username = ?, password_hash = ?, timezone = ?, week_start = ?,
+			quiet_hours_start = ?, quiet_hours_end = ?, updated_at = ?
 		WHERE id = ?
 	`
 
-	result, err := db.db.Exec(query, user.Email, user.Username, user.PasswordHash,
-		user.UpdatedAt.Format(time.RFC3339), user.ID)
+	result, err := db.db.Exec(query, user.Email, user.Username, user.PasswordHash, user.Timezone, user.WeekStart,
+		user.QuietHoursStart, user.QuietHoursEnd, user.UpdatedAt.Format(time.RFC3339), user.ID)
 	if err != nil {
 		return fmt.Errorf("failed to update user: %w", err)
 	}
@@ -940,7 +1566,8 @@ func (db *SQLiteDatabase) UpdateUser(user *User) error {
 		return ErrNotFound
 	}
 
-	return nil
+	// Habits keep to their owner's time zone and quiet hours
+	return db.rescheduleReminders("h.user_id = ?", user.ID)
 }
 
 func (db *SQLiteDatabase) DeleteUser(id string) error {
@@ -960,3 +1587,137 @@ func (db *SQLiteDatabase) DeleteUser(id string) error {
 
 	return nil
 }
+
+// Refresh Token Methods
+
+func (db *SQLiteDatabase) CreateRefreshToken(token *RefreshToken) error {
+	return db.insertRefreshToken(db.db, token)
+}
+
+// insertRefreshToken writes token using either the database or an open transaction
+func (db *SQLiteDatabase) insertRefreshToken(execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}, token *RefreshToken) error {
+	if token.ID == "" {
+		token.ID = generateUUID()
+	}
+
+	query := `
+		INSERT INTO refresh_tokens (id, user_id, family_id, token_hash, expires_at, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`
+
+	// Timestamps are stored in UTC so expires_at can be compared as text
+	_, err := execer.Exec(query, token.ID, token.UserID, token.FamilyID, token.TokenHash,
+		token.ExpiresAt.UTC().Format(time.RFC3339), token.CreatedAt.UTC().Format(time.RFC3339))
+	if err != nil {
+		if ContainsString(err.Error(), "UNIQUE constraint failed") {
+			return ErrDuplicate
+		}
+		return fmt.Errorf("failed to create refresh token: %w", err)
+	}
+
+	return nil
+}
+
+func (db *SQLiteDatabase) GetRefreshTokenByHash(tokenHash string) (*RefreshToken, error) {
+	query := `
+		SELECT id, user_id, family_id, token_hash, expires_at, created_at, revoked_at, replaced_by
+		FROM refresh_tokens WHERE token_hash = ?
+	`
+
+	token := &RefreshToken{}
+	var expiresAtStr, createdAtStr string
+	var revokedAt, replacedBy sql.NullString
+	err := db.db.QueryRow(query, tokenHash).Scan(
+		&token.ID, &token.UserID, &token.FamilyID, &token.TokenHash,
+		&expiresAtStr, &createdAtStr, &revokedAt, &replacedBy,
+	)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to get refresh token: %w", err)
+	}
+
+	if token.ExpiresAt, err = time.Parse(time.RFC3339, expiresAtStr); err != nil {
+		return nil, fmt.Errorf("failed to parse expires_at: %w", err)
+	}
+	if token.CreatedAt, err = time.Parse(time.RFC3339, createdAtStr); err != nil {
+		return nil, fmt.Errorf("failed to parse created_at: %w", err)
+	}
+	if revokedAt.Valid {
+		revokedTime, err := time.Parse(time.RFC3339, revokedAt.String)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse revoked_at: %w", err)
+		}
+		token.RevokedAt = &revokedTime
+	}
+	token.ReplacedBy = replacedBy.String
+
+	return token, nil
+}
+
+func (db *SQLiteDatabase) RotateRefreshToken(oldID string, next *RefreshToken) error {
+	tx, err := db.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if next.ID == "" {
+		next.ID = generateUUID()
+	}
+
+	// Only an unrevoked token can be rotated, so two concurrent refreshes with
+	// the same token cannot both succeed
+	revokeQuery := `
+		UPDATE refresh_tokens SET revoked_at = ?, replaced_by = ?
+		WHERE id = ? AND revoked_at IS NULL
+	`
+
+	result, err := tx.Exec(revokeQuery, time.Now().UTC().Format(time.RFC3339), next.ID, oldID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke refresh token: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	if err := db.insertRefreshToken(tx, next); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (db *SQLiteDatabase) RevokeRefreshTokenFamily(familyID string) error {
+	query := `UPDATE refresh_tokens SET revoked_at = ? WHERE family_id = ? AND revoked_at IS NULL`
+
+	if _, err := db.db.Exec(query, time.Now().UTC().Format(time.RFC3339), familyID); err != nil {
+		return fmt.Errorf("failed to revoke refresh token family: %w", err)
+	}
+
+	return nil
+}
+
+func (db *SQLiteDatabase) IsRefreshTokenFamilyActive(familyID string) (bool, error) {
+	query := `
+		SELECT COUNT(*) FROM refresh_tokens
+		WHERE family_id = ? AND revoked_at IS NULL AND expires_at > ?
+	`
+
+	var count int
+	if err := db.db.QueryRow(query, familyID, time.Now().UTC().Format(time.RFC3339)).Scan(&count); err != nil {
+		return false, fmt.Errorf("failed to check refresh token family: %w", err)
+	}
+
+	return count > 0, nil
+}
@@ -0,0 +1,130 @@
+package db
+
+import (
+	"sort"
+	"time"
+
+	"habit-tracker/server/stats"
+)
+
+// Both backends load habits and entries and hand them to the stats package
+// through these helpers, so they report identical numbers. Every builder works
+// in the owner's calendar: now is converted to its zone, and dates and
+// timestamps stored without a zone are read as local to it.
+
+// statsHabit converts a habit and its tracking entries for the stats package.
+// Entries with unparseable timestamps are ignored.
+func statsHabit(habit *Habit, entries []*TrackingEntry, cal Calendar) stats.Habit {
+	h := stats.Habit{
+		Cadence:     habit.Cadence(cal),
+		Completions: statsCompletions(entries, cal),
+		Target:      habit.Target,
+		Aggregation: habit.Aggregation,
+	}
+	if start, ok := ParseTimestampIn(habit.StartDate, cal.Location); ok {
+		h.Start = start
+	}
+	for _, pause := range habit.Pauses {
+		start, ok := ParseTimestampIn(pause.Start, cal.Location)
+		if !ok {
+			continue
+		}
+		end, _ := ParseTimestampIn(pause.End, cal.Location)
+		h.Pauses = append(h.Pauses, stats.Pause{Start: start, End: end})
+	}
+	return h
+}
+
+func statsCompletions(entries []*TrackingEntry, cal Calendar) []stats.Completion {
+	completions := make([]stats.Completion, 0, len(entries))
+	for _, entry := range entries {
+		if at, ok := ParseTimestampIn(entry.Timestamp, cal.Location); ok {
+			completions = append(completions, stats.Completion{Time: at, Value: entry.Value})
+		}
+	}
+	return completions
+}
+
+// entriesByHabit groups tracking entries by habit ID
+func entriesByHabit(entries []*TrackingEntry) map[string][]*TrackingEntry {
+	grouped := make(map[string][]*TrackingEntry)
+	for _, entry := range entries {
+		grouped[entry.HabitID] = append(grouped[entry.HabitID], entry)
+	}
+	return grouped
+}
+
+func buildHabitStats(habit *Habit, entries []*TrackingEntry, cal Calendar, now time.Time) *HabitStats {
+	summary := stats.Summarize(statsHabit(habit, entries, cal), now.In(cal.Location))
+
+	habitStats := &HabitStats{
+		HabitID:        habit.ID,
+		HabitName:      habit.Name,
+		Frequency:      habit.Frequency,
+		StartDate:      habit.StartDate,
+		TotalEntries:   summary.TotalEntries,
+		CurrentStreak:  summary.CurrentStreak,
+		LongestStreak:  summary.LongestStreak,
+		CompletionRate: summary.CompletionRate,
+	}
+	if !summary.LastCompleted.IsZero() {
+		habitStats.LastCompleted = summary.LastCompleted.Format(time.RFC3339)
+	}
+	return habitStats
+}
+
+func buildHabitProgress(entries []*TrackingEntry, days int, cal Calendar, now time.Time) []*ProgressPoint {
+	var progress []*ProgressPoint
+	for _, day := range stats.DailyCounts(statsCompletions(entries, cal), days, now.In(cal.Location)) {
+		progress = append(progress, &ProgressPoint{Date: day.Date, Count: day.Count, Value: day.Value})
+	}
+	return progress
+}
+
+func buildOverallStats(habits []*Habit, entries []*TrackingEntry, cal Calendar, now time.Time) *OverallStats {
+	grouped := entriesByHabit(entries)
+	statsHabits := make([]stats.Habit, 0, len(habits))
+	for _, habit := range habits {
+		statsHabits = append(statsHabits, statsHabit(habit, grouped[habit.ID], cal))
+	}
+
+	overview := stats.Overall(statsHabits, now.In(cal.Location))
+	return &OverallStats{
+		TotalHabits:      overview.TotalHabits,
+		TotalEntries:     overview.TotalEntries,
+		EntriesToday:     overview.EntriesToday,
+		EntriesThisWeek:  overview.EntriesThisWeek,
+		AvgEntriesPerDay: overview.AvgEntriesPerDay,
+	}
+}
+
+func buildCompletionRates(habits []*Habit, entries []*TrackingEntry, days int, cal Calendar, now time.Time) []*HabitCompletionRate {
+	grouped := entriesByHabit(entries)
+	now = now.In(cal.Location)
+	from := stats.WindowStart(days, now)
+
+	var rates []*HabitCompletionRate
+	for _, habit := range habits {
+		rate := stats.CompletionRate(statsHabit(habit, grouped[habit.ID], cal), from, now)
+		rates = append(rates, &HabitCompletionRate{
+			HabitID:             habit.ID,
+			HabitName:           habit.Name,
+			Frequency:           habit.Frequency,
+			StartDate:           habit.StartDate,
+			ActualCompletions:   rate.ActualCompletions,
+			ExpectedCompletions: rate.ExpectedCompletions,
+			CompletionRate:      rate.CompletionRate,
+		})
+	}
+
+	sort.Slice(rates, func(i, j int) bool { return rates[i].HabitName < rates[j].HabitName })
+	return rates
+}
+
+func buildDailyCompletions(entries []*TrackingEntry, days int, cal Calendar, now time.Time) []*DailyCompletion {
+	var completions []*DailyCompletion
+	for _, day := range stats.DailyCounts(statsCompletions(entries, cal), days, now.In(cal.Location)) {
+		completions = append(completions, &DailyCompletion{Date: day.Date, Completions: day.Count})
+	}
+	return completions
+}
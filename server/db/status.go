@@ -0,0 +1,146 @@
+package db
+
+import (
+	"fmt"
+	"time"
+)
+
+// HabitStatus is where a habit is in its lifecycle
+type HabitStatus string
+
+const (
+	StatusActive   HabitStatus = "active"
+	StatusPaused   HabitStatus = "paused"
+	StatusArchived HabitStatus = "archived"
+)
+
+func (s HabitStatus) IsValid() bool {
+	switch s {
+	case StatusActive, StatusPaused, StatusArchived:
+		return true
+	}
+	return false
+}
+
+// orActive treats the empty status of habits stored before statuses existed as active
+func (s HabitStatus) orActive() HabitStatus {
+	if s == "" {
+		return StatusActive
+	}
+	return s
+}
+
+func ValidateStatus(status string) error {
+	if !HabitStatus(status).IsValid() {
+		return fmt.Errorf("%w: %s", ErrInvalidStatus, status)
+	}
+	return nil
+}
+
+// Pause is a stretch of time in which a habit was paused or archived. An
+// empty End means the pause has not ended.
+type Pause struct {
+	Start string `json:"start"`
+	End   string `json:"end,omitempty"`
+}
+
+// StatusAt returns the habit's status at now, treating a paused habit whose
+// resume date has passed as active. Dates without a zone are read in now's
+// location, so pass the owner's local time.
+func (h *Habit) StatusAt(now time.Time) HabitStatus {
+	if h.Status == StatusPaused {
+		if resume, ok := ParseTimestampIn(h.ResumeDate, now.Location()); ok && !now.Before(resume) {
+			return StatusActive
+		}
+	}
+	return h.Status.orActive()
+}
+
+// refreshStatus applies an elapsed resume date to the habit
+func (h *Habit) refreshStatus(now time.Time) {
+	if status := h.StatusAt(now); status != h.Status {
+		h.Status = status
+		h.ResumeDate = ""
+	}
+}
+
+// SetStatus moves the habit to status at now. Pausing or archiving an active
+// habit opens a pause that ends at resumeDate, if given; reactivating it ends
+// the open pause at now. Only paused habits may have a resume date, and it
+// must be in the future.
+func (h *Habit) SetStatus(status HabitStatus, resumeDate string, now time.Time) error {
+	if !status.IsValid() {
+		return fmt.Errorf("%w: %s", ErrInvalidStatus, status)
+	}
+	if resumeDate != "" {
+		resume, ok := ParseTimestampIn(resumeDate, now.Location())
+		if status != StatusPaused || !ok || !resume.After(now) {
+			return fmt.Errorf("%w: %s", ErrInvalidResumeDate, resumeDate)
+		}
+	}
+
+	h.refreshStatus(now)
+	open := h.openPause(now)
+	nowStr := now.UTC().Format(time.RFC3339)
+
+	switch {
+	case status == StatusActive:
+		if open != nil {
+			open.End = nowStr
+		}
+	case open == nil:
+		h.Pauses = append(h.Pauses, Pause{Start: nowStr, End: resumeDate})
+	default:
+		open.End = resumeDate
+	}
+
+	h.Status = status
+	h.ResumeDate = resumeDate
+	return nil
+}
+
+// openPause returns the pause that has not yet ended at now, if any
+func (h *Habit) openPause(now time.Time) *Pause {
+	if len(h.Pauses) == 0 {
+		return nil
+	}
+	last := &h.Pauses[len(h.Pauses)-1]
+	if end, ok := ParseTimestampIn(last.End, now.Location()); ok && !end.After(now) {
+		return nil
+	}
+	return last
+}
+
+// applyStatusUpdates applies the status and resumeDate fields of a partial
+// update. Leaving the paused state without a new resume date clears it.
+func (h *Habit) applyStatusUpdates(updates map[string]interface{}, now time.Time) (bool, error) {
+	statusValue, hasStatus := updates["status"]
+	resumeValue, hasResume := updates["resumeDate"]
+	if !hasStatus && !hasResume {
+		return false, nil
+	}
+
+	h.refreshStatus(now)
+	status, resumeDate := h.StatusAt(now), h.ResumeDate
+	if hasStatus {
+		statusStr, ok := statusValue.(string)
+		if !ok {
+			return false, fmt.Errorf("%w: %v", ErrInvalidStatus, statusValue)
+		}
+		status = HabitStatus(statusStr)
+		if status != StatusPaused {
+			resumeDate = ""
+		}
+	}
+	if hasResume {
+		if resumeValue == nil {
+			resumeDate = ""
+		} else if resumeStr, ok := resumeValue.(string); ok {
+			resumeDate = resumeStr
+		} else {
+			return false, fmt.Errorf("%w: %v", ErrInvalidResumeDate, resumeValue)
+		}
+	}
+
+	return true, h.SetStatus(status, resumeDate, now)
+}
@@ -7,25 +7,14 @@ import (
 	"github.com/google/uuid"
 )
 
-func CalculateNextReminderTime(lastReminder time.Time, frequency Frequency) time.Time {
-	switch frequency {
-	case FrequencyHourly:
-		return lastReminder.Add(time.Hour)
-	case FrequencyDaily:
-		return lastReminder.AddDate(0, 0, 1)
-	case FrequencyWeekly:
-		return lastReminder.AddDate(0, 0, 7)
-	case FrequencyBiweekly:
-		return lastReminder.AddDate(0, 0, 14)
-	case FrequencyMonthly:
-		return lastReminder.AddDate(0, 1, 0)
-	case FrequencyQuarterly:
-		return lastReminder.AddDate(0, 3, 0)
-	case FrequencyYearly:
-		return lastReminder.AddDate(1, 0, 0)
-	default:
-		return lastReminder.AddDate(0, 0, 1) // Default to daily
-	}
+// Recurrence yields the next time a habit is due after a given time. Both
+// Frequency and Schedule implement it.
+type Recurrence interface {
+	NextOccurrence(after time.Time) time.Time
+}
+
+func CalculateNextReminderTime(lastReminder time.Time, recurrence Recurrence) time.Time {
+	return recurrence.NextOccurrence(lastReminder)
 }
 
 func ContainsString(str, substr string) bool {
@@ -0,0 +1,280 @@
+package db
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Fields of Habit and TrackingEntry declare their rules in a validate tag, a
+// comma-separated list of:
+//
+//	required     a string that is not blank
+//	max=N        a string of at most N characters
+//	min=N        a number no smaller than N
+//	date         a date or timestamp in a layout ParseTimestamp understands
+//	timestamp    like date, but not in the future
+//	frequency    one of the Frequency values
+//	aggregation  one of the Aggregation values
+//	schedule     an RRULE ParseSchedule supports
+//	status       one of the HabitStatus values
+//	fallback     a channel that can stand in for the WebSocket
+//	channels     a list of distinct channels
+//	clocks       a list of distinct HH:MM times of day
+//
+// Fields are reported by their JSON names. Rules other than required pass
+// empty strings.
+
+// FieldError names a field that failed validation and why
+type FieldError struct {
+	Field   string
+	Message string
+}
+
+// ValidationError lists every invalid field of a value. It matches
+// ErrValidation with errors.Is.
+type ValidationError struct {
+	Fields []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, len(e.Fields))
+	for i, field := range e.Fields {
+		messages[i] = field.Message
+	}
+	return fmt.Sprintf("%v: %s", ErrValidation, strings.Join(messages, "; "))
+}
+
+func (e *ValidationError) Is(target error) bool {
+	return target == ErrValidation
+}
+
+// orNil returns the error, or nil if no field was invalid
+func (e *ValidationError) orNil() error {
+	if len(e.Fields) == 0 {
+		return nil
+	}
+	return e
+}
+
+func (e *ValidationError) add(field, message string) {
+	e.Fields = append(e.Fields, FieldError{Field: field, Message: message})
+}
+
+// futureSkew is how far ahead of the server's clock a timestamp may be, to
+// allow for clients whose clocks run fast
+const futureSkew = 5 * time.Minute
+
+// checkRules applies a field's rules to its value, recording any failure
+func checkRules(invalid *ValidationError, name, rules string, value interface{}) {
+	for _, rule := range strings.Split(rules, ",") {
+		rule, arg, _ := strings.Cut(rule, "=")
+		if message := checkRule(rule, arg, value); message != "" {
+			invalid.add(name, name+" "+message)
+			return
+		}
+	}
+}
+
+// checkRule returns why value breaks the rule, or "" if it does not
+func checkRule(rule, arg string, value interface{}) string {
+	switch rule {
+	case "min":
+		number, ok := value.(float64)
+		if !ok {
+			return "must be a number"
+		}
+		limit, _ := strconv.ParseFloat(arg, 64)
+		if number < limit {
+			return fmt.Sprintf("must be at least %v", limit)
+		}
+		return ""
+	case "channels":
+		names, ok := stringList(value)
+		channels := make([]Channel, len(names))
+		for i, name := range names {
+			channels[i] = Channel(name)
+		}
+		if !ok || ValidateChannels(channels) != nil {
+			return "must list distinct channels from websocket, email, webhook, log"
+		}
+		return ""
+	case "clocks":
+		times, ok := stringList(value)
+		if !ok || ValidateReminderTimes(times) != nil {
+			return "must list distinct times of day as HH:MM"
+		}
+		return ""
+	}
+
+	text, ok := value.(string)
+	if !ok {
+		return "must be a string"
+	}
+	switch rule {
+	case "required":
+		if strings.TrimSpace(text) == "" {
+			return "is required"
+		}
+	case "max":
+		limit, _ := strconv.Atoi(arg)
+		if utf8.RuneCountInString(text) > limit {
+			return fmt.Sprintf("must be at most %d characters", limit)
+		}
+	case "date", "timestamp":
+		if text == "" {
+			return ""
+		}
+		at, ok := ParseTimestamp(text)
+		if !ok {
+			return "must be a date such as 2024-01-31 or an RFC 3339 date-time"
+		}
+		if rule == "timestamp" && at.After(time.Now().Add(futureSkew)) {
+			return "must not be in the future"
+		}
+	case "frequency":
+		if text != "" && ValidateFrequency(text) != nil {
+			return "must be one of hourly, daily, weekly, biweekly, monthly, quarterly, yearly"
+		}
+	case "aggregation":
+		if ValidateAggregation(text) != nil {
+			return "must be one of sum, count, max"
+		}
+	case "schedule":
+		if err := ValidateSchedule(text); err != nil {
+			return "is not a supported rule: " + strings.TrimPrefix(err.Error(), ErrInvalidSchedule.Error()+": ")
+		}
+	case "status":
+		if text != "" && ValidateStatus(text) != nil {
+			return "must be one of active, paused, archived"
+		}
+	case "fallback":
+		if ValidateFallbackChannel(text) != nil {
+			return "must be one of email, webhook, log"
+		}
+	}
+	return ""
+}
+
+// stringList returns the strings in a Go slice or a JSON array decoded into an
+// interface{}
+func stringList(value interface{}) ([]string, bool) {
+	list := reflect.ValueOf(value)
+	if list.Kind() != reflect.Slice {
+		return nil, false
+	}
+	items := make([]string, list.Len())
+	for i := range items {
+		item := list.Index(i)
+		if item.Kind() == reflect.Interface {
+			item = item.Elem()
+		}
+		if item.Kind() != reflect.String {
+			return nil, false
+		}
+		items[i] = item.String()
+	}
+	return items, true
+}
+
+// fieldValue returns a struct field's value in the form it has when decoded
+// from JSON into an interface{}
+func fieldValue(field reflect.Value) interface{} {
+	switch field.Kind() {
+	case reflect.String:
+		return field.String()
+	case reflect.Float32, reflect.Float64:
+		return field.Float()
+	case reflect.Int, reflect.Int64:
+		return float64(field.Int())
+	}
+	return field.Interface()
+}
+
+// jsonName returns the name a struct field has in JSON
+func jsonName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if name == "" {
+		return field.Name
+	}
+	return name
+}
+
+// validateStruct checks every tagged field of the struct v points to
+func validateStruct(v interface{}) *ValidationError {
+	invalid := &ValidationError{}
+	value := reflect.ValueOf(v).Elem()
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		if rules := field.Tag.Get("validate"); rules != "" {
+			checkRules(invalid, jsonName(field), rules, fieldValue(value.Field(i)))
+		}
+	}
+	return invalid
+}
+
+// validateUpdates checks the partial updates to a T against the tags of the
+// fields they set. Fields without rules are left to other checks.
+func validateUpdates(t reflect.Type, updates map[string]interface{}) *ValidationError {
+	invalid := &ValidationError{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		rules := field.Tag.Get("validate")
+		if value, exists := updates[jsonName(field)]; exists && rules != "" {
+			checkRules(invalid, jsonName(field), rules, value)
+		}
+	}
+	return invalid
+}
+
+// ValidateHabit checks the fields of a new habit
+func ValidateHabit(habit *Habit) error {
+	return validateStruct(habit).orNil()
+}
+
+// ValidateHabitUpdates checks the fields a partial update sets
+func ValidateHabitUpdates(updates map[string]interface{}) error {
+	return validateUpdates(reflect.TypeOf(Habit{}), updates).orNil()
+}
+
+// ValidateTrackingEntry checks the fields of a new entry for habit. The entry
+// cannot be logged before the day the habit starts in cal.
+func ValidateTrackingEntry(entry *TrackingEntry, habit *Habit, cal Calendar) error {
+	invalid := validateStruct(entry)
+	checkNotBeforeStart(invalid, entry.Timestamp, habit, cal)
+	return invalid.orNil()
+}
+
+// ValidateTrackingUpdates checks the fields a partial update of one of habit's
+// entries sets
+func ValidateTrackingUpdates(updates map[string]interface{}, habit *Habit, cal Calendar) error {
+	invalid := validateUpdates(reflect.TypeOf(TrackingEntry{}), updates)
+	if timestamp, ok := updates["timestamp"].(string); ok {
+		checkNotBeforeStart(invalid, timestamp, habit, cal)
+	}
+	return invalid.orNil()
+}
+
+// checkNotBeforeStart records an entry timestamp from before the day habit
+// starts. Timestamps already found invalid are not reported twice.
+func checkNotBeforeStart(invalid *ValidationError, timestamp string, habit *Habit, cal Calendar) {
+	for _, field := range invalid.Fields {
+		if field.Field == "timestamp" {
+			return
+		}
+	}
+
+	at, ok := ParseTimestampIn(timestamp, cal.Location)
+	start, startOK := ParseTimestampIn(habit.StartDate, cal.Location)
+	if !ok || !startOK {
+		return
+	}
+	start = start.In(cal.Location)
+	startDay := time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, cal.Location)
+	if at.Before(startDay) {
+		invalid.add("timestamp", "timestamp must not be before the habit's start date "+startDay.Format("2006-01-02"))
+	}
+}
@@ -0,0 +1,34 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"habit-tracker/server/problem"
+)
+
+// etagMatches reports whether an If-Match or If-None-Match header lists etag.
+// If-None-Match compares weakly, ignoring W/ prefixes; If-Match compares
+// strongly, so weak tags in it never match.
+func etagMatches(header, etag string, weak bool) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" {
+			return true
+		}
+		if weak {
+			candidate = strings.TrimPrefix(candidate, "W/")
+		}
+		if candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// preconditionFailed writes a 412 for an update whose If-Match names a version
+// of the resource that is no longer current
+func preconditionFailed(w http.ResponseWriter, r *http.Request) {
+	problem.Write(w, r, http.StatusPreconditionFailed, problem.CodePreconditionFailed,
+		"The habit was changed since it was read; fetch it again and retry")
+}
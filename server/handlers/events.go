@@ -0,0 +1,46 @@
+package handlers
+
+import "log"
+
+// Event types pushed to a user's open sockets after their data changes, so
+// their other devices stay in sync
+const (
+	EventHabitCreated    = "habit.created"
+	EventHabitUpdated    = "habit.updated"
+	EventHabitDeleted    = "habit.deleted"
+	EventTrackingCreated = "tracking.created"
+	EventTrackingUpdated = "tracking.updated"
+	EventTrackingDeleted = "tracking.deleted"
+
+	EventReminderSnoozed   = "reminder.snoozed"
+	EventReminderDismissed = "reminder.dismissed"
+)
+
+// EventPublisher delivers an event to every connection a user has open
+type EventPublisher interface {
+	Publish(userID, eventType string, payload interface{}) error
+}
+
+// Events receives an event after each successful change. It is optional.
+var Events EventPublisher
+
+// DeletedPayload identifies a deleted habit or tracking entry
+type DeletedPayload struct {
+	ID      string `json:"id"`
+	HabitID string `json:"habitId,omitempty"`
+}
+
+// publish sends an event to Events
+func publish(userID, eventType string, payload interface{}) {
+	publishTo(Events, userID, eventType, payload)
+}
+
+// publishTo sends an event, logging failures since the change itself succeeded
+func publishTo(events EventPublisher, userID, eventType string, payload interface{}) {
+	if events == nil {
+		return
+	}
+	if err := events.Publish(userID, eventType, payload); err != nil {
+		log.Printf("Error publishing %s event for user %s: %v", eventType, userID, err)
+	}
+}
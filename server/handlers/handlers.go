@@ -2,37 +2,118 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"sort"
 	"strconv"
 	"time"
 
+	"habit-tracker/server/auth"
 	"habit-tracker/server/db"
+	"habit-tracker/server/problem"
+	"habit-tracker/server/reminder"
 
 	"github.com/google/uuid"
 )
 
-func checkParams(w http.ResponseWriter, params map[string]string, requiredParams []string) bool {
+// invalidField writes a 400 naming the one field that failed validation
+func invalidField(w http.ResponseWriter, r *http.Request, field, message string) {
+	problem.Invalid(w, r, message, problem.FieldError{Field: field, Message: message})
+}
+
+// invalidFields writes a 400 listing every field a db validator rejected
+func invalidFields(w http.ResponseWriter, r *http.Request, err error) {
+	var invalid *db.ValidationError
+	if !errors.As(err, &invalid) {
+		problem.Write(w, r, http.StatusInternalServerError, problem.CodeInternal, "Failed to validate request")
+		return
+	}
+
+	fields := make([]problem.FieldError, len(invalid.Fields))
+	for i, field := range invalid.Fields {
+		fields[i] = problem.FieldError{Field: field.Field, Message: field.Message}
+	}
+	detail := fields[0].Message
+	if len(fields) > 1 {
+		detail = fmt.Sprintf("%d fields are invalid", len(fields))
+	}
+	problem.Invalid(w, r, detail, fields...)
+}
+
+// habitCalendar returns a habit and its owner's calendar, writing a 404 or 500
+// when they cannot be loaded
+func habitCalendar(w http.ResponseWriter, r *http.Request, userID, habitID string) (*db.Habit, db.Calendar, bool) {
+	habit, err := Database.GetHabit(userID, habitID)
+	if err != nil {
+		if err == db.ErrNotFound {
+			problem.Write(w, r, http.StatusNotFound, problem.CodeNotFound, "Habit not found")
+		} else {
+			problem.Write(w, r, http.StatusInternalServerError, problem.CodeInternal, "Failed to retrieve habit")
+		}
+		return nil, db.Calendar{}, false
+	}
+
+	// Without an owner the habit follows the default calendar
+	user, err := Database.GetUserByID(userID)
+	if err != nil && !errors.Is(err, db.ErrNotFound) {
+		problem.Write(w, r, http.StatusInternalServerError, problem.CodeInternal, "Failed to retrieve user")
+		return nil, db.Calendar{}, false
+	}
+	return habit, user.Calendar(), true
+}
+
+func checkParams(w http.ResponseWriter, r *http.Request, params map[string]string, requiredParams []string) bool {
 	for _, param := range requiredParams {
 		if _, ok := params[param]; !ok {
-			w.WriteHeader(http.StatusBadRequest)
-			w.Write([]byte("Missing required parameters"))
+			problem.Write(w, r, http.StatusBadRequest, problem.CodeMissingParameters, "Missing required parameters")
 			return false
 		}
 	}
 	return true
 }
 
+// checkUser returns the authenticated user's ID, writing a 401 when the request
+// did not pass through the auth middleware
+func checkUser(w http.ResponseWriter, r *http.Request) (string, bool) {
+	userID := auth.GetUserIDFromContext(r.Context())
+	if userID == "" {
+		problem.Write(w, r, http.StatusUnauthorized, problem.CodeUnauthorized, "Authentication required")
+		return "", false
+	}
+	return userID, true
+}
+
 func GetHabits(w http.ResponseWriter, r *http.Request, params map[string]string) {
-	habits, err := Database.GetAllHabits()
+	userID, ok := checkUser(w, r)
+	if !ok {
+		return
+	}
+
+	// ?status=active,paused limits the list to habits in those states
+	statuses := make(map[db.HabitStatus]bool)
+	for _, status := range db.ParseCSV(r.URL.Query().Get("status")) {
+		if err := db.ValidateStatus(status); err != nil {
+			invalidField(w, r, "status", "Invalid status: must be one of active, paused, archived")
+			return
+		}
+		statuses[db.HabitStatus(status)] = true
+	}
+
+	habits, err := Database.GetAllHabits(userID)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte("Failed to retrieve habits"))
+		problem.Write(w, r, http.StatusInternalServerError, problem.CodeInternal, "Failed to retrieve habits")
 		return
 	}
 
-	if habits == nil {
-		habits = []*db.Habit{}
+	filtered := []*db.Habit{}
+	for _, habit := range habits {
+		if len(statuses) == 0 || statuses[habit.Status] {
+			filtered = append(filtered, habit)
+		}
 	}
+	habits = filtered
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
@@ -40,16 +121,40 @@ func GetHabits(w http.ResponseWriter, r *http.Request, params map[string]string)
 }
 
 func CreateHabit(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	userID, ok := checkUser(w, r)
+	if !ok {
+		return
+	}
+
 	var habit db.Habit
-	if err := json.NewDecoder(r.Body).Decode(&habit); err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write([]byte("Invalid JSON"))
+	if err := problem.DecodeJSON(w, r, &habit); err != nil {
+		problem.BadBody(w, r, err)
+		return
+	}
+
+	// A custom schedule implies a frequency when none is given
+	if habit.Schedule != "" && habit.Frequency == "" {
+		if schedule, err := db.ParseSchedule(habit.Schedule); err == nil {
+			habit.Frequency = schedule.Frequency()
+		}
+	}
+
+	if err := db.ValidateHabit(&habit); err != nil {
+		invalidFields(w, r, err)
 		return
 	}
+	sort.Strings(habit.ReminderTimes)
 
-	if err := db.ValidateFrequency(string(habit.Frequency)); err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write([]byte("Invalid frequency: must be one of hourly, daily, weekly, biweekly, monthly, quarterly, yearly"))
+	// New habits start active unless created paused or archived; the pause
+	// history is never taken from the client
+	status := habit.Status
+	if status == "" {
+		status = db.StatusActive
+	}
+	resumeDate := habit.ResumeDate
+	habit.Status, habit.ResumeDate, habit.Pauses = db.StatusActive, "", nil
+	if err := habit.SetStatus(status, resumeDate, time.Now()); err != nil {
+		invalidStatus(w, r, err)
 		return
 	}
 
@@ -57,213 +162,576 @@ func CreateHabit(w http.ResponseWriter, r *http.Request, params map[string]strin
 		habit.ID = uuid.New().String()
 	}
 
+	habit.UserID = userID
+
 	if err := Database.CreateHabit(&habit); err != nil {
 		if err == db.ErrDuplicate {
-			w.WriteHeader(http.StatusConflict)
-			w.Write([]byte("Habit already exists"))
+			problem.Write(w, r, http.StatusConflict, problem.CodeConflict, "Habit already exists")
 		} else {
-			w.WriteHeader(http.StatusInternalServerError)
-			w.Write([]byte("Failed to create habit"))
+			problem.Write(w, r, http.StatusInternalServerError, problem.CodeInternal, "Failed to create habit")
 		}
 		return
 	}
 
+	publish(userID, EventHabitCreated, habit)
+
+	w.Header().Set("ETag", habit.ETag())
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(habit)
 }
 
 func GetHabit(w http.ResponseWriter, r *http.Request, params map[string]string) {
-	if !checkParams(w, params, []string{"id"}) {
+	if !checkParams(w, r, params, []string{"id"}) {
 		return
 	}
 
-	habit, err := Database.GetHabit(params["id"])
+	userID, ok := checkUser(w, r)
+	if !ok {
+		return
+	}
+
+	habit, err := Database.GetHabit(userID, params["id"])
 	if err != nil {
 		if err == db.ErrNotFound {
-			w.WriteHeader(http.StatusNotFound)
-			w.Write([]byte("Habit not found"))
+			problem.Write(w, r, http.StatusNotFound, problem.CodeNotFound, "Habit not found")
 		} else {
-			w.WriteHeader(http.StatusInternalServerError)
-			w.Write([]byte("Failed to retrieve habit"))
+			problem.Write(w, r, http.StatusInternalServerError, problem.CodeInternal, "Failed to retrieve habit")
 		}
 		return
 	}
 
+	w.Header().Set("ETag", habit.ETag())
+	if etagMatches(r.Header.Get("If-None-Match"), habit.ETag(), true) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(habit)
 }
 
 func UpdateHabit(w http.ResponseWriter, r *http.Request, params map[string]string) {
-	if !checkParams(w, params, []string{"id"}) {
+	if !checkParams(w, r, params, []string{"id"}) {
+		return
+	}
+
+	userID, ok := checkUser(w, r)
+	if !ok {
 		return
 	}
 
 	// Parse the request body into a map to support partial updates
 	var updates map[string]interface{}
-	if err := json.NewDecoder(r.Body).Decode(&updates); err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write([]byte("Invalid JSON"))
+	if err := problem.DecodeJSON(w, r, &updates); err != nil {
+		problem.BadBody(w, r, err)
 		return
 	}
 
-	// Validate frequency if it's being updated
-	if frequency, exists := updates["frequency"]; exists {
-		if freqStr, ok := frequency.(string); ok {
-			if err := db.ValidateFrequency(freqStr); err != nil {
-				w.WriteHeader(http.StatusBadRequest)
-				w.Write([]byte("Invalid frequency: must be one of hourly, daily, weekly, biweekly, monthly, quarterly, yearly"))
-				return
+	if err := db.ValidateHabitUpdates(updates); err != nil {
+		invalidFields(w, r, err)
+		return
+	}
+
+	// The version is read-only. Clients that read the habit make the update
+	// conditional on it being unchanged with If-Match.
+	delete(updates, "version")
+	if ifMatch := r.Header.Get("If-Match"); ifMatch != "" {
+		current, err := Database.GetHabit(userID, params["id"])
+		if err != nil {
+			if err == db.ErrNotFound {
+				problem.Write(w, r, http.StatusNotFound, problem.CodeNotFound, "Habit not found")
+			} else {
+				problem.Write(w, r, http.StatusInternalServerError, problem.CodeInternal, "Failed to retrieve habit")
 			}
-		} else {
-			w.WriteHeader(http.StatusBadRequest)
-			w.Write([]byte("Frequency must be a string"))
 			return
 		}
+		if !etagMatches(ifMatch, current.ETag(), false) {
+			preconditionFailed(w, r)
+			return
+		}
+		updates["version"] = float64(current.Version)
 	}
 
-	updatedHabit, err := Database.UpdateHabitPartial(params["id"], updates)
+	updatedHabit, err := Database.UpdateHabitPartial(userID, params["id"], updates)
 	if err != nil {
 		if err == db.ErrNotFound {
-			w.WriteHeader(http.StatusNotFound)
-			w.Write([]byte("Habit not found"))
+			problem.Write(w, r, http.StatusNotFound, problem.CodeNotFound, "Habit not found")
+		} else if errors.Is(err, db.ErrVersionConflict) {
+			preconditionFailed(w, r)
+		} else if errors.Is(err, db.ErrInvalidStatus) || errors.Is(err, db.ErrInvalidResumeDate) {
+			invalidStatus(w, r, err)
 		} else {
-			w.WriteHeader(http.StatusInternalServerError)
-			w.Write([]byte("Failed to update habit"))
+			problem.Write(w, r, http.StatusInternalServerError, problem.CodeInternal, "Failed to update habit")
 		}
 		return
 	}
 
+	publish(userID, EventHabitUpdated, updatedHabit)
+
+	w.Header().Set("ETag", updatedHabit.ETag())
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(updatedHabit)
 }
 
+// invalidStatus writes the response for a rejected status or resume date
+func invalidStatus(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, db.ErrInvalidResumeDate) {
+		invalidField(w, r, "resumeDate", "Invalid resume date: only paused habits can have one, and it must be in the future")
+		return
+	}
+	invalidField(w, r, "status", "Invalid status: must be one of active, paused, archived")
+}
+
 func DeleteHabit(w http.ResponseWriter, r *http.Request, params map[string]string) {
-	if !checkParams(w, params, []string{"id"}) {
+	if !checkParams(w, r, params, []string{"id"}) {
+		return
+	}
+
+	userID, ok := checkUser(w, r)
+	if !ok {
 		return
 	}
 
-	if err := Database.DeleteHabit(params["id"]); err != nil {
+	if err := Database.DeleteHabit(userID, params["id"]); err != nil {
 		if err == db.ErrNotFound {
-			w.WriteHeader(http.StatusNotFound)
-			w.Write([]byte("Habit not found"))
+			problem.Write(w, r, http.StatusNotFound, problem.CodeNotFound, "Habit not found")
 		} else {
-			w.WriteHeader(http.StatusInternalServerError)
-			w.Write([]byte("Failed to delete habit"))
+			problem.Write(w, r, http.StatusInternalServerError, problem.CodeInternal, "Failed to delete habit")
 		}
 		return
 	}
 
+	publish(userID, EventHabitDeleted, DeletedPayload{ID: params["id"]})
+
 	w.WriteHeader(http.StatusNoContent)
 }
 
 func CreateTracking(w http.ResponseWriter, r *http.Request, params map[string]string) {
-	if !checkParams(w, params, []string{"id"}) {
+	if !checkParams(w, r, params, []string{"id"}) {
 		return
 	}
 
-	var entry db.TrackingEntry
-	if err := json.NewDecoder(r.Body).Decode(&entry); err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write([]byte("Invalid JSON"))
+	userID, ok := checkUser(w, r)
+	if !ok {
 		return
 	}
 
-	if entry.ID == "" {
-		entry.ID = uuid.New().String()
+	var entry db.TrackingEntry
+	if err := problem.DecodeJSON(w, r, &entry); err != nil {
+		problem.BadBody(w, r, err)
+		return
 	}
 
 	entry.HabitID = params["id"]
+	if err := LogTracking(Database, Events, userID, &entry); err != nil {
+		switch {
+		case errors.Is(err, db.ErrNotFound):
+			problem.Write(w, r, http.StatusNotFound, problem.CodeNotFound, "Habit not found")
+		case errors.Is(err, db.ErrValidation):
+			invalidFields(w, r, err)
+		case errors.Is(err, db.ErrDuplicate):
+			problem.Write(w, r, http.StatusConflict, problem.CodeConflict, "Tracking entry already exists")
+		default:
+			problem.Write(w, r, http.StatusInternalServerError, problem.CodeInternal, "Failed to create tracking entry")
+		}
+		return
+	}
 
-	if entry.Timestamp == "" {
-		entry.Timestamp = time.Now().Format(time.RFC3339)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(entry)
+}
+
+func GetTracking(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	if !checkParams(w, r, params, []string{"id"}) {
+		return
 	}
 
-	if err := Database.CreateTrackingEntry(&entry); err != nil {
-		if err == db.ErrDuplicate {
-			w.WriteHeader(http.StatusConflict)
-			w.Write([]byte("Tracking entry already exists"))
+	userID, ok := checkUser(w, r)
+	if !ok {
+		return
+	}
+
+	entries, err := Database.GetTrackingEntriesByHabitID(userID, params["id"])
+	if err != nil {
+		if err == db.ErrNotFound {
+			problem.Write(w, r, http.StatusNotFound, problem.CodeNotFound, "Habit not found")
 		} else {
-			w.WriteHeader(http.StatusInternalServerError)
-			w.Write([]byte("Failed to create tracking entry"))
+			problem.Write(w, r, http.StatusInternalServerError, problem.CodeInternal, "Failed to retrieve tracking entries")
 		}
 		return
 	}
 
-	if err := Database.UpdateReminderLastReminder(entry.HabitID, entry.Timestamp); err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte("Failed to update reminder"))
+	if entries == nil {
+		entries = []*db.TrackingEntry{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(entries)
+}
+
+func GetTrackingEntry(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	if !checkParams(w, r, params, []string{"id", "entryId"}) {
+		return
+	}
+
+	userID, ok := checkUser(w, r)
+	if !ok {
+		return
+	}
+
+	entry, ok := findTrackingEntry(w, r, userID, params)
+	if !ok {
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
+	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(entry)
 }
 
-func GetTracking(w http.ResponseWriter, r *http.Request, params map[string]string) {
-	if !checkParams(w, params, []string{"id"}) {
+func UpdateTrackingEntry(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	if !checkParams(w, r, params, []string{"id", "entryId"}) {
 		return
 	}
 
-	entries, err := Database.GetTrackingEntriesByHabitID(params["id"])
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte("Failed to retrieve tracking entries"))
+	userID, ok := checkUser(w, r)
+	if !ok {
 		return
 	}
 
-	if entries == nil {
-		entries = []*db.TrackingEntry{}
+	var updates map[string]interface{}
+	if err := problem.DecodeJSON(w, r, &updates); err != nil {
+		problem.BadBody(w, r, err)
+		return
 	}
 
+	if _, ok := findTrackingEntry(w, r, userID, params); !ok {
+		return
+	}
+
+	habit, cal, ok := habitCalendar(w, r, userID, params["id"])
+	if !ok {
+		return
+	}
+	if err := db.ValidateTrackingUpdates(updates, habit, cal); err != nil {
+		invalidFields(w, r, err)
+		return
+	}
+
+	updatedEntry, err := Database.UpdateTrackingEntryPartial(userID, params["entryId"], updates)
+	if err != nil {
+		if err == db.ErrNotFound {
+			problem.Write(w, r, http.StatusNotFound, problem.CodeNotFound, "Tracking entry not found")
+		} else {
+			problem.Write(w, r, http.StatusInternalServerError, problem.CodeInternal, "Failed to update tracking entry")
+		}
+		return
+	}
+
+	publish(userID, EventTrackingUpdated, updatedEntry)
+
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(entries)
+	json.NewEncoder(w).Encode(updatedEntry)
+}
+
+func DeleteTrackingEntry(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	if !checkParams(w, r, params, []string{"id", "entryId"}) {
+		return
+	}
+
+	userID, ok := checkUser(w, r)
+	if !ok {
+		return
+	}
+
+	entry, ok := findTrackingEntry(w, r, userID, params)
+	if !ok {
+		return
+	}
+
+	if err := Database.DeleteTrackingEntry(userID, entry.ID); err != nil {
+		if err == db.ErrNotFound {
+			problem.Write(w, r, http.StatusNotFound, problem.CodeNotFound, "Tracking entry not found")
+		} else {
+			problem.Write(w, r, http.StatusInternalServerError, problem.CodeInternal, "Failed to delete tracking entry")
+		}
+		return
+	}
+
+	publish(userID, EventTrackingDeleted, DeletedPayload{ID: entry.ID, HabitID: entry.HabitID})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// findTrackingEntry loads the entry named by the entryId parameter, writing a
+// 404 unless it belongs to the caller and to the habit named by id
+func findTrackingEntry(w http.ResponseWriter, r *http.Request, userID string, params map[string]string) (*db.TrackingEntry, bool) {
+	entry, err := Database.GetTrackingEntry(userID, params["entryId"])
+	if err == nil && entry.HabitID != params["id"] {
+		err = db.ErrNotFound
+	}
+	if err != nil {
+		if err == db.ErrNotFound {
+			problem.Write(w, r, http.StatusNotFound, problem.CodeNotFound, "Tracking entry not found")
+		} else {
+			problem.Write(w, r, http.StatusInternalServerError, problem.CodeInternal, "Failed to retrieve tracking entry")
+		}
+		return nil, false
+	}
+	return entry, true
 }
 
 func UpdateReminder(w http.ResponseWriter, r *http.Request, params map[string]string) {
-	if !checkParams(w, params, []string{"id"}) {
+	if !checkParams(w, r, params, []string{"id"}) {
+		return
+	}
+
+	userID, ok := checkUser(w, r)
+	if !ok {
+		return
+	}
+
+	// Only the last reminder can be changed; the reminder is the one in the path
+	var request db.Reminder
+	if err := problem.DecodeJSON(w, r, &request); err != nil {
+		problem.BadBody(w, r, err)
+		return
+	}
+	if err := db.ValidateTimestamp(request.LastReminder); err != nil {
+		invalidField(w, r, "lastReminder", "Invalid last reminder: must be a date such as 2024-01-31 or an RFC 3339 date-time")
+		return
+	}
+	// Stored as RFC 3339, the only form the scheduler reads
+	lastReminder, _ := db.ParseTimestamp(request.LastReminder)
+
+	existing, err := Database.GetReminderByID(userID, params["id"])
+	if err == nil {
+		err = Database.UpdateReminderLastReminder(userID, existing.HabitID, lastReminder.Format(time.RFC3339))
+	}
+	if err != nil {
+		if err == db.ErrNotFound {
+			problem.Write(w, r, http.StatusNotFound, problem.CodeNotFound, "Reminder not found")
+		} else {
+			problem.Write(w, r, http.StatusInternalServerError, problem.CodeInternal, "Failed to update reminder")
+		}
+		return
+	}
+
+	updated, err := Database.GetReminder(userID, existing.HabitID)
+	if err != nil {
+		problem.Write(w, r, http.StatusInternalServerError, problem.CodeInternal, "Failed to retrieve reminder")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(updated)
+}
+
+// reminderActionError writes the response for a failed snooze or dismissal
+func reminderActionError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, db.ErrNotFound):
+		problem.Write(w, r, http.StatusNotFound, problem.CodeNotFound, "Habit or notification not found")
+	case errors.Is(err, reminder.ErrInvalidSnooze):
+		problem.Invalid(w, r, "Invalid snooze: give minutes or an RFC 3339 until time, ending within 7 days")
+	default:
+		problem.Write(w, r, http.StatusInternalServerError, problem.CodeInternal, "Failed to update reminder")
+	}
+}
+
+func writeReminderAction(w http.ResponseWriter, action *db.ReminderAction) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(action)
+}
+
+// SnoozeReminder sends the habit's reminder again after a number of minutes or
+// at a given time
+func SnoozeReminder(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	if !checkParams(w, r, params, []string{"id"}) {
+		return
+	}
+
+	userID, ok := checkUser(w, r)
+	if !ok {
+		return
+	}
+
+	var request reminder.SnoozeRequest
+	if err := problem.DecodeJSON(w, r, &request); err != nil {
+		problem.BadBody(w, r, err)
+		return
+	}
+
+	action, err := SnoozeHabitReminder(Database, Events, userID, params["id"], request)
+	if err != nil {
+		reminderActionError(w, r, err)
+		return
+	}
+
+	writeReminderAction(w, action)
+}
+
+// DismissReminderRequest optionally names the inbox entry being dismissed
+type DismissReminderRequest struct {
+	NotificationID string `json:"notificationId,omitempty"`
+}
+
+// DismissReminder silences the habit's reminder for the rest of its period
+func DismissReminder(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	if !checkParams(w, r, params, []string{"id"}) {
+		return
+	}
+
+	userID, ok := checkUser(w, r)
+	if !ok {
+		return
+	}
+
+	// The body is optional
+	var request DismissReminderRequest
+	if err := problem.DecodeJSON(w, r, &request); err != nil && err != io.EOF {
+		problem.BadBody(w, r, err)
+		return
+	}
+
+	action, err := DismissHabitReminder(Database, Events, userID, params["id"], request.NotificationID)
+	if err != nil {
+		reminderActionError(w, r, err)
+		return
+	}
+
+	writeReminderAction(w, action)
+}
+
+// GetReminderHistory lists what the user did with the habit's reminders, newest first
+func GetReminderHistory(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	if !checkParams(w, r, params, []string{"id"}) {
+		return
+	}
+
+	userID, ok := checkUser(w, r)
+	if !ok {
+		return
+	}
+
+	actions, err := Database.GetReminderActions(userID, params["id"])
+	if err != nil {
+		if err == db.ErrNotFound {
+			problem.Write(w, r, http.StatusNotFound, problem.CodeNotFound, "Habit not found")
+		} else {
+			problem.Write(w, r, http.StatusInternalServerError, problem.CodeInternal, "Failed to retrieve reminder history")
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(actions)
+}
+
+// Notification Handlers
+
+func GetNotifications(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	userID, ok := checkUser(w, r)
+	if !ok {
+		return
+	}
+
+	unreadOnly := r.URL.Query().Get("unread") == "true"
+	notifications, err := Database.GetNotifications(userID, unreadOnly)
+	if err != nil {
+		problem.Write(w, r, http.StatusInternalServerError, problem.CodeInternal, "Failed to retrieve notifications")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(notifications)
+}
+
+func UpdateNotification(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	if !checkParams(w, r, params, []string{"id"}) {
+		return
+	}
+
+	userID, ok := checkUser(w, r)
+	if !ok {
+		return
+	}
+
+	var updates map[string]interface{}
+	if err := problem.DecodeJSON(w, r, &updates); err != nil {
+		problem.BadBody(w, r, err)
 		return
 	}
 
-	var reminder db.Reminder
-	if err := json.NewDecoder(r.Body).Decode(&reminder); err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write([]byte("Invalid JSON"))
+	for _, field := range []string{"read", "dismissed"} {
+		if value, exists := updates[field]; exists {
+			if _, ok := value.(bool); !ok {
+				invalidField(w, r, field, "Read and dismissed must be booleans")
+				return
+			}
+		}
+	}
+
+	notification, err := Database.UpdateNotificationPartial(userID, params["id"], updates)
+	if err != nil {
+		if err == db.ErrNotFound {
+			problem.Write(w, r, http.StatusNotFound, problem.CodeNotFound, "Notification not found")
+		} else {
+			problem.Write(w, r, http.StatusInternalServerError, problem.CodeInternal, "Failed to update notification")
+		}
 		return
 	}
 
-	reminder.ID = params["id"]
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(notification)
+}
 
-	if err := Database.UpdateReminderLastReminder(reminder.HabitID, reminder.LastReminder); err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte("Failed to update reminder"))
+func MarkAllNotificationsRead(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	userID, ok := checkUser(w, r)
+	if !ok {
+		return
+	}
+
+	marked, err := Database.MarkAllNotificationsRead(userID)
+	if err != nil {
+		problem.Write(w, r, http.StatusInternalServerError, problem.CodeInternal, "Failed to update notifications")
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(reminder)
+	json.NewEncoder(w).Encode(map[string]int{"marked": marked})
 }
 
 // Statistics and Analytics Handlers
 
 func GetHabitStats(w http.ResponseWriter, r *http.Request, params map[string]string) {
-	if !checkParams(w, params, []string{"id"}) {
+	if !checkParams(w, r, params, []string{"id"}) {
 		return
 	}
 
-	stats, err := Database.GetHabitStats(params["id"])
+	userID, ok := checkUser(w, r)
+	if !ok {
+		return
+	}
+
+	stats, err := Database.GetHabitStats(userID, params["id"])
 	if err != nil {
 		if err == db.ErrNotFound {
-			w.WriteHeader(http.StatusNotFound)
-			w.Write([]byte("Habit not found"))
+			problem.Write(w, r, http.StatusNotFound, problem.CodeNotFound, "Habit not found")
 		} else {
-			w.WriteHeader(http.StatusInternalServerError)
-			w.Write([]byte("Failed to retrieve habit statistics"))
+			problem.Write(w, r, http.StatusInternalServerError, problem.CodeInternal, "Failed to retrieve habit statistics")
 		}
 		return
 	}
@@ -274,7 +742,12 @@ func GetHabitStats(w http.ResponseWriter, r *http.Request, params map[string]str
 }
 
 func GetHabitProgress(w http.ResponseWriter, r *http.Request, params map[string]string) {
-	if !checkParams(w, params, []string{"id"}) {
+	if !checkParams(w, r, params, []string{"id"}) {
+		return
+	}
+
+	userID, ok := checkUser(w, r)
+	if !ok {
 		return
 	}
 
@@ -286,10 +759,13 @@ func GetHabitProgress(w http.ResponseWriter, r *http.Request, params map[string]
 		}
 	}
 
-	progress, err := Database.GetHabitProgress(params["id"], days)
+	progress, err := Database.GetHabitProgress(userID, params["id"], days)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte("Failed to retrieve habit progress"))
+		if err == db.ErrNotFound {
+			problem.Write(w, r, http.StatusNotFound, problem.CodeNotFound, "Habit not found")
+		} else {
+			problem.Write(w, r, http.StatusInternalServerError, problem.CodeInternal, "Failed to retrieve habit progress")
+		}
 		return
 	}
 
@@ -303,10 +779,14 @@ func GetHabitProgress(w http.ResponseWriter, r *http.Request, params map[string]
 }
 
 func GetOverallStats(w http.ResponseWriter, r *http.Request, params map[string]string) {
-	stats, err := Database.GetOverallStats()
+	userID, ok := checkUser(w, r)
+	if !ok {
+		return
+	}
+
+	stats, err := Database.GetOverallStats(userID)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte("Failed to retrieve overall statistics"))
+		problem.Write(w, r, http.StatusInternalServerError, problem.CodeInternal, "Failed to retrieve overall statistics")
 		return
 	}
 
@@ -316,6 +796,11 @@ func GetOverallStats(w http.ResponseWriter, r *http.Request, params map[string]s
 }
 
 func GetHabitCompletionRates(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	userID, ok := checkUser(w, r)
+	if !ok {
+		return
+	}
+
 	// Default to 30 days, allow override via query parameter
 	days := 30
 	if daysParam := r.URL.Query().Get("days"); daysParam != "" {
@@ -324,10 +809,9 @@ func GetHabitCompletionRates(w http.ResponseWriter, r *http.Request, params map[
 		}
 	}
 
-	rates, err := Database.GetHabitCompletionRates(days)
+	rates, err := Database.GetHabitCompletionRates(userID, days)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte("Failed to retrieve completion rates"))
+		problem.Write(w, r, http.StatusInternalServerError, problem.CodeInternal, "Failed to retrieve completion rates")
 		return
 	}
 
@@ -341,6 +825,11 @@ func GetHabitCompletionRates(w http.ResponseWriter, r *http.Request, params map[
 }
 
 func GetDailyCompletions(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	userID, ok := checkUser(w, r)
+	if !ok {
+		return
+	}
+
 	// Default to 30 days, allow override via query parameter
 	days := 30
 	if daysParam := r.URL.Query().Get("days"); daysParam != "" {
@@ -349,10 +838,9 @@ func GetDailyCompletions(w http.ResponseWriter, r *http.Request, params map[stri
 		}
 	}
 
-	completions, err := Database.GetDailyCompletions(days)
+	completions, err := Database.GetDailyCompletions(userID, days)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte("Failed to retrieve daily completions"))
+		problem.Write(w, r, http.StatusInternalServerError, problem.CodeInternal, "Failed to retrieve daily completions")
 		return
 	}
 
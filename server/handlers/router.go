@@ -2,70 +2,263 @@ package handlers
 
 import (
 	"habit-tracker/server/db"
+	"habit-tracker/server/problem"
 	"log"
 	"net/http"
 	"strings"
+	"time"
+
+	"github.com/google/uuid"
 )
 
 type HandlerFunc func(http.ResponseWriter, *http.Request, map[string]string)
 
-type route struct {
-	method  string
-	pattern string
-	handler HandlerFunc
-}
+// Middleware wraps a handler with shared behaviour such as authentication or
+// logging. It has the standard net/http shape, so middleware like
+// AuthService.AuthMiddleware can be used as is.
+type Middleware func(http.Handler) http.Handler
 
+// Router matches requests against a tree of path segments. Requests for a path
+// registered under other methods get a 405 listing them, and HEAD and OPTIONS
+// are answered for every path unless registered explicitly.
 type Router struct {
-	routes []route
+	root       *node
+	middleware []Middleware
+}
+
+// Group registers routes under a shared prefix, each wrapped in the group's
+// middleware
+type Group struct {
+	router     *Router
+	prefix     string
+	middleware []Middleware
 }
 
 var Database db.Database
 
+// CreateRouter returns a router that adds CORS headers to every response
 func CreateRouter() *Router {
-	return &Router{
-		routes: []route{},
+	router := &Router{
+		root: newNode(),
 	}
+	router.Use(CORS)
+	return router
+}
+
+// Use adds middleware that runs for every request the router serves, including
+// ones that match no route. Middleware runs in the order it was added.
+func (r *Router) Use(middleware ...Middleware) {
+	r.middleware = append(r.middleware, middleware...)
+}
+
+// Handle registers a route. Patterns are made of static segments, :param
+// segments matching any one segment and, last, a *param catch-all matching the
+// rest of the path. Static segments win over parameters wherever both match.
+// Any middleware given runs for this route only, inside the router's own.
+func (r *Router) Handle(method, pattern string, handler HandlerFunc, middleware ...Middleware) {
+	r.root.add(method, pattern, chain(handler, middleware))
 }
 
-func (r *Router) Handle(method, pattern string, handler HandlerFunc) {
-	r.routes = append(r.routes, route{method: method, pattern: pattern, handler: handler})
+// Group returns a group of routes under prefix that share the given middleware
+func (r *Router) Group(prefix string, middleware ...Middleware) *Group {
+	return &Group{router: r, prefix: strings.TrimRight(prefix, "/"), middleware: middleware}
+}
+
+// Use adds middleware to the group. It only wraps routes registered after it.
+func (g *Group) Use(middleware ...Middleware) {
+	g.middleware = append(g.middleware, middleware...)
+}
+
+// Handle registers a route at the group's prefix followed by pattern. The
+// group's middleware runs before the route's own.
+func (g *Group) Handle(method, pattern string, handler HandlerFunc, middleware ...Middleware) {
+	chained := append(append([]Middleware{}, g.middleware...), middleware...)
+	g.router.Handle(method, g.prefix+strings.TrimRight(pattern, "/"), handler, chained...)
+}
+
+// Group returns a nested group that adds prefix and middleware to this one's
+func (g *Group) Group(prefix string, middleware ...Middleware) *Group {
+	chained := append(append([]Middleware{}, g.middleware...), middleware...)
+	return &Group{router: g.router, prefix: g.prefix + strings.TrimRight(prefix, "/"), middleware: chained}
+}
+
+// Adapt turns a handler that takes no route parameters into a router handler
+func Adapt(handler http.HandlerFunc) HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+		handler(w, r)
+	}
+}
+
+// chain wraps handler in middleware, the first of which runs outermost
+func chain(handler HandlerFunc, middleware []Middleware) HandlerFunc {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		handler = wrap(middleware[i], handler)
+	}
+	return handler
+}
+
+// wrap runs a router handler behind net/http middleware, passing the route
+// parameters through
+func wrap(middleware Middleware, next HandlerFunc) HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+		middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next(w, r, params)
+		})).ServeHTTP(w, r)
+	}
 }
 
 func addCORSHeaders(w http.ResponseWriter) {
 	w.Header().Set("Access-Control-Allow-Origin", "*") // TODO: Change to only allow requests from the frontend
 	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PATCH, DELETE, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, If-Match, If-None-Match")
+	w.Header().Set("Access-Control-Expose-Headers", "ETag")
 	w.Header().Set("Access-Control-Max-Age", "86400")
 }
 
-func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
-	addCORSHeaders(w)
+// CORS adds the CORS headers to every response. Preflight requests are
+// answered by the router's automatic OPTIONS responses.
+func CORS(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		addCORSHeaders(w)
+		next.ServeHTTP(w, r)
+	})
+}
 
-	if req.Method == "OPTIONS" {
-		w.WriteHeader(http.StatusOK)
-		return
+// statusRecorder remembers the status code written through it, and whether
+// the response has started
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	if !s.wroteHeader {
+		s.status, s.wroteHeader = status, true
 	}
+	s.ResponseWriter.WriteHeader(status)
+}
 
-	for _, route := range r.routes {
-		if req.Method != route.method {
-			continue
+func (s *statusRecorder) Write(b []byte) (int, error) {
+	s.wroteHeader = true
+	return s.ResponseWriter.Write(b)
+}
+
+// RequestID gives each request an ID, reported in the X-Request-ID response
+// header and in error responses. A well-formed ID sent by the client, such as
+// one set by a proxy, is kept.
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get(problem.RequestIDHeader)
+		if !validRequestID(requestID) {
+			requestID = uuid.New().String()
 		}
 
-		params, matched := Match(route.pattern, req.URL.Path)
+		w.Header().Set(problem.RequestIDHeader, requestID)
+		next.ServeHTTP(w, r.WithContext(problem.WithRequestID(r.Context(), requestID)))
+	})
+}
 
-		if !matched {
-			continue
+// validRequestID accepts up to 64 letters, digits, dashes and underscores
+func validRequestID(requestID string) bool {
+	if requestID == "" || len(requestID) > 64 {
+		return false
+	}
+	for _, c := range requestID {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+			return false
 		}
+	}
+	return true
+}
+
+// Logging logs each request with its response status and duration. Requests
+// whose handler panicked are logged too, as the 500 they are answered with
+// unless the handler had already responded.
+func Logging(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		finished := false
+		defer func() {
+			if !finished && !recorder.wroteHeader {
+				recorder.status = http.StatusInternalServerError
+			}
+			log.Println(r.Method, r.URL.Path, recorder.status, time.Since(start), problem.RequestIDFromContext(r.Context()))
+		}()
+
+		next.ServeHTTP(recorder, r)
+		finished = true
+	})
+}
+
+// Recovery turns a panicking handler into a 500 response instead of a dropped
+// connection. A handler that panics after it started responding has its
+// response cut short instead, since the status has already been sent.
+func Recovery(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		defer func() {
+			if err := recover(); err != nil {
+				log.Printf("Panic serving %s %s: %v", r.Method, r.URL.Path, err)
+				if !recorder.wroteHeader {
+					problem.Write(recorder, r, http.StatusInternalServerError, problem.CodeInternal, "Internal server error")
+				}
+			}
+		}()
+
+		next.ServeHTTP(recorder, r)
+	})
+}
+
+func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	var handler http.Handler = http.HandlerFunc(r.dispatch)
+	for i := len(r.middleware) - 1; i >= 0; i-- {
+		handler = r.middleware[i](handler)
+	}
+	handler.ServeHTTP(w, req)
+}
+
+// headWriter discards the body of a GET handler answering a HEAD request
+type headWriter struct {
+	http.ResponseWriter
+}
 
-		log.Println(route.method, req.URL.Path)
+func (w headWriter) Write(b []byte) (int, error) {
+	return len(b), nil
+}
 
-		route.handler(w, req, params)
+// dispatch runs the route matching the request
+func (r *Router) dispatch(w http.ResponseWriter, req *http.Request) {
+	params := make(map[string]string)
+	found := r.root.lookup(splitPath(req.URL.Path), params)
+	if found == nil {
+		problem.Write(w, req, http.StatusNotFound, problem.CodeNotFound, "No route matches "+req.URL.Path)
+		return
+	}
+
+	handler, exists := found.handlers[req.Method]
+	switch {
+	case exists:
+	case req.Method == "HEAD" && found.handlers["GET"] != nil:
+		handler = found.handlers["GET"]
+		w = headWriter{w}
+	case req.Method == "OPTIONS":
+		w.Header().Set("Allow", found.allowedFor)
+		w.WriteHeader(http.StatusOK)
+		return
+	default:
+		w.Header().Set("Allow", found.allowedFor)
+		problem.Write(w, req, http.StatusMethodNotAllowed, problem.CodeMethodNotAllowed,
+			req.Method+" is not allowed on "+req.URL.Path)
 		return
 	}
 
-	http.NotFound(w, req)
+	handler(w, req, params)
 }
 
+// Match reports whether path matches a pattern of static and :param segments
+// on its own. The router itself matches against its tree of routes.
 func Match(pattern, path string) (map[string]string, bool) {
 	patternParts := strings.Split(strings.Trim(pattern, "/"), "/")
 	pathParts := strings.Split(strings.Trim(path, "/"), "/")
@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"errors"
+	"time"
+
+	"habit-tracker/server/db"
+	"habit-tracker/server/reminder"
+
+	"github.com/google/uuid"
+)
+
+// The changes below can be made over HTTP or over a WebSocket. The handlers
+// and the socket RPC dispatcher both call these, so the two stay in step.
+
+// LogTracking stores a new entry for one of the user's habits, then publishes
+// it to events, which may be nil. Entries without an ID or timestamp get a new
+// ID and the current time. A missing habit is reported as db.ErrNotFound and
+// invalid fields as a *db.ValidationError.
+func LogTracking(database db.Database, events EventPublisher, userID string, entry *db.TrackingEntry) error {
+	if entry.ID == "" {
+		entry.ID = uuid.New().String()
+	}
+	if entry.Timestamp == "" {
+		entry.Timestamp = time.Now().Format(time.RFC3339)
+	}
+
+	habit, err := database.GetHabit(userID, entry.HabitID)
+	if err != nil {
+		return err
+	}
+	// Without an owner the habit follows the default calendar
+	user, err := database.GetUserByID(userID)
+	if err != nil && !errors.Is(err, db.ErrNotFound) {
+		return err
+	}
+	if err := db.ValidateTrackingEntry(entry, habit, user.Calendar()); err != nil {
+		return err
+	}
+
+	if err := database.CreateTrackingEntry(userID, entry); err != nil {
+		return err
+	}
+	if err := database.UpdateReminderLastReminder(userID, entry.HabitID, entry.Timestamp); err != nil {
+		return err
+	}
+
+	publishTo(events, userID, EventTrackingCreated, *entry)
+	return nil
+}
+
+// SnoozeHabitReminder sends the habit's reminder again once the snooze in
+// request is over, then publishes the snooze to events
+func SnoozeHabitReminder(database db.Database, events EventPublisher, userID, habitID string, request reminder.SnoozeRequest) (*db.ReminderAction, error) {
+	now := time.Now()
+	until, err := request.SnoozeUntil(now)
+	if err != nil {
+		return nil, err
+	}
+	action, err := reminder.Snooze(database, userID, habitID, request.NotificationID, until, now)
+	if err != nil {
+		return nil, err
+	}
+
+	publishTo(events, userID, EventReminderSnoozed, action)
+	return action, nil
+}
+
+// DismissHabitReminder silences the habit's reminder for the rest of its
+// period, then publishes the dismissal to events
+func DismissHabitReminder(database db.Database, events EventPublisher, userID, habitID, notificationID string) (*db.ReminderAction, error) {
+	action, err := reminder.Dismiss(database, userID, habitID, notificationID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	publishTo(events, userID, EventReminderDismissed, action)
+	return action, nil
+}
@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// node is one path segment in the router's tree. A node's children are tried
+// in order of precedence: static segments, then a :param, then a *catch-all.
+type node struct {
+	static     map[string]*node
+	param      *node
+	catchAll   *node
+	paramName  string // set on :param and *catch-all children
+	pattern    string // the pattern registered at this node, if any
+	handlers   map[string]HandlerFunc
+	allowedFor string // the Allow header value, kept up to date by add
+}
+
+func newNode() *node {
+	return &node{static: make(map[string]*node)}
+}
+
+// splitPath returns the segments of a path, ignoring leading and trailing
+// slashes, so "/", "" and "/habits/" all behave like their trimmed forms
+func splitPath(path string) []string {
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return nil
+	}
+	return strings.Split(path, "/")
+}
+
+// add registers handler for method at pattern. It panics on patterns that
+// would be ambiguous, as these are programming errors.
+func (n *node) add(method, pattern string, handler HandlerFunc) {
+	segments := splitPath(pattern)
+	current := n
+	for i, segment := range segments {
+		switch {
+		case strings.HasPrefix(segment, ":"):
+			current = current.child(&current.param, segment[1:], pattern)
+		case strings.HasPrefix(segment, "*"):
+			if i != len(segments)-1 {
+				panic(fmt.Sprintf("router: catch-all %s must end pattern %s", segment, pattern))
+			}
+			current = current.child(&current.catchAll, segment[1:], pattern)
+		default:
+			child, exists := current.static[segment]
+			if !exists {
+				child = newNode()
+				current.static[segment] = child
+			}
+			current = child
+		}
+	}
+
+	if current.handlers == nil {
+		current.handlers = make(map[string]HandlerFunc)
+	}
+	if _, exists := current.handlers[method]; exists {
+		panic(fmt.Sprintf("router: %s %s is already registered", method, pattern))
+	}
+	if current.pattern != "" && current.pattern != pattern {
+		panic(fmt.Sprintf("router: %s conflicts with %s", pattern, current.pattern))
+	}
+	current.pattern = pattern
+	current.handlers[method] = handler
+	current.allowedFor = allowHeader(current.handlers)
+}
+
+// child returns the parameter child in slot, creating it if needed. Every
+// route must use the same name for a parameter in the same position.
+func (n *node) child(slot **node, name, pattern string) *node {
+	if name == "" {
+		panic(fmt.Sprintf("router: unnamed parameter in %s", pattern))
+	}
+	if *slot == nil {
+		*slot = newNode()
+		(*slot).paramName = name
+	} else if (*slot).paramName != name {
+		panic(fmt.Sprintf("router: parameter %s in %s conflicts with %s", name, pattern, (*slot).paramName))
+	}
+	return *slot
+}
+
+// lookup returns the node with handlers that matches the path segments,
+// filling in params. Static segments take precedence over parameters, which
+// take precedence over catch-alls; a branch that leads nowhere falls back to
+// the next one.
+func (n *node) lookup(segments []string, params map[string]string) *node {
+	if len(segments) == 0 {
+		if n.handlers != nil {
+			return n
+		}
+		return nil
+	}
+
+	if child, exists := n.static[segments[0]]; exists {
+		if found := child.lookup(segments[1:], params); found != nil {
+			return found
+		}
+	}
+	if n.param != nil {
+		if found := n.param.lookup(segments[1:], params); found != nil {
+			params[n.param.paramName] = segments[0]
+			return found
+		}
+	}
+	if n.catchAll != nil && n.catchAll.handlers != nil {
+		params[n.catchAll.paramName] = strings.Join(segments, "/")
+		return n.catchAll
+	}
+	return nil
+}
+
+// allowHeader lists the methods a node answers, including the HEAD and
+// OPTIONS responses the router provides itself
+func allowHeader(handlers map[string]HandlerFunc) string {
+	methods := []string{"OPTIONS"}
+	for method := range handlers {
+		if method != "OPTIONS" {
+			methods = append(methods, method)
+		}
+	}
+	if _, hasGet := handlers["GET"]; hasGet {
+		if _, hasHead := handlers["HEAD"]; !hasHead {
+			methods = append(methods, "HEAD")
+		}
+	}
+	sort.Strings(methods)
+	return strings.Join(methods, ", ")
+}
@@ -2,13 +2,15 @@ package main
 
 import (
 	"log"
+	"net"
 	"net/http"
+	"net/smtp"
 	"os"
-	"time"
 
 	"habit-tracker/server/auth"
 	"habit-tracker/server/db"
 	"habit-tracker/server/handlers"
+	"habit-tracker/server/notify"
 	"habit-tracker/server/reminder"
 	"habit-tracker/server/sockets"
 )
@@ -20,15 +22,29 @@ import (
 		POST /habits
 		PATCH /habits/:id
 		DELETE /habits/:id
+		WS /ws
+
+	Tracking Endpoints:
 		POST /habits/:id/tracking
 		GET /habits/:id/tracking
-		WS /ws
+		GET /habits/:id/tracking/:entryId
+		PATCH /habits/:id/tracking/:entryId
+		DELETE /habits/:id/tracking/:entryId
+
+	Reminder Endpoints:
+		PATCH /reminders/:id
+		POST /habits/:id/reminder/snooze
+		POST /habits/:id/reminder/dismiss
+		GET /habits/:id/reminder/history
 
 	Authentication Endpoints:
 		POST /auth/register
 		POST /auth/login
 		GET /auth/profile
+		PATCH /auth/profile
 		GET /auth/validate
+		POST /auth/refresh
+		POST /auth/logout
 
 	Statistics Endpoints:
 		GET /habits/:id/stats
@@ -36,25 +52,60 @@ import (
 		GET /stats/overview
 		GET /stats/completion-rates
 		GET /stats/daily-completions
+
+	Notification Endpoints:
+		GET /notifications
+		PATCH /notifications/:id
+		POST /notifications/read-all
+
+	Every route also answers HEAD when it has a GET, and OPTIONS.
 */
 
-// Auth handler wrappers to adapt from http.HandlerFunc to handlers.HandlerFunc
-func wrapAuthHandler(handler func(http.ResponseWriter, *http.Request)) handlers.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request, params map[string]string) {
-		handler(w, r)
+// newDispatcher sets up the reminder delivery channels. The WebSocket and the
+// log sink are always available; email and webhooks are enabled through
+// SMTP_ADDR and WEBHOOK_URL.
+func newDispatcher(hub *sockets.Hub) *notify.Dispatcher {
+	dispatcher := notify.NewDispatcher()
+	dispatcher.Register(db.ChannelWebSocket, notify.NewWebSocketNotifier(hub.MessageUser))
+
+	logNotifier := notify.NewLogNotifier(os.Stdout)
+	if path := os.Getenv("NOTIFY_LOG_FILE"); path != "" {
+		fileNotifier, err := notify.NewFileNotifier(path)
+		if err != nil {
+			log.Fatalf("Failed to open notification log: %v", err)
+		}
+		logNotifier = fileNotifier
+	}
+	dispatcher.Register(db.ChannelLog, logNotifier)
+
+	if addr := os.Getenv("SMTP_ADDR"); addr != "" {
+		var smtpAuth smtp.Auth
+		if username := os.Getenv("SMTP_USERNAME"); username != "" {
+			host, _, _ := net.SplitHostPort(addr)
+			smtpAuth = smtp.PlainAuth("", username, os.Getenv("SMTP_PASSWORD"), host)
+		}
+		dispatcher.Register(db.ChannelEmail, notify.NewSMTPNotifier(addr, os.Getenv("SMTP_FROM"), smtpAuth))
+		log.Printf("Email reminders enabled via %s", addr)
 	}
-}
 
-func wrapAuthMiddleware(authService *auth.AuthService, handler func(http.ResponseWriter, *http.Request)) handlers.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request, params map[string]string) {
-		// Create a wrapper handler that calls the auth middleware
-		middlewareHandler := authService.AuthMiddleware(http.HandlerFunc(handler))
-		middlewareHandler.ServeHTTP(w, r)
+	if url := os.Getenv("WEBHOOK_URL"); url != "" {
+		dispatcher.Register(db.ChannelWebhook, notify.NewWebhookNotifier(url))
+		log.Println("Webhook reminders enabled")
 	}
+
+	return dispatcher
 }
 
 func main() {
-	database, err := db.NewDatabaseFromConfig()
+	config := db.ParseConfig()
+	if config.IsMigrationCommand() {
+		if err := db.RunMigrationCommand(config); err != nil {
+			log.Fatalf("Migration failed: %v", err)
+		}
+		return
+	}
+
+	database, err := db.NewDatabase(config)
 	if err != nil {
 		log.Fatalf("Failed to initialize database: %v", err)
 	}
@@ -73,54 +124,76 @@ func main() {
 		log.Println("Warning: Using default JWT secret. Set JWT_SECRET environment variable for production.")
 	}
 
-	authService := auth.NewAuthService(database, jwtSecret, 24*time.Hour)
-
-	go sockets.HandleMessages()
+	authService := auth.NewAuthService(database, jwtSecret, auth.DefaultAccessTokenExpiry)
+	hub := sockets.NewHub(authService, database)
+	handlers.Events = hub
 
 	reminderService := reminder.NewReminderService(database)
+	reminderService.SetDispatcher(newDispatcher(hub))
 	reminderService.Start()
 	log.Println("Reminder service started")
 
 	router := handlers.CreateRouter()
-
-	// Authentication routes (public)
-	router.Handle("POST", "/auth/register", wrapAuthHandler(authService.RegisterHandler))
-	router.Handle("POST", "/auth/login", wrapAuthHandler(authService.LoginHandler))
-
-	// Authentication routes (protected)
-	router.Handle("GET", "/auth/profile", wrapAuthMiddleware(authService, authService.ProfileHandler))
-	router.Handle("GET", "/auth/validate", wrapAuthHandler(authService.ValidateTokenHandler))
-
-	// Habit routes
-	router.Handle("GET", "/habits", handlers.GetHabits)
-	router.Handle("POST", "/habits", handlers.CreateHabit)
-	router.Handle("GET", "/habits/:id", handlers.GetHabit)
-	router.Handle("PATCH", "/habits/:id", handlers.UpdateHabit)
-	router.Handle("DELETE", "/habits/:id", handlers.DeleteHabit)
-
-	// Tracking routes
-	router.Handle("POST", "/habits/:id/tracking", handlers.CreateTracking)
-	router.Handle("GET", "/habits/:id/tracking", handlers.GetTracking)
-
-	// Reminder routes
-	router.Handle("PATCH", "/reminders/:id", handlers.UpdateReminder)
-
-	// Statistics routes
-	router.Handle("GET", "/habits/:id/stats", handlers.GetHabitStats)
-	router.Handle("GET", "/habits/:id/progress", handlers.GetHabitProgress)
-	router.Handle("GET", "/stats/overview", handlers.GetOverallStats)
-	router.Handle("GET", "/stats/completion-rates", handlers.GetHabitCompletionRates)
-	router.Handle("GET", "/stats/daily-completions", handlers.GetDailyCompletions)
+	router.Use(handlers.RequestID, handlers.Logging, handlers.Recovery)
+	requireAuth := authService.AuthMiddleware
+
+	// Authentication routes (public unless marked)
+	authRoutes := router.Group("/auth")
+	authRoutes.Handle("POST", "/register", handlers.Adapt(authService.RegisterHandler))
+	authRoutes.Handle("POST", "/login", handlers.Adapt(authService.LoginHandler))
+	authRoutes.Handle("POST", "/refresh", handlers.Adapt(authService.RefreshHandler))
+	authRoutes.Handle("GET", "/profile", handlers.Adapt(authService.ProfileHandler), requireAuth)
+	authRoutes.Handle("PATCH", "/profile", handlers.Adapt(authService.UpdateProfileHandler), requireAuth)
+	authRoutes.Handle("POST", "/logout", handlers.Adapt(authService.LogoutHandler), requireAuth)
+	authRoutes.Handle("GET", "/validate", handlers.Adapt(authService.ValidateTokenHandler))
+
+	// Habit routes (protected)
+	habits := router.Group("/habits", requireAuth)
+	habits.Handle("GET", "", handlers.GetHabits)
+	habits.Handle("POST", "", handlers.CreateHabit)
+	habits.Handle("GET", "/:id", handlers.GetHabit)
+	habits.Handle("PATCH", "/:id", handlers.UpdateHabit)
+	habits.Handle("DELETE", "/:id", handlers.DeleteHabit)
+
+	// Tracking routes (protected)
+	habits.Handle("POST", "/:id/tracking", handlers.CreateTracking)
+	habits.Handle("GET", "/:id/tracking", handlers.GetTracking)
+	habits.Handle("GET", "/:id/tracking/:entryId", handlers.GetTrackingEntry)
+	habits.Handle("PATCH", "/:id/tracking/:entryId", handlers.UpdateTrackingEntry)
+	habits.Handle("DELETE", "/:id/tracking/:entryId", handlers.DeleteTrackingEntry)
+
+	// Reminder routes (protected)
+	router.Handle("PATCH", "/reminders/:id", handlers.UpdateReminder, requireAuth)
+	habits.Handle("POST", "/:id/reminder/snooze", handlers.SnoozeReminder)
+	habits.Handle("POST", "/:id/reminder/dismiss", handlers.DismissReminder)
+	habits.Handle("GET", "/:id/reminder/history", handlers.GetReminderHistory)
+
+	// Notification routes (protected)
+	notifications := router.Group("/notifications", requireAuth)
+	notifications.Handle("GET", "", handlers.GetNotifications)
+	notifications.Handle("POST", "/read-all", handlers.MarkAllNotificationsRead)
+	notifications.Handle("PATCH", "/:id", handlers.UpdateNotification)
+
+	// Statistics routes (protected)
+	habits.Handle("GET", "/:id/stats", handlers.GetHabitStats)
+	habits.Handle("GET", "/:id/progress", handlers.GetHabitProgress)
+	stats := router.Group("/stats", requireAuth)
+	stats.Handle("GET", "/overview", handlers.GetOverallStats)
+	stats.Handle("GET", "/completion-rates", handlers.GetHabitCompletionRates)
+	stats.Handle("GET", "/daily-completions", handlers.GetDailyCompletions)
 
 	mux := http.NewServeMux()
-	mux.HandleFunc("/ws", sockets.WSHandler)
+	mux.Handle("/ws", hub)
 	mux.Handle("/", router)
 
 	log.Println("Server is running on port 8080")
 	log.Println("Auth endpoints available:")
 	log.Println("POST /auth/register - Register a new user")
 	log.Println("POST /auth/login - Login and get JWT token")
+	log.Println("POST /auth/refresh - Exchange a refresh token for new tokens")
+	log.Println("POST /auth/logout - Revoke the current session (requires Bearer token)")
 	log.Println("GET /auth/profile - Get user profile (requires Bearer token)")
+	log.Println("PATCH /auth/profile - Update time zone, week start and quiet hours (requires Bearer token)")
 	log.Println("GET /auth/validate - Validate JWT token")
 	log.Fatal(http.ListenAndServe(":8080", mux))
 }
@@ -0,0 +1,54 @@
+package notify
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"habit-tracker/server/db"
+)
+
+// LogNotifier appends each notification as a JSON line to a writer, such as
+// a file or standard output
+type LogNotifier struct {
+	mutex  sync.Mutex
+	writer io.Writer
+}
+
+// LogEntry is a line written by LogNotifier
+type LogEntry struct {
+	Time   string `json:"time"`
+	UserID string `json:"userId"`
+	Notification
+}
+
+func NewLogNotifier(writer io.Writer) *LogNotifier {
+	return &LogNotifier{writer: writer}
+}
+
+// NewFileNotifier appends notifications to the file at path, creating it if needed
+func NewFileNotifier(path string) (*LogNotifier, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return NewLogNotifier(file), nil
+}
+
+func (n *LogNotifier) Notify(user *db.User, notification Notification) error {
+	line, err := json.Marshal(LogEntry{
+		Time:         time.Now().Format(time.RFC3339),
+		UserID:       user.ID,
+		Notification: notification,
+	})
+	if err != nil {
+		return err
+	}
+
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	_, err = n.writer.Write(append(line, '\n'))
+	return err
+}
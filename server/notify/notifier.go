@@ -0,0 +1,84 @@
+package notify
+
+import (
+	"errors"
+	"fmt"
+	"log"
+
+	"habit-tracker/server/db"
+)
+
+// ErrChannelUnavailable is returned for channels the server has no notifier for
+var ErrChannelUnavailable = errors.New("channel not configured")
+
+// Notification is a message for a single user. Channels that carry structured
+// data send Type and Data; the others render Subject and Body. ID refers to the
+// user's inbox entry, if the notification has one.
+type Notification struct {
+	ID      string      `json:"id,omitempty"`
+	Type    string      `json:"type"`
+	Subject string      `json:"subject"`
+	Body    string      `json:"body"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+// Notifier delivers notifications over one channel
+type Notifier interface {
+	Notify(user *db.User, notification Notification) error
+}
+
+// Dispatcher routes notifications to the notifiers of the channels a habit
+// has chosen
+type Dispatcher struct {
+	notifiers map[db.Channel]Notifier
+}
+
+func NewDispatcher() *Dispatcher {
+	return &Dispatcher{notifiers: make(map[db.Channel]Notifier)}
+}
+
+// Register sets the notifier used for a channel
+func (d *Dispatcher) Register(channel db.Channel, notifier Notifier) {
+	d.notifiers[channel] = notifier
+}
+
+// Deliver sends the notification on each of the habit's channels. When the
+// WebSocket delivery fails the habit's fallback channel is tried in its place,
+// unless that channel is already one of the habit's channels.
+func (d *Dispatcher) Deliver(user *db.User, habit *db.Habit, notification Notification) error {
+	channels := habit.DeliveryChannels()
+	selected := make(map[db.Channel]bool, len(channels))
+	for _, channel := range channels {
+		selected[channel] = true
+	}
+
+	var errs []error
+	for _, channel := range channels {
+		err := d.send(channel, user, notification)
+		if err == nil {
+			continue
+		}
+
+		fallback := habit.FallbackChannel
+		if channel == db.ChannelWebSocket && fallback != "" && !selected[fallback] {
+			log.Printf("WebSocket delivery to user %s failed (%v), falling back to %s", user.ID, err, fallback)
+			if fallbackErr := d.send(fallback, user, notification); fallbackErr != nil {
+				errs = append(errs, err, fallbackErr)
+			}
+			continue
+		}
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+func (d *Dispatcher) send(channel db.Channel, user *db.User, notification Notification) error {
+	notifier, ok := d.notifiers[channel]
+	if !ok {
+		return fmt.Errorf("%s: %w", channel, ErrChannelUnavailable)
+	}
+	if err := notifier.Notify(user, notification); err != nil {
+		return fmt.Errorf("%s: %w", channel, err)
+	}
+	return nil
+}
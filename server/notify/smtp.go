@@ -0,0 +1,46 @@
+package notify
+
+import (
+	"errors"
+	"fmt"
+	"net/smtp"
+	"strings"
+
+	"habit-tracker/server/db"
+)
+
+var errNoEmail = errors.New("user has no email address")
+
+// SMTPNotifier emails notifications to the user's address
+type SMTPNotifier struct {
+	Addr string // host:port of the SMTP server
+	From string
+	Auth smtp.Auth // optional
+}
+
+func NewSMTPNotifier(addr, from string, auth smtp.Auth) *SMTPNotifier {
+	return &SMTPNotifier{Addr: addr, From: from, Auth: auth}
+}
+
+func (n *SMTPNotifier) Notify(user *db.User, notification Notification) error {
+	if user.Email == "" {
+		return errNoEmail
+	}
+
+	var message strings.Builder
+	fmt.Fprintf(&message, "From: %s\r\n", headerValue(n.From))
+	fmt.Fprintf(&message, "To: %s\r\n", headerValue(user.Email))
+	fmt.Fprintf(&message, "Subject: %s\r\n", headerValue(notification.Subject))
+	message.WriteString("MIME-Version: 1.0\r\n")
+	message.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	message.WriteString("\r\n")
+	message.WriteString(strings.ReplaceAll(notification.Body, "\n", "\r\n"))
+	message.WriteString("\r\n")
+
+	return smtp.SendMail(n.Addr, n.Auth, n.From, []string{user.Email}, []byte(message.String()))
+}
+
+// headerValue keeps user-controlled text such as habit names from adding headers
+func headerValue(value string) string {
+	return strings.NewReplacer("\r", " ", "\n", " ").Replace(value)
+}
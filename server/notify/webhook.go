@@ -0,0 +1,45 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"habit-tracker/server/db"
+)
+
+// WebhookNotifier POSTs notifications as JSON to a fixed URL
+type WebhookNotifier struct {
+	URL    string
+	Client *http.Client
+}
+
+// WebhookPayload is the body of a webhook request
+type WebhookPayload struct {
+	UserID string `json:"userId"`
+	Notification
+}
+
+func NewWebhookNotifier(url string) *WebhookNotifier {
+	return &WebhookNotifier{URL: url, Client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+func (n *WebhookNotifier) Notify(user *db.User, notification Notification) error {
+	body, err := json.Marshal(WebhookPayload{UserID: user.ID, Notification: notification})
+	if err != nil {
+		return err
+	}
+
+	resp, err := n.Client.Post(n.URL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook responded with %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,31 @@
+package notify
+
+import (
+	"encoding/json"
+
+	"habit-tracker/server/db"
+)
+
+// WebSocketNotifier pushes notifications to the user's open sockets as
+// {"type": ..., "id": ..., "data": ...} messages
+type WebSocketNotifier struct {
+	send func(userID string, message []byte) error
+}
+
+// NewWebSocketNotifier delivers through send, which must fail when the user
+// has no open connection so that a fallback channel can be tried
+func NewWebSocketNotifier(send func(userID string, message []byte) error) *WebSocketNotifier {
+	return &WebSocketNotifier{send: send}
+}
+
+func (n *WebSocketNotifier) Notify(user *db.User, notification Notification) error {
+	message, err := json.Marshal(struct {
+		Type string      `json:"type"`
+		ID   string      `json:"id,omitempty"`
+		Data interface{} `json:"data"`
+	}{notification.Type, notification.ID, notification.Data})
+	if err != nil {
+		return err
+	}
+	return n.send(user.ID, message)
+}
@@ -0,0 +1,125 @@
+// Package problem writes error responses as RFC 7807 problem details, shared by
+// the API handlers and the auth package so clients parse a single format.
+package problem
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// ContentType is the media type of problem responses
+const ContentType = "application/problem+json"
+
+// RequestIDHeader carries the request ID on requests and responses
+const RequestIDHeader = "X-Request-ID"
+
+// MaxBodyBytes caps the size of JSON request bodies
+const MaxBodyBytes = 64 << 10
+
+// Stable machine-readable error codes. Clients may rely on these; the detail
+// text is for people and may change.
+const (
+	CodeInvalidJSON        = "invalid_json"
+	CodeRequestTooLarge    = "request_too_large"
+	CodeValidation         = "validation_failed"
+	CodeMissingParameters  = "missing_parameters"
+	CodeNotFound           = "not_found"
+	CodeMethodNotAllowed   = "method_not_allowed"
+	CodeConflict           = "conflict"
+	CodePreconditionFailed = "precondition_failed"
+	CodeInternal           = "internal_error"
+	CodeUnauthorized       = "unauthorized"
+	CodeInvalidToken       = "invalid_token"
+	CodeTokenExpired       = "token_expired"
+	CodeTokenRevoked       = "token_revoked"
+	CodeRefreshTokenReused = "refresh_token_reused"
+	CodeInvalidCredentials = "invalid_credentials"
+	CodeEmailInUse         = "email_in_use"
+	CodeUsernameInUse      = "username_in_use"
+)
+
+// Problem is an RFC 7807 problem details object, extended with a code, the
+// request ID and any invalid fields
+type Problem struct {
+	Type      string       `json:"type"`
+	Title     string       `json:"title"`
+	Status    int          `json:"status"`
+	Detail    string       `json:"detail,omitempty"`
+	Instance  string       `json:"instance,omitempty"`
+	Code      string       `json:"code"`
+	RequestID string       `json:"requestId,omitempty"`
+	Errors    []FieldError `json:"errors,omitempty"`
+}
+
+// FieldError describes one invalid field of a request body
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Write sends a problem response with the given status, code and detail
+func Write(w http.ResponseWriter, r *http.Request, status int, code, detail string) {
+	WriteProblem(w, r, &Problem{Status: status, Code: code, Detail: detail})
+}
+
+// Invalid sends a 400 listing the fields that failed validation
+func Invalid(w http.ResponseWriter, r *http.Request, detail string, fields ...FieldError) {
+	WriteProblem(w, r, &Problem{Status: http.StatusBadRequest, Code: CodeValidation, Detail: detail, Errors: fields})
+}
+
+// DecodeJSON decodes the request body into v, reading no more than
+// MaxBodyBytes of it
+func DecodeJSON(w http.ResponseWriter, r *http.Request, v interface{}) error {
+	r.Body = http.MaxBytesReader(w, r.Body, MaxBodyBytes)
+	return json.NewDecoder(r.Body).Decode(v)
+}
+
+// BadBody sends the response for a body DecodeJSON rejected: a 413 if it was
+// too large, or a 400 if it was not valid JSON
+func BadBody(w http.ResponseWriter, r *http.Request, err error) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		Write(w, r, http.StatusRequestEntityTooLarge, CodeRequestTooLarge,
+			fmt.Sprintf("Request body must not exceed %d bytes", tooLarge.Limit))
+		return
+	}
+	Write(w, r, http.StatusBadRequest, CodeInvalidJSON, "Invalid JSON")
+}
+
+// WriteProblem sends p, filling in the fields the request determines
+func WriteProblem(w http.ResponseWriter, r *http.Request, p *Problem) {
+	if p.Type == "" {
+		p.Type = "about:blank"
+	}
+	if p.Title == "" {
+		p.Title = http.StatusText(p.Status)
+	}
+	if p.Instance == "" {
+		p.Instance = r.URL.Path
+	}
+	if p.RequestID == "" {
+		p.RequestID = RequestIDFromContext(r.Context())
+	}
+
+	w.Header().Set("Content-Type", ContentType)
+	w.WriteHeader(p.Status)
+	json.NewEncoder(w).Encode(p)
+}
+
+type contextKey string
+
+const requestIDKey contextKey = "requestID"
+
+// WithRequestID returns a context carrying the request ID
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey, requestID)
+}
+
+// RequestIDFromContext returns the request ID, or "" if none was assigned
+func RequestIDFromContext(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDKey).(string)
+	return requestID
+}
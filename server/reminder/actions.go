@@ -0,0 +1,125 @@
+package reminder
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"habit-tracker/server/db"
+)
+
+// ErrInvalidSnooze is returned for snoozes that do not end within MaxSnooze
+var ErrInvalidSnooze = errors.New("invalid snooze")
+
+// MaxSnooze bounds how far a reminder can be pushed back
+const MaxSnooze = 7 * 24 * time.Hour
+
+// SnoozeRequest asks for a reminder to be sent again after Minutes, or at
+// Until. NotificationID names the inbox entry the user acted on, if any.
+type SnoozeRequest struct {
+	Minutes        int    `json:"minutes,omitempty"`
+	Until          string `json:"until,omitempty"`
+	NotificationID string `json:"notificationId,omitempty"`
+}
+
+// SnoozeUntil returns when the snoozed reminder should fire. Exactly one of
+// Minutes and Until must be given.
+func (r SnoozeRequest) SnoozeUntil(now time.Time) (time.Time, error) {
+	var until time.Time
+	switch {
+	case r.Minutes != 0 && r.Until != "":
+		return time.Time{}, fmt.Errorf("%w: give either minutes or until", ErrInvalidSnooze)
+	case r.Minutes != 0:
+		until = now.Add(time.Duration(r.Minutes) * time.Minute)
+	case r.Until != "":
+		parsed, err := time.Parse(time.RFC3339, r.Until)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("%w: until must be an RFC 3339 time", ErrInvalidSnooze)
+		}
+		until = parsed
+	default:
+		return time.Time{}, fmt.Errorf("%w: minutes or until is required", ErrInvalidSnooze)
+	}
+
+	if !until.After(now) || until.Sub(now) > MaxSnooze {
+		return time.Time{}, fmt.Errorf("%w: must end within %v", ErrInvalidSnooze, MaxSnooze)
+	}
+	return until, nil
+}
+
+// Snooze sends the habit's reminder again at until instead of on its usual
+// schedule, and records the action in the habit's reminder history
+func Snooze(database db.Database, userID, habitID, notificationID string, until, now time.Time) (*db.ReminderAction, error) {
+	if _, err := database.GetReminder(userID, habitID); err != nil {
+		return nil, err
+	}
+	return record(database, db.ReminderSnoozed, userID, habitID, notificationID, until, now)
+}
+
+// Dismiss silences the habit's reminder for the rest of the current period.
+// The next reminder comes when the habit would usually be reminded, but no
+// earlier than the start of its next period or the end of quiet hours.
+func Dismiss(database db.Database, userID, habitID, notificationID string, now time.Time) (*db.ReminderAction, error) {
+	habit, err := database.GetHabit(userID, habitID)
+	if err != nil {
+		return nil, err
+	}
+	reminder, err := database.GetReminder(userID, habitID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Without an owner the habit follows the default calendar
+	user, err := database.GetUserByID(userID)
+	if err != nil && !errors.Is(err, db.ErrNotFound) {
+		return nil, err
+	}
+	cal := user.Calendar()
+
+	local := now.In(cal.Location)
+	cadence := habit.Cadence(cal)
+	until := cadence.NextPeriodStart(cadence.PeriodStart(local))
+	if quiet, ok := user.QuietHours(); ok {
+		until = quiet.Defer(until)
+	}
+	if lastReminder, ok := db.ParseTimestampIn(reminder.LastReminder, cal.Location); ok {
+		if next := db.NextReminderTime(habit, user, lastReminder); next.After(until) {
+			until = next
+		}
+	}
+
+	return record(database, db.ReminderDismissed, userID, habitID, notificationID, until, now)
+}
+
+// record applies a snooze or dismissal. The inbox entry acted on is dismissed,
+// since the reminder will be sent again.
+func record(database db.Database, actionType db.ReminderActionType, userID, habitID, notificationID string, until, now time.Time) (*db.ReminderAction, error) {
+	if notificationID != "" {
+		if _, err := database.GetNotification(userID, notificationID); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := database.SnoozeReminder(userID, habitID, until); err != nil {
+		return nil, err
+	}
+
+	action := &db.ReminderAction{
+		UserID:         userID,
+		HabitID:        habitID,
+		NotificationID: notificationID,
+		Action:         actionType,
+		Until:          until,
+		CreatedAt:      now,
+	}
+	if err := database.CreateReminderAction(action); err != nil {
+		return nil, err
+	}
+
+	if notificationID != "" {
+		if _, err := database.UpdateNotificationPartial(userID, notificationID, map[string]interface{}{"dismissed": true}); err != nil {
+			return nil, err
+		}
+	}
+	return action, nil
+}
@@ -2,18 +2,39 @@ package reminder
 
 import (
 	"encoding/json"
+	"errors"
 	"log"
+	"sync"
 	"time"
 
 	"habit-tracker/server/db"
-	"habit-tracker/server/sockets"
+	"habit-tracker/server/notify"
+
+	"github.com/google/uuid"
 )
 
+// ReminderService sends each reminder when it falls due. The database keeps
+// every reminder's next-fire time; the service sleeps until the earliest one
+// and is woken early whenever a write schedules a reminder sooner.
+//
+// Replicas sharing a database elect a single worker through a lease stored in
+// it. The others stand by and take over once the lease expires.
 type ReminderService struct {
 	database      db.Database
-	ticker        *time.Ticker
+	dispatcher    *notify.Dispatcher
 	stopChan      chan bool
-	checkInterval time.Duration
+	done          chan struct{}
+	retryInterval time.Duration
+
+	// workerID identifies this replica as the lease holder
+	workerID      string
+	leaseDuration time.Duration
+	leaseExpiry   time.Time
+
+	// wake is signalled when pending holds a newly scheduled time
+	wake    chan struct{}
+	mutex   sync.Mutex
+	pending time.Time
 }
 
 type ReminderMessage struct {
@@ -29,67 +50,191 @@ type ReminderData struct {
 	Timestamp   string `json:"timestamp"`
 }
 
-const (
-	// Default user ID until proper user management is implemented
-	DefaultUserID = "user-123"
+// DefaultRetryInterval is how long reminders that could not be sent wait
+// before they are tried again
+const DefaultRetryInterval = time.Minute
 
-	DefaultCheckInterval = 5 * time.Minute
-)
+// DefaultLeaseDuration is how long the reminder worker keeps its lease without
+// renewing it, and so how long a dead worker's replicas wait to take over
+const DefaultLeaseDuration = 30 * time.Second
 
+// workerLease names the lease held by the active reminder worker
+const workerLease = "reminder-worker"
+
+// NewReminderService creates a service with no delivery channels; reminders
+// are only stored in the inbox until SetDispatcher provides some
 func NewReminderService(database db.Database) *ReminderService {
 	return &ReminderService{
 		database:      database,
+		dispatcher:    notify.NewDispatcher(),
 		stopChan:      make(chan bool),
-		checkInterval: DefaultCheckInterval,
+		done:          make(chan struct{}),
+		retryInterval: DefaultRetryInterval,
+		workerID:      uuid.New().String(),
+		leaseDuration: DefaultLeaseDuration,
+		wake:          make(chan struct{}, 1),
 	}
 }
 
-func (rs *ReminderService) SetCheckInterval(interval time.Duration) {
-	rs.checkInterval = interval
+func (rs *ReminderService) SetDispatcher(dispatcher *notify.Dispatcher) {
+	rs.dispatcher = dispatcher
+}
+
+func (rs *ReminderService) SetRetryInterval(interval time.Duration) {
+	rs.retryInterval = interval
+}
+
+// SetLeaseDuration must be called before Start. The lease is renewed three
+// times per duration.
+func (rs *ReminderService) SetLeaseDuration(duration time.Duration) {
+	rs.leaseDuration = duration
 }
 
+// Start sends any reminders already due and then waits for the next one, once
+// this replica holds the worker lease
 func (rs *ReminderService) Start() {
-	log.Printf("Starting reminder service with check interval: %v", rs.checkInterval)
+	log.Printf("Starting reminder service as worker %s", rs.workerID)
+	rs.database.SetReminderListener(rs.schedule)
+	go rs.run()
+}
 
-	rs.ticker = time.NewTicker(rs.checkInterval)
+// Stop waits for the service to release its lease, so another replica can take
+// over at once
+func (rs *ReminderService) Stop() {
+	rs.stopChan <- true
+	<-rs.done
+}
 
-	go rs.checkAndSendReminders()
+// schedule is the database's reminder listener. It never blocks: the earliest
+// time not yet seen by the run loop is kept, and the loop is signalled.
+func (rs *ReminderService) schedule(next time.Time) {
+	rs.mutex.Lock()
+	if rs.pending.IsZero() || next.Before(rs.pending) {
+		rs.pending = next
+	}
+	rs.mutex.Unlock()
 
-	go func() {
-		for {
-			select {
-			case <-rs.ticker.C:
-				rs.checkAndSendReminders()
-			case <-rs.stopChan:
-				log.Println("Reminder service stopped")
-				return
+	select {
+	case rs.wake <- struct{}{}:
+	default:
+	}
+}
+
+// run keeps a single timer armed for the earliest due reminder while this
+// replica is the reminder worker, renewing its lease as it goes
+func (rs *ReminderService) run() {
+	defer close(rs.done)
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	renew := time.NewTicker(rs.leaseDuration / 3)
+	defer renew.Stop()
+
+	// armed is when the timer fires; it is zero while nothing is scheduled
+	armed := time.Now()
+	leading := rs.elect()
+	if !leading {
+		timer.Stop()
+		armed = time.Time{}
+	}
+
+	for {
+		select {
+		case <-renew.C:
+			wasLeading := leading
+			leading = rs.elect()
+			switch {
+			case leading && !wasLeading:
+				log.Printf("Reminder worker %s took over", rs.workerID)
+				armed = time.Now()
+				timer.Reset(0)
+			case !leading && wasLeading:
+				log.Printf("Reminder worker %s lost its lease", rs.workerID)
+				armed = time.Time{}
+				timer.Stop()
+			case leading:
+				// Reminders scheduled by other replicas are only seen in the database
+				if next := rs.nextWakeUp(); !next.IsZero() && (armed.IsZero() || next.Before(armed)) {
+					armed = next
+					timer.Reset(time.Until(armed))
+				}
+			}
+		case <-timer.C:
+			if !leading {
+				continue
+			}
+			rs.sendDueReminders()
+			armed = rs.nextWakeUp()
+			if !armed.IsZero() {
+				timer.Reset(time.Until(armed))
+			}
+		case <-rs.wake:
+			rs.mutex.Lock()
+			next := rs.pending
+			rs.pending = time.Time{}
+			rs.mutex.Unlock()
+
+			if leading && !next.IsZero() && (armed.IsZero() || next.Before(armed)) {
+				armed = next
+				timer.Reset(time.Until(armed))
 			}
+		case <-rs.stopChan:
+			if leading {
+				if err := rs.database.ReleaseLease(workerLease, rs.workerID); err != nil {
+					log.Printf("Error releasing the reminder worker lease: %v", err)
+				}
+			}
+			log.Println("Reminder service stopped")
+			return
 		}
-	}()
+	}
 }
 
-func (rs *ReminderService) Stop() {
-	if rs.ticker != nil {
-		rs.ticker.Stop()
+// elect acquires or renews the worker lease, reporting whether this replica
+// is the reminder worker
+func (rs *ReminderService) elect() bool {
+	now := time.Now()
+	acquired, err := rs.database.AcquireLease(workerLease, rs.workerID, rs.leaseDuration)
+	if err != nil {
+		log.Printf("Error acquiring the reminder worker lease: %v", err)
+		return false
 	}
-	rs.stopChan <- true
+	if acquired {
+		rs.leaseExpiry = now.Add(rs.leaseDuration)
+	}
+	return acquired
 }
 
-func (rs *ReminderService) checkAndSendReminders() {
-	log.Println("Checking for habits needing reminders...")
+// nextWakeUp returns when the earliest reminder is due, or the zero time if
+// none is scheduled. Reminders that are still due after a pass could not be
+// sent, so they are retried after the retry interval.
+func (rs *ReminderService) nextWakeUp() time.Time {
+	now := time.Now()
+	next, ok, err := rs.database.NextReminderDue()
+	switch {
+	case err != nil:
+		log.Printf("Error finding the next reminder: %v", err)
+		return now.Add(rs.retryInterval)
+	case !ok:
+		return time.Time{}
+	case !next.After(now):
+		return now.Add(rs.retryInterval)
+	}
+	return next
+}
 
+func (rs *ReminderService) sendDueReminders() {
 	habits, err := rs.database.GetHabitsNeedingReminders()
 	if err != nil {
 		log.Printf("Error fetching habits needing reminders: %v", err)
 		return
 	}
 
-	if len(habits) == 0 {
-		log.Println("No habits need reminders at this time")
-		return
-	}
-
 	for _, habit := range habits {
+		// Another replica may take over once the lease runs out
+		if !time.Now().Before(rs.leaseExpiry) {
+			log.Printf("Reminder worker lease expired with reminders left to send")
+			return
+		}
 		if err := rs.sendReminderForHabit(habit); err != nil {
 			log.Printf("Error sending reminder for habit %s (%s): %v", habit.ID, habit.Name, err)
 			continue
@@ -97,24 +242,104 @@ func (rs *ReminderService) checkAndSendReminders() {
 	}
 }
 
+// sendReminderForHabit sends the habit's due reminder once. The send is
+// claimed in the database first, so no other worker sends it too; a claim left
+// by a worker that died mid-send is taken over and finished with the same
+// inbox entry.
 func (rs *ReminderService) sendReminderForHabit(habit *db.Habit) error {
+	now := time.Now()
+	reminder, err := rs.database.GetReminder(habit.UserID, habit.ID)
+	if err != nil {
+		return err
+	}
+	dueAt, err := time.Parse(time.RFC3339, reminder.NextReminder)
+	if err != nil {
+		return err
+	}
+
+	send := &db.ReminderSend{
+		UserID:    habit.UserID,
+		HabitID:   habit.ID,
+		DueAt:     dueAt,
+		Worker:    rs.workerID,
+		ClaimedAt: now,
+	}
+	claimed, err := rs.database.ClaimReminderSend(send, now.Add(-rs.leaseDuration))
+	if err != nil {
+		return err
+	}
+	if !claimed {
+		// The reminder was already sent for this due time, yet is due again
+		// because its last reminder was moved back. Counting from the due
+		// time moves it past the send instead of finding it due forever.
+		if !send.SentAt.IsZero() {
+			return rs.database.UpdateReminderLastReminder(habit.UserID, habit.ID, dueAt.Format(time.RFC3339))
+		}
+		return nil
+	}
+
 	reminderData := ReminderData{
 		HabitID:     habit.ID,
 		HabitName:   habit.Name,
 		Description: habit.Description,
 		Frequency:   string(habit.Frequency),
-		Timestamp:   time.Now().Format(time.RFC3339),
+		Timestamp:   now.Format(time.RFC3339),
+	}
+
+	body := "Time for " + habit.Name
+	if habit.Description != "" {
+		body += ": " + habit.Description
+	}
+	notification := notify.Notification{
+		ID:      send.NotificationID,
+		Type:    "reminder",
+		Subject: "Reminder: " + habit.Name,
+		Body:    body,
+		Data:    reminderData,
 	}
 
-	reminderMessage := ReminderMessage{
-		Type: "reminder",
-		Data: reminderData,
+	// Email needs the owner's address; the other channels only need the ID
+	user, err := rs.database.GetUserByID(habit.UserID)
+	switch {
+	case errors.Is(err, db.ErrNotFound):
+		user = &db.User{ID: habit.UserID}
+	case err != nil:
+		return err
+	default:
+		if err := rs.storeInInbox(habit, notification, now); err != nil {
+			return err
+		}
 	}
 
-	messageBytes, err := json.Marshal(reminderMessage)
+	// Once stored the reminder counts as sent even if delivery fails, so the
+	// habit is not reminded again until its next period
+	deliverErr := rs.dispatcher.Deliver(user, habit, notification)
+	if err := rs.database.CompleteReminderSend(send, time.Now()); err != nil {
+		return err
+	}
+	return deliverErr
+}
+
+// storeInInbox keeps the reminder for users who are offline. A send that is
+// taken over stores it under the same ID, which is only kept once.
+func (rs *ReminderService) storeInInbox(habit *db.Habit, notification notify.Notification, now time.Time) error {
+	data, err := json.Marshal(notification.Data)
 	if err != nil {
 		return err
 	}
 
-	return sockets.MessageUser(DefaultUserID, messageBytes)
+	entry := &db.Notification{
+		ID:        notification.ID,
+		UserID:    habit.UserID,
+		HabitID:   habit.ID,
+		Type:      notification.Type,
+		Subject:   notification.Subject,
+		Body:      notification.Body,
+		Data:      data,
+		CreatedAt: now,
+	}
+	if err := rs.database.CreateNotification(entry); err != nil && !errors.Is(err, db.ErrDuplicate) {
+		return err
+	}
+	return nil
 }
@@ -0,0 +1,265 @@
+package sockets
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"habit-tracker/server/auth"
+	"habit-tracker/server/db"
+
+	"github.com/gorilla/websocket"
+)
+
+// Defaults for the Hub's tunable fields
+const (
+	DefaultAuthTimeout   = 10 * time.Second
+	DefaultPingInterval  = 30 * time.Second
+	DefaultPongWait      = 60 * time.Second
+	DefaultWriteWait     = 10 * time.Second
+	DefaultSendQueueSize = 64
+	maxMessageSize       = 64 * 1024
+)
+
+// Hub tracks every authenticated connection by user. Each connection has its
+// own buffered send queue drained by a write goroutine, so a slow client never
+// holds up delivery to the others; a client whose queue fills up is evicted.
+type Hub struct {
+	// AuthService validates the bearer tokens presented by clients
+	AuthService *auth.AuthService
+	// Database holds the notification inbox replayed to newly authenticated
+	// connections. It is optional.
+	Database db.Database
+
+	// AuthTimeout is how long a connection may stay open without authenticating
+	AuthTimeout time.Duration
+	// PingInterval is how often clients are pinged; a client that has not
+	// answered within PongWait is dropped
+	PingInterval time.Duration
+	PongWait     time.Duration
+	// WriteWait bounds how long a single write may take
+	WriteWait time.Duration
+	// SendQueueSize is the number of messages buffered per connection
+	SendQueueSize int
+
+	mutex sync.RWMutex
+	users map[string]map[*client]bool
+}
+
+func NewHub(authService *auth.AuthService, database db.Database) *Hub {
+	return &Hub{
+		AuthService:   authService,
+		Database:      database,
+		AuthTimeout:   DefaultAuthTimeout,
+		PingInterval:  DefaultPingInterval,
+		PongWait:      DefaultPongWait,
+		WriteWait:     DefaultWriteWait,
+		SendQueueSize: DefaultSendQueueSize,
+		users:         make(map[string]map[*client]bool),
+	}
+}
+
+// register adds an authenticated client under its user
+func (h *Hub) register(c *client, userID string) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	c.userID = userID
+	if h.users[userID] == nil {
+		h.users[userID] = make(map[*client]bool)
+	}
+	h.users[userID][c] = true
+}
+
+// unregister removes a client; it is a no-op for clients that never
+// authenticated or were already removed
+func (h *Hub) unregister(c *client) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	userClients, ok := h.users[c.userID]
+	if !ok {
+		return
+	}
+	delete(userClients, c)
+	if len(userClients) == 0 {
+		delete(h.users, c.userID)
+	}
+}
+
+// ConnectionCount returns how many authenticated connections a user has open
+func (h *Hub) ConnectionCount(userID string) int {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	return len(h.users[userID])
+}
+
+// connections returns the clients of a user. Messages are queued after the
+// lock is released because evicting a slow client unregisters it.
+func (h *Hub) connections(userID string) []*client {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+
+	clients := make([]*client, 0, len(h.users[userID]))
+	for c := range h.users[userID] {
+		clients = append(clients, c)
+	}
+	return clients
+}
+
+// MessageUser queues a message on every connection the user has open. It
+// returns ErrNotConnected if the user has none.
+func (h *Hub) MessageUser(userID string, message []byte) error {
+	clients := h.connections(userID)
+	if len(clients) == 0 {
+		log.Printf("User %s not found or not connected", userID)
+		return ErrNotConnected
+	}
+
+	id := notificationID(message)
+	for _, c := range clients {
+		if id == "" || c.markNotified(id) {
+			c.queue(message)
+		}
+	}
+	return nil
+}
+
+// notificationID returns the ID of a notification message, or "" for other
+// messages
+func notificationID(message []byte) string {
+	var notification struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(message, &notification); err != nil {
+		return ""
+	}
+	return notification.ID
+}
+
+// Publish sends a typed event to every connection the user has open. Users
+// with no open connection have nothing to sync, so that is not an error.
+func (h *Hub) Publish(userID, eventType string, payload interface{}) error {
+	message, err := json.Marshal(Message{Type: eventType, Data: payload})
+	if err != nil {
+		return err
+	}
+	if err := h.MessageUser(userID, message); err != nil && !errors.Is(err, ErrNotConnected) {
+		return err
+	}
+	return nil
+}
+
+// client is a single connection and its send queue
+type client struct {
+	hub  *Hub
+	conn *websocket.Conn
+	send chan []byte
+	// userID is set by the hub when the client is registered
+	userID string
+
+	// done is closed once the connection is shutting down
+	done      chan struct{}
+	closeOnce sync.Once
+
+	// notified holds the IDs of the notifications queued so far, so that one
+	// both replayed and delivered live is only sent once
+	notifiedMutex sync.Mutex
+	notified      map[string]bool
+}
+
+func newClient(hub *Hub, conn *websocket.Conn) *client {
+	return &client{
+		hub:      hub,
+		conn:     conn,
+		send:     make(chan []byte, hub.SendQueueSize),
+		done:     make(chan struct{}),
+		notified: make(map[string]bool),
+	}
+}
+
+// markNotified records that the notification is being sent to the client. It
+// returns false if it already was.
+func (c *client) markNotified(id string) bool {
+	c.notifiedMutex.Lock()
+	defer c.notifiedMutex.Unlock()
+
+	if c.notified[id] {
+		return false
+	}
+	c.notified[id] = true
+	return true
+}
+
+// queue adds a message without blocking, evicting the client if its queue is full
+func (c *client) queue(message []byte) {
+	select {
+	case c.send <- message:
+	case <-c.done:
+	default:
+		c.evict()
+	}
+}
+
+// evict stops delivering to the client straight away. Closing may wait for the
+// blocked writer, so it happens in the background.
+func (c *client) evict() {
+	log.Printf("Evicting slow client %s", c.conn.RemoteAddr())
+	c.hub.unregister(c)
+	go c.close(websocket.CloseTryAgainLater, "send queue full")
+}
+
+// queueWait adds a message, waiting for room. It is used for replies to the
+// client's own requests, which are sent from its read goroutine.
+func (c *client) queueWait(message []byte) {
+	select {
+	case c.send <- message:
+	case <-c.done:
+	}
+}
+
+// reply queues the answer to one of the client's requests
+func (c *client) reply(reply Reply) {
+	message, err := json.Marshal(reply)
+	if err != nil {
+		log.Printf("Error marshaling reply: %v", err)
+		return
+	}
+	c.queueWait(message)
+}
+
+// close sends a close frame and drops the connection, once
+func (c *client) close(code int, reason string) {
+	c.closeOnce.Do(func() {
+		close(c.done)
+		closeWithReason(c.conn, code, reason, c.hub.WriteWait)
+	})
+}
+
+// writePump drains the send queue and pings the client until the connection closes
+func (c *client) writePump() {
+	ticker := time.NewTicker(c.hub.PingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case message := <-c.send:
+			c.conn.SetWriteDeadline(time.Now().Add(c.hub.WriteWait))
+			if err := c.conn.WriteMessage(websocket.TextMessage, message); err != nil {
+				log.Printf("Error sending message to client: %v", err)
+				c.close(websocket.CloseGoingAway, "write failed")
+				return
+			}
+		case <-ticker.C:
+			deadline := time.Now().Add(c.hub.WriteWait)
+			if err := c.conn.WriteControl(websocket.PingMessage, nil, deadline); err != nil {
+				c.close(websocket.CloseGoingAway, "ping failed")
+				return
+			}
+		case <-c.done:
+			return
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package sockets
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+
+	"habit-tracker/server/db"
+	"habit-tracker/server/handlers"
+	"habit-tracker/server/reminder"
+)
+
+// ProtocolVersion is the version of the request/reply envelope. Requests
+// without a version are treated as this version.
+const ProtocolVersion = 1
+
+// Error codes carried in failed replies
+const (
+	CodeBadRequest         = "bad_request"
+	CodeUnknownType        = "unknown_type"
+	CodeUnsupportedVersion = "unsupported_version"
+	CodeUnauthenticated    = "unauthenticated"
+	CodeNotFound           = "not_found"
+	CodeConflict           = "conflict"
+	CodeInternal           = "internal"
+)
+
+// Request is a message sent by a client. The reply carries the same ID so
+// clients can have several requests in flight.
+type Request struct {
+	Version int             `json:"v,omitempty"`
+	ID      string          `json:"id,omitempty"`
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+	// Data holds the payload of auth messages from clients that predate the envelope
+	Data json.RawMessage `json:"data,omitempty"`
+}
+
+// Reply answers a Request. Successful replies repeat the request type and
+// carry a payload; failed ones have type "error" and an Error.
+type Reply struct {
+	Version int         `json:"v"`
+	ID      string      `json:"id,omitempty"`
+	Type    string      `json:"type"`
+	Payload interface{} `json:"payload,omitempty"`
+	Error   *RPCError   `json:"error,omitempty"`
+}
+
+// RPCError describes why a request failed
+type RPCError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *RPCError) Error() string {
+	return e.Code + ": " + e.Message
+}
+
+func newRPCError(code, format string, args ...interface{}) *RPCError {
+	return &RPCError{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// operation handles one request type for an authenticated user
+type operation func(h *Hub, userID string, payload json.RawMessage) (interface{}, error)
+
+var operations = map[string]operation{
+	"habits.list":      listHabits,
+	"tracking.create":  createTracking,
+	"reminder.snooze":  snoozeReminder,
+	"reminder.dismiss": dismissReminder,
+}
+
+// call runs a request and builds its reply
+func (h *Hub) call(userID string, request Request) Reply {
+	payload, err := h.run(userID, request)
+	if err != nil {
+		return errorReply(request.ID, err)
+	}
+	return Reply{Version: ProtocolVersion, ID: request.ID, Type: request.Type, Payload: payload}
+}
+
+func (h *Hub) run(userID string, request Request) (interface{}, error) {
+	if request.Version != 0 && request.Version != ProtocolVersion {
+		return nil, newRPCError(CodeUnsupportedVersion, "protocol version %d is not supported", request.Version)
+	}
+	op, ok := operations[request.Type]
+	if !ok {
+		return nil, newRPCError(CodeUnknownType, "unknown message type %q", request.Type)
+	}
+	if userID == "" {
+		return nil, newRPCError(CodeUnauthenticated, "authenticate before sending %s", request.Type)
+	}
+	if h.Database == nil {
+		return nil, newRPCError(CodeInternal, "no database configured")
+	}
+	return op(h, userID, request.Payload)
+}
+
+// errorReply maps an operation's error to an error code
+func errorReply(id string, err error) Reply {
+	var rpcErr *RPCError
+	switch {
+	case errors.As(err, &rpcErr):
+	case errors.Is(err, db.ErrNotFound):
+		rpcErr = newRPCError(CodeNotFound, "not found")
+	case errors.Is(err, db.ErrDuplicate):
+		rpcErr = newRPCError(CodeConflict, "already exists")
+	case errors.Is(err, reminder.ErrInvalidSnooze), errors.Is(err, db.ErrValidation):
+		rpcErr = newRPCError(CodeBadRequest, err.Error())
+	default:
+		log.Printf("Error handling socket request %s: %v", id, err)
+		rpcErr = newRPCError(CodeInternal, "request failed")
+	}
+	return Reply{Version: ProtocolVersion, ID: id, Type: "error", Error: rpcErr}
+}
+
+// decodePayload unmarshals an optional payload into v
+func decodePayload(payload json.RawMessage, v interface{}) error {
+	if len(payload) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(payload, v); err != nil {
+		return newRPCError(CodeBadRequest, "invalid payload: %v", err)
+	}
+	return nil
+}
+
+// ListHabitsPayload optionally limits habits.list to some statuses
+type ListHabitsPayload struct {
+	Status []string `json:"status,omitempty"`
+}
+
+func listHabits(h *Hub, userID string, payload json.RawMessage) (interface{}, error) {
+	var request ListHabitsPayload
+	if err := decodePayload(payload, &request); err != nil {
+		return nil, err
+	}
+
+	statuses := make(map[db.HabitStatus]bool)
+	for _, status := range request.Status {
+		if err := db.ValidateStatus(status); err != nil {
+			return nil, newRPCError(CodeBadRequest, "invalid status: must be one of active, paused, archived")
+		}
+		statuses[db.HabitStatus(status)] = true
+	}
+
+	habits, err := h.Database.GetAllHabits(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	filtered := []*db.Habit{}
+	for _, habit := range habits {
+		if len(statuses) == 0 || statuses[habit.Status] {
+			filtered = append(filtered, habit)
+		}
+	}
+	return filtered, nil
+}
+
+// createTracking logs an entry like POST /habits/:id/tracking, with the habit
+// named by the payload's habitId
+func createTracking(h *Hub, userID string, payload json.RawMessage) (interface{}, error) {
+	var entry db.TrackingEntry
+	if err := decodePayload(payload, &entry); err != nil {
+		return nil, err
+	}
+	if entry.HabitID == "" {
+		return nil, newRPCError(CodeBadRequest, "habitId is required")
+	}
+
+	if err := handlers.LogTracking(h.Database, h, userID, &entry); err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// SnoozeReminderPayload names the habit whose reminder is snoozed, and for how long
+type SnoozeReminderPayload struct {
+	HabitID string `json:"habitId"`
+	reminder.SnoozeRequest
+}
+
+// snoozeReminder sends the habit's reminder again after the snooze, like
+// POST /habits/:id/reminder/snooze
+func snoozeReminder(h *Hub, userID string, payload json.RawMessage) (interface{}, error) {
+	var request SnoozeReminderPayload
+	if err := decodePayload(payload, &request); err != nil {
+		return nil, err
+	}
+	if request.HabitID == "" {
+		return nil, newRPCError(CodeBadRequest, "habitId is required")
+	}
+
+	return handlers.SnoozeHabitReminder(h.Database, h, userID, request.HabitID, request.SnoozeRequest)
+}
+
+// DismissReminderPayload names the habit whose reminder is dismissed
+type DismissReminderPayload struct {
+	HabitID        string `json:"habitId"`
+	NotificationID string `json:"notificationId,omitempty"`
+}
+
+// dismissReminder silences the habit's reminder for the rest of its period,
+// like POST /habits/:id/reminder/dismiss
+func dismissReminder(h *Hub, userID string, payload json.RawMessage) (interface{}, error) {
+	var request DismissReminderPayload
+	if err := decodePayload(payload, &request); err != nil {
+		return nil, err
+	}
+	if request.HabitID == "" {
+		return nil, newRPCError(CodeBadRequest, "habitId is required")
+	}
+
+	return handlers.DismissHabitReminder(h.Database, h, userID, request.HabitID, request.NotificationID)
+}
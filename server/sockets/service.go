@@ -2,9 +2,14 @@ package sockets
 
 import (
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
-	"sync"
+	"strings"
+	"time"
+
+	"habit-tracker/server/auth"
+	"habit-tracker/server/db"
 
 	"github.com/gorilla/websocket"
 )
@@ -15,10 +20,11 @@ var upgrader = websocket.Upgrader{
 	},
 }
 
-var clients = make(map[*websocket.Conn]bool)         // Connected clients
-var clientUserMap = make(map[*websocket.Conn]string) // Map client connections to user IDs
-var broadcast = make(chan []byte)                    // Broadcast channel
-var mutex = &sync.Mutex{}                            // Protect clients map
+var errUserMismatch = errors.New("token belongs to a different user")
+
+// ErrNotConnected is returned when a message is sent to a user with no
+// authenticated connection
+var ErrNotConnected = errors.New("user not connected")
 
 type Message struct {
 	Type string      `json:"type"`
@@ -26,33 +32,197 @@ type Message struct {
 }
 
 type AuthData struct {
-	UserID string `json:"userId"`
+	Token string `json:"token"`
+}
+
+// AuthenticatedData is sent back to a client once its token is accepted
+type AuthenticatedData struct {
+	UserID    string    `json:"userId"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// InboxMessage is an unread inbox notification replayed to a socket after it
+// authenticates, in the same shape as live notifications
+type InboxMessage struct {
+	Type     string          `json:"type"`
+	ID       string          `json:"id"`
+	Data     json.RawMessage `json:"data,omitempty"`
+	Replayed bool            `json:"replayed"`
+}
+
+// session tracks the authentication state of a single connection. It is only
+// used from the connection's read goroutine.
+type session struct {
+	hub         *Hub
+	client      *client
+	userID      string
+	authTimer   *time.Timer
+	expiryTimer *time.Timer
+}
+
+// bearerToken extracts a token from the handshake, either from the
+// Authorization header or the token query parameter (browsers cannot set
+// headers on WebSocket requests)
+func bearerToken(r *http.Request) string {
+	if header := r.Header.Get("Authorization"); strings.HasPrefix(header, "Bearer ") {
+		return strings.TrimPrefix(header, "Bearer ")
+	}
+	return r.URL.Query().Get("token")
+}
+
+// closeWithReason sends a close frame before dropping the connection
+func closeWithReason(conn *websocket.Conn, code int, reason string, wait time.Duration) {
+	deadline := time.Now().Add(wait)
+	conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), deadline)
+	conn.Close()
+}
+
+// authenticate validates the token and registers the connection for its user.
+// Re-authenticating with a fresh token extends the connection's lifetime.
+func (s *session) authenticate(token string) error {
+	if s.hub.AuthService == nil {
+		return auth.ErrInvalidToken
+	}
+
+	claims, err := s.hub.AuthService.ValidateToken(token)
+	if err != nil {
+		return err
+	}
+	expiresAt, err := claims.GetExpirationTime()
+	if err != nil || expiresAt == nil {
+		return auth.ErrInvalidToken
+	}
+
+	// Rejects revoked sessions and deleted users
+	user, err := s.hub.AuthService.GetUserFromToken(token)
+	if err != nil {
+		return err
+	}
+	if s.userID != "" && s.userID != user.ID {
+		return errUserMismatch
+	}
+
+	firstAuth := s.userID == ""
+	s.userID = user.ID
+	s.authTimer.Stop()
+	if s.expiryTimer != nil {
+		s.expiryTimer.Stop()
+	}
+	c := s.client
+	s.expiryTimer = time.AfterFunc(time.Until(expiresAt.Time), func() {
+		log.Printf("Token expired for user %s, closing connection", user.ID)
+		c.close(websocket.ClosePolicyViolation, "token expired")
+	})
+
+	// Acknowledge so the client knows when it must re-authenticate
+	ack, err := json.Marshal(Message{
+		Type: "authenticated",
+		Data: AuthenticatedData{UserID: user.ID, ExpiresAt: expiresAt.Time},
+	})
+	if err != nil {
+		return err
+	}
+
+	// The acknowledgement is queued before the connection can receive
+	// anything else
+	c.queueWait(ack)
+	if !firstAuth {
+		return nil
+	}
+
+	// The unread backlog is replayed once per connection, not on token
+	// refreshes. It is read after registering, so a notification stored in
+	// between is delivered live or replayed, and never both.
+	s.hub.register(c, user.ID)
+	if s.hub.Database == nil {
+		return nil
+	}
+	backlog, err := s.hub.Database.GetNotifications(user.ID, true)
+	if err != nil {
+		log.Printf("Error loading unread notifications for user %s: %v", user.ID, err)
+		return nil
+	}
+	return replay(c, backlog)
+}
+
+// replay queues unread notifications oldest first, skipping any already
+// delivered live
+func replay(c *client, backlog []*db.Notification) error {
+	for i := len(backlog) - 1; i >= 0; i-- {
+		notification := backlog[i]
+		if !c.markNotified(notification.ID) {
+			continue
+		}
+		message, err := json.Marshal(InboxMessage{
+			Type:     notification.Type,
+			ID:       notification.ID,
+			Data:     notification.Data,
+			Replayed: true,
+		})
+		if err != nil {
+			return err
+		}
+		c.queueWait(message)
+	}
+	return nil
 }
 
-func WSHandler(w http.ResponseWriter, r *http.Request) {
+// ServeHTTP upgrades the request to a WebSocket and reads from it until it closes
+func (h *Hub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	log.Printf("WebSocket connection attempt from: %s", r.RemoteAddr)
 
+	// A token presented during the handshake is checked before upgrading
+	handshakeToken := bearerToken(r)
+	if handshakeToken != "" && h.AuthService != nil {
+		if _, err := h.AuthService.GetUserFromToken(handshakeToken); err != nil {
+			http.Error(w, "Invalid or expired token", http.StatusUnauthorized)
+			return
+		}
+	}
+
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		log.Printf("Error upgrading connection: %v", err)
 		return
 	}
+
+	c := newClient(h, conn)
+	go c.writePump()
+
+	// Connections that do not authenticate in time are closed
+	s := &session{hub: h, client: c}
+	s.authTimer = time.AfterFunc(h.AuthTimeout, func() {
+		log.Printf("Client %s did not authenticate in time", r.RemoteAddr)
+		c.close(websocket.ClosePolicyViolation, "authentication timeout")
+	})
+
 	defer func() {
-		conn.Close()
-		mutex.Lock()
-		delete(clients, conn)
-		delete(clientUserMap, conn)
-		clientCount := len(clients)
-		mutex.Unlock()
-		log.Printf("Client disconnected and cleaned up. Total clients: %d", clientCount)
+		s.authTimer.Stop()
+		if s.expiryTimer != nil {
+			s.expiryTimer.Stop()
+		}
+		c.close(websocket.CloseNormalClosure, "")
+		h.unregister(c)
+		log.Printf("Client disconnected and cleaned up. Connections for user: %d", h.ConnectionCount(s.userID))
 	}()
 
-	mutex.Lock()
-	clients[conn] = true
-	clientCount := len(clients)
-	mutex.Unlock()
+	// Clients must answer pings within PongWait
+	conn.SetReadLimit(maxMessageSize)
+	conn.SetReadDeadline(time.Now().Add(h.PongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(h.PongWait))
+	})
+
+	if handshakeToken != "" {
+		if err := s.authenticate(handshakeToken); err != nil {
+			log.Printf("Error authenticating client: %v", err)
+			c.close(websocket.ClosePolicyViolation, "authentication failed")
+			return
+		}
+		log.Printf("Client authenticated with user ID: %s", s.userID)
+	}
 
-	log.Printf("Client connected. Total clients: %d", clientCount)
+	log.Printf("Client connected from: %s", r.RemoteAddr)
 
 	for {
 		_, messageBytes, err := conn.ReadMessage()
@@ -61,86 +231,34 @@ func WSHandler(w http.ResponseWriter, r *http.Request) {
 			break
 		}
 
-		var msg Message
-		if err := json.Unmarshal(messageBytes, &msg); err != nil {
-			log.Printf("Error parsing message: %v", err)
+		var request Request
+		if err := json.Unmarshal(messageBytes, &request); err != nil {
+			c.reply(errorReply("", newRPCError(CodeBadRequest, "invalid JSON")))
 			continue
 		}
 
-		if msg.Type == "auth" {
-			authDataBytes, err := json.Marshal(msg.Data)
-			if err != nil {
-				log.Printf("Error marshaling auth data: %v", err)
-				continue
+		if request.Type == "auth" {
+			authPayload := request.Payload
+			if len(authPayload) == 0 {
+				authPayload = request.Data
 			}
 
 			var authData AuthData
-			if err := json.Unmarshal(authDataBytes, &authData); err != nil {
-				log.Printf("Error parsing auth data: %v", err)
+			if err := json.Unmarshal(authPayload, &authData); err != nil {
+				c.reply(errorReply(request.ID, newRPCError(CodeBadRequest, "invalid auth payload")))
 				continue
 			}
 
-			mutex.Lock()
-			clientUserMap[conn] = authData.UserID
-			mutex.Unlock()
-
-			log.Printf("Client authenticated with user ID: %s", authData.UserID)
-			continue
-		}
-
-		log.Printf("Received message: %s", string(messageBytes))
-		broadcast <- messageBytes
-	}
-}
-
-func HandleMessages() {
-	log.Println("WebSocket message handler started")
-	for {
-
-		message := <-broadcast
-		log.Printf("Broadcasting message to %d clients: %s", len(clients), string(message))
-
-		mutex.Lock()
-		for client := range clients {
-			err := client.WriteMessage(websocket.TextMessage, message)
-			if err != nil {
-				log.Printf("Error sending message to client: %v", err)
-				client.Close()
-				delete(clients, client)
-				delete(clientUserMap, client)
+			if err := s.authenticate(authData.Token); err != nil {
+				log.Printf("Error authenticating client: %v", err)
+				c.close(websocket.ClosePolicyViolation, "authentication failed")
+				break
 			}
-		}
-		mutex.Unlock()
-	}
-}
 
-func MessageUser(userID string, message []byte) error {
-	mutex.Lock()
-	defer mutex.Unlock()
-
-	var targetConn *websocket.Conn
-	for conn, connUserID := range clientUserMap {
-		if connUserID == userID {
-			targetConn = conn
-			break
+			log.Printf("Client authenticated with user ID: %s", s.userID)
+			continue
 		}
-	}
-
-	if targetConn == nil {
-		log.Printf("User %s not found or not connected", userID)
-		return nil
-	}
 
-	err := targetConn.WriteMessage(websocket.TextMessage, message)
-	if err != nil {
-		log.Printf("Error sending message to user %s: %v", userID, err)
-
-		targetConn.Close()
-		delete(clients, targetConn)
-		delete(clientUserMap, targetConn)
-		return err
+		c.reply(h.call(s.userID, request))
 	}
-
-	log.Printf("Message sent to user %s: %s", userID, string(message))
-	return nil
 }
@@ -0,0 +1,339 @@
+// Package stats computes habit statistics from completion times. It knows
+// nothing about storage, so every database backend produces the same numbers.
+package stats
+
+import (
+	"sort"
+	"time"
+)
+
+// dateFormat is the layout used for per-day buckets
+const dateFormat = "2006-01-02"
+
+// Cadence divides time into the periods a habit is expected to be completed in
+type Cadence interface {
+	// PeriodStart returns the start of the period containing t
+	PeriodStart(t time.Time) time.Time
+	// NextPeriodStart returns the start of the period after the one beginning at periodStart
+	NextPeriodStart(periodStart time.Time) time.Time
+}
+
+// Aggregation combines the values recorded in a period before they are
+// compared with a habit's target
+type Aggregation string
+
+const (
+	AggregationSum   Aggregation = "sum"
+	AggregationCount Aggregation = "count"
+	AggregationMax   Aggregation = "max"
+)
+
+// IsValid reports whether a is a known aggregation
+func (a Aggregation) IsValid() bool {
+	switch a {
+	case AggregationSum, AggregationCount, AggregationMax:
+		return true
+	}
+	return false
+}
+
+// Completion is a single tracked occurrence and the amount recorded with it
+type Completion struct {
+	Time  time.Time
+	Value float64
+}
+
+// Pause is a stretch of time in which a habit is not expected to be done. A
+// zero End means the pause is ongoing.
+type Pause struct {
+	Start time.Time
+	End   time.Time
+}
+
+// Habit is the statistics view of a habit: when it started, how often it is
+// due, what counts as done and when it was completed. A habit without a
+// target is done for a period as soon as it has one completion. Periods that
+// overlap a pause are neither expected nor break streaks unless they were
+// completed anyway.
+type Habit struct {
+	Cadence     Cadence
+	Start       time.Time
+	Completions []Completion
+	Target      float64
+	Aggregation Aggregation
+	Pauses      []Pause
+}
+
+// Summary holds the per-habit statistics
+type Summary struct {
+	TotalEntries   int
+	CurrentStreak  int
+	LongestStreak  int
+	CompletionRate float64
+	LastCompleted  time.Time
+}
+
+// Rate compares completions with what the cadence expects over a window
+type Rate struct {
+	ActualCompletions   int
+	ExpectedCompletions int
+	CompletionRate      float64
+}
+
+// Overview holds statistics across all of a user's habits
+type Overview struct {
+	TotalHabits      int
+	TotalEntries     int
+	EntriesToday     int
+	EntriesThisWeek  int
+	AvgEntriesPerDay float64
+}
+
+// DayCount is the number of completions on a single day and the sum of their values
+type DayCount struct {
+	Date  string
+	Count int
+	Value float64
+}
+
+// Summarize computes streaks, completion rate and totals for a habit
+func Summarize(habit Habit, now time.Time) Summary {
+	summary := Summary{TotalEntries: len(habit.Completions)}
+	for _, completion := range habit.Completions {
+		if completion.Time.After(summary.LastCompleted) {
+			summary.LastCompleted = completion.Time
+		}
+	}
+
+	summary.CurrentStreak, summary.LongestStreak = Streaks(habit, now)
+	summary.CompletionRate = CompletionRate(habit, habit.Start, now).CompletionRate
+	return summary
+}
+
+// Streaks counts consecutive satisfied periods of a habit. The current
+// streak ends at the period containing now; an unsatisfied current period
+// does not break it until the period is over.
+func Streaks(habit Habit, now time.Time) (current, longest int) {
+	cadence := habit.Cadence
+	satisfied := habit.satisfiedPeriods(habit.Completions, now.Location())
+	if len(satisfied) == 0 {
+		return 0, 0
+	}
+
+	periods := make([]time.Time, 0, len(satisfied))
+	for _, start := range satisfied {
+		periods = append(periods, start)
+	}
+	sort.Slice(periods, func(i, j int) bool { return periods[i].Before(periods[j]) })
+
+	run := 0
+	for i, period := range periods {
+		if i > 0 && habit.nextCountedPeriod(periods[i-1], period).Equal(period) {
+			run++
+		} else {
+			run = 1
+		}
+		if run > longest {
+			longest = run
+		}
+	}
+
+	// Walk back from the current period, skipping it if it is still open and
+	// stepping over paused periods
+	period := cadence.PeriodStart(now)
+	if _, ok := satisfied[period.Unix()]; !ok {
+		period = previousPeriodStart(cadence, period)
+	}
+	for {
+		if _, ok := satisfied[period.Unix()]; ok {
+			current++
+		} else if !habit.paused(period) {
+			break
+		}
+		period = previousPeriodStart(cadence, period)
+	}
+
+	return current, longest
+}
+
+// CompletionRate compares the periods satisfied between from and now with
+// the number of periods the cadence expects. Windows never reach back before
+// the habit's start, and the current period only counts once it is satisfied.
+func CompletionRate(habit Habit, from, now time.Time) Rate {
+	if !habit.Start.IsZero() && from.Before(habit.Start) {
+		from = habit.Start
+	}
+
+	var rate Rate
+	var inWindow []Completion
+	for _, completion := range habit.Completions {
+		if !completion.Time.Before(from) && !completion.Time.After(now) {
+			inWindow = append(inWindow, completion)
+		}
+	}
+	rate.ActualCompletions = len(inWindow)
+
+	satisfied := habit.satisfiedPeriods(inWindow, now.Location())
+	current := habit.Cadence.PeriodStart(now)
+	for period := habit.Cadence.PeriodStart(from.In(now.Location())); !period.After(now); period = habit.Cadence.NextPeriodStart(period) {
+		_, done := satisfied[period.Unix()]
+		if period.Equal(current) && !done {
+			break
+		}
+		if !done && habit.paused(period) {
+			continue
+		}
+		rate.ExpectedCompletions++
+	}
+
+	if rate.ExpectedCompletions > 0 {
+		rate.CompletionRate = float64(len(satisfied)) / float64(rate.ExpectedCompletions)
+	}
+	return rate
+}
+
+// Overall computes statistics across habits. "This week" covers the last
+// seven days and the average is taken over the last thirty.
+func Overall(habits []Habit, now time.Time) Overview {
+	today := startOfDay(now)
+	weekStart := today.AddDate(0, 0, -6)
+	monthStart := today.AddDate(0, 0, -29)
+
+	overview := Overview{TotalHabits: len(habits)}
+	lastThirtyDays := 0
+	for _, habit := range habits {
+		for _, completion := range habit.Completions {
+			completion := completion.Time.In(now.Location())
+			overview.TotalEntries++
+			if !completion.Before(today) {
+				overview.EntriesToday++
+			}
+			if !completion.Before(weekStart) {
+				overview.EntriesThisWeek++
+			}
+			if !completion.Before(monthStart) {
+				lastThirtyDays++
+			}
+		}
+	}
+
+	overview.AvgEntriesPerDay = float64(lastThirtyDays) / 30
+	return overview
+}
+
+// DailyCounts buckets completions by day over the last days days, including
+// today. Days without completions are omitted and the result is ordered by date.
+func DailyCounts(completions []Completion, days int, now time.Time) []DayCount {
+	from := WindowStart(days, now)
+
+	counts := make(map[string]*DayCount)
+	for _, completion := range completions {
+		at := completion.Time.In(now.Location())
+		if at.Before(from) || at.After(now) {
+			continue
+		}
+		date := at.Format(dateFormat)
+		if counts[date] == nil {
+			counts[date] = &DayCount{Date: date}
+		}
+		counts[date].Count++
+		counts[date].Value += completion.Value
+	}
+
+	result := make([]DayCount, 0, len(counts))
+	for _, count := range counts {
+		result = append(result, *count)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Date < result[j].Date })
+	return result
+}
+
+// WindowStart returns the start of a window covering the last days days,
+// including today
+func WindowStart(days int, now time.Time) time.Time {
+	if days < 1 {
+		days = 1
+	}
+	return startOfDay(now).AddDate(0, 0, -(days - 1))
+}
+
+func startOfDay(t time.Time) time.Time {
+	year, month, day := t.Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, t.Location())
+}
+
+// satisfiedPeriods returns the starts of the periods in which the
+// completions meet the habit's target, keyed by Unix time
+func (habit Habit) satisfiedPeriods(completions []Completion, loc *time.Location) map[int64]time.Time {
+	starts := make(map[int64]time.Time)
+	values := make(map[int64][]float64)
+	for _, completion := range completions {
+		start := habit.Cadence.PeriodStart(completion.Time.In(loc))
+		starts[start.Unix()] = start
+		values[start.Unix()] = append(values[start.Unix()], completion.Value)
+	}
+
+	satisfied := make(map[int64]time.Time)
+	for key, start := range starts {
+		if habit.meetsTarget(values[key]) {
+			satisfied[key] = start
+		}
+	}
+	return satisfied
+}
+
+// paused reports whether the period starting at periodStart overlaps a pause
+func (habit Habit) paused(periodStart time.Time) bool {
+	if len(habit.Pauses) == 0 {
+		return false
+	}
+	periodEnd := habit.Cadence.NextPeriodStart(periodStart)
+	for _, pause := range habit.Pauses {
+		if periodEnd.After(pause.Start) && (pause.End.IsZero() || periodStart.Before(pause.End)) {
+			return true
+		}
+	}
+	return false
+}
+
+// nextCountedPeriod returns the first period after from that is not paused,
+// stopping early at until
+func (habit Habit) nextCountedPeriod(from, until time.Time) time.Time {
+	period := habit.Cadence.NextPeriodStart(from)
+	for period.Before(until) && habit.paused(period) {
+		period = habit.Cadence.NextPeriodStart(period)
+	}
+	return period
+}
+
+// meetsTarget reports whether a period's recorded values complete the habit
+func (habit Habit) meetsTarget(values []float64) bool {
+	if habit.Target <= 0 {
+		return len(values) > 0
+	}
+	return Aggregate(habit.Aggregation, values) >= habit.Target
+}
+
+// Aggregate combines a period's values. An empty aggregation sums them.
+func Aggregate(aggregation Aggregation, values []float64) float64 {
+	total := 0.0
+	for _, value := range values {
+		switch aggregation {
+		case AggregationCount:
+			total++
+		case AggregationMax:
+			if value > total {
+				total = value
+			}
+		default:
+			total += value
+		}
+	}
+	return total
+}
+
+// previousPeriodStart returns the start of the period before the one that
+// begins at periodStart
+func previousPeriodStart(cadence Cadence, periodStart time.Time) time.Time {
+	return cadence.PeriodStart(periodStart.Add(-time.Nanosecond))
+}
@@ -69,9 +69,10 @@ func (suite *AuthTestSuite) TestLoginSuccess() {
 	suite.NoError(err)
 
 	// Login with correct credentials
-	token, user, err := suite.authService.Login(email, password)
+	tokens, user, err := suite.authService.Login(email, password)
 	suite.NoError(err)
-	suite.NotEmpty(token)
+	suite.NotEmpty(tokens.AccessToken)
+	suite.NotEmpty(tokens.RefreshToken)
 	suite.NotNil(user)
 	suite.Equal(email, user.Email)
 	suite.Equal(username, user.Username)
@@ -81,9 +82,9 @@ func (suite *AuthTestSuite) TestLoginInvalidEmail() {
 	email := "nonexistent@example.com"
 	password := "password123"
 
-	token, user, err := suite.authService.Login(email, password)
+	tokens, user, err := suite.authService.Login(email, password)
 	suite.Error(err)
-	suite.Empty(token)
+	suite.Nil(tokens)
 	suite.Nil(user)
 	suite.Contains(err.Error(), "invalid credentials")
 }
@@ -99,9 +100,9 @@ func (suite *AuthTestSuite) TestLoginInvalidPassword() {
 	suite.NoError(err)
 
 	// Login with wrong password
-	token, user, err := suite.authService.Login(email, wrongPassword)
+	tokens, user, err := suite.authService.Login(email, wrongPassword)
 	suite.Error(err)
-	suite.Empty(token)
+	suite.Nil(tokens)
 	suite.Nil(user)
 	suite.Contains(err.Error(), "invalid credentials")
 }
@@ -115,8 +116,9 @@ func (suite *AuthTestSuite) TestValidateTokenSuccess() {
 	_, err := suite.authService.Register(email, username, password)
 	suite.NoError(err)
 
-	token, _, err := suite.authService.Login(email, password)
+	tokens, _, err := suite.authService.Login(email, password)
 	suite.NoError(err)
+	token := tokens.AccessToken
 
 	// Validate token
 	user, err := suite.authService.GetUserFromToken(token)
@@ -146,8 +148,9 @@ func (suite *AuthTestSuite) TestValidateTokenExpired() {
 	_, err := shortExpiryService.Register(email, username, password)
 	suite.NoError(err)
 
-	token, _, err := shortExpiryService.Login(email, password)
+	tokens, _, err := shortExpiryService.Login(email, password)
 	suite.NoError(err)
+	token := tokens.AccessToken
 
 	// Wait for token to expire
 	time.Sleep(10 * time.Millisecond)
@@ -203,8 +206,9 @@ func (suite *AuthTestSuite) TestTokenContainsClaims() {
 	user, err := suite.authService.Register(email, username, password)
 	suite.NoError(err)
 
-	token, _, err := suite.authService.Login(email, password)
+	tokens, _, err := suite.authService.Login(email, password)
 	suite.NoError(err)
+	token := tokens.AccessToken
 
 	// Validate token and check if user data matches
 	validatedUser, err := suite.authService.GetUserFromToken(token)
@@ -238,6 +242,94 @@ func (suite *AuthTestSuite) TestLoginEmptyFields() {
 	suite.Error(err)
 }
 
+func (suite *AuthTestSuite) loginTestUser() *auth.TokenPair {
+	_, err := suite.authService.Register("test@example.com", "testuser", "password123")
+	suite.Require().NoError(err)
+
+	tokens, _, err := suite.authService.Login("test@example.com", "password123")
+	suite.Require().NoError(err)
+	return tokens
+}
+
+func (suite *AuthTestSuite) TestRefreshRotatesTokens() {
+	tokens := suite.loginTestUser()
+
+	refreshed, err := suite.authService.Refresh(tokens.RefreshToken)
+	suite.NoError(err)
+	suite.NotEmpty(refreshed.AccessToken)
+	suite.NotEqual(tokens.RefreshToken, refreshed.RefreshToken)
+	suite.Equal(tokens.SessionID, refreshed.SessionID)
+
+	// The new access token is usable
+	_, err = suite.authService.GetUserFromToken(refreshed.AccessToken)
+	suite.NoError(err)
+
+	// The rotated token can be used again
+	_, err = suite.authService.Refresh(refreshed.RefreshToken)
+	suite.NoError(err)
+}
+
+func (suite *AuthTestSuite) TestRefreshInvalidToken() {
+	_, err := suite.authService.Refresh("not-a-refresh-token")
+	suite.ErrorIs(err, auth.ErrInvalidToken)
+}
+
+func (suite *AuthTestSuite) TestRefreshExpiredToken() {
+	suite.authService.SetRefreshTokenExpiry(time.Millisecond)
+	tokens := suite.loginTestUser()
+
+	time.Sleep(10 * time.Millisecond)
+
+	_, err := suite.authService.Refresh(tokens.RefreshToken)
+	suite.ErrorIs(err, auth.ErrExpiredToken)
+}
+
+func (suite *AuthTestSuite) TestRefreshTokenReuseRevokesFamily() {
+	tokens := suite.loginTestUser()
+
+	refreshed, err := suite.authService.Refresh(tokens.RefreshToken)
+	suite.NoError(err)
+
+	// Replaying the already rotated token is treated as theft
+	_, err = suite.authService.Refresh(tokens.RefreshToken)
+	suite.ErrorIs(err, auth.ErrTokenReused)
+
+	// Every token in the family is now unusable
+	_, err = suite.authService.Refresh(refreshed.RefreshToken)
+	suite.Error(err)
+
+	_, err = suite.authService.GetUserFromToken(refreshed.AccessToken)
+	suite.ErrorIs(err, auth.ErrRevokedToken)
+
+	_, err = suite.authService.GetUserFromToken(tokens.AccessToken)
+	suite.ErrorIs(err, auth.ErrRevokedToken)
+}
+
+func (suite *AuthTestSuite) TestLogoutRevokesSession() {
+	tokens := suite.loginTestUser()
+
+	suite.NoError(suite.authService.Logout(tokens.SessionID))
+
+	_, err := suite.authService.GetUserFromToken(tokens.AccessToken)
+	suite.ErrorIs(err, auth.ErrRevokedToken)
+
+	_, err = suite.authService.Refresh(tokens.RefreshToken)
+	suite.Error(err)
+}
+
+func (suite *AuthTestSuite) TestLogoutLeavesOtherSessionsActive() {
+	first := suite.loginTestUser()
+
+	second, _, err := suite.authService.Login("test@example.com", "password123")
+	suite.NoError(err)
+	suite.NotEqual(first.SessionID, second.SessionID)
+
+	suite.NoError(suite.authService.Logout(first.SessionID))
+
+	_, err = suite.authService.GetUserFromToken(second.AccessToken)
+	suite.NoError(err)
+}
+
 // Run the test suite
 func TestAuthTestSuite(t *testing.T) {
 	suite.Run(t, new(AuthTestSuite))
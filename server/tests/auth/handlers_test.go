@@ -10,6 +10,7 @@ import (
 
 	"habit-tracker/server/auth"
 	"habit-tracker/server/db"
+	"habit-tracker/server/problem"
 
 	"github.com/stretchr/testify/suite"
 )
@@ -53,6 +54,21 @@ func (suite *HandlersTestSuite) TestRegisterHandlerSuccess() {
 	suite.Equal(registerData.Username, response.User.Username)
 }
 
+func (suite *HandlersTestSuite) TestRegisterHandlerStoresPreferences() {
+	body := []byte(`{"email": "test@example.com", "username": "testuser", "password": "password123", "timezone": "Europe/Berlin", "weekStart": "sunday"}`)
+	req := httptest.NewRequest("POST", "/auth/register", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+
+	auth.RegisterHandler(suite.authService).ServeHTTP(rr, req)
+	suite.Equal(http.StatusCreated, rr.Code)
+
+	stored, err := suite.database.GetUserByEmail("test@example.com")
+	suite.NoError(err)
+	suite.Equal("Europe/Berlin", stored.Timezone)
+	suite.Equal("sunday", stored.WeekStart)
+}
+
 func (suite *HandlersTestSuite) TestRegisterHandlerInvalidJSON() {
 	req := httptest.NewRequest("POST", "/auth/register", bytes.NewReader([]byte("invalid json")))
 	req.Header.Set("Content-Type", "application/json")
@@ -63,10 +79,11 @@ func (suite *HandlersTestSuite) TestRegisterHandlerInvalidJSON() {
 
 	suite.Equal(http.StatusBadRequest, rr.Code)
 
-	var response auth.ErrorResponse
+	var response problem.Problem
 	err := json.Unmarshal(rr.Body.Bytes(), &response)
 	suite.NoError(err)
-	suite.Contains(response.Error, "Invalid JSON")
+	suite.Contains(response.Detail, "Invalid JSON")
+	suite.Equal(problem.CodeInvalidJSON, response.Code)
 }
 
 func (suite *HandlersTestSuite) TestRegisterHandlerMissingFields() {
@@ -86,11 +103,17 @@ func (suite *HandlersTestSuite) TestRegisterHandlerMissingFields() {
 	handler.ServeHTTP(rr, req)
 
 	suite.Equal(http.StatusBadRequest, rr.Code)
+	suite.Equal(problem.ContentType, rr.Header().Get("Content-Type"))
 
-	var response auth.ErrorResponse
+	var response problem.Problem
 	err = json.Unmarshal(rr.Body.Bytes(), &response)
 	suite.NoError(err)
-	suite.Contains(response.Error, "required")
+	suite.Contains(response.Detail, "required")
+	suite.Equal(problem.CodeValidation, response.Code)
+	suite.Equal([]problem.FieldError{
+		{Field: "username", Message: "username is required"},
+		{Field: "password", Message: "password is required"},
+	}, response.Errors)
 }
 
 func (suite *HandlersTestSuite) TestRegisterHandlerDuplicateEmail() {
@@ -117,10 +140,11 @@ func (suite *HandlersTestSuite) TestRegisterHandlerDuplicateEmail() {
 
 	suite.Equal(http.StatusConflict, rr.Code)
 
-	var response auth.ErrorResponse
+	var response problem.Problem
 	err = json.Unmarshal(rr.Body.Bytes(), &response)
 	suite.NoError(err)
-	suite.Contains(response.Error, "already exists")
+	suite.Contains(response.Detail, "already exists")
+	suite.Equal(problem.CodeEmailInUse, response.Code)
 }
 
 func (suite *HandlersTestSuite) TestLoginHandlerSuccess() {
@@ -154,6 +178,8 @@ func (suite *HandlersTestSuite) TestLoginHandlerSuccess() {
 	suite.NoError(err)
 	suite.Equal("Login successful", response.Message)
 	suite.NotEmpty(response.Token)
+	suite.NotEmpty(response.RefreshToken)
+	suite.Positive(response.ExpiresIn)
 	suite.Equal(email, response.User.Email)
 	suite.Equal(username, response.User.Username)
 }
@@ -176,10 +202,11 @@ func (suite *HandlersTestSuite) TestLoginHandlerInvalidCredentials() {
 
 	suite.Equal(http.StatusUnauthorized, rr.Code)
 
-	var response auth.ErrorResponse
+	var response problem.Problem
 	err = json.Unmarshal(rr.Body.Bytes(), &response)
 	suite.NoError(err)
-	suite.Contains(response.Error, "Invalid credentials")
+	suite.Contains(response.Detail, "Invalid credentials")
+	suite.Equal(problem.CodeInvalidCredentials, response.Code)
 }
 
 func (suite *HandlersTestSuite) TestLoginHandlerInvalidJSON() {
@@ -192,10 +219,11 @@ func (suite *HandlersTestSuite) TestLoginHandlerInvalidJSON() {
 
 	suite.Equal(http.StatusBadRequest, rr.Code)
 
-	var response auth.ErrorResponse
+	var response problem.Problem
 	err := json.Unmarshal(rr.Body.Bytes(), &response)
 	suite.NoError(err)
-	suite.Contains(response.Error, "Invalid JSON")
+	suite.Contains(response.Detail, "Invalid JSON")
+	suite.Equal(problem.CodeInvalidJSON, response.Code)
 }
 
 func (suite *HandlersTestSuite) TestLoginHandlerMissingFields() {
@@ -216,10 +244,10 @@ func (suite *HandlersTestSuite) TestLoginHandlerMissingFields() {
 
 	suite.Equal(http.StatusBadRequest, rr.Code)
 
-	var response auth.ErrorResponse
+	var response problem.Problem
 	err = json.Unmarshal(rr.Body.Bytes(), &response)
 	suite.NoError(err)
-	suite.Contains(response.Error, "required")
+	suite.Contains(response.Detail, "required")
 }
 
 func (suite *HandlersTestSuite) TestProfileHandlerSuccess() {
@@ -260,10 +288,10 @@ func (suite *HandlersTestSuite) TestProfileHandlerNoUser() {
 
 	suite.Equal(http.StatusUnauthorized, rr.Code)
 
-	var response auth.ErrorResponse
+	var response problem.Problem
 	err := json.Unmarshal(rr.Body.Bytes(), &response)
 	suite.NoError(err)
-	suite.Contains(response.Error, "User not found")
+	suite.Contains(response.Detail, "User not found")
 }
 
 func (suite *HandlersTestSuite) TestValidateHandlerSuccess() {
@@ -275,8 +303,9 @@ func (suite *HandlersTestSuite) TestValidateHandlerSuccess() {
 	_, err := suite.authService.Register(email, username, password)
 	suite.NoError(err)
 
-	token, _, err := suite.authService.Login(email, password)
+	tokens, _, err := suite.authService.Login(email, password)
 	suite.NoError(err)
+	token := tokens.AccessToken
 
 	req := httptest.NewRequest("GET", "/auth/validate", nil)
 	req.Header.Set("Authorization", "Bearer "+token)
@@ -339,8 +368,9 @@ func (suite *HandlersTestSuite) TestValidateHandlerExpiredToken() {
 	_, err := shortExpiryService.Register(email, username, password)
 	suite.NoError(err)
 
-	token, _, err := shortExpiryService.Login(email, password)
+	tokens, _, err := shortExpiryService.Login(email, password)
 	suite.NoError(err)
+	token := tokens.AccessToken
 
 	// Wait for token to expire
 	time.Sleep(10 * time.Millisecond)
@@ -361,6 +391,91 @@ func (suite *HandlersTestSuite) TestValidateHandlerExpiredToken() {
 	suite.Nil(response.User)
 }
 
+func (suite *HandlersTestSuite) postRefresh(refreshToken string) *httptest.ResponseRecorder {
+	body, err := json.Marshal(auth.RefreshRequest{RefreshToken: refreshToken})
+	suite.NoError(err)
+
+	req := httptest.NewRequest("POST", "/auth/refresh", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+
+	handler := auth.RefreshHandler(suite.authService)
+	handler.ServeHTTP(rr, req)
+	return rr
+}
+
+func (suite *HandlersTestSuite) TestRefreshHandlerSuccess() {
+	_, err := suite.authService.Register("test@example.com", "testuser", "password123")
+	suite.NoError(err)
+
+	tokens, _, err := suite.authService.Login("test@example.com", "password123")
+	suite.NoError(err)
+
+	rr := suite.postRefresh(tokens.RefreshToken)
+	suite.Equal(http.StatusOK, rr.Code)
+
+	var response auth.RefreshResponse
+	err = json.Unmarshal(rr.Body.Bytes(), &response)
+	suite.NoError(err)
+	suite.NotEmpty(response.Token)
+	suite.NotEmpty(response.RefreshToken)
+	suite.NotEqual(tokens.RefreshToken, response.RefreshToken)
+}
+
+func (suite *HandlersTestSuite) TestRefreshHandlerReusedToken() {
+	_, err := suite.authService.Register("test@example.com", "testuser", "password123")
+	suite.NoError(err)
+
+	tokens, _, err := suite.authService.Login("test@example.com", "password123")
+	suite.NoError(err)
+
+	rr := suite.postRefresh(tokens.RefreshToken)
+	suite.Equal(http.StatusOK, rr.Code)
+
+	rr = suite.postRefresh(tokens.RefreshToken)
+	suite.Equal(http.StatusUnauthorized, rr.Code)
+
+	var response problem.Problem
+	err = json.Unmarshal(rr.Body.Bytes(), &response)
+	suite.NoError(err)
+	suite.Contains(response.Detail, "reuse")
+	suite.Equal(problem.CodeRefreshTokenReused, response.Code)
+}
+
+func (suite *HandlersTestSuite) TestRefreshHandlerMissingToken() {
+	rr := suite.postRefresh("")
+	suite.Equal(http.StatusBadRequest, rr.Code)
+}
+
+func (suite *HandlersTestSuite) TestLogoutHandlerRevokesSession() {
+	_, err := suite.authService.Register("test@example.com", "testuser", "password123")
+	suite.NoError(err)
+
+	tokens, _, err := suite.authService.Login("test@example.com", "password123")
+	suite.NoError(err)
+
+	req := httptest.NewRequest("POST", "/auth/logout", nil)
+	req.Header.Set("Authorization", "Bearer "+tokens.AccessToken)
+	rr := httptest.NewRecorder()
+
+	handler := suite.authService.AuthMiddleware(auth.LogoutHandler(suite.authService))
+	handler.ServeHTTP(rr, req)
+
+	suite.Equal(http.StatusNoContent, rr.Code)
+
+	// The access token is rejected after logout
+	req = httptest.NewRequest("GET", "/auth/validate", nil)
+	req.Header.Set("Authorization", "Bearer "+tokens.AccessToken)
+	rr = httptest.NewRecorder()
+
+	auth.ValidateHandler(suite.authService).ServeHTTP(rr, req)
+	suite.Equal(http.StatusUnauthorized, rr.Code)
+
+	// And so is the refresh token
+	rr = suite.postRefresh(tokens.RefreshToken)
+	suite.Equal(http.StatusUnauthorized, rr.Code)
+}
+
 func (suite *HandlersTestSuite) TestHandlersWithWrongHTTPMethods() {
 	// Test GET request to register endpoint
 	req := httptest.NewRequest("GET", "/auth/register", nil)
@@ -394,3 +509,58 @@ func (suite *HandlersTestSuite) TestHandlersWithWrongHTTPMethods() {
 func TestHandlersTestSuite(t *testing.T) {
 	suite.Run(t, new(HandlersTestSuite))
 }
+
+func (suite *HandlersTestSuite) TestUpdateProfileHandler() {
+	user, err := suite.authService.Register("test@example.com", "testuser", "password123")
+	suite.NoError(err)
+
+	patch := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("PATCH", "/auth/profile", bytes.NewReader([]byte(body)))
+		req = req.WithContext(auth.SetUserInContext(req.Context(), user))
+		rr := httptest.NewRecorder()
+		auth.UpdateProfileHandler(suite.authService).ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := patch(`{"timezone": "Europe/Berlin", "weekStart": "sunday"}`)
+	suite.Equal(http.StatusOK, rr.Code)
+
+	var response auth.ProfileResponse
+	suite.NoError(json.Unmarshal(rr.Body.Bytes(), &response))
+	suite.Equal("Europe/Berlin", response.User.Timezone)
+	suite.Equal("sunday", response.User.WeekStart)
+
+	stored, err := suite.database.GetUserByID(user.ID)
+	suite.NoError(err)
+	suite.Equal("Europe/Berlin", stored.Timezone)
+	suite.Equal(time.Sunday, stored.Calendar().WeekStart)
+
+	// Omitted fields are left unchanged
+	rr = patch(`{"weekStart": "monday"}`)
+	suite.Equal(http.StatusOK, rr.Code)
+	stored, err = suite.database.GetUserByID(user.ID)
+	suite.NoError(err)
+	suite.Equal("Europe/Berlin", stored.Timezone)
+	suite.Equal("monday", stored.WeekStart)
+
+	suite.Equal(http.StatusBadRequest, patch(`{"timezone": "Mars/Olympus"}`).Code)
+	suite.Equal(http.StatusBadRequest, patch(`{"weekStart": "funday"}`).Code)
+
+	// Quiet hours need both ends and can be cleared together
+	rr = patch(`{"quietHoursStart": "22:00", "quietHoursEnd": "07:00"}`)
+	suite.Equal(http.StatusOK, rr.Code)
+	suite.NoError(json.Unmarshal(rr.Body.Bytes(), &response))
+	suite.Equal("22:00", response.User.QuietHoursStart)
+	suite.Equal("07:00", response.User.QuietHoursEnd)
+
+	suite.Equal(http.StatusBadRequest, patch(`{"quietHoursEnd": ""}`).Code)
+	suite.Equal(http.StatusBadRequest, patch(`{"quietHoursStart": "25:00"}`).Code)
+	stored, err = suite.database.GetUserByID(user.ID)
+	suite.NoError(err)
+	suite.Equal("07:00", stored.QuietHoursEnd)
+
+	suite.Equal(http.StatusOK, patch(`{"quietHoursStart": "", "quietHoursEnd": ""}`).Code)
+	stored, err = suite.database.GetUserByID(user.ID)
+	suite.NoError(err)
+	suite.Empty(stored.QuietHoursStart)
+}
@@ -33,8 +33,9 @@ func (suite *MiddlewareTestSuite) TestAuthMiddlewareWithValidToken() {
 	_, err := suite.authService.Register(email, username, password)
 	suite.NoError(err)
 
-	token, _, err := suite.authService.Login(email, password)
+	tokens, _, err := suite.authService.Login(email, password)
 	suite.NoError(err)
+	token := tokens.AccessToken
 
 	// Create test handler
 	called := false
@@ -139,8 +140,9 @@ func (suite *MiddlewareTestSuite) TestOptionalAuthMiddlewareWithValidToken() {
 	_, err := suite.authService.Register(email, username, password)
 	suite.NoError(err)
 
-	token, _, err := suite.authService.Login(email, password)
+	tokens, _, err := suite.authService.Login(email, password)
 	suite.NoError(err)
+	token := tokens.AccessToken
 
 	// Create test handler
 	called := false
@@ -283,8 +285,9 @@ func (suite *MiddlewareTestSuite) TestAuthMiddlewareWithExpiredToken() {
 	_, err := shortExpiryService.Register(email, username, password)
 	suite.NoError(err)
 
-	token, _, err := shortExpiryService.Login(email, password)
+	tokens, _, err := shortExpiryService.Login(email, password)
 	suite.NoError(err)
+	token := tokens.AccessToken
 
 	// Wait for token to expire
 	time.Sleep(10 * time.Millisecond)
@@ -0,0 +1,64 @@
+package db_test
+
+import (
+	"testing"
+	"time"
+
+	"habit-tracker/server/db"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatsFollowUserTimezone(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	require.NoError(t, err)
+
+	// Late last night in New York is already today in UTC
+	yesterday := time.Now().In(loc).AddDate(0, 0, -1)
+	lateNight := time.Date(yesterday.Year(), yesterday.Month(), yesterday.Day(), 23, 30, 0, 0, loc)
+
+	forEachDatabase(t, func(t *testing.T, database db.Database) {
+		require.NoError(t, database.CreateUser(&db.User{
+			ID: testUserID, Email: "tz@example.com", Username: "tz", Timezone: "America/New_York", WeekStart: "sunday",
+		}))
+		require.NoError(t, database.CreateHabit(&db.Habit{
+			ID: "journal", UserID: testUserID, Name: "Journal", Frequency: db.FrequencyDaily,
+			StartDate: lateNight.AddDate(0, 0, -3).Format("2006-01-02"),
+		}))
+		require.NoError(t, database.CreateTrackingEntry(testUserID, &db.TrackingEntry{
+			ID: "journal-1", HabitID: "journal", Timestamp: lateNight.UTC().Format(time.RFC3339),
+		}))
+
+		daily, err := database.GetDailyCompletions(testUserID, 7)
+		require.NoError(t, err)
+		require.Len(t, daily, 1)
+		assert.Equal(t, lateNight.Format("2006-01-02"), daily[0].Date)
+
+		progress, err := database.GetHabitProgress(testUserID, "journal", 7)
+		require.NoError(t, err)
+		require.Len(t, progress, 1)
+		assert.Equal(t, lateNight.Format("2006-01-02"), progress[0].Date)
+	})
+}
+
+func TestCalendarWeekStart(t *testing.T) {
+	wednesday := time.Date(2024, time.May, 15, 9, 0, 0, 0, time.UTC)
+
+	monday := db.DefaultCalendar.Cadence(db.FrequencyWeekly).PeriodStart(wednesday)
+	assert.Equal(t, time.Date(2024, time.May, 13, 0, 0, 0, 0, time.UTC), monday)
+
+	sundayCal := db.Calendar{Location: time.UTC, WeekStart: time.Sunday}
+	sunday := sundayCal.Cadence(db.FrequencyWeekly).PeriodStart(wednesday)
+	assert.Equal(t, time.Date(2024, time.May, 12, 0, 0, 0, 0, time.UTC), sunday)
+	assert.Equal(t, sunday.AddDate(0, 0, 7), sundayCal.Cadence(db.FrequencyWeekly).NextPeriodStart(sunday))
+
+	user := &db.User{Timezone: "Asia/Tokyo", WeekStart: "saturday"}
+	assert.Equal(t, "Asia/Tokyo", user.Calendar().Location.String())
+	assert.Equal(t, time.Saturday, user.Calendar().WeekStart)
+	assert.Equal(t, db.DefaultCalendar, (&db.User{Timezone: "Mars/Olympus"}).Calendar())
+
+	assert.ErrorIs(t, db.ValidateTimezone("Mars/Olympus"), db.ErrInvalidTimezone)
+	assert.ErrorIs(t, db.ValidateWeekStart("funday"), db.ErrInvalidWeekStart)
+	assert.NoError(t, db.ValidateWeekStart(""))
+}
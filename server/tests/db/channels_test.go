@@ -0,0 +1,55 @@
+package db_test
+
+import (
+	"testing"
+
+	"habit-tracker/server/db"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHabitChannelsPersist(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, database db.Database) {
+		require.NoError(t, database.CreateHabit(&db.Habit{
+			ID: "stretch", UserID: testUserID, Name: "Stretch", Frequency: db.FrequencyDaily, StartDate: "2024-01-01",
+			Channels: []db.Channel{db.ChannelWebSocket, db.ChannelLog}, FallbackChannel: db.ChannelEmail,
+		}))
+
+		habit, err := database.GetHabit(testUserID, "stretch")
+		require.NoError(t, err)
+		assert.Equal(t, []db.Channel{db.ChannelWebSocket, db.ChannelLog}, habit.DeliveryChannels())
+		assert.Equal(t, db.ChannelEmail, habit.FallbackChannel)
+
+		habit, err = database.UpdateHabitPartial(testUserID, "stretch", map[string]interface{}{
+			"channels":        []interface{}{"webhook"},
+			"fallbackChannel": "",
+		})
+		require.NoError(t, err)
+		assert.Equal(t, []db.Channel{db.ChannelWebhook}, habit.Channels)
+		assert.Empty(t, habit.FallbackChannel)
+
+		habit, err = database.GetHabit(testUserID, "stretch")
+		require.NoError(t, err)
+		assert.Equal(t, []db.Channel{db.ChannelWebhook}, habit.Channels)
+
+		// An empty list goes back to the WebSocket
+		habit, err = database.UpdateHabitPartial(testUserID, "stretch", map[string]interface{}{"channels": []interface{}{}})
+		require.NoError(t, err)
+		assert.Equal(t, db.DefaultChannels, habit.DeliveryChannels())
+
+		_, err = database.UpdateHabitPartial(testUserID, "stretch", map[string]interface{}{"channels": []interface{}{"pager"}})
+		assert.ErrorIs(t, err, db.ErrInvalidChannel)
+		_, err = database.UpdateHabitPartial(testUserID, "stretch", map[string]interface{}{"fallbackChannel": "websocket"})
+		assert.ErrorIs(t, err, db.ErrInvalidChannel)
+	})
+}
+
+func TestValidateChannels(t *testing.T) {
+	assert.NoError(t, db.ValidateChannels(nil))
+	assert.NoError(t, db.ValidateChannels([]db.Channel{db.ChannelEmail, db.ChannelWebhook}))
+	assert.ErrorIs(t, db.ValidateChannels([]db.Channel{db.ChannelEmail, db.ChannelEmail}), db.ErrInvalidChannel)
+	assert.ErrorIs(t, db.ValidateChannels([]db.Channel{"sms"}), db.ErrInvalidChannel)
+	assert.NoError(t, db.ValidateFallbackChannel(""))
+	assert.ErrorIs(t, db.ValidateFallbackChannel("websocket"), db.ErrInvalidChannel)
+}
@@ -1,15 +1,41 @@
 package db_test
 
 import (
+	"fmt"
+	"path/filepath"
+	"sync"
 	"testing"
 	"time"
 
 	"habit-tracker/server/db"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
 )
 
+const (
+	testUserID  = "test-user"
+	otherUserID = "other-user"
+)
+
+// newSQLiteDatabase returns a migrated SQLite database in a temporary
+// directory that is closed when the test ends
+func newSQLiteDatabase(t *testing.T) *db.SQLiteDatabase {
+	t.Helper()
+	sqlite, err := db.NewSQLiteDatabase(filepath.Join(t.TempDir(), "habits.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { sqlite.Close() })
+	return sqlite
+}
+
+// forEachDatabase runs test against a fresh map database and a fresh SQLite
+// database, as subtests, so that both backends are held to the same behavior
+func forEachDatabase(t *testing.T, test func(t *testing.T, database db.Database)) {
+	t.Run("map", func(t *testing.T) { test(t, db.NewMapDatabase()) })
+	t.Run("sqlite", func(t *testing.T) { test(t, newSQLiteDatabase(t)) })
+}
+
 type InMemoryDBTestSuite struct {
 	suite.Suite
 	db *db.MapDatabase
@@ -19,6 +45,21 @@ func (suite *InMemoryDBTestSuite) SetupTest() {
 	suite.db = db.NewMapDatabase()
 }
 
+// seedHabits creates daily habits owned by testUserID for tests that only
+// care about tracking entries
+func (suite *InMemoryDBTestSuite) seedHabits(ids ...string) {
+	for _, id := range ids {
+		err := suite.db.CreateHabit(&db.Habit{
+			ID:        id,
+			UserID:    testUserID,
+			Name:      "Habit " + id,
+			Frequency: db.FrequencyDaily,
+			StartDate: "2024-01-01",
+		})
+		suite.Require().NoError(err)
+	}
+}
+
 func (suite *InMemoryDBTestSuite) TestNewMapDatabase() {
 	database := db.NewMapDatabase()
 	suite.NotNil(database)
@@ -33,6 +74,7 @@ func (suite *InMemoryDBTestSuite) TestPing() {
 func (suite *InMemoryDBTestSuite) TestCreateHabit() {
 	habit := &db.Habit{
 		ID:          "test-habit-1",
+		UserID:      testUserID,
 		Name:        "Exercise",
 		Description: "Daily workout",
 		Frequency:   db.FrequencyDaily,
@@ -43,7 +85,7 @@ func (suite *InMemoryDBTestSuite) TestCreateHabit() {
 	suite.NoError(err)
 
 	// Verify habit is stored by retrieving it
-	stored, err := suite.db.GetHabit(habit.ID)
+	stored, err := suite.db.GetHabit(testUserID, habit.ID)
 	suite.NoError(err)
 	suite.NotNil(stored)
 	suite.Equal(habit.ID, stored.ID)
@@ -59,6 +101,7 @@ func (suite *InMemoryDBTestSuite) TestCreateHabit() {
 func (suite *InMemoryDBTestSuite) TestCreateHabitDuplicate() {
 	habit := &db.Habit{
 		ID:          "test-habit-1",
+		UserID:      testUserID,
 		Name:        "Exercise",
 		Description: "Daily workout",
 		Frequency:   db.FrequencyDaily,
@@ -77,6 +120,7 @@ func (suite *InMemoryDBTestSuite) TestCreateHabitDuplicate() {
 func (suite *InMemoryDBTestSuite) TestGetHabit() {
 	habit := &db.Habit{
 		ID:          "test-habit-1",
+		UserID:      testUserID,
 		Name:        "Exercise",
 		Description: "Daily workout",
 		Frequency:   db.FrequencyDaily,
@@ -88,7 +132,7 @@ func (suite *InMemoryDBTestSuite) TestGetHabit() {
 	suite.NoError(err)
 
 	// Get habit
-	retrieved, err := suite.db.GetHabit(habit.ID)
+	retrieved, err := suite.db.GetHabit(testUserID, habit.ID)
 	suite.NoError(err)
 	suite.NotNil(retrieved)
 	suite.Equal(habit.ID, retrieved.ID)
@@ -102,13 +146,13 @@ func (suite *InMemoryDBTestSuite) TestGetHabit() {
 }
 
 func (suite *InMemoryDBTestSuite) TestGetHabitNotFound() {
-	retrieved, err := suite.db.GetHabit("nonexistent")
+	retrieved, err := suite.db.GetHabit(testUserID, "nonexistent")
 	suite.Nil(retrieved)
 	suite.Equal(db.ErrNotFound, err)
 }
 
 func (suite *InMemoryDBTestSuite) TestGetAllHabitsEmpty() {
-	habits, err := suite.db.GetAllHabits()
+	habits, err := suite.db.GetAllHabits(testUserID)
 	suite.NoError(err)
 	suite.Empty(habits)
 }
@@ -117,6 +161,7 @@ func (suite *InMemoryDBTestSuite) TestGetAllHabits() {
 	habits := []*db.Habit{
 		{
 			ID:          "habit-1",
+			UserID:      testUserID,
 			Name:        "Exercise",
 			Description: "Daily workout",
 			Frequency:   db.FrequencyDaily,
@@ -124,6 +169,7 @@ func (suite *InMemoryDBTestSuite) TestGetAllHabits() {
 		},
 		{
 			ID:          "habit-2",
+			UserID:      testUserID,
 			Name:        "Reading",
 			Description: "Read for 30 minutes",
 			Frequency:   db.FrequencyDaily,
@@ -138,7 +184,7 @@ func (suite *InMemoryDBTestSuite) TestGetAllHabits() {
 	}
 
 	// Get all habits
-	retrieved, err := suite.db.GetAllHabits()
+	retrieved, err := suite.db.GetAllHabits(testUserID)
 	suite.NoError(err)
 	suite.Len(retrieved, 2)
 
@@ -160,6 +206,7 @@ func (suite *InMemoryDBTestSuite) TestGetAllHabits() {
 func (suite *InMemoryDBTestSuite) TestUpdateHabit() {
 	habit := &db.Habit{
 		ID:          "test-habit-1",
+		UserID:      testUserID,
 		Name:        "Exercise",
 		Description: "Daily workout",
 		Frequency:   db.FrequencyDaily,
@@ -173,6 +220,7 @@ func (suite *InMemoryDBTestSuite) TestUpdateHabit() {
 	// Update habit
 	updatedHabit := &db.Habit{
 		ID:          "test-habit-1",
+		UserID:      testUserID,
 		Name:        "Updated Exercise",
 		Description: "Updated daily workout",
 		Frequency:   db.FrequencyWeekly,
@@ -183,7 +231,7 @@ func (suite *InMemoryDBTestSuite) TestUpdateHabit() {
 	suite.NoError(err)
 
 	// Verify update
-	retrieved, err := suite.db.GetHabit(habit.ID)
+	retrieved, err := suite.db.GetHabit(testUserID, habit.ID)
 	suite.NoError(err)
 	suite.Equal(updatedHabit.Name, retrieved.Name)
 	suite.Equal(updatedHabit.Description, retrieved.Description)
@@ -194,6 +242,7 @@ func (suite *InMemoryDBTestSuite) TestUpdateHabit() {
 func (suite *InMemoryDBTestSuite) TestUpdateHabitNotFound() {
 	habit := &db.Habit{
 		ID:          "nonexistent",
+		UserID:      testUserID,
 		Name:        "Exercise",
 		Description: "Daily workout",
 		Frequency:   db.FrequencyDaily,
@@ -208,6 +257,7 @@ func (suite *InMemoryDBTestSuite) TestUpdateHabitPartial() {
 	// Create a habit first
 	habit := &db.Habit{
 		ID:          "test-habit-partial",
+		UserID:      testUserID,
 		Name:        "Original Name",
 		Description: "Original Description",
 		Frequency:   db.FrequencyDaily,
@@ -222,7 +272,7 @@ func (suite *InMemoryDBTestSuite) TestUpdateHabitPartial() {
 		"name": "Updated Name",
 	}
 
-	updatedHabit, err := suite.db.UpdateHabitPartial("test-habit-partial", updates)
+	updatedHabit, err := suite.db.UpdateHabitPartial(testUserID, "test-habit-partial", updates)
 	suite.NoError(err)
 	suite.NotNil(updatedHabit)
 
@@ -239,7 +289,7 @@ func (suite *InMemoryDBTestSuite) TestUpdateHabitPartial() {
 		"frequency":   "weekly",
 	}
 
-	updatedHabit2, err := suite.db.UpdateHabitPartial("test-habit-partial", updates2)
+	updatedHabit2, err := suite.db.UpdateHabitPartial(testUserID, "test-habit-partial", updates2)
 	suite.NoError(err)
 	suite.NotNil(updatedHabit2)
 
@@ -255,14 +305,14 @@ func (suite *InMemoryDBTestSuite) TestUpdateHabitPartial() {
 		"frequency": "invalid_frequency",
 	}
 
-	_, err = suite.db.UpdateHabitPartial("test-habit-partial", invalidUpdates)
+	_, err = suite.db.UpdateHabitPartial(testUserID, "test-habit-partial", invalidUpdates)
 	suite.Error(err)
 	suite.Contains(err.Error(), "invalid frequency")
 
 	// Test with empty updates
 	emptyUpdates := map[string]interface{}{}
 
-	unchangedHabit, err := suite.db.UpdateHabitPartial("test-habit-partial", emptyUpdates)
+	unchangedHabit, err := suite.db.UpdateHabitPartial(testUserID, "test-habit-partial", emptyUpdates)
 	suite.NoError(err)
 	suite.NotNil(unchangedHabit)
 
@@ -279,13 +329,14 @@ func (suite *InMemoryDBTestSuite) TestUpdateHabitPartialNotFound() {
 		"name": "Updated Name",
 	}
 
-	_, err := suite.db.UpdateHabitPartial("nonexistent", updates)
+	_, err := suite.db.UpdateHabitPartial(testUserID, "nonexistent", updates)
 	suite.Equal(db.ErrNotFound, err)
 }
 
 func (suite *InMemoryDBTestSuite) TestDeleteHabit() {
 	habit := &db.Habit{
 		ID:          "test-habit-1",
+		UserID:      testUserID,
 		Name:        "Exercise",
 		Description: "Daily workout",
 		Frequency:   db.FrequencyDaily,
@@ -297,20 +348,22 @@ func (suite *InMemoryDBTestSuite) TestDeleteHabit() {
 	suite.NoError(err)
 
 	// Delete habit
-	err = suite.db.DeleteHabit(habit.ID)
+	err = suite.db.DeleteHabit(testUserID, habit.ID)
 	suite.NoError(err)
 
 	// Verify deletion
-	_, err = suite.db.GetHabit(habit.ID)
+	_, err = suite.db.GetHabit(testUserID, habit.ID)
 	suite.Equal(db.ErrNotFound, err)
 }
 
 func (suite *InMemoryDBTestSuite) TestDeleteHabitNotFound() {
-	err := suite.db.DeleteHabit("nonexistent")
+	err := suite.db.DeleteHabit(testUserID, "nonexistent")
 	suite.Equal(db.ErrNotFound, err)
 }
 
 func (suite *InMemoryDBTestSuite) TestCreateTrackingEntry() {
+	suite.seedHabits("habit-1")
+
 	entry := &db.TrackingEntry{
 		ID:        "entry-1",
 		HabitID:   "habit-1",
@@ -318,11 +371,11 @@ func (suite *InMemoryDBTestSuite) TestCreateTrackingEntry() {
 		Note:      "Great workout!",
 	}
 
-	err := suite.db.CreateTrackingEntry(entry)
+	err := suite.db.CreateTrackingEntry(testUserID, entry)
 	suite.NoError(err)
 
 	// Verify entry is stored by retrieving it
-	stored, err := suite.db.GetTrackingEntry(entry.ID)
+	stored, err := suite.db.GetTrackingEntry(testUserID, entry.ID)
 	suite.NoError(err)
 	suite.NotNil(stored)
 	suite.Equal(entry.ID, stored.ID)
@@ -335,6 +388,8 @@ func (suite *InMemoryDBTestSuite) TestCreateTrackingEntry() {
 }
 
 func (suite *InMemoryDBTestSuite) TestCreateTrackingEntryDuplicate() {
+	suite.seedHabits("habit-1")
+
 	entry := &db.TrackingEntry{
 		ID:        "entry-1",
 		HabitID:   "habit-1",
@@ -343,15 +398,17 @@ func (suite *InMemoryDBTestSuite) TestCreateTrackingEntryDuplicate() {
 	}
 
 	// Create entry first time
-	err := suite.db.CreateTrackingEntry(entry)
+	err := suite.db.CreateTrackingEntry(testUserID, entry)
 	suite.NoError(err)
 
 	// Try to create same entry again
-	err = suite.db.CreateTrackingEntry(entry)
+	err = suite.db.CreateTrackingEntry(testUserID, entry)
 	suite.Equal(db.ErrDuplicate, err)
 }
 
 func (suite *InMemoryDBTestSuite) TestGetTrackingEntry() {
+	suite.seedHabits("habit-1")
+
 	entry := &db.TrackingEntry{
 		ID:        "entry-1",
 		HabitID:   "habit-1",
@@ -360,11 +417,11 @@ func (suite *InMemoryDBTestSuite) TestGetTrackingEntry() {
 	}
 
 	// Create entry
-	err := suite.db.CreateTrackingEntry(entry)
+	err := suite.db.CreateTrackingEntry(testUserID, entry)
 	suite.NoError(err)
 
 	// Get entry
-	retrieved, err := suite.db.GetTrackingEntry(entry.ID)
+	retrieved, err := suite.db.GetTrackingEntry(testUserID, entry.ID)
 	suite.NoError(err)
 	suite.NotNil(retrieved)
 	suite.Equal(entry.ID, retrieved.ID)
@@ -377,12 +434,14 @@ func (suite *InMemoryDBTestSuite) TestGetTrackingEntry() {
 }
 
 func (suite *InMemoryDBTestSuite) TestGetTrackingEntryNotFound() {
-	retrieved, err := suite.db.GetTrackingEntry("nonexistent")
+	retrieved, err := suite.db.GetTrackingEntry(testUserID, "nonexistent")
 	suite.Nil(retrieved)
 	suite.Equal(db.ErrNotFound, err)
 }
 
 func (suite *InMemoryDBTestSuite) TestGetTrackingEntriesByHabitID() {
+	suite.seedHabits("habit-1", "habit-2")
+
 	entries := []*db.TrackingEntry{
 		{
 			ID:        "entry-1",
@@ -406,12 +465,12 @@ func (suite *InMemoryDBTestSuite) TestGetTrackingEntriesByHabitID() {
 
 	// Create entries
 	for _, entry := range entries {
-		err := suite.db.CreateTrackingEntry(entry)
+		err := suite.db.CreateTrackingEntry(testUserID, entry)
 		suite.NoError(err)
 	}
 
 	// Get entries for habit-1
-	retrieved, err := suite.db.GetTrackingEntriesByHabitID("habit-1")
+	retrieved, err := suite.db.GetTrackingEntriesByHabitID(testUserID, "habit-1")
 	suite.NoError(err)
 	suite.Len(retrieved, 2)
 
@@ -421,18 +480,20 @@ func (suite *InMemoryDBTestSuite) TestGetTrackingEntriesByHabitID() {
 	}
 
 	// Get entries for habit-2
-	retrieved, err = suite.db.GetTrackingEntriesByHabitID("habit-2")
+	retrieved, err = suite.db.GetTrackingEntriesByHabitID(testUserID, "habit-2")
 	suite.NoError(err)
 	suite.Len(retrieved, 1)
 	suite.Equal("habit-2", retrieved[0].HabitID)
 
 	// Get entries for nonexistent habit
-	retrieved, err = suite.db.GetTrackingEntriesByHabitID("nonexistent")
-	suite.NoError(err)
+	retrieved, err = suite.db.GetTrackingEntriesByHabitID(testUserID, "nonexistent")
+	suite.Equal(db.ErrNotFound, err)
 	suite.Empty(retrieved)
 }
 
 func (suite *InMemoryDBTestSuite) TestDeleteTrackingEntry() {
+	suite.seedHabits("habit-1")
+
 	entry := &db.TrackingEntry{
 		ID:        "entry-1",
 		HabitID:   "habit-1",
@@ -441,20 +502,20 @@ func (suite *InMemoryDBTestSuite) TestDeleteTrackingEntry() {
 	}
 
 	// Create entry
-	err := suite.db.CreateTrackingEntry(entry)
+	err := suite.db.CreateTrackingEntry(testUserID, entry)
 	suite.NoError(err)
 
 	// Delete entry
-	err = suite.db.DeleteTrackingEntry(entry.ID)
+	err = suite.db.DeleteTrackingEntry(testUserID, entry.ID)
 	suite.NoError(err)
 
 	// Verify deletion
-	_, err = suite.db.GetTrackingEntry(entry.ID)
+	_, err = suite.db.GetTrackingEntry(testUserID, entry.ID)
 	suite.Equal(db.ErrNotFound, err)
 }
 
 func (suite *InMemoryDBTestSuite) TestDeleteTrackingEntryNotFound() {
-	err := suite.db.DeleteTrackingEntry("nonexistent")
+	err := suite.db.DeleteTrackingEntry(testUserID, "nonexistent")
 	suite.Equal(db.ErrNotFound, err)
 }
 
@@ -462,6 +523,7 @@ func (suite *InMemoryDBTestSuite) TestDeleteTrackingEntryNotFound() {
 func (suite *InMemoryDBTestSuite) TestConcurrentAccess() {
 	habit := &db.Habit{
 		ID:          "concurrent-habit",
+		UserID:      testUserID,
 		Name:        "Concurrent Test",
 		Description: "Testing concurrent access",
 		Frequency:   db.FrequencyDaily,
@@ -472,7 +534,7 @@ func (suite *InMemoryDBTestSuite) TestConcurrentAccess() {
 	err := suite.db.CreateHabit(habit)
 	suite.NoError(err)
 
-	retrieved, err := suite.db.GetHabit(habit.ID)
+	retrieved, err := suite.db.GetHabit(testUserID, habit.ID)
 	suite.NoError(err)
 	suite.Equal(habit.ID, retrieved.ID)
 }
@@ -481,6 +543,7 @@ func (suite *InMemoryDBTestSuite) TestCreateReminder() {
 	// First create a habit
 	habit := &db.Habit{
 		ID:          "test-habit-1",
+		UserID:      testUserID,
 		Name:        "Exercise",
 		Description: "Daily workout",
 		Frequency:   db.FrequencyDaily,
@@ -490,7 +553,7 @@ func (suite *InMemoryDBTestSuite) TestCreateReminder() {
 	suite.NoError(err)
 
 	// Get the automatically created reminder
-	stored, err := suite.db.GetReminder(habit.ID)
+	stored, err := suite.db.GetReminder(testUserID, habit.ID)
 	suite.NoError(err)
 	suite.NotNil(stored)
 	suite.Equal(habit.ID+"-reminder", stored.ID)
@@ -505,6 +568,7 @@ func (suite *InMemoryDBTestSuite) TestCreateReminderDuplicate() {
 	// First create a habit
 	habit := &db.Habit{
 		ID:          "test-habit-1",
+		UserID:      testUserID,
 		Name:        "Exercise",
 		Description: "Daily workout",
 		Frequency:   db.FrequencyDaily,
@@ -520,7 +584,7 @@ func (suite *InMemoryDBTestSuite) TestCreateReminderDuplicate() {
 		LastReminder: "2024-01-02T10:00:00Z",
 	}
 
-	err = suite.db.CreateReminder(duplicateReminder)
+	err = suite.db.CreateReminder(testUserID, duplicateReminder)
 	suite.Equal(db.ErrDuplicate, err)
 }
 
@@ -528,6 +592,7 @@ func (suite *InMemoryDBTestSuite) TestGetReminder() {
 	// First create a habit
 	habit := &db.Habit{
 		ID:          "test-habit-1",
+		UserID:      testUserID,
 		Name:        "Exercise",
 		Description: "Daily workout",
 		Frequency:   db.FrequencyDaily,
@@ -537,7 +602,7 @@ func (suite *InMemoryDBTestSuite) TestGetReminder() {
 	suite.NoError(err)
 
 	// Get reminder
-	retrieved, err := suite.db.GetReminder(habit.ID)
+	retrieved, err := suite.db.GetReminder(testUserID, habit.ID)
 	suite.NoError(err)
 	suite.NotNil(retrieved)
 	suite.Equal(habit.ID+"-reminder", retrieved.ID)
@@ -549,7 +614,7 @@ func (suite *InMemoryDBTestSuite) TestGetReminder() {
 }
 
 func (suite *InMemoryDBTestSuite) TestGetReminderNotFound() {
-	retrieved, err := suite.db.GetReminder("nonexistent-habit")
+	retrieved, err := suite.db.GetReminder(testUserID, "nonexistent-habit")
 	suite.Nil(retrieved)
 	suite.Equal(db.ErrNotFound, err)
 }
@@ -558,6 +623,7 @@ func (suite *InMemoryDBTestSuite) TestUpdateReminderLastReminder() {
 	// First create a habit
 	habit := &db.Habit{
 		ID:          "test-habit-1",
+		UserID:      testUserID,
 		Name:        "Exercise",
 		Description: "Daily workout",
 		Frequency:   db.FrequencyDaily,
@@ -568,17 +634,17 @@ func (suite *InMemoryDBTestSuite) TestUpdateReminderLastReminder() {
 
 	// Update last reminder time
 	newLastReminder := "2024-01-02T10:00:00Z"
-	err = suite.db.UpdateReminderLastReminder(habit.ID, newLastReminder)
+	err = suite.db.UpdateReminderLastReminder(testUserID, habit.ID, newLastReminder)
 	suite.NoError(err)
 
 	// Verify update
-	retrieved, err := suite.db.GetReminder(habit.ID)
+	retrieved, err := suite.db.GetReminder(testUserID, habit.ID)
 	suite.NoError(err)
 	suite.Equal(newLastReminder, retrieved.LastReminder)
 }
 
 func (suite *InMemoryDBTestSuite) TestUpdateReminderLastReminderNotFound() {
-	err := suite.db.UpdateReminderLastReminder("nonexistent-habit", "2024-01-01T10:00:00Z")
+	err := suite.db.UpdateReminderLastReminder(testUserID, "nonexistent-habit", "2024-01-01T10:00:00Z")
 	suite.Equal(db.ErrNotFound, err)
 }
 
@@ -586,6 +652,7 @@ func (suite *InMemoryDBTestSuite) TestDeleteReminder() {
 	// First create a habit
 	habit := &db.Habit{
 		ID:          "test-habit-1",
+		UserID:      testUserID,
 		Name:        "Exercise",
 		Description: "Daily workout",
 		Frequency:   db.FrequencyDaily,
@@ -595,22 +662,22 @@ func (suite *InMemoryDBTestSuite) TestDeleteReminder() {
 	suite.NoError(err)
 
 	// Verify reminder exists
-	retrieved, err := suite.db.GetReminder(habit.ID)
+	retrieved, err := suite.db.GetReminder(testUserID, habit.ID)
 	suite.NoError(err)
 	suite.NotNil(retrieved)
 
 	// Delete reminder
-	err = suite.db.DeleteReminder(habit.ID)
+	err = suite.db.DeleteReminder(testUserID, habit.ID)
 	suite.NoError(err)
 
 	// Verify reminder is deleted
-	retrieved, err = suite.db.GetReminder(habit.ID)
+	retrieved, err = suite.db.GetReminder(testUserID, habit.ID)
 	suite.Nil(retrieved)
 	suite.Equal(db.ErrNotFound, err)
 }
 
 func (suite *InMemoryDBTestSuite) TestDeleteReminderNotFound() {
-	err := suite.db.DeleteReminder("nonexistent-habit")
+	err := suite.db.DeleteReminder(testUserID, "nonexistent-habit")
 	suite.Equal(db.ErrNotFound, err)
 }
 
@@ -619,6 +686,7 @@ func (suite *InMemoryDBTestSuite) TestGetHabitsNeedingReminders() {
 	habits := []*db.Habit{
 		{
 			ID:          "habit-daily",
+			UserID:      testUserID,
 			Name:        "Daily Exercise",
 			Description: "Daily workout",
 			Frequency:   db.FrequencyDaily,
@@ -626,6 +694,7 @@ func (suite *InMemoryDBTestSuite) TestGetHabitsNeedingReminders() {
 		},
 		{
 			ID:          "habit-weekly",
+			UserID:      testUserID,
 			Name:        "Weekly Reading",
 			Description: "Read a book",
 			Frequency:   db.FrequencyWeekly,
@@ -633,6 +702,7 @@ func (suite *InMemoryDBTestSuite) TestGetHabitsNeedingReminders() {
 		},
 		{
 			ID:          "habit-hourly",
+			UserID:      testUserID,
 			Name:        "Hourly Water",
 			Description: "Drink water",
 			Frequency:   db.FrequencyHourly,
@@ -649,7 +719,7 @@ func (suite *InMemoryDBTestSuite) TestGetHabitsNeedingReminders() {
 	// Update reminders with old timestamps to trigger reminders
 	oldTime := "2024-01-01T10:00:00Z"
 	for _, habit := range habits {
-		err := suite.db.UpdateReminderLastReminder(habit.ID, oldTime)
+		err := suite.db.UpdateReminderLastReminder(testUserID, habit.ID, oldTime)
 		suite.NoError(err)
 	}
 
@@ -673,6 +743,7 @@ func (suite *InMemoryDBTestSuite) TestGetHabitsNeedingRemindersNoReminders() {
 	// Create a habit but no reminder
 	habit := &db.Habit{
 		ID:          "habit-no-reminder",
+		UserID:      testUserID,
 		Name:        "Exercise",
 		Description: "Daily workout",
 		Frequency:   db.FrequencyDaily,
@@ -683,7 +754,7 @@ func (suite *InMemoryDBTestSuite) TestGetHabitsNeedingRemindersNoReminders() {
 	suite.NoError(err)
 
 	// Delete the auto-created reminder to test empty case
-	err = suite.db.DeleteReminder(habit.ID)
+	err = suite.db.DeleteReminder(testUserID, habit.ID)
 	suite.NoError(err)
 
 	// Get habits needing reminders - should be empty
@@ -696,6 +767,7 @@ func (suite *InMemoryDBTestSuite) TestGetHabitsNeedingRemindersRecentReminders()
 	// Create a habit
 	habit := &db.Habit{
 		ID:          "habit-recent",
+		UserID:      testUserID,
 		Name:        "Exercise",
 		Description: "Daily workout",
 		Frequency:   db.FrequencyDaily,
@@ -707,7 +779,7 @@ func (suite *InMemoryDBTestSuite) TestGetHabitsNeedingRemindersRecentReminders()
 
 	// Update reminder to very recent time (future)
 	futureTime := "2099-01-01T10:00:00Z"
-	err = suite.db.UpdateReminderLastReminder(habit.ID, futureTime)
+	err = suite.db.UpdateReminderLastReminder(testUserID, habit.ID, futureTime)
 	suite.NoError(err)
 
 	// Get habits needing reminders - should be empty
@@ -720,6 +792,7 @@ func (suite *InMemoryDBTestSuite) TestGetHabitsNeedingRemindersInvalidTimestamp(
 	// Create a habit
 	habit := &db.Habit{
 		ID:          "habit-invalid",
+		UserID:      testUserID,
 		Name:        "Exercise",
 		Description: "Daily workout",
 		Frequency:   db.FrequencyDaily,
@@ -730,7 +803,7 @@ func (suite *InMemoryDBTestSuite) TestGetHabitsNeedingRemindersInvalidTimestamp(
 	suite.NoError(err)
 
 	// Update reminder to invalid timestamp
-	err = suite.db.UpdateReminderLastReminder(habit.ID, "invalid-timestamp")
+	err = suite.db.UpdateReminderLastReminder(testUserID, habit.ID, "invalid-timestamp")
 	suite.NoError(err)
 
 	// Get habits needing reminders - should handle invalid timestamp gracefully
@@ -746,6 +819,7 @@ func (suite *InMemoryDBTestSuite) TestHabitReminderIntegration() {
 	// Test that creating a habit automatically creates a reminder
 	habit := &db.Habit{
 		ID:          "test-habit-integration",
+		UserID:      testUserID,
 		Name:        "Exercise",
 		Description: "Daily workout",
 		Frequency:   db.FrequencyDaily,
@@ -756,7 +830,7 @@ func (suite *InMemoryDBTestSuite) TestHabitReminderIntegration() {
 	suite.NoError(err)
 
 	// Verify reminder was automatically created
-	reminder, err := suite.db.GetReminder(habit.ID)
+	reminder, err := suite.db.GetReminder(testUserID, habit.ID)
 	suite.NoError(err)
 	suite.NotNil(reminder)
 	suite.Equal(habit.ID+"-reminder", reminder.ID)
@@ -764,15 +838,72 @@ func (suite *InMemoryDBTestSuite) TestHabitReminderIntegration() {
 	suite.NotEmpty(reminder.LastReminder)
 
 	// Test that deleting a habit also deletes the reminder
-	err = suite.db.DeleteHabit(habit.ID)
+	err = suite.db.DeleteHabit(testUserID, habit.ID)
 	suite.NoError(err)
 
 	// Verify reminder is also deleted
-	reminder, err = suite.db.GetReminder(habit.ID)
+	reminder, err = suite.db.GetReminder(testUserID, habit.ID)
 	suite.Nil(reminder)
 	suite.Equal(db.ErrNotFound, err)
 }
 
+func (suite *InMemoryDBTestSuite) TestHabitsScopedToOwner() {
+	suite.seedHabits("owned-habit")
+
+	entry := &db.TrackingEntry{
+		ID:        "owned-entry",
+		HabitID:   "owned-habit",
+		Timestamp: "2024-01-01T10:00:00Z",
+	}
+	suite.NoError(suite.db.CreateTrackingEntry(testUserID, entry))
+
+	// Another user cannot see or modify the habit
+	_, err := suite.db.GetHabit(otherUserID, "owned-habit")
+	suite.Equal(db.ErrNotFound, err)
+
+	habits, err := suite.db.GetAllHabits(otherUserID)
+	suite.NoError(err)
+	suite.Empty(habits)
+
+	_, err = suite.db.UpdateHabitPartial(otherUserID, "owned-habit", map[string]interface{}{"name": "Hijacked"})
+	suite.Equal(db.ErrNotFound, err)
+
+	suite.Equal(db.ErrNotFound, suite.db.DeleteHabit(otherUserID, "owned-habit"))
+
+	// Tracking entries and reminders follow the habit's owner
+	err = suite.db.CreateTrackingEntry(otherUserID, &db.TrackingEntry{ID: "foreign-entry", HabitID: "owned-habit"})
+	suite.Equal(db.ErrNotFound, err)
+
+	_, err = suite.db.GetTrackingEntry(otherUserID, "owned-entry")
+	suite.Equal(db.ErrNotFound, err)
+
+	suite.Equal(db.ErrNotFound, suite.db.DeleteTrackingEntry(otherUserID, "owned-entry"))
+
+	_, err = suite.db.GetReminder(otherUserID, "owned-habit")
+	suite.Equal(db.ErrNotFound, err)
+
+	suite.Equal(db.ErrNotFound, suite.db.UpdateReminderLastReminder(otherUserID, "owned-habit", "2024-01-01T10:00:00Z"))
+
+	// Statistics only include the caller's habits
+	_, err = suite.db.GetHabitStats(otherUserID, "owned-habit")
+	suite.Equal(db.ErrNotFound, err)
+
+	overall, err := suite.db.GetOverallStats(otherUserID)
+	suite.NoError(err)
+	suite.Equal(0, overall.TotalHabits)
+	suite.Equal(0, overall.TotalEntries)
+
+	overall, err = suite.db.GetOverallStats(testUserID)
+	suite.NoError(err)
+	suite.Equal(1, overall.TotalHabits)
+	suite.Equal(1, overall.TotalEntries)
+
+	// The owner still sees everything untouched
+	habit, err := suite.db.GetHabit(testUserID, "owned-habit")
+	suite.NoError(err)
+	suite.Equal("Habit owned-habit", habit.Name)
+}
+
 func TestInMemoryDBTestSuite(t *testing.T) {
 	suite.Run(t, new(InMemoryDBTestSuite))
 }
@@ -782,6 +913,7 @@ func TestHabitCopyIntegrity(t *testing.T) {
 	database := db.NewMapDatabase()
 	original := &db.Habit{
 		ID:          "test-habit",
+		UserID:      testUserID,
 		Name:        "Original Name",
 		Description: "Original Description",
 		Frequency:   db.FrequencyDaily,
@@ -796,7 +928,7 @@ func TestHabitCopyIntegrity(t *testing.T) {
 	original.Name = "Modified Name"
 
 	// Verify stored habit wasn't affected
-	retrieved, err := database.GetHabit("test-habit")
+	retrieved, err := database.GetHabit(testUserID, "test-habit")
 	assert.NoError(t, err)
 	assert.Equal(t, "Original Name", retrieved.Name)
 
@@ -804,13 +936,16 @@ func TestHabitCopyIntegrity(t *testing.T) {
 	retrieved.Name = "Another Modification"
 
 	// Verify stored habit still wasn't affected
-	retrieved2, err := database.GetHabit("test-habit")
+	retrieved2, err := database.GetHabit(testUserID, "test-habit")
 	assert.NoError(t, err)
 	assert.Equal(t, "Original Name", retrieved2.Name)
 }
 
 func TestTrackingEntryCopyIntegrity(t *testing.T) {
 	database := db.NewMapDatabase()
+	err := database.CreateHabit(&db.Habit{ID: "test-habit", UserID: testUserID, Name: "Exercise", Frequency: db.FrequencyDaily})
+	assert.NoError(t, err)
+
 	original := &db.TrackingEntry{
 		ID:        "test-entry",
 		HabitID:   "test-habit",
@@ -819,14 +954,14 @@ func TestTrackingEntryCopyIntegrity(t *testing.T) {
 	}
 
 	// Create entry
-	err := database.CreateTrackingEntry(original)
+	err = database.CreateTrackingEntry(testUserID, original)
 	assert.NoError(t, err)
 
 	// Modify original after creation
 	original.Note = "Modified Note"
 
 	// Verify stored entry wasn't affected
-	retrieved, err := database.GetTrackingEntry("test-entry")
+	retrieved, err := database.GetTrackingEntry(testUserID, "test-entry")
 	assert.NoError(t, err)
 	assert.Equal(t, "Original Note", retrieved.Note)
 
@@ -834,7 +969,7 @@ func TestTrackingEntryCopyIntegrity(t *testing.T) {
 	retrieved.Note = "Another Modification"
 
 	// Verify stored entry still wasn't affected
-	retrieved2, err := database.GetTrackingEntry("test-entry")
+	retrieved2, err := database.GetTrackingEntry(testUserID, "test-entry")
 	assert.NoError(t, err)
 	assert.Equal(t, "Original Note", retrieved2.Note)
 }
@@ -845,6 +980,7 @@ func TestReminderCopyIntegrity(t *testing.T) {
 	// Create a habit first
 	habit := &db.Habit{
 		ID:          "test-habit",
+		UserID:      testUserID,
 		Name:        "Exercise",
 		Description: "Daily workout",
 		Frequency:   db.FrequencyDaily,
@@ -854,7 +990,7 @@ func TestReminderCopyIntegrity(t *testing.T) {
 	assert.NoError(t, err)
 
 	// Get the automatically created reminder
-	retrieved, err := database.GetReminder(habit.ID)
+	retrieved, err := database.GetReminder(testUserID, habit.ID)
 	assert.NoError(t, err)
 	assert.NotNil(t, retrieved)
 
@@ -865,12 +1001,43 @@ func TestReminderCopyIntegrity(t *testing.T) {
 	retrieved.LastReminder = "2024-01-02T10:00:00Z"
 
 	// Get the reminder again to ensure database stores copies
-	retrieved2, err := database.GetReminder(habit.ID)
+	retrieved2, err := database.GetReminder(testUserID, habit.ID)
 	assert.NoError(t, err)
 	assert.NotSame(t, retrieved, retrieved2)                       // Should be different objects
 	assert.Equal(t, originalLastReminder, retrieved2.LastReminder) // Should have original data
 }
 
+func TestMapDatabaseConcurrentUse(t *testing.T) {
+	database := db.NewMapDatabase()
+	require.NoError(t, database.CreateHabit(&db.Habit{
+		ID: "test-habit", UserID: testUserID, Name: "Exercise", Frequency: db.FrequencyDaily, StartDate: "2024-01-01",
+	}))
+
+	// Writers and readers share the maps, as handlers, sockets and the
+	// reminder service do; run with -race to check the locking
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				entry := &db.TrackingEntry{ID: fmt.Sprintf("entry-%d-%d", i, j), HabitID: "test-habit", Timestamp: "2024-05-01T08:00:00Z"}
+				assert.NoError(t, database.CreateTrackingEntry(testUserID, entry))
+				assert.NoError(t, database.UpdateReminderLastReminder(testUserID, "test-habit", entry.Timestamp))
+				_, err := database.GetHabitStats(testUserID, "test-habit")
+				assert.NoError(t, err)
+				_, _, err = database.NextReminderDue()
+				assert.NoError(t, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	entries, err := database.GetTrackingEntriesByHabitID(testUserID, "test-habit")
+	require.NoError(t, err)
+	assert.Len(t, entries, 160)
+}
+
 func TestCalculateNextReminderTime(t *testing.T) {
 	baseTime := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
 
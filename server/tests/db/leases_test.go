@@ -0,0 +1,86 @@
+package db_test
+
+import (
+	"testing"
+	"time"
+
+	"habit-tracker/server/db"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLeases(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, database db.Database) {
+		acquired, err := database.AcquireLease("worker", "a", time.Hour)
+		require.NoError(t, err)
+		assert.True(t, acquired)
+
+		// Only the holder can renew a live lease
+		acquired, err = database.AcquireLease("worker", "b", time.Hour)
+		require.NoError(t, err)
+		assert.False(t, acquired)
+		acquired, err = database.AcquireLease("worker", "a", 50*time.Millisecond)
+		require.NoError(t, err)
+		assert.True(t, acquired)
+
+		// An expired lease can be taken over
+		time.Sleep(60 * time.Millisecond)
+		acquired, err = database.AcquireLease("worker", "b", time.Hour)
+		require.NoError(t, err)
+		assert.True(t, acquired)
+
+		// Only the holder can release it
+		require.NoError(t, database.ReleaseLease("worker", "a"))
+		acquired, err = database.AcquireLease("worker", "a", time.Hour)
+		require.NoError(t, err)
+		assert.False(t, acquired)
+		require.NoError(t, database.ReleaseLease("worker", "b"))
+		acquired, err = database.AcquireLease("worker", "a", time.Hour)
+		require.NoError(t, err)
+		assert.True(t, acquired)
+	})
+}
+
+func TestReminderSendsAreClaimedOnce(t *testing.T) {
+	now := time.Now()
+	dueAt := now.Add(-time.Minute).Truncate(time.Second)
+	forEachDatabase(t, func(t *testing.T, database db.Database) {
+		require.NoError(t, database.CreateUser(&db.User{ID: testUserID, Email: "sends@example.com", Username: "sends"}))
+		require.NoError(t, database.CreateHabit(&db.Habit{
+			ID: "read", UserID: testUserID, Name: "Read", Frequency: db.FrequencyDaily, StartDate: "2024-01-01",
+		}))
+		claim := func(worker string, claimedAt, staleBefore time.Time) (*db.ReminderSend, bool) {
+			send := &db.ReminderSend{UserID: testUserID, HabitID: "read", DueAt: dueAt, Worker: worker, ClaimedAt: claimedAt}
+			claimed, err := database.ClaimReminderSend(send, staleBefore)
+			require.NoError(t, err)
+			return send, claimed
+		}
+
+		first, claimed := claim("a", now, now.Add(-time.Hour))
+		require.True(t, claimed)
+		assert.NotEmpty(t, first.NotificationID)
+
+		// Another worker waits until the claim is stale, then takes it over
+		// with the same inbox entry
+		_, claimed = claim("b", now, now.Add(-time.Hour))
+		assert.False(t, claimed)
+		takeover, claimed := claim("b", now.Add(time.Minute), now.Add(time.Second))
+		require.True(t, claimed)
+		assert.Equal(t, first.ID, takeover.ID)
+		assert.Equal(t, first.NotificationID, takeover.NotificationID)
+
+		// A completed send is never claimed again, and the reminder moves on
+		require.NoError(t, database.CompleteReminderSend(takeover, now))
+		assert.ErrorIs(t, database.CompleteReminderSend(takeover, now), db.ErrNotFound)
+		_, claimed = claim("c", now.Add(time.Hour), now.Add(time.Hour))
+		assert.False(t, claimed)
+
+		reminder, err := database.GetReminder(testUserID, "read")
+		require.NoError(t, err)
+		assert.Equal(t, now.Format(time.RFC3339), reminder.LastReminder)
+		next, err := time.Parse(time.RFC3339, reminder.NextReminder)
+		require.NoError(t, err)
+		assert.WithinDuration(t, now.AddDate(0, 0, 1), next, 2*time.Second)
+	})
+}
@@ -0,0 +1,124 @@
+package db_test
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"habit-tracker/server/db"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewSQLiteDatabaseMigratesToLatest(t *testing.T) {
+	database, err := db.NewSQLiteDatabase(filepath.Join(t.TempDir(), "habits.db"))
+	require.NoError(t, err)
+	defer database.Close()
+
+	version, err := database.SchemaVersion()
+	require.NoError(t, err)
+	assert.Equal(t, db.LatestSchemaVersion(), version)
+
+	// Running again is a no-op
+	require.NoError(t, database.Migrate())
+}
+
+func TestMigrateDownAndUp(t *testing.T) {
+	database, err := db.NewSQLiteDatabase(filepath.Join(t.TempDir(), "habits.db"))
+	require.NoError(t, err)
+	defer database.Close()
+
+	require.NoError(t, database.MigrateTo(0))
+	version, err := database.SchemaVersion()
+	require.NoError(t, err)
+	assert.Equal(t, 0, version)
+
+	// The schema is gone
+	_, err = database.GetAllHabits(testUserID)
+	assert.Error(t, err)
+
+	require.NoError(t, database.Migrate())
+	require.NoError(t, database.CreateHabit(&db.Habit{
+		ID: "habit-1", UserID: testUserID, Name: "Read", Frequency: db.FrequencyDaily, StartDate: "2024-01-01",
+	}))
+}
+
+func TestMigrateToUnknownVersion(t *testing.T) {
+	database, err := db.OpenSQLiteDatabase(filepath.Join(t.TempDir(), "habits.db"))
+	require.NoError(t, err)
+	defer database.Close()
+
+	assert.ErrorIs(t, database.MigrateTo(db.LatestSchemaVersion()+1), db.ErrUnknownSchemaVersion)
+	assert.ErrorIs(t, database.MigrateTo(-1), db.ErrUnknownSchemaVersion)
+}
+
+func TestMigrateRefusesNewerDatabase(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "habits.db")
+	database, err := db.NewSQLiteDatabase(path)
+	require.NoError(t, err)
+	database.Close()
+
+	raw, err := sql.Open("sqlite3", path)
+	require.NoError(t, err)
+	_, err = raw.Exec(`INSERT INTO schema_migrations (version, description, applied_at) VALUES (?, 'from the future', '')`,
+		db.LatestSchemaVersion()+1)
+	require.NoError(t, err)
+	raw.Close()
+
+	_, err = db.NewSQLiteDatabase(path)
+	assert.ErrorIs(t, err, db.ErrUnknownSchemaVersion)
+}
+
+func TestMigrateAdoptsLegacyDatabase(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "habits.db")
+
+	// A habits.db created before migrations and per-user ownership existed
+	raw, err := sql.Open("sqlite3", path)
+	require.NoError(t, err)
+	_, err = raw.Exec(`
+		CREATE TABLE habits (id TEXT PRIMARY KEY, name TEXT NOT NULL, description TEXT, frequency TEXT, start_date TEXT);
+		INSERT INTO habits (id, name, description, frequency, start_date) VALUES ('legacy', 'Walk', '', 'daily', '2024-01-01');
+	`)
+	require.NoError(t, err)
+	raw.Close()
+
+	database, err := db.NewSQLiteDatabase(path)
+	require.NoError(t, err)
+	defer database.Close()
+
+	version, err := database.SchemaVersion()
+	require.NoError(t, err)
+	assert.Equal(t, db.LatestSchemaVersion(), version)
+
+	// Existing rows survive and are unowned until claimed
+	habit, err := database.GetHabit("", "legacy")
+	require.NoError(t, err)
+	assert.Equal(t, "Walk", habit.Name)
+}
+
+func TestExistingRemindersAreScheduledOnOpen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "habits.db")
+	database, err := db.OpenSQLiteDatabase(path)
+	require.NoError(t, err)
+	require.NoError(t, database.MigrateTo(9))
+	database.Close()
+
+	// A reminder stored before next-fire times were
+	raw, err := sql.Open("sqlite3", path)
+	require.NoError(t, err)
+	_, err = raw.Exec(`
+		INSERT INTO habits (id, user_id, name, description, frequency, start_date) VALUES ('walk', 'user-1', 'Walk', '', 'daily', '2024-01-01');
+		INSERT INTO reminders (id, habit_id, last_reminder) VALUES ('walk-reminder', 'walk', '2024-05-15T08:00:00Z');
+	`)
+	require.NoError(t, err)
+	raw.Close()
+
+	database, err = db.NewSQLiteDatabase(path)
+	require.NoError(t, err)
+	defer database.Close()
+
+	reminder, err := database.GetReminder("user-1", "walk")
+	require.NoError(t, err)
+	assert.Equal(t, "2024-05-16T08:00:00Z", reminder.NextReminder)
+}
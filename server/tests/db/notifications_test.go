@@ -0,0 +1,55 @@
+package db_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"habit-tracker/server/db"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNotificationInbox(t *testing.T) {
+	now := time.Now()
+	forEachDatabase(t, func(t *testing.T, database db.Database) {
+		require.NoError(t, database.CreateUser(&db.User{ID: testUserID, Email: "inbox@example.com", Username: "inbox"}))
+		for i := 0; i < 3; i++ {
+			require.NoError(t, database.CreateNotification(&db.Notification{
+				UserID: testUserID, HabitID: "read", Type: "reminder", Subject: "Reminder: Read",
+				Data: json.RawMessage(`{"habitId":"read"}`), CreatedAt: now.Add(time.Duration(i) * time.Millisecond),
+			}))
+		}
+
+		notifications, err := database.GetNotifications(testUserID, false)
+		require.NoError(t, err)
+		require.Len(t, notifications, 3)
+		assert.True(t, notifications[0].CreatedAt.After(notifications[1].CreatedAt), "newest first")
+		assert.JSONEq(t, `{"habitId":"read"}`, string(notifications[0].Data))
+
+		newest, oldest := notifications[0], notifications[2]
+		updated, err := database.UpdateNotificationPartial(testUserID, newest.ID, map[string]interface{}{"read": true})
+		require.NoError(t, err)
+		assert.True(t, updated.Read)
+		_, err = database.UpdateNotificationPartial(testUserID, oldest.ID, map[string]interface{}{"dismissed": true})
+		require.NoError(t, err)
+
+		unread, err := database.GetNotifications(testUserID, true)
+		require.NoError(t, err)
+		require.Len(t, unread, 1)
+		assert.Equal(t, notifications[1].ID, unread[0].ID)
+
+		// Dismissed notifications are kept but not listed or marked
+		marked, err := database.MarkAllNotificationsRead(testUserID)
+		require.NoError(t, err)
+		assert.Equal(t, 1, marked)
+		dismissed, err := database.GetNotification(testUserID, oldest.ID)
+		require.NoError(t, err)
+		assert.True(t, dismissed.Dismissed)
+		assert.False(t, dismissed.Read)
+
+		_, err = database.GetNotification("someone-else", newest.ID)
+		assert.ErrorIs(t, err, db.ErrNotFound)
+	})
+}
@@ -0,0 +1,42 @@
+package db_test
+
+import (
+	"testing"
+	"time"
+
+	"habit-tracker/server/db"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func date(year int, month time.Month, day, hour int) time.Time {
+	return time.Date(year, month, day, hour, 0, 0, 0, time.UTC)
+}
+
+func TestPeriodStart(t *testing.T) {
+	// Wednesday 2024-05-15 13:45
+	now := time.Date(2024, time.May, 15, 13, 45, 0, 0, time.UTC)
+
+	assert.Equal(t, date(2024, time.May, 15, 13), db.FrequencyHourly.PeriodStart(now))
+	assert.Equal(t, date(2024, time.May, 15, 0), db.FrequencyDaily.PeriodStart(now))
+	assert.Equal(t, date(2024, time.May, 13, 0), db.FrequencyWeekly.PeriodStart(now))
+	assert.Equal(t, date(2024, time.May, 1, 0), db.FrequencyMonthly.PeriodStart(now))
+	assert.Equal(t, date(2024, time.April, 1, 0), db.FrequencyQuarterly.PeriodStart(now))
+	assert.Equal(t, date(2024, time.January, 1, 0), db.FrequencyYearly.PeriodStart(now))
+
+	// Both weeks of a biweekly period share the same start
+	biweekly := db.FrequencyBiweekly.PeriodStart(now)
+	assert.Equal(t, time.Monday, biweekly.Weekday())
+	assert.Equal(t, biweekly, db.FrequencyBiweekly.PeriodStart(biweekly.AddDate(0, 0, 13)))
+	assert.NotEqual(t, biweekly, db.FrequencyBiweekly.PeriodStart(biweekly.AddDate(0, 0, 14)))
+}
+
+func TestParseTimestamp(t *testing.T) {
+	for _, value := range []string{"2024-05-15T13:45:00Z", "2024-05-15T13:45:00.123Z", "2024-05-15 13:45:00", "2024-05-15"} {
+		_, ok := db.ParseTimestamp(value)
+		assert.True(t, ok, value)
+	}
+
+	_, ok := db.ParseTimestamp("not a time")
+	assert.False(t, ok)
+}
@@ -0,0 +1,112 @@
+package db_test
+
+import (
+	"testing"
+	"time"
+
+	"habit-tracker/server/db"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNextReminderTime(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	require.NoError(t, err)
+	owner := &db.User{Timezone: "Europe/Berlin"}
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2024, time.May, day, hour, minute, 0, 0, berlin)
+	}
+
+	// Without reminder times a habit is reminded a period after the last reminder
+	daily := &db.Habit{Frequency: db.FrequencyDaily, StartDate: "2024-01-01"}
+	assert.True(t, at(16, 10, 30).Equal(db.NextReminderTime(daily, owner, at(15, 10, 30))))
+
+	// Reminder times are in the owner's zone, and several a day are allowed
+	daily.ReminderTimes = []string{"08:00", "20:00"}
+	assert.True(t, at(15, 20, 0).Equal(db.NextReminderTime(daily, owner, at(15, 10, 30))))
+	assert.True(t, at(16, 8, 0).Equal(db.NextReminderTime(daily, owner, at(15, 20, 0))))
+	assert.True(t, at(16, 8, 0).Equal(db.NextReminderTime(daily, owner, at(15, 21, 0).UTC())))
+
+	// Other habits are reminded at the first time on the day they are next due
+	weekly := &db.Habit{Frequency: db.FrequencyWeekly, StartDate: "2024-01-01", ReminderTimes: []string{"09:00", "18:00"}}
+	assert.True(t, at(22, 9, 0).Equal(db.NextReminderTime(weekly, owner, at(15, 19, 0))))
+
+	scheduled := &db.Habit{
+		Frequency: db.FrequencyWeekly, StartDate: "2024-01-01", Schedule: "FREQ=WEEKLY;BYDAY=MO,FR",
+		ReminderTimes: []string{"07:30"},
+	}
+	assert.True(t, at(17, 7, 30).Equal(db.NextReminderTime(scheduled, owner, at(13, 7, 30))))
+}
+
+func TestQuietHoursDeferReminders(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	require.NoError(t, err)
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2024, time.May, day, hour, minute, 0, 0, berlin)
+	}
+	daily := &db.Habit{Frequency: db.FrequencyDaily, StartDate: "2024-01-01", ReminderTimes: []string{"06:00", "12:00", "23:00"}}
+
+	// Quiet hours that wrap past midnight hold reminders on either side of it
+	owner := &db.User{Timezone: "Europe/Berlin", QuietHoursStart: "22:00", QuietHoursEnd: "07:00"}
+	assert.True(t, at(16, 7, 0).Equal(db.NextReminderTime(daily, owner, at(15, 12, 0))))
+	assert.True(t, at(16, 7, 0).Equal(db.NextReminderTime(daily, owner, at(15, 23, 0))))
+	assert.True(t, at(15, 12, 0).Equal(db.NextReminderTime(daily, owner, at(15, 7, 0))))
+
+	owner = &db.User{Timezone: "Europe/Berlin", QuietHoursStart: "11:00", QuietHoursEnd: "13:30"}
+	assert.True(t, at(15, 13, 30).Equal(db.NextReminderTime(daily, owner, at(15, 6, 0))))
+
+	quiet := db.QuietHours{Start: 22 * 60, End: 7 * 60}
+	assert.True(t, at(15, 21, 59).Equal(quiet.Defer(at(15, 21, 59))))
+	assert.True(t, at(15, 7, 0).Equal(quiet.Defer(at(15, 7, 0))))
+}
+
+func TestValidateReminderTimesAndQuietHours(t *testing.T) {
+	assert.NoError(t, db.ValidateReminderTimes(nil))
+	assert.NoError(t, db.ValidateReminderTimes([]string{"07:00", "21:30"}))
+	assert.ErrorIs(t, db.ValidateReminderTimes([]string{"7:00"}), db.ErrInvalidReminderTime)
+	assert.ErrorIs(t, db.ValidateReminderTimes([]string{"24:00"}), db.ErrInvalidReminderTime)
+	assert.ErrorIs(t, db.ValidateReminderTimes([]string{"08:00", "08:00"}), db.ErrInvalidReminderTime)
+
+	assert.NoError(t, db.ValidateQuietHours("", ""))
+	assert.NoError(t, db.ValidateQuietHours("22:00", "07:00"))
+	assert.ErrorIs(t, db.ValidateQuietHours("22:00", ""), db.ErrInvalidQuietHours)
+	assert.ErrorIs(t, db.ValidateQuietHours("22:00", "22:00"), db.ErrInvalidQuietHours)
+}
+
+func TestReminderTimesAndQuietHoursPersist(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, database db.Database) {
+		require.NoError(t, database.CreateUser(&db.User{
+			ID: testUserID, Email: "quiet@example.com", Username: "quiet", QuietHoursStart: "22:00", QuietHoursEnd: "07:00",
+		}))
+		user, err := database.GetUserByID(testUserID)
+		require.NoError(t, err)
+		assert.Equal(t, "22:00", user.QuietHoursStart)
+		assert.Equal(t, "07:00", user.QuietHoursEnd)
+
+		require.NoError(t, database.CreateHabit(&db.Habit{
+			ID: "water", UserID: testUserID, Name: "Water", Frequency: db.FrequencyDaily, StartDate: "2024-01-01",
+			ReminderTimes: []string{"09:00", "15:00"},
+		}))
+		habit, err := database.GetHabit(testUserID, "water")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"09:00", "15:00"}, habit.ReminderTimes)
+
+		habit, err = database.UpdateHabitPartial(testUserID, "water", map[string]interface{}{
+			"reminderTimes": []interface{}{"18:00", "08:30"},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"08:30", "18:00"}, habit.ReminderTimes)
+
+		habit, err = database.GetHabit(testUserID, "water")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"08:30", "18:00"}, habit.ReminderTimes)
+
+		_, err = database.UpdateHabitPartial(testUserID, "water", map[string]interface{}{"reminderTimes": []interface{}{"noon"}})
+		assert.ErrorIs(t, err, db.ErrInvalidReminderTime)
+
+		habit, err = database.UpdateHabitPartial(testUserID, "water", map[string]interface{}{"reminderTimes": []interface{}{}})
+		require.NoError(t, err)
+		assert.Empty(t, habit.ReminderTimes)
+	})
+}
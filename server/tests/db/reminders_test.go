@@ -0,0 +1,206 @@
+package db_test
+
+import (
+	"testing"
+	"time"
+
+	"habit-tracker/server/db"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReminderSnoozes(t *testing.T) {
+	now := time.Now()
+	forEachDatabase(t, func(t *testing.T, database db.Database) {
+		require.NoError(t, database.CreateUser(&db.User{ID: testUserID, Email: "snooze@example.com", Username: "snooze"}))
+		require.NoError(t, database.CreateHabit(&db.Habit{
+			ID: "read", UserID: testUserID, Name: "Read", Frequency: db.FrequencyDaily, StartDate: "2024-01-01",
+		}))
+		dueHabits := func() int {
+			habits, err := database.GetHabitsNeedingReminders()
+			require.NoError(t, err)
+			return len(habits)
+		}
+
+		// Just reminded, so only an elapsed snooze makes it due again
+		require.Equal(t, 0, dueHabits())
+		require.NoError(t, database.SnoozeReminder(testUserID, "read", now.Add(-time.Minute)))
+		assert.Equal(t, 1, dueHabits())
+
+		// A snooze also holds back a reminder that is otherwise due
+		require.NoError(t, database.UpdateReminderLastReminder(testUserID, "read", now.AddDate(0, 0, -2).Format(time.RFC3339)))
+		require.NoError(t, database.SnoozeReminder(testUserID, "read", now.Add(time.Hour)))
+		assert.Equal(t, 0, dueHabits())
+		reminder, err := database.GetReminder(testUserID, "read")
+		require.NoError(t, err)
+		assert.NotEmpty(t, reminder.SnoozedUntil)
+
+		// Sending the reminder ends the snooze
+		require.NoError(t, database.UpdateReminderLastReminder(testUserID, "read", now.Format(time.RFC3339)))
+		reminder, err = database.GetReminder(testUserID, "read")
+		require.NoError(t, err)
+		assert.Empty(t, reminder.SnoozedUntil)
+
+		assert.ErrorIs(t, database.SnoozeReminder("someone-else", "read", now), db.ErrNotFound)
+	})
+}
+
+func TestReminderActions(t *testing.T) {
+	now := time.Now()
+	forEachDatabase(t, func(t *testing.T, database db.Database) {
+		require.NoError(t, database.CreateHabit(&db.Habit{
+			ID: "read", UserID: testUserID, Name: "Read", Frequency: db.FrequencyDaily, StartDate: "2024-01-01",
+		}))
+
+		for i, actionType := range []db.ReminderActionType{db.ReminderSnoozed, db.ReminderDismissed} {
+			require.NoError(t, database.CreateReminderAction(&db.ReminderAction{
+				UserID: testUserID, HabitID: "read", NotificationID: "inbox-1", Action: actionType,
+				Until: now.Add(time.Hour), CreatedAt: now.Add(time.Duration(i) * time.Millisecond),
+			}))
+		}
+
+		actions, err := database.GetReminderActions(testUserID, "read")
+		require.NoError(t, err)
+		require.Len(t, actions, 2)
+		assert.Equal(t, db.ReminderDismissed, actions[0].Action, "newest first")
+		assert.Equal(t, "inbox-1", actions[1].NotificationID)
+		assert.WithinDuration(t, now.Add(time.Hour), actions[1].Until, time.Millisecond)
+
+		// Actions are scoped to the habit's owner
+		_, err = database.GetReminderActions("someone-else", "read")
+		assert.ErrorIs(t, err, db.ErrNotFound)
+		err = database.CreateReminderAction(&db.ReminderAction{UserID: "someone-else", HabitID: "read", Action: db.ReminderSnoozed})
+		assert.ErrorIs(t, err, db.ErrNotFound)
+	})
+}
+
+func TestRemindersAreRescheduledOnWrites(t *testing.T) {
+	last := time.Date(2024, time.May, 15, 21, 30, 0, 0, time.UTC)
+	forEachDatabase(t, func(t *testing.T, database db.Database) {
+		var heard []time.Time
+		database.SetReminderListener(func(next time.Time) {
+			heard = append(heard, next)
+		})
+		nextReminder := func() string {
+			reminder, err := database.GetReminder(testUserID, "walk")
+			require.NoError(t, err)
+			return reminder.NextReminder
+		}
+
+		require.NoError(t, database.CreateUser(&db.User{ID: testUserID, Email: "walk@example.com", Username: "walk"}))
+		require.NoError(t, database.CreateHabit(&db.Habit{
+			ID: "walk", UserID: testUserID, Name: "Walk", Frequency: db.FrequencyDaily, StartDate: "2024-01-01",
+		}))
+		require.NotEmpty(t, heard)
+
+		require.NoError(t, database.UpdateReminderLastReminder(testUserID, "walk", last.Format(time.RFC3339)))
+		assert.Equal(t, "2024-05-16T21:30:00Z", nextReminder())
+		due, ok, err := database.NextReminderDue()
+		require.NoError(t, err)
+		assert.True(t, ok)
+		assert.True(t, due.Equal(last.AddDate(0, 0, 1)))
+		assert.True(t, heard[len(heard)-1].Equal(due))
+
+		// The owner's quiet hours move every one of their reminders
+		user, err := database.GetUserByID(testUserID)
+		require.NoError(t, err)
+		user.QuietHoursStart, user.QuietHoursEnd = "21:00", "07:00"
+		require.NoError(t, database.UpdateUser(user))
+		assert.Equal(t, "2024-05-17T07:00:00Z", nextReminder())
+
+		// Habit changes reschedule too
+		_, err = database.UpdateHabitPartial(testUserID, "walk", map[string]interface{}{"reminderTimes": []interface{}{"12:00"}})
+		require.NoError(t, err)
+		assert.Equal(t, "2024-05-16T12:00:00Z", nextReminder())
+
+		// A snooze into the quiet hours waits for them to end
+		require.NoError(t, database.SnoozeReminder(testUserID, "walk", last.Add(time.Hour)))
+		assert.Equal(t, "2024-05-16T07:00:00Z", nextReminder())
+		require.NoError(t, database.SnoozeReminder(testUserID, "walk", last.Add(-2*time.Hour)))
+		assert.Equal(t, "2024-05-15T19:30:00Z", nextReminder())
+
+		// The reminder is overdue, so it is the only one needing a reminder
+		habits, err := database.GetHabitsNeedingReminders()
+		require.NoError(t, err)
+		require.Len(t, habits, 1)
+		assert.Equal(t, "walk", habits[0].ID)
+
+		// Habits paused without a resume date are never reminded
+		_, err = database.UpdateHabitPartial(testUserID, "walk", map[string]interface{}{"status": "paused"})
+		require.NoError(t, err)
+		assert.Empty(t, nextReminder())
+		_, ok, err = database.NextReminderDue()
+		require.NoError(t, err)
+		assert.False(t, ok)
+	})
+}
+
+func TestDeletedHabitLeavesNoReminderDue(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, database db.Database) {
+		require.NoError(t, database.CreateHabit(&db.Habit{
+			ID: "walk", UserID: testUserID, Name: "Walk", Frequency: db.FrequencyDaily, StartDate: "2024-01-01",
+		}))
+		_, ok, err := database.NextReminderDue()
+		require.NoError(t, err)
+		require.True(t, ok)
+
+		require.NoError(t, database.DeleteHabit(testUserID, "walk"))
+		_, ok, err = database.NextReminderDue()
+		require.NoError(t, err)
+		assert.False(t, ok)
+		_, err = database.GetReminder(testUserID, "walk")
+		assert.ErrorIs(t, err, db.ErrNotFound)
+	})
+}
+
+func TestEntryChangesMoveLastReminder(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, database db.Database) {
+		require.NoError(t, database.CreateHabit(&db.Habit{
+			ID: "walk", UserID: testUserID, Name: "Walk", Frequency: db.FrequencyDaily, StartDate: "2024-01-01",
+		}))
+		for _, entry := range []*db.TrackingEntry{
+			{ID: "older", HabitID: "walk", Timestamp: "2024-05-10T08:00:00Z"},
+			{ID: "newer", HabitID: "walk", Timestamp: "2024-05-12T08:00:00Z"},
+		} {
+			require.NoError(t, database.CreateTrackingEntry(testUserID, entry))
+			require.NoError(t, database.UpdateReminderLastReminder(testUserID, "walk", entry.Timestamp))
+		}
+		reminder := func() *db.Reminder {
+			reminder, err := database.GetReminder(testUserID, "walk")
+			require.NoError(t, err)
+			return reminder
+		}
+
+		// Moving the latest check-in moves the reminder with it
+		_, err := database.UpdateTrackingEntryPartial(testUserID, "newer", map[string]interface{}{"timestamp": "2024-05-11T08:00:00Z"})
+		require.NoError(t, err)
+		assert.Equal(t, "2024-05-11T08:00:00Z", reminder().LastReminder)
+		assert.Equal(t, "2024-05-12T08:00:00Z", reminder().NextReminder)
+
+		require.NoError(t, database.DeleteTrackingEntry(testUserID, "newer"))
+		assert.Equal(t, "2024-05-10T08:00:00Z", reminder().LastReminder)
+
+		// Without check-ins the reminder counts from the start date again
+		require.NoError(t, database.DeleteTrackingEntry(testUserID, "older"))
+		assert.Equal(t, "2024-01-01T00:00:00Z", reminder().LastReminder)
+		assert.Equal(t, "2024-01-02T00:00:00Z", reminder().NextReminder)
+	})
+}
+
+func TestGetReminderByID(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, database db.Database) {
+		require.NoError(t, database.CreateHabit(&db.Habit{
+			ID: "walk", UserID: testUserID, Name: "Walk", Frequency: db.FrequencyDaily, StartDate: "2024-01-01",
+		}))
+
+		reminder, err := database.GetReminderByID(testUserID, "walk-reminder")
+		require.NoError(t, err)
+		assert.Equal(t, "walk", reminder.HabitID)
+
+		_, err = database.GetReminderByID(otherUserID, "walk-reminder")
+		assert.ErrorIs(t, err, db.ErrNotFound)
+		_, err = database.GetReminderByID(testUserID, "walk")
+		assert.ErrorIs(t, err, db.ErrNotFound)
+	})
+}
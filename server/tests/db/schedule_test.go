@@ -0,0 +1,185 @@
+package db_test
+
+import (
+	"testing"
+	"time"
+
+	"habit-tracker/server/db"
+	"habit-tracker/server/stats"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSchedule(t *testing.T) {
+	for _, rule := range []string{
+		"FREQ=DAILY",
+		"FREQ=DAILY;INTERVAL=3",
+		"RRULE:FREQ=WEEKLY;BYDAY=MO,WE,FR",
+		"FREQ=MONTHLY;BYDAY=1SU",
+		"FREQ=MONTHLY;BYDAY=-1FR",
+		"FREQ=MONTHLY;BYMONTHDAY=1,15,-1",
+		"FREQ=DAILY;INTERVAL=366",
+	} {
+		_, err := db.ParseSchedule(rule)
+		assert.NoError(t, err, rule)
+	}
+
+	for _, rule := range []string{
+		"",
+		"INTERVAL=2",
+		"FREQ=YEARLY",
+		"FREQ=DAILY;INTERVAL=0",
+		"FREQ=DAILY;INTERVAL=367",
+		"FREQ=DAILY;INTERVAL=100000000",
+		"FREQ=DAILY;BYDAY=MO",
+		"FREQ=WEEKLY;BYDAY=1MO",
+		"FREQ=WEEKLY;BYDAY=XX",
+		"FREQ=MONTHLY;BYMONTHDAY=32",
+		"FREQ=MONTHLY;COUNT=3",
+	} {
+		_, err := db.ParseSchedule(rule)
+		assert.ErrorIs(t, err, db.ErrInvalidSchedule, rule)
+	}
+
+	assert.NoError(t, db.ValidateSchedule(""))
+}
+
+func TestScheduleOccurs(t *testing.T) {
+	habit := &db.Habit{StartDate: "2024-05-01", Schedule: "FREQ=WEEKLY;BYDAY=MO,WE,FR"}
+	schedule := habit.ParsedSchedule()
+	require.NotNil(t, schedule)
+	assert.True(t, schedule.Occurs(date(2024, time.May, 13, 9)))  // Monday
+	assert.False(t, schedule.Occurs(date(2024, time.May, 14, 9))) // Tuesday
+	assert.True(t, schedule.Occurs(date(2024, time.May, 17, 9)))  // Friday
+
+	habit = &db.Habit{StartDate: "2024-05-01", Schedule: "FREQ=DAILY;INTERVAL=3"}
+	schedule = habit.ParsedSchedule()
+	assert.True(t, schedule.Occurs(date(2024, time.May, 4, 0)))
+	assert.False(t, schedule.Occurs(date(2024, time.May, 5, 0)))
+	assert.True(t, schedule.Occurs(date(2024, time.April, 28, 0)))
+
+	habit = &db.Habit{StartDate: "2024-05-01", Schedule: "FREQ=MONTHLY;BYDAY=1SU,-1FR"}
+	schedule = habit.ParsedSchedule()
+	assert.True(t, schedule.Occurs(date(2024, time.June, 2, 0)))
+	assert.False(t, schedule.Occurs(date(2024, time.June, 9, 0)))
+	assert.True(t, schedule.Occurs(date(2024, time.May, 31, 0)))
+	assert.False(t, schedule.Occurs(date(2024, time.May, 24, 0)))
+
+	// Rules that recur on the start date's day need a start date
+	for _, rule := range []string{"FREQ=WEEKLY", "FREQ=MONTHLY"} {
+		schedule, err := db.ParseSchedule(rule)
+		require.NoError(t, err)
+		for day := 13; day < 20; day++ {
+			assert.False(t, schedule.Occurs(date(2024, time.May, day, 9)), rule)
+		}
+	}
+	schedule = (&db.Habit{StartDate: "2024-05-01", Schedule: "FREQ=WEEKLY"}).ParsedSchedule()
+	assert.True(t, schedule.Occurs(date(2024, time.May, 15, 9)))  // Wednesday
+	assert.False(t, schedule.Occurs(date(2024, time.May, 16, 9))) // Thursday
+
+	// An invalid rule leaves the habit on its frequency
+	habit = &db.Habit{Frequency: db.FrequencyDaily, Schedule: "FREQ=SOMETIMES"}
+	assert.Nil(t, habit.ParsedSchedule())
+	assert.Equal(t, db.DefaultCalendar.Cadence(db.FrequencyDaily), habit.Cadence(db.DefaultCalendar))
+}
+
+func TestSchedulePeriods(t *testing.T) {
+	habit := &db.Habit{StartDate: "2024-05-01", Schedule: "FREQ=WEEKLY;BYDAY=MO,WE,FR"}
+	cadence := habit.Cadence(db.DefaultCalendar)
+
+	// Unscheduled days belong to the previous scheduled day
+	assert.Equal(t, date(2024, time.May, 13, 0), cadence.PeriodStart(date(2024, time.May, 14, 18)))
+	assert.Equal(t, date(2024, time.May, 15, 0), cadence.NextPeriodStart(date(2024, time.May, 13, 0)))
+	assert.Equal(t, date(2024, time.May, 20, 0), cadence.NextPeriodStart(date(2024, time.May, 17, 0)))
+
+	monthly := (&db.Habit{StartDate: "2024-01-01", Schedule: "FREQ=MONTHLY;BYDAY=1SU"}).Cadence(db.DefaultCalendar)
+	assert.Equal(t, date(2024, time.May, 5, 0), monthly.PeriodStart(date(2024, time.June, 1, 12)))
+	assert.Equal(t, date(2024, time.June, 2, 0), monthly.NextPeriodStart(date(2024, time.May, 5, 0)))
+}
+
+// TestSchedulePeriodsMatchOccurs checks the periods found for each day against
+// a day-by-day search of the days the rule occurs on
+func TestSchedulePeriodsMatchOccurs(t *testing.T) {
+	for _, rule := range []string{
+		"FREQ=DAILY",
+		"FREQ=DAILY;INTERVAL=5",
+		"FREQ=DAILY;INTERVAL=366",
+		"FREQ=WEEKLY",
+		"FREQ=WEEKLY;INTERVAL=3;BYDAY=TU,SA",
+		"FREQ=WEEKLY;INTERVAL=2;BYDAY=SU;WKST=SU",
+		"FREQ=MONTHLY;INTERVAL=2;BYMONTHDAY=31",
+		"FREQ=MONTHLY;BYDAY=-1FR",
+	} {
+		schedule := (&db.Habit{StartDate: "2024-01-10", Schedule: rule}).ParsedSchedule()
+		require.NotNil(t, schedule, rule)
+
+		for day := date(2023, time.June, 1, 12); day.Before(date(2026, time.January, 1, 0)); day = day.AddDate(0, 0, 1) {
+			start := schedule.PeriodStart(day)
+			require.True(t, schedule.Occurs(start), "%s: period of %s starts on %s", rule, day, start)
+			for d := start.AddDate(0, 0, 1); d.Before(day); d = d.AddDate(0, 0, 1) {
+				require.False(t, schedule.Occurs(d), "%s: period of %s skips %s", rule, day, d)
+			}
+
+			next := schedule.NextPeriodStart(start)
+			require.True(t, schedule.Occurs(next), "%s: period after %s starts on %s", rule, start, next)
+			for d := start.AddDate(0, 0, 1); d.Before(next); d = d.AddDate(0, 0, 1) {
+				require.False(t, schedule.Occurs(d), "%s: period after %s skips %s", rule, start, d)
+			}
+		}
+	}
+}
+
+func TestScheduledReminderTime(t *testing.T) {
+	habit := &db.Habit{Frequency: db.FrequencyWeekly, StartDate: "2024-05-01", Schedule: "FREQ=WEEKLY;BYDAY=MO,WE,FR"}
+
+	// Friday's reminder is followed by Monday's at the same time of day
+	friday := time.Date(2024, time.May, 17, 10, 30, 0, 0, time.UTC)
+	assert.Equal(t, time.Date(2024, time.May, 20, 10, 30, 0, 0, time.UTC),
+		db.CalculateNextReminderTime(friday, habit.Recurrence(db.DefaultCalendar)))
+
+	habit.Schedule = ""
+	assert.Equal(t, friday.AddDate(0, 0, 7), db.CalculateNextReminderTime(friday, habit.Recurrence(db.DefaultCalendar)))
+}
+
+func TestScheduledHabitStats(t *testing.T) {
+	habit := &db.Habit{StartDate: "2024-05-13", Schedule: "FREQ=WEEKLY;BYDAY=MO,WE,FR"}
+	statsHabit := stats.Habit{Cadence: habit.Cadence(db.DefaultCalendar), Start: date(2024, time.May, 13, 0)}
+	for _, day := range []int{13, 15, 17, 20} {
+		statsHabit.Completions = append(statsHabit.Completions, stats.Completion{Time: date(2024, time.May, day, 8)})
+	}
+
+	// Tuesdays and Thursdays are not scheduled, so they never break the streak
+	now := date(2024, time.May, 21, 12)
+	current, longest := stats.Streaks(statsHabit, now)
+	assert.Equal(t, 4, current)
+	assert.Equal(t, 4, longest)
+
+	rate := stats.CompletionRate(statsHabit, statsHabit.Start, now)
+	assert.Equal(t, 4, rate.ExpectedCompletions)
+	assert.Equal(t, 1.0, rate.CompletionRate)
+
+	// Missing Wednesday the 22nd breaks it once Friday arrives
+	current, _ = stats.Streaks(statsHabit, date(2024, time.May, 24, 12))
+	assert.Equal(t, 0, current)
+}
+
+func TestScheduleIsStored(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, database db.Database) {
+		require.NoError(t, database.CreateHabit(&db.Habit{
+			ID: "gym", UserID: testUserID, Name: "Gym", Frequency: db.FrequencyWeekly,
+			StartDate: "2024-05-01", Schedule: "FREQ=WEEKLY;BYDAY=MO,WE,FR",
+		}))
+
+		stored, err := database.GetHabit(testUserID, "gym")
+		require.NoError(t, err)
+		assert.Equal(t, "FREQ=WEEKLY;BYDAY=MO,WE,FR", stored.Schedule)
+
+		updated, err := database.UpdateHabitPartial(testUserID, "gym", map[string]interface{}{"schedule": "FREQ=DAILY;INTERVAL=2"})
+		require.NoError(t, err)
+		assert.Equal(t, "FREQ=DAILY;INTERVAL=2", updated.Schedule)
+
+		_, err = database.UpdateHabitPartial(testUserID, "gym", map[string]interface{}{"schedule": "FREQ=HOURLY"})
+		assert.ErrorIs(t, err, db.ErrInvalidSchedule)
+	})
+}
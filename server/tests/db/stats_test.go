@@ -0,0 +1,148 @@
+package db_test
+
+import (
+	"testing"
+	"time"
+
+	"habit-tracker/server/db"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// seedStatsData stores a daily and a weekly habit with history ending today, plus another user's habit
+func seedStatsData(t *testing.T, database db.Database) {
+	now := time.Now()
+	habits := []*db.Habit{
+		{ID: "stats-daily", UserID: testUserID, Name: "Read", Frequency: db.FrequencyDaily, StartDate: now.AddDate(0, 0, -10).Format("2006-01-02")},
+		{ID: "stats-weekly", UserID: testUserID, Name: "Call home", Frequency: db.FrequencyWeekly, StartDate: now.AddDate(0, 0, -60).Format("2006-01-02")},
+		{ID: "stats-other", UserID: otherUserID, Name: "Other", Frequency: db.FrequencyDaily, StartDate: now.Format("2006-01-02")},
+	}
+	for _, habit := range habits {
+		require.NoError(t, database.CreateHabit(habit))
+	}
+
+	var entries []*db.TrackingEntry
+	for day := 0; day < 3; day++ {
+		entries = append(entries, &db.TrackingEntry{HabitID: "stats-daily", Timestamp: now.AddDate(0, 0, -day).Format(time.RFC3339)})
+	}
+	for week := 0; week < 4; week++ {
+		entries = append(entries, &db.TrackingEntry{HabitID: "stats-weekly", Timestamp: now.AddDate(0, 0, -7*week).Format(time.RFC3339)})
+	}
+	for i, entry := range entries {
+		entry.ID = "stats-entry-" + string(rune('a'+i))
+		require.NoError(t, database.CreateTrackingEntry(testUserID, entry))
+	}
+}
+
+func TestBackendsReportSameStats(t *testing.T) {
+	sqlite := newSQLiteDatabase(t)
+
+	memory := db.NewMapDatabase()
+	seedStatsData(t, memory)
+	seedStatsData(t, sqlite)
+
+	for _, habitID := range []string{"stats-daily", "stats-weekly"} {
+		memoryStats, err := memory.GetHabitStats(testUserID, habitID)
+		require.NoError(t, err)
+		sqliteStats, err := sqlite.GetHabitStats(testUserID, habitID)
+		require.NoError(t, err)
+		assert.Equal(t, memoryStats, sqliteStats)
+
+		memoryProgress, err := memory.GetHabitProgress(testUserID, habitID, 30)
+		require.NoError(t, err)
+		sqliteProgress, err := sqlite.GetHabitProgress(testUserID, habitID, 30)
+		require.NoError(t, err)
+		assert.Equal(t, memoryProgress, sqliteProgress)
+	}
+
+	memoryOverall, err := memory.GetOverallStats(testUserID)
+	require.NoError(t, err)
+	sqliteOverall, err := sqlite.GetOverallStats(testUserID)
+	require.NoError(t, err)
+	assert.Equal(t, memoryOverall, sqliteOverall)
+
+	memoryRates, err := memory.GetHabitCompletionRates(testUserID, 30)
+	require.NoError(t, err)
+	sqliteRates, err := sqlite.GetHabitCompletionRates(testUserID, 30)
+	require.NoError(t, err)
+	assert.Equal(t, memoryRates, sqliteRates)
+
+	memoryDaily, err := memory.GetDailyCompletions(testUserID, 30)
+	require.NoError(t, err)
+	sqliteDaily, err := sqlite.GetDailyCompletions(testUserID, 30)
+	require.NoError(t, err)
+	assert.Equal(t, memoryDaily, sqliteDaily)
+}
+
+func TestMapDatabaseHabitStats(t *testing.T) {
+	memory := db.NewMapDatabase()
+	seedStatsData(t, memory)
+
+	stats, err := memory.GetHabitStats(testUserID, "stats-daily")
+	require.NoError(t, err)
+	assert.Equal(t, 3, stats.TotalEntries)
+	assert.Equal(t, 3, stats.CurrentStreak)
+	assert.Equal(t, 3, stats.LongestStreak)
+	assert.Greater(t, stats.CompletionRate, 0.0)
+	assert.NotEmpty(t, stats.LastCompleted)
+
+	stats, err = memory.GetHabitStats(testUserID, "stats-weekly")
+	require.NoError(t, err)
+	assert.Equal(t, 4, stats.CurrentStreak)
+
+	progress, err := memory.GetHabitProgress(testUserID, "stats-weekly", 7)
+	require.NoError(t, err)
+	assert.Len(t, progress, 1)
+
+	overall, err := memory.GetOverallStats(testUserID)
+	require.NoError(t, err)
+	assert.Equal(t, 2, overall.TotalHabits)
+	assert.Equal(t, 7, overall.TotalEntries)
+	assert.Equal(t, 2, overall.EntriesToday)
+	assert.Greater(t, overall.AvgEntriesPerDay, 0.0)
+}
+
+func TestQuantitativeHabitStats(t *testing.T) {
+	now := time.Now()
+	forEachDatabase(t, func(t *testing.T, database db.Database) {
+		habit := &db.Habit{
+			ID: "water", UserID: testUserID, Name: "Water", Frequency: db.FrequencyDaily,
+			StartDate: now.AddDate(0, 0, -2).Format("2006-01-02"), Target: 8, Unit: "glasses", Aggregation: db.AggregationSum,
+		}
+		require.NoError(t, database.CreateHabit(habit))
+
+		stored, err := database.GetHabit(testUserID, "water")
+		require.NoError(t, err)
+		assert.Equal(t, 8.0, stored.Target)
+		assert.Equal(t, "glasses", stored.Unit)
+		assert.Equal(t, db.AggregationSum, stored.Aggregation)
+
+		// Yesterday fell short of the target, today has met it
+		entries := []*db.TrackingEntry{
+			{ID: "w1", HabitID: "water", Timestamp: now.AddDate(0, 0, -1).Format(time.RFC3339), Value: 6},
+			{ID: "w2", HabitID: "water", Timestamp: now.Format(time.RFC3339), Value: 5},
+			{ID: "w3", HabitID: "water", Timestamp: now.Format(time.RFC3339), Value: 3},
+		}
+		for _, entry := range entries {
+			require.NoError(t, database.CreateTrackingEntry(testUserID, entry))
+		}
+
+		stats, err := database.GetHabitStats(testUserID, "water")
+		require.NoError(t, err)
+		assert.Equal(t, 3, stats.TotalEntries)
+		assert.Equal(t, 1, stats.CurrentStreak)
+
+		entry, err := database.GetTrackingEntry(testUserID, "w1")
+		require.NoError(t, err)
+		assert.Equal(t, 6.0, entry.Value)
+
+		updated, err := database.UpdateHabitPartial(testUserID, "water", map[string]interface{}{"target": 4.0, "aggregation": "max"})
+		require.NoError(t, err)
+		assert.Equal(t, 4.0, updated.Target)
+		assert.Equal(t, db.AggregationMax, updated.Aggregation)
+
+		_, err = database.UpdateHabitPartial(testUserID, "water", map[string]interface{}{"aggregation": "average"})
+		assert.ErrorIs(t, err, db.ErrInvalidAggregation)
+	})
+}
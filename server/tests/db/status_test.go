@@ -0,0 +1,85 @@
+package db_test
+
+import (
+	"testing"
+	"time"
+
+	"habit-tracker/server/db"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetStatusRecordsPauses(t *testing.T) {
+	now := time.Date(2024, time.May, 10, 12, 0, 0, 0, time.UTC)
+	habit := &db.Habit{Status: db.StatusActive}
+
+	require.NoError(t, habit.SetStatus(db.StatusPaused, "2024-05-20", now))
+	assert.Equal(t, db.StatusPaused, habit.StatusAt(now))
+	assert.Equal(t, []db.Pause{{Start: "2024-05-10T12:00:00Z", End: "2024-05-20"}}, habit.Pauses)
+
+	// The habit resumes by itself on the resume date
+	assert.Equal(t, db.StatusActive, habit.StatusAt(time.Date(2024, time.May, 20, 0, 0, 0, 0, time.UTC)))
+
+	// Resuming early ends the pause now
+	later := now.AddDate(0, 0, 2)
+	require.NoError(t, habit.SetStatus(db.StatusActive, "", later))
+	assert.Equal(t, "2024-05-12T12:00:00Z", habit.Pauses[0].End)
+
+	require.NoError(t, habit.SetStatus(db.StatusArchived, "", later.AddDate(0, 0, 1)))
+	assert.Len(t, habit.Pauses, 2)
+	assert.Empty(t, habit.Pauses[1].End)
+
+	assert.ErrorIs(t, habit.SetStatus("retired", "", later), db.ErrInvalidStatus)
+	assert.ErrorIs(t, habit.SetStatus(db.StatusArchived, "2024-06-01", later), db.ErrInvalidResumeDate)
+	assert.ErrorIs(t, habit.SetStatus(db.StatusPaused, "2024-05-01", later), db.ErrInvalidResumeDate)
+}
+
+func TestPausedHabitsSkipRemindersAndStats(t *testing.T) {
+	now := time.Now()
+	forEachDatabase(t, func(t *testing.T, database db.Database) {
+		require.NoError(t, database.CreateHabit(&db.Habit{
+			ID: "yoga", UserID: testUserID, Name: "Yoga", Frequency: db.FrequencyDaily,
+			StartDate: now.AddDate(0, 0, -5).Format("2006-01-02"),
+		}))
+		require.NoError(t, database.UpdateReminderLastReminder(testUserID, "yoga", now.AddDate(0, 0, -2).Format(time.RFC3339)))
+		for day := 1; day <= 2; day++ {
+			require.NoError(t, database.CreateTrackingEntry(testUserID, &db.TrackingEntry{
+				ID: "yoga-" + string(rune('0'+day)), HabitID: "yoga", Timestamp: now.AddDate(0, 0, -day).Format(time.RFC3339),
+			}))
+		}
+
+		habits, err := database.GetHabitsNeedingReminders()
+		require.NoError(t, err)
+		assert.Len(t, habits, 1)
+
+		resume := now.AddDate(0, 0, 7).Format("2006-01-02")
+		updated, err := database.UpdateHabitPartial(testUserID, "yoga", map[string]interface{}{"status": "paused", "resumeDate": resume})
+		require.NoError(t, err)
+		assert.Equal(t, db.StatusPaused, updated.Status)
+		assert.Equal(t, resume, updated.ResumeDate)
+
+		habits, err = database.GetHabitsNeedingReminders()
+		require.NoError(t, err)
+		assert.Empty(t, habits)
+
+		// The pause history survives a reload
+		stored, err := database.GetHabit(testUserID, "yoga")
+		require.NoError(t, err)
+		require.Len(t, stored.Pauses, 1)
+		assert.Equal(t, resume, stored.Pauses[0].End)
+
+		// Today is paused, so the streak stands
+		stats, err := database.GetHabitStats(testUserID, "yoga")
+		require.NoError(t, err)
+		assert.Equal(t, 2, stats.CurrentStreak)
+
+		_, err = database.UpdateHabitPartial(testUserID, "yoga", map[string]interface{}{"status": "archived", "resumeDate": resume})
+		assert.ErrorIs(t, err, db.ErrInvalidResumeDate)
+
+		updated, err = database.UpdateHabitPartial(testUserID, "yoga", map[string]interface{}{"status": "archived"})
+		require.NoError(t, err)
+		assert.Equal(t, db.StatusArchived, updated.Status)
+		assert.Empty(t, updated.ResumeDate)
+	})
+}
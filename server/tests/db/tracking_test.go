@@ -0,0 +1,30 @@
+package db_test
+
+import (
+	"testing"
+
+	"habit-tracker/server/db"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpdateTrackingEntryPartial(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, database db.Database) {
+		require.NoError(t, database.CreateHabit(&db.Habit{ID: "run", UserID: testUserID, Name: "Run", Frequency: db.FrequencyDaily, StartDate: "2024-01-01"}))
+		require.NoError(t, database.CreateTrackingEntry(testUserID, &db.TrackingEntry{ID: "run-1", HabitID: "run", Timestamp: "2024-05-01T08:00:00Z", Value: 3}))
+
+		updated, err := database.UpdateTrackingEntryPartial(testUserID, "run-1", map[string]interface{}{"value": 5.0, "note": "Windy"})
+		require.NoError(t, err)
+		assert.Equal(t, 5.0, updated.Value)
+		assert.Equal(t, "Windy", updated.Note)
+		assert.Equal(t, "2024-05-01T08:00:00Z", updated.Timestamp)
+
+		_, err = database.UpdateTrackingEntryPartial(testUserID, "run-1", map[string]interface{}{"timestamp": "soon"})
+		assert.ErrorIs(t, err, db.ErrInvalidTimestamp)
+		_, err = database.UpdateTrackingEntryPartial(testUserID, "run-1", map[string]interface{}{"value": -1.0})
+		assert.ErrorIs(t, err, db.ErrInvalidValue)
+		_, err = database.UpdateTrackingEntryPartial(otherUserID, "run-1", map[string]interface{}{"note": "Mine now"})
+		assert.ErrorIs(t, err, db.ErrNotFound)
+	})
+}
@@ -0,0 +1,121 @@
+package db_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"habit-tracker/server/db"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// invalidFields returns the names of the fields err reports
+func invalidFields(t *testing.T, err error) []string {
+	t.Helper()
+	require.ErrorIs(t, err, db.ErrValidation)
+	var invalid *db.ValidationError
+	require.ErrorAs(t, err, &invalid)
+
+	fields := make([]string, len(invalid.Fields))
+	for i, field := range invalid.Fields {
+		fields[i] = field.Field
+	}
+	return fields
+}
+
+func TestValidateHabit(t *testing.T) {
+	valid := db.Habit{Name: "Read", Frequency: db.FrequencyDaily, StartDate: "2024-01-01"}
+	require.NoError(t, db.ValidateHabit(&valid))
+
+	// Start dates may be full timestamps, as the UI sends them
+	withTime := valid
+	withTime.StartDate = "2024-01-01T08:30:00.000Z"
+	require.NoError(t, db.ValidateHabit(&withTime))
+
+	tests := []struct {
+		name   string
+		change func(*db.Habit)
+		fields []string
+	}{
+		{"blank name", func(h *db.Habit) { h.Name = "  " }, []string{"name"}},
+		{"long name", func(h *db.Habit) { h.Name = strings.Repeat("é", 101) }, []string{"name"}},
+		{"long description", func(h *db.Habit) { h.Description = strings.Repeat("a", 1001) }, []string{"description"}},
+		{"missing start date", func(h *db.Habit) { h.StartDate = "" }, []string{"startDate"}},
+		{"bad start date", func(h *db.Habit) { h.StartDate = "01/02/2024" }, []string{"startDate"}},
+		{"negative target", func(h *db.Habit) { h.Target = -1 }, []string{"target"}},
+		{"unknown frequency", func(h *db.Habit) { h.Frequency = "fortnightly" }, []string{"frequency"}},
+		{"unknown aggregation", func(h *db.Habit) { h.Aggregation = "mean" }, []string{"aggregation"}},
+		{"bad schedule", func(h *db.Habit) { h.Schedule = "FREQ=WEEKLY;INTERVAL=367" }, []string{"schedule"}},
+		{"unknown status", func(h *db.Habit) { h.Status = "done" }, []string{"status"}},
+		{"repeated channel", func(h *db.Habit) { h.Channels = []db.Channel{db.ChannelEmail, db.ChannelEmail} }, []string{"channels"}},
+		{"websocket fallback", func(h *db.Habit) { h.FallbackChannel = db.ChannelWebSocket }, []string{"fallbackChannel"}},
+		{"bad reminder time", func(h *db.Habit) { h.ReminderTimes = []string{"25:00"} }, []string{"reminderTimes"}},
+		{"every field reported", func(h *db.Habit) {
+			h.Name, h.StartDate, h.Unit = "", "soon", strings.Repeat("g", 33)
+		}, []string{"name", "startDate", "unit"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			habit := valid
+			tt.change(&habit)
+			assert.Equal(t, tt.fields, invalidFields(t, db.ValidateHabit(&habit)))
+		})
+	}
+}
+
+func TestValidateHabitUpdates(t *testing.T) {
+	// Only the fields being updated are checked
+	require.NoError(t, db.ValidateHabitUpdates(map[string]interface{}{"description": "Before bed"}))
+	require.NoError(t, db.ValidateHabitUpdates(map[string]interface{}{"startDate": "2024-02-01"}))
+
+	require.NoError(t, db.ValidateHabitUpdates(map[string]interface{}{
+		"channels": []interface{}{"email", "webhook"}, "reminderTimes": []interface{}{"21:30"}, "status": "paused",
+	}))
+
+	err := db.ValidateHabitUpdates(map[string]interface{}{"name": "", "startDate": 20240201, "target": "8"})
+	assert.ElementsMatch(t, []string{"name", "startDate", "target"}, invalidFields(t, err))
+
+	err = db.ValidateHabitUpdates(map[string]interface{}{
+		"frequency": 7, "aggregation": "mean", "schedule": "FREQ=SECONDLY", "status": "done",
+		"channels": "email", "fallbackChannel": "websocket", "reminderTimes": []interface{}{"08:00", 9},
+	})
+	assert.ElementsMatch(t, []string{
+		"frequency", "aggregation", "schedule", "status", "channels", "fallbackChannel", "reminderTimes",
+	}, invalidFields(t, err))
+}
+
+func TestValidateTrackingEntry(t *testing.T) {
+	habit := &db.Habit{ID: "read", Name: "Read", Frequency: db.FrequencyDaily, StartDate: "2024-03-10"}
+	utc := db.DefaultCalendar
+
+	require.NoError(t, db.ValidateTrackingEntry(&db.TrackingEntry{Timestamp: "2024-03-10T00:00:00Z"}, habit, utc))
+	require.NoError(t, db.ValidateTrackingEntry(&db.TrackingEntry{Timestamp: time.Now().Format(time.RFC3339)}, habit, utc))
+
+	for _, timestamp := range []string{
+		"last tuesday",
+		time.Now().Add(time.Hour).Format(time.RFC3339),
+		"2024-03-09T23:59:59Z",
+	} {
+		err := db.ValidateTrackingEntry(&db.TrackingEntry{Timestamp: timestamp}, habit, utc)
+		assert.Equal(t, []string{"timestamp"}, invalidFields(t, err), timestamp)
+	}
+
+	// The start date begins at midnight in the owner's time zone
+	auckland, err := time.LoadLocation("Pacific/Auckland")
+	require.NoError(t, err)
+	entry := &db.TrackingEntry{Timestamp: "2024-03-09T12:00:00Z"}
+	require.NoError(t, db.ValidateTrackingEntry(entry, habit, db.Calendar{Location: auckland, WeekStart: time.Monday}))
+
+	err = db.ValidateTrackingEntry(&db.TrackingEntry{Timestamp: "2024-04-01T08:00:00Z", Value: -1, Note: strings.Repeat("n", 1001)}, habit, utc)
+	assert.Equal(t, []string{"note", "value"}, invalidFields(t, err))
+}
+
+func TestValidateTrackingUpdates(t *testing.T) {
+	habit := &db.Habit{ID: "read", Name: "Read", Frequency: db.FrequencyDaily, StartDate: "2024-03-10"}
+
+	require.NoError(t, db.ValidateTrackingUpdates(map[string]interface{}{"note": "Chapter 3"}, habit, db.DefaultCalendar))
+	err := db.ValidateTrackingUpdates(map[string]interface{}{"timestamp": "2024-01-01T08:00:00Z"}, habit, db.DefaultCalendar)
+	assert.Equal(t, []string{"timestamp"}, invalidFields(t, err))
+}
@@ -0,0 +1,46 @@
+package db_test
+
+import (
+	"testing"
+
+	"habit-tracker/server/db"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHabitVersions(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, database db.Database) {
+		habit := &db.Habit{ID: "read", UserID: testUserID, Name: "Read", Frequency: db.FrequencyDaily, StartDate: "2024-01-01"}
+		require.NoError(t, database.CreateHabit(habit))
+		assert.Equal(t, int64(1), habit.Version)
+		assert.NotEmpty(t, habit.UpdatedAt)
+
+		stored, err := database.GetHabit(testUserID, "read")
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), stored.Version)
+		assert.Equal(t, `"1-active"`, stored.ETag())
+
+		// Every update moves the version on, unless it changes nothing
+		updated, err := database.UpdateHabitPartial(testUserID, "read", map[string]interface{}{"name": "Read more"})
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), updated.Version)
+		updated, err = database.UpdateHabitPartial(testUserID, "read", map[string]interface{}{"id": "ignored"})
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), updated.Version)
+
+		// A conditional update only applies to the version it names
+		_, err = database.UpdateHabitPartial(testUserID, "read", map[string]interface{}{"name": "Stale", "version": 1.0})
+		assert.ErrorIs(t, err, db.ErrVersionConflict)
+		updated, err = database.UpdateHabitPartial(testUserID, "read", map[string]interface{}{"name": "Read daily", "version": 2.0})
+		require.NoError(t, err)
+		assert.Equal(t, int64(3), updated.Version)
+		assert.Equal(t, "Read daily", updated.Name)
+
+		updated.Description = "Twenty pages"
+		require.NoError(t, database.UpdateHabit(updated))
+		stored, err = database.GetHabit(testUserID, "read")
+		require.NoError(t, err)
+		assert.Equal(t, int64(4), stored.Version)
+	})
+}
@@ -5,20 +5,50 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
+	"habit-tracker/server/auth"
 	"habit-tracker/server/db"
 	"habit-tracker/server/handlers"
+	"habit-tracker/server/problem"
 
 	"github.com/stretchr/testify/suite"
 )
 
+const testUserID = "integration-user"
+
+// asUser stands in for auth.AuthMiddleware by placing userID in the request context
+func asUser(userID string, handler handlers.HandlerFunc) handlers.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+		ctx := auth.SetUserInContext(r.Context(), &db.User{ID: userID})
+		handler(w, r.WithContext(ctx), params)
+	}
+}
+
+// publishedEvent is an event recorded by recordingPublisher
+type publishedEvent struct {
+	UserID  string
+	Type    string
+	Payload interface{}
+}
+
+type recordingPublisher struct {
+	events []publishedEvent
+}
+
+func (p *recordingPublisher) Publish(userID, eventType string, payload interface{}) error {
+	p.events = append(p.events, publishedEvent{userID, eventType, payload})
+	return nil
+}
+
 type IntegrationTestSuite struct {
 	suite.Suite
 	router *handlers.Router
 	server *httptest.Server
 	origDB db.Database
+	events *recordingPublisher
 }
 
 func (suite *IntegrationTestSuite) SetupSuite() {
@@ -30,13 +60,23 @@ func (suite *IntegrationTestSuite) SetupSuite() {
 
 	// Create router and register handlers
 	suite.router = handlers.CreateRouter()
-	suite.router.Handle("GET", "/habits", handlers.GetHabits)
-	suite.router.Handle("POST", "/habits", handlers.CreateHabit)
-	suite.router.Handle("GET", "/habits/:id", handlers.GetHabit)
-	suite.router.Handle("PATCH", "/habits/:id", handlers.UpdateHabit)
-	suite.router.Handle("DELETE", "/habits/:id", handlers.DeleteHabit)
-	suite.router.Handle("POST", "/habits/:id/tracking", handlers.CreateTracking)
-	suite.router.Handle("GET", "/habits/:id/tracking", handlers.GetTracking)
+	suite.router.Handle("GET", "/habits", asUser(testUserID, handlers.GetHabits))
+	suite.router.Handle("POST", "/habits", asUser(testUserID, handlers.CreateHabit))
+	suite.router.Handle("GET", "/habits/:id", asUser(testUserID, handlers.GetHabit))
+	suite.router.Handle("PATCH", "/habits/:id", asUser(testUserID, handlers.UpdateHabit))
+	suite.router.Handle("DELETE", "/habits/:id", asUser(testUserID, handlers.DeleteHabit))
+	suite.router.Handle("POST", "/habits/:id/tracking", asUser(testUserID, handlers.CreateTracking))
+	suite.router.Handle("GET", "/habits/:id/tracking", asUser(testUserID, handlers.GetTracking))
+	suite.router.Handle("GET", "/habits/:id/tracking/:entryId", asUser(testUserID, handlers.GetTrackingEntry))
+	suite.router.Handle("PATCH", "/habits/:id/tracking/:entryId", asUser(testUserID, handlers.UpdateTrackingEntry))
+	suite.router.Handle("DELETE", "/habits/:id/tracking/:entryId", asUser(testUserID, handlers.DeleteTrackingEntry))
+	suite.router.Handle("PATCH", "/reminders/:id", asUser(testUserID, handlers.UpdateReminder))
+	suite.router.Handle("POST", "/habits/:id/reminder/snooze", asUser(testUserID, handlers.SnoozeReminder))
+	suite.router.Handle("POST", "/habits/:id/reminder/dismiss", asUser(testUserID, handlers.DismissReminder))
+	suite.router.Handle("GET", "/habits/:id/reminder/history", asUser(testUserID, handlers.GetReminderHistory))
+	suite.router.Handle("GET", "/notifications", asUser(testUserID, handlers.GetNotifications))
+	suite.router.Handle("POST", "/notifications/read-all", asUser(testUserID, handlers.MarkAllNotificationsRead))
+	suite.router.Handle("PATCH", "/notifications/:id", asUser(testUserID, handlers.UpdateNotification))
 
 	// Create test server
 	suite.server = httptest.NewServer(suite.router)
@@ -46,11 +86,14 @@ func (suite *IntegrationTestSuite) TearDownSuite() {
 	suite.server.Close()
 	// Restore original database
 	handlers.Database = suite.origDB
+	handlers.Events = nil
 }
 
 func (suite *IntegrationTestSuite) SetupTest() {
 	// Reset database state before each test
 	handlers.Database = db.NewMapDatabase()
+	suite.events = &recordingPublisher{}
+	handlers.Events = suite.events
 }
 
 func (suite *IntegrationTestSuite) TestGetHabitsEmpty() {
@@ -103,6 +146,17 @@ func (suite *IntegrationTestSuite) TestCreateHabitInvalidJSON() {
 	defer resp.Body.Close()
 
 	suite.Equal(http.StatusBadRequest, resp.StatusCode)
+	suite.Equal(problem.CodeInvalidJSON, suite.decodeProblem(resp).Code)
+}
+
+// decodeProblem reads a problem+json error response
+func (suite *IntegrationTestSuite) decodeProblem(resp *http.Response) problem.Problem {
+	suite.Equal(problem.ContentType, resp.Header.Get("Content-Type"))
+
+	var response problem.Problem
+	suite.NoError(json.NewDecoder(resp.Body).Decode(&response))
+	suite.Equal(resp.StatusCode, response.Status)
+	return response
 }
 
 func (suite *IntegrationTestSuite) TestCreateHabitInvalidFrequency() {
@@ -121,12 +175,19 @@ func (suite *IntegrationTestSuite) TestCreateHabitInvalidFrequency() {
 	defer resp.Body.Close()
 
 	suite.Equal(http.StatusBadRequest, resp.StatusCode)
+	response := suite.decodeProblem(resp)
+	suite.Equal(problem.CodeValidation, response.Code)
+	suite.Equal("/habits", response.Instance)
+	if suite.Len(response.Errors, 1) {
+		suite.Equal("frequency", response.Errors[0].Field)
+	}
 }
 
 func (suite *IntegrationTestSuite) TestGetHabitById() {
 	// First create a habit
 	habit := &db.Habit{
 		ID:          "test-habit-1",
+		UserID:      testUserID,
 		Name:        "Reading",
 		Description: "Read for 30 minutes",
 		Frequency:   db.FrequencyDaily,
@@ -155,12 +216,16 @@ func (suite *IntegrationTestSuite) TestGetHabitNotFound() {
 	defer resp.Body.Close()
 
 	suite.Equal(http.StatusNotFound, resp.StatusCode)
+	response := suite.decodeProblem(resp)
+	suite.Equal(problem.CodeNotFound, response.Code)
+	suite.Equal("Habit not found", response.Detail)
 }
 
 func (suite *IntegrationTestSuite) TestUpdateHabit() {
 	// First create a habit
 	habit := &db.Habit{
 		ID:          "test-habit-2",
+		UserID:      testUserID,
 		Name:        "Meditation",
 		Description: "Daily meditation",
 		Frequency:   db.FrequencyDaily,
@@ -225,6 +290,7 @@ func (suite *IntegrationTestSuite) TestUpdateHabitInvalidFrequency() {
 	// First create a habit
 	habit := &db.Habit{
 		ID:          "test-habit-invalid-freq",
+		UserID:      testUserID,
 		Name:        "Test Habit",
 		Description: "Test description",
 		Frequency:   db.FrequencyDaily,
@@ -260,6 +326,7 @@ func (suite *IntegrationTestSuite) TestUpdateHabitPartial() {
 	// First create a habit
 	originalHabit := &db.Habit{
 		ID:          "test-habit-partial",
+		UserID:      testUserID,
 		Name:        "Original Name",
 		Description: "Original Description",
 		Frequency:   db.FrequencyDaily,
@@ -358,6 +425,7 @@ func (suite *IntegrationTestSuite) TestDeleteHabit() {
 	// First create a habit
 	habit := &db.Habit{
 		ID:          "test-habit-3",
+		UserID:      testUserID,
 		Name:        "Journaling",
 		Description: "Daily journaling",
 		Frequency:   db.FrequencyDaily,
@@ -378,7 +446,7 @@ func (suite *IntegrationTestSuite) TestDeleteHabit() {
 	suite.Equal(http.StatusNoContent, resp.StatusCode)
 
 	// Verify it's deleted
-	_, err = handlers.Database.GetHabit("test-habit-3")
+	_, err = handlers.Database.GetHabit(testUserID, "test-habit-3")
 	suite.Equal(db.ErrNotFound, err)
 }
 
@@ -398,6 +466,7 @@ func (suite *IntegrationTestSuite) TestCreateTracking() {
 	// First create a habit
 	habit := &db.Habit{
 		ID:          "test-habit-4",
+		UserID:      testUserID,
 		Name:        "Running",
 		Description: "Daily run",
 		Frequency:   db.FrequencyDaily,
@@ -434,6 +503,7 @@ func (suite *IntegrationTestSuite) TestCreateTrackingWithCustomTimestamp() {
 	// First create a habit
 	habit := &db.Habit{
 		ID:          "test-habit-5",
+		UserID:      testUserID,
 		Name:        "Water",
 		Description: "Drink water",
 		Frequency:   db.FrequencyHourly,
@@ -468,6 +538,7 @@ func (suite *IntegrationTestSuite) TestGetTracking() {
 	// First create a habit
 	habit := &db.Habit{
 		ID:          "test-habit-6",
+		UserID:      testUserID,
 		Name:        "Stretching",
 		Description: "Daily stretching",
 		Frequency:   db.FrequencyDaily,
@@ -493,7 +564,7 @@ func (suite *IntegrationTestSuite) TestGetTracking() {
 	}
 
 	for _, entry := range entries {
-		err := handlers.Database.CreateTrackingEntry(entry)
+		err := handlers.Database.CreateTrackingEntry(testUserID, entry)
 		suite.NoError(err)
 	}
 
@@ -514,6 +585,7 @@ func (suite *IntegrationTestSuite) TestGetTrackingEmpty() {
 	// First create a habit
 	habit := &db.Habit{
 		ID:          "test-habit-7",
+		UserID:      testUserID,
 		Name:        "Empty Habit",
 		Description: "No tracking entries",
 		Frequency:   db.FrequencyDaily,
@@ -669,7 +741,7 @@ func (suite *IntegrationTestSuite) TestParameterValidation() {
 			name:           "GET tracking with valid habit ID format",
 			method:         "GET",
 			url:            "/habits/valid-id/tracking",
-			expectedStatus: http.StatusOK, // Should return empty array for non-existent habit
+			expectedStatus: http.StatusNotFound, // Habit doesn't exist, but parameter is valid
 		},
 		{
 			name:           "GET invalid route",
@@ -701,7 +773,708 @@ func (suite *IntegrationTestSuite) TestParameterValidation() {
 	}
 }
 
+func (suite *IntegrationTestSuite) TestOtherUsersHabitsAreHidden() {
+	habit := &db.Habit{
+		ID:          "foreign-habit",
+		UserID:      "someone-else",
+		Name:        "Private",
+		Description: "Belongs to another user",
+		Frequency:   db.FrequencyDaily,
+		StartDate:   "2024-01-01",
+	}
+	err := handlers.Database.CreateHabit(habit)
+	suite.NoError(err)
+
+	// The habit is not listed for the current user
+	resp, err := http.Get(suite.server.URL + "/habits")
+	suite.NoError(err)
+	defer resp.Body.Close()
+
+	var habits []db.Habit
+	err = json.NewDecoder(resp.Body).Decode(&habits)
+	suite.NoError(err)
+	suite.Len(habits, 0)
+
+	// Direct access to the habit and its tracking entries is a 404
+	for _, url := range []string{"/habits/foreign-habit", "/habits/foreign-habit/tracking"} {
+		resp, err := http.Get(suite.server.URL + url)
+		suite.NoError(err)
+		resp.Body.Close()
+		suite.Equal(http.StatusNotFound, resp.StatusCode, url)
+	}
+
+	jsonData, err := json.Marshal(db.TrackingEntry{Note: "Not mine"})
+	suite.NoError(err)
+
+	resp, err = http.Post(suite.server.URL+"/habits/foreign-habit/tracking", "application/json", bytes.NewBuffer(jsonData))
+	suite.NoError(err)
+	resp.Body.Close()
+	suite.Equal(http.StatusNotFound, resp.StatusCode)
+
+	req, err := http.NewRequest("DELETE", suite.server.URL+"/habits/foreign-habit", nil)
+	suite.NoError(err)
+	resp, err = http.DefaultClient.Do(req)
+	suite.NoError(err)
+	resp.Body.Close()
+	suite.Equal(http.StatusNotFound, resp.StatusCode)
+
+	// The owner's habit is untouched
+	_, err = handlers.Database.GetHabit("someone-else", "foreign-habit")
+	suite.NoError(err)
+}
+
+func (suite *IntegrationTestSuite) TestCreatedHabitIsOwnedByCaller() {
+	jsonData, err := json.Marshal(map[string]interface{}{
+		"name":      "Owned",
+		"frequency": "daily",
+		"startDate": "2024-01-01",
+		"userId":    "someone-else",
+	})
+	suite.NoError(err)
+
+	resp, err := http.Post(suite.server.URL+"/habits", "application/json", bytes.NewBuffer(jsonData))
+	suite.NoError(err)
+	defer resp.Body.Close()
+	suite.Equal(http.StatusCreated, resp.StatusCode)
+
+	var created db.Habit
+	err = json.NewDecoder(resp.Body).Decode(&created)
+	suite.NoError(err)
+	suite.Equal(testUserID, created.UserID)
+}
+
+func (suite *IntegrationTestSuite) TestHabitRoutesRequireUser() {
+	req := httptest.NewRequest("GET", "/habits", nil)
+	w := httptest.NewRecorder()
+
+	handlers.GetHabits(w, req, map[string]string{})
+
+	suite.Equal(http.StatusUnauthorized, w.Code)
+}
+
 // Run the test suite
+func (suite *IntegrationTestSuite) TestCreateQuantitativeHabit() {
+	jsonData, err := json.Marshal(map[string]interface{}{
+		"name":        "Water",
+		"frequency":   "daily",
+		"startDate":   "2024-01-01",
+		"target":      8,
+		"unit":        "glasses",
+		"aggregation": "sum",
+	})
+	suite.NoError(err)
+
+	resp, err := http.Post(suite.server.URL+"/habits", "application/json", bytes.NewBuffer(jsonData))
+	suite.NoError(err)
+	defer resp.Body.Close()
+	suite.Equal(http.StatusCreated, resp.StatusCode)
+
+	var created db.Habit
+	suite.NoError(json.NewDecoder(resp.Body).Decode(&created))
+	suite.Equal(8.0, created.Target)
+	suite.Equal("glasses", created.Unit)
+	suite.Equal(db.AggregationSum, created.Aggregation)
+
+	entryData, err := json.Marshal(map[string]interface{}{"value": 3})
+	suite.NoError(err)
+
+	resp, err = http.Post(suite.server.URL+"/habits/"+created.ID+"/tracking", "application/json", bytes.NewBuffer(entryData))
+	suite.NoError(err)
+	defer resp.Body.Close()
+	suite.Equal(http.StatusCreated, resp.StatusCode)
+
+	var entry db.TrackingEntry
+	suite.NoError(json.NewDecoder(resp.Body).Decode(&entry))
+	suite.Equal(3.0, entry.Value)
+}
+
+func (suite *IntegrationTestSuite) TestCreateHabitInvalidGoal() {
+	for _, habitData := range []map[string]interface{}{
+		{"name": "Water", "frequency": "daily", "target": 8, "aggregation": "average"},
+		{"name": "Water", "frequency": "daily", "target": -1},
+	} {
+		jsonData, err := json.Marshal(habitData)
+		suite.NoError(err)
+
+		resp, err := http.Post(suite.server.URL+"/habits", "application/json", bytes.NewBuffer(jsonData))
+		suite.NoError(err)
+		resp.Body.Close()
+		suite.Equal(http.StatusBadRequest, resp.StatusCode)
+	}
+}
+
+func (suite *IntegrationTestSuite) TestCreateTrackingNegativeValue() {
+	habit := &db.Habit{ID: "water", UserID: testUserID, Name: "Water", Frequency: db.FrequencyDaily, StartDate: "2024-01-01", Target: 8}
+	suite.NoError(handlers.Database.CreateHabit(habit))
+
+	entryData, err := json.Marshal(map[string]interface{}{"value": -2})
+	suite.NoError(err)
+
+	resp, err := http.Post(suite.server.URL+"/habits/water/tracking", "application/json", bytes.NewBuffer(entryData))
+	suite.NoError(err)
+	defer resp.Body.Close()
+	suite.Equal(http.StatusBadRequest, resp.StatusCode)
+}
+
+func (suite *IntegrationTestSuite) TestCreateScheduledHabit() {
+	jsonData, err := json.Marshal(map[string]interface{}{
+		"name":      "Gym",
+		"startDate": "2024-01-01",
+		"schedule":  "FREQ=WEEKLY;BYDAY=MO,WE,FR",
+	})
+	suite.NoError(err)
+
+	resp, err := http.Post(suite.server.URL+"/habits", "application/json", bytes.NewBuffer(jsonData))
+	suite.NoError(err)
+	defer resp.Body.Close()
+	suite.Equal(http.StatusCreated, resp.StatusCode)
+
+	var created db.Habit
+	suite.NoError(json.NewDecoder(resp.Body).Decode(&created))
+	suite.Equal("FREQ=WEEKLY;BYDAY=MO,WE,FR", created.Schedule)
+	suite.Equal(db.FrequencyWeekly, created.Frequency)
+
+	for _, schedule := range []interface{}{"FREQ=YEARLY", "FREQ=WEEKLY;BYDAY=XX", 3} {
+		updateData, err := json.Marshal(map[string]interface{}{"schedule": schedule})
+		suite.NoError(err)
+
+		req, err := http.NewRequest(http.MethodPatch, suite.server.URL+"/habits/"+created.ID, bytes.NewBuffer(updateData))
+		suite.NoError(err)
+		resp, err := http.DefaultClient.Do(req)
+		suite.NoError(err)
+		resp.Body.Close()
+		suite.Equal(http.StatusBadRequest, resp.StatusCode)
+	}
+}
+
+func (suite *IntegrationTestSuite) TestEditAndDeleteTrackingEntry() {
+	habit := &db.Habit{ID: "read", UserID: testUserID, Name: "Read", Frequency: db.FrequencyDaily, StartDate: "2024-01-01"}
+	suite.NoError(handlers.Database.CreateHabit(habit))
+	for _, entry := range []*db.TrackingEntry{
+		{ID: "first", HabitID: "read", Timestamp: "2024-05-01T08:00:00Z", Note: "Chapter 1"},
+		{ID: "second", HabitID: "read", Timestamp: "2024-05-02T08:00:00Z", Note: "Chapter 2"},
+	} {
+		suite.NoError(handlers.Database.CreateTrackingEntry(testUserID, entry))
+	}
+
+	resp, err := http.Get(suite.server.URL + "/habits/read/tracking/first")
+	suite.NoError(err)
+	defer resp.Body.Close()
+	suite.Equal(http.StatusOK, resp.StatusCode)
+
+	var entry db.TrackingEntry
+	suite.NoError(json.NewDecoder(resp.Body).Decode(&entry))
+	suite.Equal("Chapter 1", entry.Note)
+
+	// Moving the first entry after the second makes it the latest check-in
+	updateData, err := json.Marshal(map[string]interface{}{"timestamp": "2024-05-03T08:00:00Z", "note": "Chapter 3"})
+	suite.NoError(err)
+	req, err := http.NewRequest(http.MethodPatch, suite.server.URL+"/habits/read/tracking/first", bytes.NewBuffer(updateData))
+	suite.NoError(err)
+	resp, err = http.DefaultClient.Do(req)
+	suite.NoError(err)
+	defer resp.Body.Close()
+	suite.Equal(http.StatusOK, resp.StatusCode)
+
+	suite.NoError(json.NewDecoder(resp.Body).Decode(&entry))
+	suite.Equal("Chapter 3", entry.Note)
+	suite.Equal("2024-05-03T08:00:00Z", entry.Timestamp)
+
+	reminder, err := handlers.Database.GetReminder(testUserID, "read")
+	suite.NoError(err)
+	suite.Equal("2024-05-03T08:00:00Z", reminder.LastReminder)
+
+	req, err = http.NewRequest(http.MethodDelete, suite.server.URL+"/habits/read/tracking/first", nil)
+	suite.NoError(err)
+	resp, err = http.DefaultClient.Do(req)
+	suite.NoError(err)
+	resp.Body.Close()
+	suite.Equal(http.StatusNoContent, resp.StatusCode)
+
+	reminder, err = handlers.Database.GetReminder(testUserID, "read")
+	suite.NoError(err)
+	suite.Equal("2024-05-02T08:00:00Z", reminder.LastReminder)
+
+	resp, err = http.Get(suite.server.URL + "/habits/read/tracking/first")
+	suite.NoError(err)
+	resp.Body.Close()
+	suite.Equal(http.StatusNotFound, resp.StatusCode)
+}
+
+func (suite *IntegrationTestSuite) TestUpdateTrackingEntryValidation() {
+	habit := &db.Habit{ID: "read", UserID: testUserID, Name: "Read", Frequency: db.FrequencyDaily, StartDate: "2024-01-01"}
+	suite.NoError(handlers.Database.CreateHabit(habit))
+	suite.NoError(handlers.Database.CreateTrackingEntry(testUserID, &db.TrackingEntry{ID: "entry", HabitID: "read", Timestamp: "2024-05-01T08:00:00Z"}))
+
+	for _, updates := range []map[string]interface{}{
+		{"timestamp": "yesterday"},
+		{"value": -1},
+		{"note": 42},
+	} {
+		updateData, err := json.Marshal(updates)
+		suite.NoError(err)
+		req, err := http.NewRequest(http.MethodPatch, suite.server.URL+"/habits/read/tracking/entry", bytes.NewBuffer(updateData))
+		suite.NoError(err)
+		resp, err := http.DefaultClient.Do(req)
+		suite.NoError(err)
+		resp.Body.Close()
+		suite.Equal(http.StatusBadRequest, resp.StatusCode)
+	}
+}
+
+func (suite *IntegrationTestSuite) TestTrackingEntriesOfOtherHabitsAreHidden() {
+	for _, habit := range []*db.Habit{
+		{ID: "mine", UserID: testUserID, Name: "Mine", Frequency: db.FrequencyDaily, StartDate: "2024-01-01"},
+		{ID: "also-mine", UserID: testUserID, Name: "Also mine", Frequency: db.FrequencyDaily, StartDate: "2024-01-01"},
+		{ID: "foreign", UserID: "someone-else", Name: "Private", Frequency: db.FrequencyDaily, StartDate: "2024-01-01"},
+	} {
+		suite.NoError(handlers.Database.CreateHabit(habit))
+	}
+	suite.NoError(handlers.Database.CreateTrackingEntry(testUserID, &db.TrackingEntry{ID: "my-entry", HabitID: "mine", Timestamp: "2024-05-01T08:00:00Z"}))
+	suite.NoError(handlers.Database.CreateTrackingEntry("someone-else", &db.TrackingEntry{ID: "foreign-entry", HabitID: "foreign", Timestamp: "2024-05-01T08:00:00Z"}))
+
+	// An entry is only reachable through its own habit and owner
+	for _, url := range []string{"/habits/also-mine/tracking/my-entry", "/habits/foreign/tracking/foreign-entry"} {
+		resp, err := http.Get(suite.server.URL + url)
+		suite.NoError(err)
+		resp.Body.Close()
+		suite.Equal(http.StatusNotFound, resp.StatusCode, url)
+
+		req, err := http.NewRequest(http.MethodDelete, suite.server.URL+url, nil)
+		suite.NoError(err)
+		resp, err = http.DefaultClient.Do(req)
+		suite.NoError(err)
+		resp.Body.Close()
+		suite.Equal(http.StatusNotFound, resp.StatusCode, url)
+	}
+
+	_, err := handlers.Database.GetTrackingEntry("someone-else", "foreign-entry")
+	suite.NoError(err)
+}
+
+func (suite *IntegrationTestSuite) TestFilterHabitsByStatus() {
+	for _, habit := range []*db.Habit{
+		{ID: "running", UserID: testUserID, Name: "Running", Frequency: db.FrequencyDaily, StartDate: "2024-01-01"},
+		{ID: "piano", UserID: testUserID, Name: "Piano", Frequency: db.FrequencyDaily, StartDate: "2024-01-01"},
+	} {
+		suite.NoError(handlers.Database.CreateHabit(habit))
+	}
+
+	updateData, err := json.Marshal(map[string]interface{}{"status": "paused"})
+	suite.NoError(err)
+	req, err := http.NewRequest(http.MethodPatch, suite.server.URL+"/habits/piano", bytes.NewBuffer(updateData))
+	suite.NoError(err)
+	resp, err := http.DefaultClient.Do(req)
+	suite.NoError(err)
+	defer resp.Body.Close()
+	suite.Equal(http.StatusOK, resp.StatusCode)
+
+	var paused db.Habit
+	suite.NoError(json.NewDecoder(resp.Body).Decode(&paused))
+	suite.Equal(db.StatusPaused, paused.Status)
+	suite.Len(paused.Pauses, 1)
+
+	for status, expected := range map[string][]string{"active": {"running"}, "paused": {"piano"}, "archived": {}} {
+		resp, err := http.Get(suite.server.URL + "/habits?status=" + status)
+		suite.NoError(err)
+		var habits []db.Habit
+		suite.NoError(json.NewDecoder(resp.Body).Decode(&habits))
+		resp.Body.Close()
+
+		ids := []string{}
+		for _, habit := range habits {
+			ids = append(ids, habit.ID)
+		}
+		suite.Equal(expected, ids, status)
+	}
+
+	resp, err = http.Get(suite.server.URL + "/habits?status=sleeping")
+	suite.NoError(err)
+	resp.Body.Close()
+	suite.Equal(http.StatusBadRequest, resp.StatusCode)
+}
+
+func (suite *IntegrationTestSuite) TestInvalidResumeDate() {
+	jsonData, err := json.Marshal(map[string]interface{}{
+		"name": "Swim", "frequency": "weekly", "startDate": "2024-01-01", "status": "paused", "resumeDate": "2020-01-01",
+	})
+	suite.NoError(err)
+
+	resp, err := http.Post(suite.server.URL+"/habits", "application/json", bytes.NewBuffer(jsonData))
+	suite.NoError(err)
+	resp.Body.Close()
+	suite.Equal(http.StatusBadRequest, resp.StatusCode)
+
+	suite.NoError(handlers.Database.CreateHabit(&db.Habit{ID: "swim", UserID: testUserID, Name: "Swim", Frequency: db.FrequencyWeekly, StartDate: "2024-01-01"}))
+	updateData, err := json.Marshal(map[string]interface{}{"status": "archived", "resumeDate": "2999-01-01"})
+	suite.NoError(err)
+	req, err := http.NewRequest(http.MethodPatch, suite.server.URL+"/habits/swim", bytes.NewBuffer(updateData))
+	suite.NoError(err)
+	resp, err = http.DefaultClient.Do(req)
+	suite.NoError(err)
+	defer resp.Body.Close()
+	suite.Equal(http.StatusBadRequest, resp.StatusCode)
+	response := suite.decodeProblem(resp)
+	if suite.Len(response.Errors, 1) {
+		suite.Equal("resumeDate", response.Errors[0].Field)
+	}
+}
+
+func (suite *IntegrationTestSuite) TestHabitReminderChannels() {
+	jsonData, err := json.Marshal(map[string]interface{}{
+		"name": "Journal", "frequency": "daily", "startDate": "2024-01-01",
+		"channels": []string{"websocket", "log"}, "fallbackChannel": "email",
+	})
+	suite.NoError(err)
+
+	resp, err := http.Post(suite.server.URL+"/habits", "application/json", bytes.NewBuffer(jsonData))
+	suite.NoError(err)
+	var habit db.Habit
+	suite.NoError(json.NewDecoder(resp.Body).Decode(&habit))
+	resp.Body.Close()
+	suite.Equal(http.StatusCreated, resp.StatusCode)
+	suite.Equal([]db.Channel{db.ChannelWebSocket, db.ChannelLog}, habit.Channels)
+
+	for _, update := range []map[string]interface{}{
+		{"channels": []string{"pager"}},
+		{"channels": "email"},
+		{"fallbackChannel": "websocket"},
+	} {
+		updateData, err := json.Marshal(update)
+		suite.NoError(err)
+		req, err := http.NewRequest(http.MethodPatch, suite.server.URL+"/habits/"+habit.ID, bytes.NewBuffer(updateData))
+		suite.NoError(err)
+		resp, err = http.DefaultClient.Do(req)
+		suite.NoError(err)
+		resp.Body.Close()
+		suite.Equal(http.StatusBadRequest, resp.StatusCode, "update %v", update)
+	}
+}
+
+func (suite *IntegrationTestSuite) getNotifications(query string) []db.Notification {
+	resp, err := http.Get(suite.server.URL + "/notifications" + query)
+	suite.Require().NoError(err)
+	defer resp.Body.Close()
+	suite.Require().Equal(http.StatusOK, resp.StatusCode)
+
+	var notifications []db.Notification
+	suite.Require().NoError(json.NewDecoder(resp.Body).Decode(&notifications))
+	return notifications
+}
+
+func (suite *IntegrationTestSuite) patchNotification(id, body string) int {
+	req, err := http.NewRequest(http.MethodPatch, suite.server.URL+"/notifications/"+id, bytes.NewBufferString(body))
+	suite.Require().NoError(err)
+	resp, err := http.DefaultClient.Do(req)
+	suite.Require().NoError(err)
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func (suite *IntegrationTestSuite) TestUpdateReminder() {
+	for _, id := range []string{"read", "walk"} {
+		suite.NoError(handlers.Database.CreateHabit(&db.Habit{
+			ID: id, UserID: testUserID, Name: id, Frequency: db.FrequencyDaily, StartDate: "2024-01-01",
+		}))
+	}
+	patch := func(id, body string) *http.Response {
+		req, err := http.NewRequest(http.MethodPatch, suite.server.URL+"/reminders/"+id, bytes.NewBufferString(body))
+		suite.Require().NoError(err)
+		resp, err := http.DefaultClient.Do(req)
+		suite.Require().NoError(err)
+		return resp
+	}
+
+	// The reminder is the one named in the path, whatever the body says
+	resp := patch("read-reminder", `{"habitId": "walk", "lastReminder": "2024-05-01"}`)
+	suite.Equal(http.StatusOK, resp.StatusCode)
+	var updated db.Reminder
+	suite.NoError(json.NewDecoder(resp.Body).Decode(&updated))
+	resp.Body.Close()
+	suite.Equal("read", updated.HabitID)
+	suite.Equal("2024-05-01T00:00:00Z", updated.LastReminder)
+	suite.Equal("2024-05-02T00:00:00Z", updated.NextReminder)
+	walk, err := handlers.Database.GetReminder(testUserID, "walk")
+	suite.NoError(err)
+	suite.NotEqual("2024-05-01T00:00:00Z", walk.LastReminder)
+
+	for _, body := range []string{`{"lastReminder": "last week"}`, `{}`} {
+		resp = patch("read-reminder", body)
+		suite.Equal(http.StatusBadRequest, resp.StatusCode, body)
+		response := suite.decodeProblem(resp)
+		resp.Body.Close()
+		if suite.Len(response.Errors, 1) {
+			suite.Equal("lastReminder", response.Errors[0].Field)
+		}
+	}
+
+	resp = patch("missing-reminder", `{"lastReminder": "2024-05-01"}`)
+	suite.Equal(http.StatusNotFound, resp.StatusCode)
+	resp.Body.Close()
+}
+
+func (suite *IntegrationTestSuite) TestNotificationInbox() {
+	now := time.Now()
+	for i, id := range []string{"first", "second", "third"} {
+		suite.NoError(handlers.Database.CreateNotification(&db.Notification{
+			ID: id, UserID: testUserID, Type: "reminder", Subject: "Reminder", CreatedAt: now.Add(time.Duration(i) * time.Second),
+		}))
+	}
+	suite.NoError(handlers.Database.CreateNotification(&db.Notification{
+		ID: "someone-else", UserID: "other-user", Type: "reminder", CreatedAt: now,
+	}))
+
+	notifications := suite.getNotifications("")
+	suite.Require().Len(notifications, 3)
+	suite.Equal("third", notifications[0].ID)
+
+	suite.Equal(http.StatusOK, suite.patchNotification("first", `{"read": true}`))
+	suite.Equal(http.StatusOK, suite.patchNotification("second", `{"dismissed": true}`))
+	suite.Equal(http.StatusBadRequest, suite.patchNotification("third", `{"read": "yes"}`))
+	suite.Equal(http.StatusNotFound, suite.patchNotification("someone-else", `{"read": true}`))
+
+	// Dismissed notifications leave the inbox
+	suite.Len(suite.getNotifications(""), 2)
+	unread := suite.getNotifications("?unread=true")
+	suite.Require().Len(unread, 1)
+	suite.Equal("third", unread[0].ID)
+
+	resp, err := http.Post(suite.server.URL+"/notifications/read-all", "application/json", nil)
+	suite.Require().NoError(err)
+	var result map[string]int
+	suite.NoError(json.NewDecoder(resp.Body).Decode(&result))
+	resp.Body.Close()
+	suite.Equal(1, result["marked"])
+	suite.Empty(suite.getNotifications("?unread=true"))
+}
+
+func (suite *IntegrationTestSuite) eventTypes() []string {
+	var types []string
+	for _, event := range suite.events.events {
+		suite.Equal(testUserID, event.UserID)
+		types = append(types, event.Type)
+	}
+	return types
+}
+
+func (suite *IntegrationTestSuite) TestMutationsPublishEvents() {
+	resp, err := http.Post(suite.server.URL+"/habits", "application/json",
+		bytes.NewBufferString(`{"name": "Read", "frequency": "daily", "startDate": "2024-01-01"}`))
+	suite.Require().NoError(err)
+	var habit db.Habit
+	suite.NoError(json.NewDecoder(resp.Body).Decode(&habit))
+	resp.Body.Close()
+
+	req, err := http.NewRequest(http.MethodPatch, suite.server.URL+"/habits/"+habit.ID, bytes.NewBufferString(`{"name": "Read more"}`))
+	suite.Require().NoError(err)
+	resp, err = http.DefaultClient.Do(req)
+	suite.Require().NoError(err)
+	resp.Body.Close()
+
+	resp, err = http.Post(suite.server.URL+"/habits/"+habit.ID+"/tracking", "application/json", bytes.NewBufferString(`{"note": "chapter 1"}`))
+	suite.Require().NoError(err)
+	resp.Body.Close()
+
+	// Rejected changes publish nothing
+	resp, err = http.Post(suite.server.URL+"/habits/"+habit.ID+"/tracking", "application/json", bytes.NewBufferString(`{"value": -1}`))
+	suite.Require().NoError(err)
+	resp.Body.Close()
+	suite.Equal(http.StatusBadRequest, resp.StatusCode)
+
+	req, err = http.NewRequest(http.MethodDelete, suite.server.URL+"/habits/"+habit.ID, nil)
+	suite.Require().NoError(err)
+	resp, err = http.DefaultClient.Do(req)
+	suite.Require().NoError(err)
+	resp.Body.Close()
+
+	suite.Equal([]string{
+		handlers.EventHabitCreated, handlers.EventHabitUpdated, handlers.EventTrackingCreated, handlers.EventHabitDeleted,
+	}, suite.eventTypes())
+
+	events := suite.events.events
+	suite.Equal("Read", events[0].Payload.(db.Habit).Name)
+	suite.Equal("Read more", events[1].Payload.(*db.Habit).Name)
+	suite.Equal("chapter 1", events[2].Payload.(db.TrackingEntry).Note)
+	suite.Equal(handlers.DeletedPayload{ID: habit.ID}, events[3].Payload)
+}
+
+func (suite *IntegrationTestSuite) TestSnoozeAndDismissReminder() {
+	suite.Require().NoError(handlers.Database.CreateHabit(&db.Habit{
+		ID: "read", UserID: testUserID, Name: "Read", Frequency: db.FrequencyDaily, StartDate: "2024-01-01",
+	}))
+	suite.Require().NoError(handlers.Database.CreateNotification(&db.Notification{
+		ID: "inbox-1", UserID: testUserID, HabitID: "read", Type: "reminder", CreatedAt: time.Now(),
+	}))
+
+	post := func(path, body string) *http.Response {
+		resp, err := http.Post(suite.server.URL+path, "application/json", bytes.NewBufferString(body))
+		suite.Require().NoError(err)
+		return resp
+	}
+
+	resp := post("/habits/read/reminder/snooze", `{"minutes": 30, "notificationId": "inbox-1"}`)
+	var action db.ReminderAction
+	suite.NoError(json.NewDecoder(resp.Body).Decode(&action))
+	resp.Body.Close()
+	suite.Equal(http.StatusOK, resp.StatusCode)
+	suite.Equal(db.ReminderSnoozed, action.Action)
+	suite.WithinDuration(time.Now().Add(30*time.Minute), action.Until, 5*time.Second)
+	suite.Empty(suite.getNotifications(""), "the snoozed inbox entry is dismissed")
+
+	for _, tc := range []struct {
+		path, body string
+		status     int
+	}{
+		{"/habits/read/reminder/snooze", `{}`, http.StatusBadRequest},
+		{"/habits/read/reminder/snooze", `{"until": "yesterday"}`, http.StatusBadRequest},
+		{"/habits/read/reminder/dismiss", `not json`, http.StatusBadRequest},
+		{"/habits/missing/reminder/snooze", `{"minutes": 5}`, http.StatusNotFound},
+	} {
+		resp := post(tc.path, tc.body)
+		resp.Body.Close()
+		suite.Equal(tc.status, resp.StatusCode, "%s %s", tc.path, tc.body)
+	}
+
+	resp = post("/habits/read/reminder/dismiss", "")
+	resp.Body.Close()
+	suite.Equal(http.StatusOK, resp.StatusCode)
+
+	resp, err := http.Get(suite.server.URL + "/habits/read/reminder/history")
+	suite.Require().NoError(err)
+	var history []db.ReminderAction
+	suite.NoError(json.NewDecoder(resp.Body).Decode(&history))
+	resp.Body.Close()
+	suite.Require().Len(history, 2)
+	suite.Equal(db.ReminderDismissed, history[0].Action)
+	suite.Equal("inbox-1", history[1].NotificationID)
+
+	suite.Equal([]string{handlers.EventReminderSnoozed, handlers.EventReminderDismissed}, suite.eventTypes())
+}
+
+func (suite *IntegrationTestSuite) TestCreateHabitReportsEveryInvalidField() {
+	habitData, err := json.Marshal(map[string]interface{}{
+		"name": "", "frequency": "daily", "startDate": "next week", "description": strings.Repeat("a", 1001),
+		"channels": []string{"email", "email"}, "fallbackChannel": "websocket", "reminderTimes": []string{"7am"},
+	})
+	suite.NoError(err)
+
+	resp, err := http.Post(suite.server.URL+"/habits", "application/json", bytes.NewBuffer(habitData))
+	suite.NoError(err)
+	defer resp.Body.Close()
+	suite.Equal(http.StatusBadRequest, resp.StatusCode)
+
+	response := suite.decodeProblem(resp)
+	suite.Equal(problem.CodeValidation, response.Code)
+	fields := make([]string, len(response.Errors))
+	for i, fieldError := range response.Errors {
+		fields[i] = fieldError.Field
+	}
+	suite.Equal("6 fields are invalid", response.Detail)
+	suite.Equal([]string{"name", "description", "startDate", "channels", "fallbackChannel", "reminderTimes"}, fields)
+}
+
+func (suite *IntegrationTestSuite) TestCreateTrackingTimestampValidation() {
+	habit := &db.Habit{ID: "read", UserID: testUserID, Name: "Read", Frequency: db.FrequencyDaily, StartDate: "2024-03-10"}
+	suite.NoError(handlers.Database.CreateHabit(habit))
+
+	for _, timestamp := range []string{
+		"not a time",
+		time.Now().Add(24 * time.Hour).Format(time.RFC3339),
+		"2024-03-09T08:00:00Z",
+	} {
+		entryData, err := json.Marshal(map[string]interface{}{"timestamp": timestamp})
+		suite.NoError(err)
+
+		resp, err := http.Post(suite.server.URL+"/habits/read/tracking", "application/json", bytes.NewBuffer(entryData))
+		suite.NoError(err)
+		suite.Equal(http.StatusBadRequest, resp.StatusCode, timestamp)
+		response := suite.decodeProblem(resp)
+		resp.Body.Close()
+		suite.Require().Len(response.Errors, 1)
+		suite.Equal("timestamp", response.Errors[0].Field)
+	}
+
+	// Entries cannot be moved before the start date either
+	suite.NoError(handlers.Database.CreateTrackingEntry(testUserID, &db.TrackingEntry{ID: "entry", HabitID: "read", Timestamp: "2024-05-01T08:00:00Z"}))
+	req, err := http.NewRequest(http.MethodPatch, suite.server.URL+"/habits/read/tracking/entry",
+		bytes.NewBufferString(`{"timestamp": "2024-03-01T08:00:00Z"}`))
+	suite.NoError(err)
+	resp, err := http.DefaultClient.Do(req)
+	suite.NoError(err)
+	resp.Body.Close()
+	suite.Equal(http.StatusBadRequest, resp.StatusCode)
+}
+
+func (suite *IntegrationTestSuite) TestRequestBodyTooLarge() {
+	habitData, err := json.Marshal(map[string]interface{}{
+		"name": "Read", "frequency": "daily", "startDate": "2024-01-01", "description": strings.Repeat("a", problem.MaxBodyBytes),
+	})
+	suite.NoError(err)
+
+	resp, err := http.Post(suite.server.URL+"/habits", "application/json", bytes.NewBuffer(habitData))
+	suite.NoError(err)
+	defer resp.Body.Close()
+	suite.Equal(http.StatusRequestEntityTooLarge, resp.StatusCode)
+	suite.Equal(problem.CodeRequestTooLarge, suite.decodeProblem(resp).Code)
+}
+
+func (suite *IntegrationTestSuite) TestHabitETags() {
+	habit := &db.Habit{ID: "read", UserID: testUserID, Name: "Read", Frequency: db.FrequencyDaily, StartDate: "2024-01-01"}
+	suite.NoError(handlers.Database.CreateHabit(habit))
+
+	get := func(ifNoneMatch string) *http.Response {
+		req, err := http.NewRequest(http.MethodGet, suite.server.URL+"/habits/read", nil)
+		suite.NoError(err)
+		req.Header.Set("If-None-Match", ifNoneMatch)
+		resp, err := http.DefaultClient.Do(req)
+		suite.NoError(err)
+		resp.Body.Close()
+		return resp
+	}
+	patch := func(ifMatch, body string) *http.Response {
+		req, err := http.NewRequest(http.MethodPatch, suite.server.URL+"/habits/read", bytes.NewBufferString(body))
+		suite.NoError(err)
+		req.Header.Set("If-Match", ifMatch)
+		resp, err := http.DefaultClient.Do(req)
+		suite.NoError(err)
+		return resp
+	}
+
+	resp := get("")
+	suite.Equal(http.StatusOK, resp.StatusCode)
+	etag := resp.Header.Get("ETag")
+	suite.NotEmpty(etag)
+
+	// An unchanged habit is not sent again
+	resp = get(etag)
+	suite.Equal(http.StatusNotModified, resp.StatusCode)
+	suite.Equal(etag, resp.Header.Get("ETag"))
+
+	// The first device's update applies and changes the ETag
+	resp = patch(etag, `{"name": "Read more"}`)
+	suite.Equal(http.StatusOK, resp.StatusCode)
+	updatedETag := resp.Header.Get("ETag")
+	suite.NotEqual(etag, updatedETag)
+	var updated db.Habit
+	suite.NoError(json.NewDecoder(resp.Body).Decode(&updated))
+	resp.Body.Close()
+	suite.Equal(int64(2), updated.Version)
+
+	// The second device still holds the old ETag, so its update is refused
+	resp = patch(etag, `{"name": "Read less"}`)
+	suite.Equal(http.StatusPreconditionFailed, resp.StatusCode)
+	suite.Equal(problem.CodePreconditionFailed, suite.decodeProblem(resp).Code)
+	resp.Body.Close()
+
+	resp = get(etag)
+	suite.Equal(http.StatusOK, resp.StatusCode)
+	suite.Equal(updatedETag, resp.Header.Get("ETag"))
+
+	stored, err := handlers.Database.GetHabit(testUserID, "read")
+	suite.NoError(err)
+	suite.Equal("Read more", stored.Name)
+}
+
 func TestIntegrationTestSuite(t *testing.T) {
 	suite.Run(t, new(IntegrationTestSuite))
 }
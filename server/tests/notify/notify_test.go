@@ -0,0 +1,193 @@
+package notify_test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"habit-tracker/server/db"
+	"habit-tracker/server/notify"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	testUser     = &db.User{ID: "user-1", Email: "ada@example.com", Username: "ada"}
+	testReminder = notify.Notification{
+		Type:    "reminder",
+		Subject: "Reminder: Read",
+		Body:    "Time for Read",
+		Data:    map[string]string{"habitId": "read"},
+	}
+)
+
+// recordingNotifier remembers what it was asked to send and fails with err
+type recordingNotifier struct {
+	sent []notify.Notification
+	err  error
+}
+
+func (n *recordingNotifier) Notify(user *db.User, notification notify.Notification) error {
+	if n.err != nil {
+		return n.err
+	}
+	n.sent = append(n.sent, notification)
+	return nil
+}
+
+// fakeSMTPServer accepts a single mail and returns its DATA section
+func fakeSMTPServer(t *testing.T) (string, <-chan string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+
+	mail := make(chan string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		reader := bufio.NewReader(conn)
+		reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+		reply("220 localhost ESMTP")
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			command := strings.ToUpper(strings.TrimSpace(line))
+			switch {
+			case strings.HasPrefix(command, "EHLO"), strings.HasPrefix(command, "HELO"):
+				reply("250 localhost")
+			case strings.HasPrefix(command, "DATA"):
+				reply("354 end with .")
+				var data strings.Builder
+				for {
+					dataLine, err := reader.ReadString('\n')
+					if err != nil || dataLine == ".\r\n" {
+						break
+					}
+					data.WriteString(dataLine)
+				}
+				mail <- data.String()
+				reply("250 queued")
+			case strings.HasPrefix(command, "QUIT"):
+				reply("221 bye")
+				return
+			default:
+				reply("250 OK")
+			}
+		}
+	}()
+	return listener.Addr().String(), mail
+}
+
+func TestSMTPNotifier(t *testing.T) {
+	addr, mail := fakeSMTPServer(t)
+	notifier := notify.NewSMTPNotifier(addr, "reminders@example.com", nil)
+
+	notification := testReminder
+	notification.Subject = "Reminder: Read\r\nBcc: everyone@example.com"
+	require.NoError(t, notifier.Notify(testUser, notification))
+
+	message := <-mail
+	assert.Contains(t, message, "To: ada@example.com\r\n")
+	assert.Contains(t, message, "Subject: Reminder: Read  Bcc: everyone@example.com\r\n")
+	assert.NotContains(t, message, "\r\nBcc:")
+	assert.Contains(t, message, "\r\n\r\nTime for Read")
+
+	assert.Error(t, notifier.Notify(&db.User{ID: "no-email"}, testReminder))
+}
+
+func TestWebhookNotifier(t *testing.T) {
+	var received notify.WebhookPayload
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+	}))
+	defer server.Close()
+
+	require.NoError(t, notify.NewWebhookNotifier(server.URL).Notify(testUser, testReminder))
+	assert.Equal(t, "user-1", received.UserID)
+	assert.Equal(t, "reminder", received.Type)
+	assert.Equal(t, "Reminder: Read", received.Subject)
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer failing.Close()
+	assert.Error(t, notify.NewWebhookNotifier(failing.URL).Notify(testUser, testReminder))
+}
+
+func TestLogNotifiers(t *testing.T) {
+	var buffer bytes.Buffer
+	require.NoError(t, notify.NewLogNotifier(&buffer).Notify(testUser, testReminder))
+
+	var entry notify.LogEntry
+	require.NoError(t, json.Unmarshal(buffer.Bytes(), &entry))
+	assert.Equal(t, "user-1", entry.UserID)
+	assert.Equal(t, "Reminder: Read", entry.Subject)
+
+	path := filepath.Join(t.TempDir(), "notifications.log")
+	fileNotifier, err := notify.NewFileNotifier(path)
+	require.NoError(t, err)
+	require.NoError(t, fileNotifier.Notify(testUser, testReminder))
+	require.NoError(t, fileNotifier.Notify(testUser, testReminder))
+
+	contents, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, 2, strings.Count(string(contents), "\n"))
+}
+
+func TestWebSocketNotifierSendsTypedMessage(t *testing.T) {
+	var sentTo string
+	var sent []byte
+	notifier := notify.NewWebSocketNotifier(func(userID string, message []byte) error {
+		sentTo, sent = userID, message
+		return nil
+	})
+
+	require.NoError(t, notifier.Notify(testUser, testReminder))
+	assert.Equal(t, "user-1", sentTo)
+	assert.JSONEq(t, `{"type": "reminder", "data": {"habitId": "read"}}`, string(sent))
+}
+
+func TestDispatcherFallsBackWhenWebSocketFails(t *testing.T) {
+	websocket := &recordingNotifier{err: errors.New("user not connected")}
+	email := &recordingNotifier{}
+	logSink := &recordingNotifier{}
+
+	dispatcher := notify.NewDispatcher()
+	dispatcher.Register(db.ChannelWebSocket, websocket)
+	dispatcher.Register(db.ChannelEmail, email)
+	dispatcher.Register(db.ChannelLog, logSink)
+
+	// The fallback replaces the failed WebSocket delivery
+	habit := &db.Habit{FallbackChannel: db.ChannelEmail}
+	require.NoError(t, dispatcher.Deliver(testUser, habit, testReminder))
+	assert.Len(t, email.sent, 1)
+
+	// Every chosen channel is used, and a fallback that is already chosen is not sent twice
+	habit = &db.Habit{Channels: []db.Channel{db.ChannelWebSocket, db.ChannelEmail, db.ChannelLog}, FallbackChannel: db.ChannelEmail}
+	assert.Error(t, dispatcher.Deliver(testUser, habit, testReminder))
+	assert.Len(t, email.sent, 2)
+	assert.Len(t, logSink.sent, 1)
+
+	// Without a fallback the failure is reported
+	assert.Error(t, dispatcher.Deliver(testUser, &db.Habit{}, testReminder))
+
+	// Channels without a notifier are unavailable
+	err := dispatcher.Deliver(testUser, &db.Habit{Channels: []db.Channel{db.ChannelWebhook}}, testReminder)
+	assert.ErrorIs(t, err, notify.ErrChannelUnavailable)
+}
@@ -0,0 +1,77 @@
+package reminder_test
+
+import (
+	"testing"
+	"time"
+
+	"habit-tracker/server/db"
+	"habit-tracker/server/reminder"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSnoozeUntil(t *testing.T) {
+	now := time.Date(2024, time.March, 4, 18, 0, 0, 0, time.UTC)
+
+	until, err := reminder.SnoozeRequest{Minutes: 30}.SnoozeUntil(now)
+	require.NoError(t, err)
+	assert.Equal(t, now.Add(30*time.Minute), until)
+
+	until, err = reminder.SnoozeRequest{Until: "2024-03-04T21:00:00Z"}.SnoozeUntil(now)
+	require.NoError(t, err)
+	assert.Equal(t, now.Add(3*time.Hour), until)
+
+	for _, request := range []reminder.SnoozeRequest{
+		{},
+		{Minutes: 10, Until: "2024-03-04T21:00:00Z"},
+		{Minutes: -5},
+		{Until: "tonight"},
+		{Until: "2024-03-04T17:00:00Z"},
+		{Minutes: 8 * 24 * 60},
+	} {
+		_, err := request.SnoozeUntil(now)
+		assert.ErrorIs(t, err, reminder.ErrInvalidSnooze, "request %+v", request)
+	}
+}
+
+func TestSnoozeAndDismiss(t *testing.T) {
+	database := db.NewMapDatabase()
+	require.NoError(t, database.CreateUser(&db.User{ID: "user-1", Email: "ada@example.com", Username: "ada"}))
+	require.NoError(t, database.CreateHabit(&db.Habit{
+		ID: "read", UserID: "user-1", Name: "Read", Frequency: db.FrequencyDaily, StartDate: "2024-01-01",
+	}))
+	require.NoError(t, database.CreateNotification(&db.Notification{ID: "inbox-1", UserID: "user-1", HabitID: "read", Type: "reminder"}))
+
+	now := time.Now()
+	action, err := reminder.Snooze(database, "user-1", "read", "inbox-1", now.Add(-time.Second), now)
+	require.NoError(t, err)
+	assert.Equal(t, db.ReminderSnoozed, action.Action)
+
+	// The snoozed reminder fires again, and the inbox entry acted on is dismissed
+	due, err := database.GetHabitsNeedingReminders()
+	require.NoError(t, err)
+	assert.Len(t, due, 1)
+	notification, err := database.GetNotification("user-1", "inbox-1")
+	require.NoError(t, err)
+	assert.True(t, notification.Dismissed)
+
+	// Dismissing waits for the next day, which is when the daily habit is next due anyway
+	require.NoError(t, database.UpdateReminderLastReminder("user-1", "read", now.Format(time.RFC3339)))
+	action, err = reminder.Dismiss(database, "user-1", "read", "", now)
+	require.NoError(t, err)
+	tomorrow := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC)
+	assert.False(t, action.Until.Before(tomorrow))
+	assert.WithinDuration(t, now.AddDate(0, 0, 1), action.Until, time.Second)
+
+	history, err := database.GetReminderActions("user-1", "read")
+	require.NoError(t, err)
+	require.Len(t, history, 2)
+	assert.Equal(t, db.ReminderDismissed, history[0].Action)
+	assert.Equal(t, "inbox-1", history[1].NotificationID)
+
+	_, err = reminder.Snooze(database, "user-1", "read", "missing", now.Add(time.Hour), now)
+	assert.ErrorIs(t, err, db.ErrNotFound)
+	_, err = reminder.Dismiss(database, "someone-else", "read", "", now)
+	assert.ErrorIs(t, err, db.ErrNotFound)
+}
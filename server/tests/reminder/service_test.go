@@ -2,11 +2,14 @@ package reminder_test
 
 import (
 	"encoding/json"
+	"path/filepath"
 	"testing"
 	"time"
 
 	"habit-tracker/server/db"
+	"habit-tracker/server/notify"
 	"habit-tracker/server/reminder"
+	"habit-tracker/server/sockets"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
@@ -27,13 +30,13 @@ func (m *MockDatabase) CreateHabit(habit *db.Habit) error {
 	return args.Error(0)
 }
 
-func (m *MockDatabase) GetHabit(id string) (*db.Habit, error) {
-	args := m.Called(id)
+func (m *MockDatabase) GetHabit(userID, id string) (*db.Habit, error) {
+	args := m.Called(userID, id)
 	return args.Get(0).(*db.Habit), args.Error(1)
 }
 
-func (m *MockDatabase) GetAllHabits() ([]*db.Habit, error) {
-	args := m.Called()
+func (m *MockDatabase) GetAllHabits(userID string) ([]*db.Habit, error) {
+	args := m.Called(userID)
 	return args.Get(0).([]*db.Habit), args.Error(1)
 }
 
@@ -42,84 +45,164 @@ func (m *MockDatabase) UpdateHabit(habit *db.Habit) error {
 	return args.Error(0)
 }
 
-func (m *MockDatabase) UpdateHabitPartial(id string, updates map[string]interface{}) (*db.Habit, error) {
-	args := m.Called(id, updates)
+func (m *MockDatabase) UpdateHabitPartial(userID, id string, updates map[string]interface{}) (*db.Habit, error) {
+	args := m.Called(userID, id, updates)
 	return args.Get(0).(*db.Habit), args.Error(1)
 }
 
-func (m *MockDatabase) DeleteHabit(id string) error {
-	args := m.Called(id)
+func (m *MockDatabase) DeleteHabit(userID, id string) error {
+	args := m.Called(userID, id)
 	return args.Error(0)
 }
 
-func (m *MockDatabase) CreateTrackingEntry(entry *db.TrackingEntry) error {
-	args := m.Called(entry)
+func (m *MockDatabase) CreateTrackingEntry(userID string, entry *db.TrackingEntry) error {
+	args := m.Called(userID, entry)
 	return args.Error(0)
 }
 
-func (m *MockDatabase) GetTrackingEntry(id string) (*db.TrackingEntry, error) {
-	args := m.Called(id)
+func (m *MockDatabase) GetTrackingEntry(userID, id string) (*db.TrackingEntry, error) {
+	args := m.Called(userID, id)
 	return args.Get(0).(*db.TrackingEntry), args.Error(1)
 }
 
-func (m *MockDatabase) GetTrackingEntriesByHabitID(habitID string) ([]*db.TrackingEntry, error) {
-	args := m.Called(habitID)
+func (m *MockDatabase) GetTrackingEntriesByHabitID(userID, habitID string) ([]*db.TrackingEntry, error) {
+	args := m.Called(userID, habitID)
 	return args.Get(0).([]*db.TrackingEntry), args.Error(1)
 }
 
-func (m *MockDatabase) DeleteTrackingEntry(id string) error {
-	args := m.Called(id)
+func (m *MockDatabase) UpdateTrackingEntryPartial(userID, id string, updates map[string]interface{}) (*db.TrackingEntry, error) {
+	args := m.Called(userID, id, updates)
+	return args.Get(0).(*db.TrackingEntry), args.Error(1)
+}
+
+func (m *MockDatabase) DeleteTrackingEntry(userID, id string) error {
+	args := m.Called(userID, id)
 	return args.Error(0)
 }
 
-func (m *MockDatabase) CreateReminder(reminder *db.Reminder) error {
-	args := m.Called(reminder)
+func (m *MockDatabase) CreateReminder(userID string, reminder *db.Reminder) error {
+	args := m.Called(userID, reminder)
 	return args.Error(0)
 }
 
-func (m *MockDatabase) GetReminder(habitID string) (*db.Reminder, error) {
-	args := m.Called(habitID)
+func (m *MockDatabase) GetReminder(userID, habitID string) (*db.Reminder, error) {
+	args := m.Called(userID, habitID)
+	return args.Get(0).(*db.Reminder), args.Error(1)
+}
+
+func (m *MockDatabase) GetReminderByID(userID, id string) (*db.Reminder, error) {
+	args := m.Called(userID, id)
 	return args.Get(0).(*db.Reminder), args.Error(1)
 }
 
-func (m *MockDatabase) UpdateReminderLastReminder(habitID string, lastReminder string) error {
-	args := m.Called(habitID, lastReminder)
+func (m *MockDatabase) UpdateReminderLastReminder(userID, habitID string, lastReminder string) error {
+	args := m.Called(userID, habitID, lastReminder)
 	return args.Error(0)
 }
 
+func (m *MockDatabase) SnoozeReminder(userID, habitID string, until time.Time) error {
+	args := m.Called(userID, habitID, until)
+	return args.Error(0)
+}
+
+func (m *MockDatabase) CreateReminderAction(action *db.ReminderAction) error {
+	args := m.Called(action)
+	return args.Error(0)
+}
+
+func (m *MockDatabase) GetReminderActions(userID, habitID string) ([]*db.ReminderAction, error) {
+	args := m.Called(userID, habitID)
+	return args.Get(0).([]*db.ReminderAction), args.Error(1)
+}
+
 func (m *MockDatabase) GetHabitsNeedingReminders() ([]*db.Habit, error) {
 	args := m.Called()
 	return args.Get(0).([]*db.Habit), args.Error(1)
 }
 
-func (m *MockDatabase) DeleteReminder(habitID string) error {
-	args := m.Called(habitID)
+func (m *MockDatabase) NextReminderDue() (time.Time, bool, error) {
+	args := m.Called()
+	return args.Get(0).(time.Time), args.Bool(1), args.Error(2)
+}
+
+func (m *MockDatabase) SetReminderListener(listener db.ReminderListener) {
+	m.Called(listener)
+}
+
+func (m *MockDatabase) DeleteReminder(userID, habitID string) error {
+	args := m.Called(userID, habitID)
+	return args.Error(0)
+}
+
+func (m *MockDatabase) ClaimReminderSend(send *db.ReminderSend, staleBefore time.Time) (bool, error) {
+	args := m.Called(send, staleBefore)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockDatabase) CompleteReminderSend(send *db.ReminderSend, sentAt time.Time) error {
+	args := m.Called(send, sentAt)
 	return args.Error(0)
 }
 
+func (m *MockDatabase) AcquireLease(name, holder string, ttl time.Duration) (bool, error) {
+	args := m.Called(name, holder, ttl)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockDatabase) ReleaseLease(name, holder string) error {
+	args := m.Called(name, holder)
+	return args.Error(0)
+}
+
+// Notification Methods
+func (m *MockDatabase) CreateNotification(notification *db.Notification) error {
+	args := m.Called(notification)
+	return args.Error(0)
+}
+
+func (m *MockDatabase) GetNotification(userID, id string) (*db.Notification, error) {
+	args := m.Called(userID, id)
+	return args.Get(0).(*db.Notification), args.Error(1)
+}
+
+func (m *MockDatabase) GetNotifications(userID string, unreadOnly bool) ([]*db.Notification, error) {
+	args := m.Called(userID, unreadOnly)
+	return args.Get(0).([]*db.Notification), args.Error(1)
+}
+
+func (m *MockDatabase) UpdateNotificationPartial(userID, id string, updates map[string]interface{}) (*db.Notification, error) {
+	args := m.Called(userID, id, updates)
+	return args.Get(0).(*db.Notification), args.Error(1)
+}
+
+func (m *MockDatabase) MarkAllNotificationsRead(userID string) (int, error) {
+	args := m.Called(userID)
+	return args.Int(0), args.Error(1)
+}
+
 // Statistics and Analytics Methods
-func (m *MockDatabase) GetHabitStats(habitID string) (*db.HabitStats, error) {
-	args := m.Called(habitID)
+func (m *MockDatabase) GetHabitStats(userID, habitID string) (*db.HabitStats, error) {
+	args := m.Called(userID, habitID)
 	return args.Get(0).(*db.HabitStats), args.Error(1)
 }
 
-func (m *MockDatabase) GetHabitProgress(habitID string, days int) ([]*db.ProgressPoint, error) {
-	args := m.Called(habitID, days)
+func (m *MockDatabase) GetHabitProgress(userID, habitID string, days int) ([]*db.ProgressPoint, error) {
+	args := m.Called(userID, habitID, days)
 	return args.Get(0).([]*db.ProgressPoint), args.Error(1)
 }
 
-func (m *MockDatabase) GetOverallStats() (*db.OverallStats, error) {
-	args := m.Called()
+func (m *MockDatabase) GetOverallStats(userID string) (*db.OverallStats, error) {
+	args := m.Called(userID)
 	return args.Get(0).(*db.OverallStats), args.Error(1)
 }
 
-func (m *MockDatabase) GetHabitCompletionRates(days int) ([]*db.HabitCompletionRate, error) {
-	args := m.Called(days)
+func (m *MockDatabase) GetHabitCompletionRates(userID string, days int) ([]*db.HabitCompletionRate, error) {
+	args := m.Called(userID, days)
 	return args.Get(0).([]*db.HabitCompletionRate), args.Error(1)
 }
 
-func (m *MockDatabase) GetDailyCompletions(days int) ([]*db.DailyCompletion, error) {
-	args := m.Called(days)
+func (m *MockDatabase) GetDailyCompletions(userID string, days int) ([]*db.DailyCompletion, error) {
+	args := m.Called(userID, days)
 	return args.Get(0).([]*db.DailyCompletion), args.Error(1)
 }
 
@@ -149,6 +232,32 @@ func (m *MockDatabase) DeleteUser(id string) error {
 	return args.Error(0)
 }
 
+// Refresh Token Methods
+func (m *MockDatabase) CreateRefreshToken(token *db.RefreshToken) error {
+	args := m.Called(token)
+	return args.Error(0)
+}
+
+func (m *MockDatabase) GetRefreshTokenByHash(tokenHash string) (*db.RefreshToken, error) {
+	args := m.Called(tokenHash)
+	return args.Get(0).(*db.RefreshToken), args.Error(1)
+}
+
+func (m *MockDatabase) RotateRefreshToken(oldID string, next *db.RefreshToken) error {
+	args := m.Called(oldID, next)
+	return args.Error(0)
+}
+
+func (m *MockDatabase) RevokeRefreshTokenFamily(familyID string) error {
+	args := m.Called(familyID)
+	return args.Error(0)
+}
+
+func (m *MockDatabase) IsRefreshTokenFamilyActive(familyID string) (bool, error) {
+	args := m.Called(familyID)
+	return args.Bool(0), args.Error(1)
+}
+
 func TestNewReminderService(t *testing.T) {
 	mockDB := &MockDatabase{}
 	service := reminder.NewReminderService(mockDB)
@@ -156,12 +265,12 @@ func TestNewReminderService(t *testing.T) {
 	assert.NotNil(t, service)
 }
 
-func TestSetCheckInterval(t *testing.T) {
+func TestSetRetryInterval(t *testing.T) {
 	mockDB := &MockDatabase{}
 	service := reminder.NewReminderService(mockDB)
 
 	customInterval := 10 * time.Second
-	service.SetCheckInterval(customInterval)
+	service.SetRetryInterval(customInterval)
 
 	// Note: We can't directly test the internal field, but we can verify it doesn't panic
 	assert.NotNil(t, service)
@@ -202,3 +311,205 @@ func TestCheckAndSendRemindersNoHabits(t *testing.T) {
 	// Verify mock was properly set up (the actual method call would happen in the private method)
 	mockDB.AssertNotCalled(t, "UpdateReminderLastReminder")
 }
+
+// channelNotifier reports each notification on a channel, or fails with err
+type channelNotifier struct {
+	sent chan notify.Notification
+	err  error
+}
+
+func (n *channelNotifier) Notify(user *db.User, notification notify.Notification) error {
+	if n.err != nil {
+		return n.err
+	}
+	n.sent <- notification
+	return nil
+}
+
+func TestRemindersFallBackWhenWebSocketFails(t *testing.T) {
+	database := db.NewMapDatabase()
+	user := &db.User{Email: "ada@example.com", Username: "ada"}
+	assert.NoError(t, database.CreateUser(user))
+	assert.NoError(t, database.CreateHabit(&db.Habit{
+		ID: "read", UserID: user.ID, Name: "Read", Frequency: db.FrequencyDaily,
+		StartDate: time.Now().AddDate(0, 0, -7).Format("2006-01-02"), FallbackChannel: db.ChannelEmail,
+	}))
+	assert.NoError(t, database.UpdateReminderLastReminder(user.ID, "read", time.Now().AddDate(0, 0, -2).Format(time.RFC3339)))
+
+	email := &channelNotifier{sent: make(chan notify.Notification, 1)}
+	dispatcher := notify.NewDispatcher()
+	dispatcher.Register(db.ChannelWebSocket, &channelNotifier{err: sockets.ErrNotConnected})
+	dispatcher.Register(db.ChannelEmail, email)
+
+	service := reminder.NewReminderService(database)
+	service.SetDispatcher(dispatcher)
+	service.Start()
+	defer service.Stop()
+
+	select {
+	case notification := <-email.sent:
+		assert.Equal(t, "reminder", notification.Type)
+		assert.Equal(t, "Reminder: Read", notification.Subject)
+
+		// The reminder is kept in the inbox for when the user reconnects
+		inbox, err := database.GetNotifications(user.ID, true)
+		assert.NoError(t, err)
+		if assert.Len(t, inbox, 1) {
+			assert.Equal(t, inbox[0].ID, notification.ID)
+			assert.Equal(t, "read", inbox[0].HabitID)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("reminder was not sent by email")
+	}
+}
+
+func TestReminderSentWhenDueWithoutPolling(t *testing.T) {
+	database, err := db.NewSQLiteDatabase(filepath.Join(t.TempDir(), "reminders.db"))
+	assert.NoError(t, err)
+	defer database.Close()
+
+	user := &db.User{Email: "ada@example.com", Username: "ada"}
+	assert.NoError(t, database.CreateUser(user))
+	assert.NoError(t, database.CreateHabit(&db.Habit{
+		ID: "read", UserID: user.ID, Name: "Read", Frequency: db.FrequencyDaily, StartDate: "2024-01-01",
+	}))
+
+	websocket := &channelNotifier{sent: make(chan notify.Notification, 1)}
+	dispatcher := notify.NewDispatcher()
+	dispatcher.Register(db.ChannelWebSocket, websocket)
+
+	service := reminder.NewReminderService(database)
+	service.SetDispatcher(dispatcher)
+	service.Start()
+	defer service.Stop()
+
+	// Nothing is due until tomorrow, so only the snooze can wake the service
+	select {
+	case <-websocket.sent:
+		t.Fatal("reminder sent before it was due")
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	due := time.Now().Add(time.Second).Truncate(time.Second)
+	assert.NoError(t, database.SnoozeReminder(user.ID, "read", due))
+
+	select {
+	case notification := <-websocket.sent:
+		assert.Equal(t, "Reminder: Read", notification.Subject)
+		assert.False(t, time.Now().Before(due))
+	case <-time.After(3 * time.Second):
+		t.Fatal("snoozed reminder was not sent when due")
+	}
+
+	// Sending it schedules the next one a day later
+	stored, err := database.GetReminder(user.ID, "read")
+	assert.NoError(t, err)
+	next, err := time.Parse(time.RFC3339, stored.NextReminder)
+	assert.NoError(t, err)
+	assert.WithinDuration(t, time.Now().AddDate(0, 0, 1), next, 5*time.Second)
+}
+
+func TestSentReminderMovedBackIsNotDueForever(t *testing.T) {
+	sqlite, err := db.NewSQLiteDatabase(filepath.Join(t.TempDir(), "reminders.db"))
+	assert.NoError(t, err)
+	defer sqlite.Close()
+
+	for _, database := range []db.Database{db.NewMapDatabase(), sqlite} {
+		user := &db.User{Email: "ada@example.com", Username: "ada"}
+		assert.NoError(t, database.CreateUser(user))
+		assert.NoError(t, database.CreateHabit(&db.Habit{
+			ID: "read", UserID: user.ID, Name: "Read", Frequency: db.FrequencyDaily, StartDate: "2024-01-01",
+		}))
+
+		// The reminder due twelve hours ago was sent, then its last reminder
+		// was set back so that it is due again
+		last := time.Now().Add(-36 * time.Hour).UTC().Truncate(time.Second).Format(time.RFC3339)
+		assert.NoError(t, database.UpdateReminderLastReminder(user.ID, "read", last))
+		stored, err := database.GetReminder(user.ID, "read")
+		assert.NoError(t, err)
+		due, err := time.Parse(time.RFC3339, stored.NextReminder)
+		assert.NoError(t, err)
+		send := &db.ReminderSend{UserID: user.ID, HabitID: "read", DueAt: due, Worker: "earlier", ClaimedAt: due}
+		claimed, err := database.ClaimReminderSend(send, due.Add(-time.Minute))
+		assert.NoError(t, err)
+		assert.True(t, claimed)
+		assert.NoError(t, database.CompleteReminderSend(send, due))
+		assert.NoError(t, database.UpdateReminderLastReminder(user.ID, "read", last))
+
+		websocket := &channelNotifier{sent: make(chan notify.Notification, 1)}
+		dispatcher := notify.NewDispatcher()
+		dispatcher.Register(db.ChannelWebSocket, websocket)
+		service := reminder.NewReminderService(database)
+		service.SetDispatcher(dispatcher)
+		service.Start()
+
+		select {
+		case <-websocket.sent:
+			t.Error("reminder sent twice for the same due time")
+		case <-time.After(300 * time.Millisecond):
+		}
+		service.Stop()
+
+		// The reminder moves on to the following day instead
+		stored, err = database.GetReminder(user.ID, "read")
+		assert.NoError(t, err)
+		assert.Equal(t, due.AddDate(0, 0, 1).Format(time.RFC3339), stored.NextReminder)
+	}
+}
+
+func TestOnlyOneReplicaSendsReminders(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "replicas.db")
+	first, err := db.NewSQLiteDatabase(path)
+	assert.NoError(t, err)
+	defer first.Close()
+	second, err := db.NewSQLiteDatabase(path)
+	assert.NoError(t, err)
+	defer second.Close()
+
+	user := &db.User{Email: "ada@example.com", Username: "ada"}
+	assert.NoError(t, first.CreateUser(user))
+	assert.NoError(t, first.CreateHabit(&db.Habit{
+		ID: "read", UserID: user.ID, Name: "Read", Frequency: db.FrequencyDaily, StartDate: "2024-01-01",
+	}))
+
+	sent := make(chan notify.Notification, 4)
+	start := func(database db.Database) *reminder.ReminderService {
+		dispatcher := notify.NewDispatcher()
+		dispatcher.Register(db.ChannelWebSocket, &channelNotifier{sent: sent})
+		service := reminder.NewReminderService(database)
+		service.SetDispatcher(dispatcher)
+		service.SetLeaseDuration(300 * time.Millisecond)
+		service.Start()
+		return service
+	}
+	leader := start(first)
+	time.Sleep(50 * time.Millisecond)
+	standby := start(second)
+	defer standby.Stop()
+
+	// Both replicas see the reminder fall due, but only the leader sends it
+	assert.NoError(t, first.UpdateReminderLastReminder(user.ID, "read", time.Now().AddDate(0, 0, -2).Format(time.RFC3339)))
+	select {
+	case <-sent:
+	case <-time.After(2 * time.Second):
+		t.Fatal("reminder was not sent")
+	}
+	select {
+	case <-sent:
+		t.Fatal("reminder was sent twice")
+	case <-time.After(500 * time.Millisecond):
+	}
+
+	// The standby takes over once the leader stops
+	leader.Stop()
+	assert.NoError(t, second.UpdateReminderLastReminder(user.ID, "read", time.Now().AddDate(0, 0, -3).Format(time.RFC3339)))
+	select {
+	case <-sent:
+	case <-time.After(2 * time.Second):
+		t.Fatal("standby did not take over")
+	}
+
+	inbox, err := second.GetNotifications(user.ID, false)
+	assert.NoError(t, err)
+	assert.Len(t, inbox, 2)
+}
@@ -1,11 +1,16 @@
 package tests
 
 import (
+	"bytes"
+	"encoding/json"
+	"log"
 	"net/http"
 	"net/http/httptest"
+	"os"
 	"testing"
 
 	"habit-tracker/server/handlers"
+	"habit-tracker/server/problem"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -131,6 +136,7 @@ func TestRouterServeHTTP(t *testing.T) {
 		path           string
 		expectedStatus int
 		expectedBody   string
+		expectedCode   string
 	}{
 		{
 			name:           "GET request to /test",
@@ -158,14 +164,14 @@ func TestRouterServeHTTP(t *testing.T) {
 			method:         "GET",
 			path:           "/nonexistent",
 			expectedStatus: http.StatusNotFound,
-			expectedBody:   "404 page not found\n",
+			expectedCode:   problem.CodeNotFound,
 		},
 		{
 			name:           "Method not allowed",
 			method:         "DELETE",
 			path:           "/test",
-			expectedStatus: http.StatusNotFound,
-			expectedBody:   "404 page not found\n",
+			expectedStatus: http.StatusMethodNotAllowed,
+			expectedCode:   problem.CodeMethodNotAllowed,
 		},
 	}
 
@@ -177,7 +183,17 @@ func TestRouterServeHTTP(t *testing.T) {
 			router.ServeHTTP(w, req)
 
 			assert.Equal(t, tt.expectedStatus, w.Code)
-			assert.Equal(t, tt.expectedBody, w.Body.String())
+			if tt.expectedCode == "" {
+				assert.Equal(t, tt.expectedBody, w.Body.String())
+				return
+			}
+
+			var response problem.Problem
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			assert.Equal(t, problem.ContentType, w.Header().Get("Content-Type"))
+			assert.Equal(t, tt.expectedCode, response.Code)
+			assert.Equal(t, tt.expectedStatus, response.Status)
+			assert.Equal(t, tt.path, response.Instance)
 		})
 	}
 }
@@ -194,7 +210,8 @@ func TestCORSHeaders(t *testing.T) {
 
 	assert.Equal(t, "*", w.Header().Get("Access-Control-Allow-Origin"))
 	assert.Equal(t, "GET, POST, PATCH, DELETE, OPTIONS", w.Header().Get("Access-Control-Allow-Methods"))
-	assert.Equal(t, "Content-Type, Authorization", w.Header().Get("Access-Control-Allow-Headers"))
+	assert.Equal(t, "Content-Type, Authorization, If-Match, If-None-Match", w.Header().Get("Access-Control-Allow-Headers"))
+	assert.Equal(t, "ETag", w.Header().Get("Access-Control-Expose-Headers"))
 	assert.Equal(t, "86400", w.Header().Get("Access-Control-Max-Age"))
 }
 
@@ -211,6 +228,279 @@ func TestOPTIONSRequest(t *testing.T) {
 	assert.Equal(t, http.StatusOK, w.Code)
 	assert.Equal(t, "*", w.Header().Get("Access-Control-Allow-Origin"))
 	assert.Equal(t, "GET, POST, PATCH, DELETE, OPTIONS", w.Header().Get("Access-Control-Allow-Methods"))
-	assert.Equal(t, "Content-Type, Authorization", w.Header().Get("Access-Control-Allow-Headers"))
+	assert.Equal(t, "Content-Type, Authorization, If-Match, If-None-Match", w.Header().Get("Access-Control-Allow-Headers"))
+	assert.Equal(t, "ETag", w.Header().Get("Access-Control-Expose-Headers"))
 	assert.Equal(t, "86400", w.Header().Get("Access-Control-Max-Age"))
 }
+
+// tag is middleware that appends name to the X-Trace header on the way in
+func tag(name string) handlers.Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("X-Trace", name)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func TestMiddlewareOrder(t *testing.T) {
+	router := handlers.CreateRouter()
+	router.Use(tag("router"))
+	api := router.Group("/api", tag("group"))
+	v1 := api.Group("/v1/", tag("nested"))
+	v1.Handle("GET", "/habits/:id", func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+		w.Write([]byte("habit " + params["id"]))
+	}, tag("route"))
+	router.Handle("GET", "/plain", func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	req := httptest.NewRequest("GET", "/api/v1/habits/7", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, "habit 7", w.Body.String())
+	assert.Equal(t, []string{"router", "group", "nested", "route"}, w.Header().Values("X-Trace"))
+
+	// Group middleware stays out of routes outside the group, but router
+	// middleware also runs for requests that match no route
+	req = httptest.NewRequest("GET", "/plain", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, []string{"router"}, w.Header().Values("X-Trace"))
+
+	req = httptest.NewRequest("GET", "/missing", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, []string{"router"}, w.Header().Values("X-Trace"))
+}
+
+func TestMiddlewareCanStopRequest(t *testing.T) {
+	router := handlers.CreateRouter()
+	deny := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "Authorization header required", http.StatusUnauthorized)
+		})
+	}
+	called := false
+	router.Group("/private", deny).Handle("GET", "", func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+		called = true
+	})
+
+	req := httptest.NewRequest("GET", "/private", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.False(t, called)
+}
+
+func TestRecoveryMiddleware(t *testing.T) {
+	router := handlers.CreateRouter()
+	router.Use(handlers.Recovery, handlers.Logging)
+	router.Handle("GET", "/panic", func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+		panic("boom")
+	})
+
+	req := httptest.NewRequest("GET", "/panic", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "*", w.Header().Get("Access-Control-Allow-Origin"))
+}
+
+func TestPanickingRequestsAreLogged(t *testing.T) {
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	defer log.SetOutput(os.Stderr)
+
+	router := handlers.CreateRouter()
+	router.Use(handlers.Logging, handlers.Recovery)
+	router.Handle("GET", "/panic", func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+		panic("boom")
+	})
+	router.Handle("GET", "/partial", func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte("partial"))
+		panic("boom")
+	})
+
+	w := serve(router, "GET", "/panic")
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Contains(t, logged.String(), "GET /panic 500")
+
+	// A response already under way is not followed by a problem document
+	w = serve(router, "GET", "/partial")
+	assert.Equal(t, http.StatusAccepted, w.Code)
+	assert.Equal(t, "partial", w.Body.String())
+	assert.Contains(t, logged.String(), "GET /partial 202")
+}
+
+// serve sends a request through the router and returns the recorded response
+func serve(router *handlers.Router, method, path string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+	return w
+}
+
+// echo is a handler that writes its name followed by its route parameters
+func echo(name string) handlers.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+		w.Write([]byte(name))
+		for _, key := range []string{"id", "entryId", "rest"} {
+			if value, ok := params[key]; ok {
+				w.Write([]byte(" " + key + "=" + value))
+			}
+		}
+	}
+}
+
+func TestRouterPrecedence(t *testing.T) {
+	router := handlers.CreateRouter()
+	router.Handle("GET", "/habits/:id", echo("habit"))
+	router.Handle("GET", "/habits/archived", echo("archived"))
+	router.Handle("GET", "/habits/:id/tracking/:entryId", echo("entry"))
+	router.Handle("GET", "/habits/archived/count", echo("count"))
+	router.Handle("GET", "/files/*rest", echo("files"))
+	router.Handle("GET", "/files/readme", echo("readme"))
+
+	tests := []struct {
+		path string
+		body string
+	}{
+		{"/habits/42", "habit id=42"},
+		{"/habits/archived", "archived"},
+		{"/habits/archived/", "archived"},
+		{"/habits/archived/count", "count"},
+		// The static branch leads nowhere, so the parameter is tried
+		{"/habits/archived/tracking/7", "entry id=archived entryId=7"},
+		{"/files/readme", "readme"},
+		{"/files/docs/api/v1.md", "files rest=docs/api/v1.md"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			w := serve(router, "GET", tt.path)
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, tt.body, w.Body.String())
+		})
+	}
+
+	assert.Equal(t, http.StatusNotFound, serve(router, "GET", "/files").Code)
+	assert.Equal(t, http.StatusNotFound, serve(router, "GET", "/habits/42/tracking").Code)
+}
+
+func TestRouterMethodNotAllowed(t *testing.T) {
+	router := handlers.CreateRouter()
+	router.Handle("GET", "/habits/:id", echo("get"))
+	router.Handle("PATCH", "/habits/:id", echo("patch"))
+	router.Handle("DELETE", "/habits/:id", echo("delete"))
+	router.Handle("POST", "/habits", echo("create"))
+
+	w := serve(router, "PUT", "/habits/42")
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	assert.Equal(t, "DELETE, GET, HEAD, OPTIONS, PATCH", w.Header().Get("Allow"))
+
+	w = serve(router, "GET", "/habits")
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	assert.Equal(t, "OPTIONS, POST", w.Header().Get("Allow"))
+}
+
+func TestRouterAutomaticHeadAndOptions(t *testing.T) {
+	router := handlers.CreateRouter()
+	router.Handle("GET", "/habits/:id", func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"` + params["id"] + `"}`))
+	})
+
+	w := serve(router, "HEAD", "/habits/42")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	assert.Empty(t, w.Body.String())
+
+	w = serve(router, "OPTIONS", "/habits/42")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "GET, HEAD, OPTIONS", w.Header().Get("Allow"))
+	assert.Equal(t, "*", w.Header().Get("Access-Control-Allow-Origin"))
+
+	assert.Equal(t, http.StatusNotFound, serve(router, "OPTIONS", "/missing").Code)
+}
+
+func TestRouterRejectsAmbiguousRoutes(t *testing.T) {
+	router := handlers.CreateRouter()
+	router.Handle("GET", "/habits/:id", echo("habit"))
+
+	assert.Panics(t, func() { router.Handle("GET", "/habits/:id", echo("again")) })
+	assert.Panics(t, func() { router.Handle("PATCH", "/habits/:habitId", echo("renamed")) })
+	assert.Panics(t, func() { router.Handle("GET", "/files/*rest/more", echo("files")) })
+}
+
+// benchmarkRoutes mirrors the routes registered in main.go
+var benchmarkRoutes = []struct{ method, pattern string }{
+	{"POST", "/auth/register"}, {"POST", "/auth/login"}, {"POST", "/auth/refresh"},
+	{"GET", "/auth/profile"}, {"PATCH", "/auth/profile"}, {"POST", "/auth/logout"}, {"GET", "/auth/validate"},
+	{"GET", "/habits"}, {"POST", "/habits"}, {"GET", "/habits/:id"}, {"PATCH", "/habits/:id"}, {"DELETE", "/habits/:id"},
+	{"POST", "/habits/:id/tracking"}, {"GET", "/habits/:id/tracking"}, {"GET", "/habits/:id/tracking/:entryId"},
+	{"PATCH", "/habits/:id/tracking/:entryId"}, {"DELETE", "/habits/:id/tracking/:entryId"},
+	{"PATCH", "/reminders/:id"}, {"POST", "/habits/:id/reminder/snooze"}, {"POST", "/habits/:id/reminder/dismiss"},
+	{"GET", "/habits/:id/reminder/history"}, {"GET", "/notifications"}, {"POST", "/notifications/read-all"},
+	{"PATCH", "/notifications/:id"}, {"GET", "/habits/:id/stats"}, {"GET", "/habits/:id/progress"},
+	{"GET", "/stats/overview"}, {"GET", "/stats/completion-rates"}, {"GET", "/stats/daily-completions"},
+}
+
+// benchmarkPath is matched by one of the last routes registered
+const benchmarkPath = "/stats/daily-completions"
+
+// BenchmarkLinearMatch scans the routes the way the router did before it kept
+// them in a tree
+func BenchmarkLinearMatch(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		for _, route := range benchmarkRoutes {
+			if route.method != "GET" {
+				continue
+			}
+			if _, matched := handlers.Match(route.pattern, benchmarkPath); matched {
+				break
+			}
+		}
+	}
+}
+
+func BenchmarkRouter(b *testing.B) {
+	router := handlers.CreateRouter()
+	noop := func(w http.ResponseWriter, r *http.Request, params map[string]string) {}
+	for _, route := range benchmarkRoutes {
+		router.Handle(route.method, route.pattern, noop)
+	}
+	req := httptest.NewRequest("GET", benchmarkPath, nil)
+	w := httptest.NewRecorder()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		router.ServeHTTP(w, req)
+	}
+}
+
+func TestRequestIDInProblems(t *testing.T) {
+	router := handlers.CreateRouter()
+	router.Use(handlers.RequestID)
+
+	w := serve(router, "GET", "/missing")
+	requestID := w.Header().Get(problem.RequestIDHeader)
+	assert.NotEmpty(t, requestID)
+
+	var response problem.Problem
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, requestID, response.RequestID)
+	assert.Equal(t, "Not Found", response.Title)
+
+	// A well-formed ID from the client is kept, anything else replaced
+	req := httptest.NewRequest("GET", "/missing", nil)
+	req.Header.Set(problem.RequestIDHeader, "edge-42")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, "edge-42", w.Header().Get(problem.RequestIDHeader))
+
+	req.Header.Set(problem.RequestIDHeader, "bad id\n")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.NotEqual(t, "bad id\n", w.Header().Get(problem.RequestIDHeader))
+}
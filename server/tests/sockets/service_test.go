@@ -0,0 +1,401 @@
+package sockets_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"habit-tracker/server/auth"
+	"habit-tracker/server/db"
+	"habit-tracker/server/handlers"
+	"habit-tracker/server/sockets"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/suite"
+)
+
+type SocketsTestSuite struct {
+	suite.Suite
+	database    *db.MapDatabase
+	authService *auth.AuthService
+	hub         *sockets.Hub
+	server      *httptest.Server
+}
+
+func (suite *SocketsTestSuite) SetupTest() {
+	suite.database = db.NewMapDatabase()
+	suite.authService = auth.NewAuthService(suite.database, "test-secret", time.Hour)
+	suite.hub = sockets.NewHub(suite.authService, suite.database)
+	suite.hub.AuthTimeout = time.Second
+	suite.server = httptest.NewServer(suite.hub)
+}
+
+func (suite *SocketsTestSuite) TearDownTest() {
+	suite.server.Close()
+}
+
+func (suite *SocketsTestSuite) login(service *auth.AuthService, email string) (string, string) {
+	user, err := service.Register(email, strings.Split(email, "@")[0], "password123")
+	suite.Require().NoError(err)
+
+	tokens, _, err := service.Login(email, "password123")
+	suite.Require().NoError(err)
+	return user.ID, tokens.AccessToken
+}
+
+func (suite *SocketsTestSuite) dial(query string) (*websocket.Conn, *http.Response, error) {
+	url := "ws" + strings.TrimPrefix(suite.server.URL, "http") + query
+	return websocket.DefaultDialer.Dial(url, nil)
+}
+
+func (suite *SocketsTestSuite) readMessage(conn *websocket.Conn) sockets.Message {
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var msg sockets.Message
+	suite.Require().NoError(conn.ReadJSON(&msg))
+	return msg
+}
+
+func (suite *SocketsTestSuite) expectClose(conn *websocket.Conn, timeout time.Duration) {
+	conn.SetReadDeadline(time.Now().Add(timeout))
+	_, _, err := conn.ReadMessage()
+	suite.True(websocket.IsCloseError(err, websocket.ClosePolicyViolation), "unexpected error: %v", err)
+}
+
+func (suite *SocketsTestSuite) TestHandshakeTokenAuthenticates() {
+	userID, token := suite.login(suite.authService, "alice@example.com")
+
+	conn, _, err := suite.dial("?token=" + token)
+	suite.Require().NoError(err)
+	defer conn.Close()
+
+	ack := suite.readMessage(conn)
+	suite.Equal("authenticated", ack.Type)
+
+	suite.NoError(suite.hub.MessageUser(userID, []byte(`{"type":"reminder"}`)))
+	suite.Equal("reminder", suite.readMessage(conn).Type)
+}
+
+func (suite *SocketsTestSuite) TestUnreadNotificationsReplayedOnAuth() {
+	userID, token := suite.login(suite.authService, "alice@example.com")
+	now := time.Now()
+	for i, id := range []string{"older", "newer", "seen"} {
+		suite.Require().NoError(suite.database.CreateNotification(&db.Notification{
+			ID: id, UserID: userID, Type: "reminder", Data: json.RawMessage(`{"habitId":"read"}`),
+			Read: id == "seen", CreatedAt: now.Add(time.Duration(i) * time.Minute),
+		}))
+	}
+
+	conn, _, err := suite.dial("?token=" + token)
+	suite.Require().NoError(err)
+	defer conn.Close()
+	suite.Equal("authenticated", suite.readMessage(conn).Type)
+
+	// The unread backlog follows the acknowledgement, oldest first
+	for _, id := range []string{"older", "newer"} {
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		var message sockets.InboxMessage
+		suite.Require().NoError(conn.ReadJSON(&message))
+		suite.Equal(id, message.ID)
+		suite.Equal("reminder", message.Type)
+		suite.True(message.Replayed)
+		suite.JSONEq(`{"habitId":"read"}`, string(message.Data))
+	}
+
+	// Re-authenticating on the same connection does not replay again
+	suite.NoError(conn.WriteJSON(sockets.Message{Type: "auth", Data: sockets.AuthData{Token: token}}))
+	suite.Equal("authenticated", suite.readMessage(conn).Type)
+
+	// A replayed notification delivered live as well is only sent once
+	suite.NoError(suite.hub.MessageUser(userID, []byte(`{"type":"reminder","id":"newer"}`)))
+	suite.NoError(suite.hub.MessageUser(userID, []byte(`{"type":"live"}`)))
+	suite.Equal("live", suite.readMessage(conn).Type)
+}
+
+func (suite *SocketsTestSuite) TestHandshakeInvalidTokenRejected() {
+	_, resp, err := suite.dial("?token=invalid.token.here")
+	suite.Error(err)
+	suite.Require().NotNil(resp)
+	suite.Equal(http.StatusUnauthorized, resp.StatusCode)
+}
+
+func (suite *SocketsTestSuite) TestAuthMessageAuthenticates() {
+	aliceID, aliceToken := suite.login(suite.authService, "alice@example.com")
+	bobID, _ := suite.login(suite.authService, "bob@example.com")
+
+	conn, _, err := suite.dial("")
+	suite.Require().NoError(err)
+	defer conn.Close()
+
+	suite.NoError(conn.WriteJSON(sockets.Message{Type: "auth", Data: sockets.AuthData{Token: aliceToken}}))
+
+	ack := suite.readMessage(conn)
+	suite.Equal("authenticated", ack.Type)
+	data, _ := json.Marshal(ack.Data)
+	suite.Contains(string(data), aliceID)
+
+	// Messages for another user are not delivered to this socket, and
+	// report that nobody received them
+	suite.ErrorIs(suite.hub.MessageUser(bobID, []byte(`{"type":"for-bob"}`)), sockets.ErrNotConnected)
+	suite.NoError(suite.hub.MessageUser(aliceID, []byte(`{"type":"for-alice"}`)))
+	suite.Equal("for-alice", suite.readMessage(conn).Type)
+}
+
+func (suite *SocketsTestSuite) TestAuthMessageInvalidTokenCloses() {
+	conn, _, err := suite.dial("")
+	suite.Require().NoError(err)
+	defer conn.Close()
+
+	suite.NoError(conn.WriteJSON(sockets.Message{Type: "auth", Data: sockets.AuthData{Token: "invalid.token.here"}}))
+	suite.expectClose(conn, 2*time.Second)
+}
+
+func (suite *SocketsTestSuite) TestUnauthenticatedConnectionTimesOut() {
+	suite.hub.AuthTimeout = 50 * time.Millisecond
+
+	conn, _, err := suite.dial("")
+	suite.Require().NoError(err)
+	defer conn.Close()
+
+	suite.expectClose(conn, 2*time.Second)
+}
+
+func (suite *SocketsTestSuite) TestConnectionClosedWhenTokenExpires() {
+	shortExpiryService := auth.NewAuthService(suite.database, "test-secret", 1500*time.Millisecond)
+	suite.hub.AuthService = shortExpiryService
+	_, token := suite.login(shortExpiryService, "alice@example.com")
+
+	conn, _, err := suite.dial("?token=" + token)
+	suite.Require().NoError(err)
+	defer conn.Close()
+
+	suite.Equal("authenticated", suite.readMessage(conn).Type)
+	suite.expectClose(conn, 3*time.Second)
+}
+
+func (suite *SocketsTestSuite) TestMessageReachesEveryConnection() {
+	userID, token := suite.login(suite.authService, "alice@example.com")
+
+	var conns []*websocket.Conn
+	for i := 0; i < 2; i++ {
+		conn, _, err := suite.dial("?token=" + token)
+		suite.Require().NoError(err)
+		defer conn.Close()
+		suite.Equal("authenticated", suite.readMessage(conn).Type)
+		conns = append(conns, conn)
+	}
+	suite.Equal(2, suite.hub.ConnectionCount(userID))
+
+	suite.NoError(suite.hub.MessageUser(userID, []byte(`{"type":"reminder"}`)))
+	for _, conn := range conns {
+		suite.Equal("reminder", suite.readMessage(conn).Type)
+	}
+
+	// Closing one device leaves the other connected
+	conns[0].Close()
+	suite.Eventually(func() bool { return suite.hub.ConnectionCount(userID) == 1 }, 2*time.Second, 10*time.Millisecond)
+	suite.NoError(suite.hub.MessageUser(userID, []byte(`{"type":"still-here"}`)))
+	suite.Equal("still-here", suite.readMessage(conns[1]).Type)
+}
+
+func (suite *SocketsTestSuite) TestPublishSyncsEveryConnection() {
+	userID, token := suite.login(suite.authService, "alice@example.com")
+
+	var conns []*websocket.Conn
+	for i := 0; i < 2; i++ {
+		conn, _, err := suite.dial("?token=" + token)
+		suite.Require().NoError(err)
+		defer conn.Close()
+		suite.Equal("authenticated", suite.readMessage(conn).Type)
+		conns = append(conns, conn)
+	}
+
+	suite.NoError(suite.hub.Publish(userID, "habit.created", db.Habit{ID: "read", Name: "Read"}))
+	for _, conn := range conns {
+		msg := suite.readMessage(conn)
+		suite.Equal("habit.created", msg.Type)
+		suite.Equal("Read", msg.Data.(map[string]interface{})["name"])
+	}
+
+	// Users without a connection have nothing to sync
+	suite.NoError(suite.hub.Publish("offline-user", "habit.deleted", map[string]string{"id": "read"}))
+}
+
+func (suite *SocketsTestSuite) TestSlowConsumerEvicted() {
+	suite.hub.SendQueueSize = 1
+	suite.hub.WriteWait = 100 * time.Millisecond
+	userID, token := suite.login(suite.authService, "alice@example.com")
+
+	conn, _, err := suite.dial("?token=" + token)
+	suite.Require().NoError(err)
+	defer conn.Close()
+	suite.Equal("authenticated", suite.readMessage(conn).Type)
+
+	// The client stops reading, so its queue and the socket buffers fill up
+	payload := []byte(`{"type":"flood","data":"` + strings.Repeat("x", 32*1024) + `"}`)
+	suite.Eventually(func() bool {
+		suite.hub.MessageUser(userID, payload)
+		return suite.hub.ConnectionCount(userID) == 0
+	}, 5*time.Second, time.Millisecond)
+}
+
+func (suite *SocketsTestSuite) TestIdleConnectionsArePinged() {
+	suite.hub.PingInterval = 20 * time.Millisecond
+	_, token := suite.login(suite.authService, "alice@example.com")
+
+	conn, _, err := suite.dial("?token=" + token)
+	suite.Require().NoError(err)
+	defer conn.Close()
+
+	pinged := make(chan struct{}, 1)
+	conn.SetPingHandler(func(data string) error {
+		select {
+		case pinged <- struct{}{}:
+		default:
+		}
+		return conn.WriteControl(websocket.PongMessage, []byte(data), time.Now().Add(time.Second))
+	})
+
+	// Control frames are handled while reading
+	suite.Equal("authenticated", suite.readMessage(conn).Type)
+	go conn.ReadMessage()
+	select {
+	case <-pinged:
+	case <-time.After(2 * time.Second):
+		suite.Fail("no ping received")
+	}
+}
+
+// call sends a request and reads the next reply
+func (suite *SocketsTestSuite) call(conn *websocket.Conn, request sockets.Request) sockets.Reply {
+	suite.Require().NoError(conn.WriteJSON(request))
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var reply sockets.Reply
+	suite.Require().NoError(conn.ReadJSON(&reply))
+	return reply
+}
+
+func (suite *SocketsTestSuite) TestRequestsGetCorrelatedReplies() {
+	userID, token := suite.login(suite.authService, "alice@example.com")
+	suite.Require().NoError(suite.database.CreateHabit(&db.Habit{
+		ID: "read", UserID: userID, Name: "Read", Frequency: "daily", StartDate: "2024-01-01", Status: db.StatusActive,
+	}))
+
+	conn, _, err := suite.dial("?token=" + token)
+	suite.Require().NoError(err)
+	defer conn.Close()
+	suite.Equal("authenticated", suite.readMessage(conn).Type)
+
+	reply := suite.call(conn, sockets.Request{ID: "1", Type: "habits.list"})
+	suite.Equal("1", reply.ID)
+	suite.Equal("habits.list", reply.Type)
+	suite.Nil(reply.Error)
+	suite.Len(reply.Payload, 1)
+
+	// The caller's connections receive the change as a sync event, ahead of the reply
+	event := suite.call(conn, sockets.Request{ID: "2", Type: "tracking.create", Payload: json.RawMessage(`{"habitId": "read", "note": "chapter 1"}`)})
+	suite.Equal(handlers.EventTrackingCreated, event.Type)
+	suite.Empty(event.ID)
+
+	reply = sockets.Reply{}
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	suite.Require().NoError(conn.ReadJSON(&reply))
+	suite.Equal("2", reply.ID)
+	suite.Require().Nil(reply.Error)
+	suite.Equal("chapter 1", reply.Payload.(map[string]interface{})["note"])
+	entries, err := suite.database.GetTrackingEntriesByHabitID(userID, "read")
+	suite.NoError(err)
+	suite.Len(entries, 1)
+
+	event = suite.call(conn, sockets.Request{ID: "3", Type: "reminder.snooze", Payload: json.RawMessage(`{"habitId": "read", "minutes": 15}`)})
+	suite.Equal(handlers.EventReminderSnoozed, event.Type)
+	reply = sockets.Reply{}
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	suite.Require().NoError(conn.ReadJSON(&reply))
+	suite.Equal("3", reply.ID)
+	suite.Nil(reply.Error)
+
+	event = suite.call(conn, sockets.Request{ID: "4", Type: "reminder.dismiss", Payload: json.RawMessage(`{"habitId": "read"}`)})
+	suite.Equal(handlers.EventReminderDismissed, event.Type)
+	reply = sockets.Reply{}
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	suite.Require().NoError(conn.ReadJSON(&reply))
+	suite.Equal("4", reply.ID)
+	suite.Nil(reply.Error)
+	history, err := suite.database.GetReminderActions(userID, "read")
+	suite.NoError(err)
+	suite.Len(history, 2)
+
+	reply = suite.call(conn, sockets.Request{ID: "5", Type: "reminder.snooze", Payload: json.RawMessage(`{"habitId": "read"}`)})
+	suite.Equal("5", reply.ID)
+	suite.Equal(sockets.CodeBadRequest, reply.Error.Code)
+
+	// Entries are validated as they are over HTTP
+	reply = suite.call(conn, sockets.Request{ID: "6", Type: "tracking.create", Payload: json.RawMessage(`{"habitId": "read", "value": -1, "timestamp": "2023-12-31T12:00:00Z"}`)})
+	suite.Equal("6", reply.ID)
+	suite.Require().NotNil(reply.Error)
+	suite.Equal(sockets.CodeBadRequest, reply.Error.Code)
+	suite.Contains(reply.Error.Message, "value must be at least 0")
+	suite.Contains(reply.Error.Message, "timestamp must not be before the habit's start date")
+}
+
+func (suite *SocketsTestSuite) TestInvalidRequestsGetErrors() {
+	_, token := suite.login(suite.authService, "alice@example.com")
+
+	conn, _, err := suite.dial("")
+	suite.Require().NoError(err)
+	defer conn.Close()
+
+	// Operations require authentication
+	reply := suite.call(conn, sockets.Request{ID: "1", Type: "habits.list"})
+	suite.Equal("error", reply.Type)
+	suite.Equal(sockets.CodeUnauthenticated, reply.Error.Code)
+
+	suite.NoError(conn.WriteJSON(sockets.Message{Type: "auth", Data: sockets.AuthData{Token: token}}))
+	suite.Equal("authenticated", suite.readMessage(conn).Type)
+
+	for _, tc := range []struct {
+		request sockets.Request
+		code    string
+	}{
+		{sockets.Request{ID: "2", Type: "chat", Payload: json.RawMessage(`"hello everyone"`)}, sockets.CodeUnknownType},
+		{sockets.Request{ID: "3", Version: 2, Type: "habits.list"}, sockets.CodeUnsupportedVersion},
+		{sockets.Request{ID: "4", Type: "tracking.create", Payload: json.RawMessage(`{"note": "no habit"}`)}, sockets.CodeBadRequest},
+		{sockets.Request{ID: "5", Type: "tracking.create", Payload: json.RawMessage(`{"habitId": "missing"}`)}, sockets.CodeNotFound},
+		{sockets.Request{ID: "6", Type: "habits.list", Payload: json.RawMessage(`{"status": ["done"]}`)}, sockets.CodeBadRequest},
+	} {
+		reply := suite.call(conn, tc.request)
+		suite.Equal(tc.request.ID, reply.ID)
+		suite.Equal("error", reply.Type)
+		suite.Require().NotNil(reply.Error, "request %s", tc.request.ID)
+		suite.Equal(tc.code, reply.Error.Code, "request %s", tc.request.ID)
+	}
+}
+
+func (suite *SocketsTestSuite) TestClientMessagesAreNotRebroadcast() {
+	_, aliceToken := suite.login(suite.authService, "alice@example.com")
+	_, bobToken := suite.login(suite.authService, "bob@example.com")
+
+	alice, _, err := suite.dial("?token=" + aliceToken)
+	suite.Require().NoError(err)
+	defer alice.Close()
+	suite.Equal("authenticated", suite.readMessage(alice).Type)
+
+	bob, _, err := suite.dial("?token=" + bobToken)
+	suite.Require().NoError(err)
+	defer bob.Close()
+	suite.Equal("authenticated", suite.readMessage(bob).Type)
+
+	suite.Equal("error", suite.call(alice, sockets.Request{Type: "reminder", Payload: json.RawMessage(`{"secret": true}`)}).Type)
+
+	bob.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+	_, _, err = bob.ReadMessage()
+	suite.Error(err, "bob must not receive alice's message")
+}
+
+// Run the test suite
+func TestSocketsTestSuite(t *testing.T) {
+	suite.Run(t, new(SocketsTestSuite))
+}
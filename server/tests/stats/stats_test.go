@@ -0,0 +1,262 @@
+package stats_test
+
+import (
+	"testing"
+	"time"
+
+	"habit-tracker/server/db"
+	"habit-tracker/server/stats"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func date(year int, month time.Month, day, hour int) time.Time {
+	return time.Date(year, month, day, hour, 0, 0, 0, time.UTC)
+}
+
+// habitOf builds a habit without a target from completion times
+func habitOf(cadence stats.Cadence, times ...time.Time) stats.Habit {
+	habit := stats.Habit{Cadence: cadence}
+	for _, at := range times {
+		habit.Completions = append(habit.Completions, stats.Completion{Time: at})
+	}
+	return habit
+}
+
+func TestStreaksNoCompletions(t *testing.T) {
+	current, longest := stats.Streaks(habitOf(db.FrequencyDaily), time.Now())
+	assert.Equal(t, 0, current)
+	assert.Equal(t, 0, longest)
+}
+
+func TestStreaksDaily(t *testing.T) {
+	now := date(2024, time.May, 15, 20)
+	completions := []time.Time{
+		date(2024, time.May, 1, 8),
+		date(2024, time.May, 2, 8),
+		date(2024, time.May, 3, 8),
+		date(2024, time.May, 3, 18), // same day counts once
+		date(2024, time.May, 13, 8),
+		date(2024, time.May, 14, 8),
+		date(2024, time.May, 15, 8),
+	}
+
+	current, longest := stats.Streaks(habitOf(db.FrequencyDaily, completions...), now)
+	assert.Equal(t, 3, current)
+	assert.Equal(t, 3, longest)
+}
+
+func TestStreaksWeekly(t *testing.T) {
+	// Done every Monday for four weeks
+	completions := []time.Time{
+		date(2024, time.April, 22, 9),
+		date(2024, time.April, 29, 9),
+		date(2024, time.May, 6, 9),
+		date(2024, time.May, 13, 9),
+	}
+
+	current, longest := stats.Streaks(habitOf(db.FrequencyWeekly, completions...), date(2024, time.May, 15, 9))
+	assert.Equal(t, 4, current)
+	assert.Equal(t, 4, longest)
+}
+
+func TestStreaksCurrentPeriodStillOpen(t *testing.T) {
+	completions := []time.Time{
+		date(2024, time.March, 10, 9),
+		date(2024, time.April, 10, 9),
+	}
+
+	// Nothing yet in May, but May is not over so the streak holds
+	current, _ := stats.Streaks(habitOf(db.FrequencyMonthly, completions...), date(2024, time.May, 20, 9))
+	assert.Equal(t, 2, current)
+
+	// Once June starts without a May completion the streak is broken
+	current, longest := stats.Streaks(habitOf(db.FrequencyMonthly, completions...), date(2024, time.June, 1, 9))
+	assert.Equal(t, 0, current)
+	assert.Equal(t, 2, longest)
+}
+
+func TestStreaksHourly(t *testing.T) {
+	completions := []time.Time{
+		time.Date(2024, time.May, 15, 9, 5, 0, 0, time.UTC),
+		time.Date(2024, time.May, 15, 10, 55, 0, 0, time.UTC),
+		time.Date(2024, time.May, 15, 12, 30, 0, 0, time.UTC),
+	}
+
+	current, longest := stats.Streaks(habitOf(db.FrequencyHourly, completions...), time.Date(2024, time.May, 15, 12, 45, 0, 0, time.UTC))
+	assert.Equal(t, 1, current)
+	assert.Equal(t, 2, longest)
+}
+
+func TestStreaksQuarterlyAndYearly(t *testing.T) {
+	quarterly := []time.Time{
+		date(2023, time.November, 1, 9),
+		date(2024, time.February, 1, 9),
+		date(2024, time.June, 30, 9),
+	}
+	current, longest := stats.Streaks(habitOf(db.FrequencyQuarterly, quarterly...), date(2024, time.August, 1, 9))
+	assert.Equal(t, 3, current)
+	assert.Equal(t, 3, longest)
+
+	yearly := []time.Time{
+		date(2021, time.December, 31, 9),
+		date(2023, time.January, 1, 9),
+	}
+	current, longest = stats.Streaks(habitOf(db.FrequencyYearly, yearly...), date(2024, time.March, 1, 9))
+	assert.Equal(t, 1, current)
+	assert.Equal(t, 1, longest)
+}
+
+func TestCompletionRateCountsSatisfiedPeriods(t *testing.T) {
+	now := date(2024, time.May, 31, 20)
+	habit := habitOf(db.FrequencyWeekly,
+		date(2024, time.May, 6, 9),
+		date(2024, time.May, 7, 9), // same week counts once
+		date(2024, time.May, 20, 9),
+	)
+	habit.Start = date(2024, time.May, 6, 0)
+
+	// Weeks of May 6, 13, 20 and 27; the open week of May 27 is not held against it
+	rate := stats.CompletionRate(habit, habit.Start, now)
+	assert.Equal(t, 3, rate.ActualCompletions)
+	assert.Equal(t, 3, rate.ExpectedCompletions)
+	assert.InDelta(t, 2.0/3.0, rate.CompletionRate, 0.0001)
+}
+
+func TestCompletionRateClampsToHabitStart(t *testing.T) {
+	now := date(2024, time.May, 31, 20)
+	habit := habitOf(db.FrequencyDaily, date(2024, time.May, 30, 9), date(2024, time.May, 31, 9))
+	habit.Start = date(2024, time.May, 30, 0)
+
+	rate := stats.CompletionRate(habit, stats.WindowStart(30, now), now)
+	assert.Equal(t, 2, rate.ExpectedCompletions)
+	assert.Equal(t, 1.0, rate.CompletionRate)
+}
+
+func TestPausedPeriodsAreSkipped(t *testing.T) {
+	now := date(2024, time.May, 10, 20)
+	habit := habitOf(db.FrequencyDaily,
+		date(2024, time.May, 1, 8),
+		date(2024, time.May, 2, 8),
+		date(2024, time.May, 3, 8),
+		date(2024, time.May, 5, 8), // done anyway while paused
+		date(2024, time.May, 8, 8),
+		date(2024, time.May, 9, 8),
+		date(2024, time.May, 10, 8),
+	)
+	habit.Start = date(2024, time.May, 1, 0)
+	habit.Pauses = []stats.Pause{{Start: date(2024, time.May, 4, 0), End: date(2024, time.May, 8, 0)}}
+
+	// May 4, 6 and 7 were paused: they neither count nor break the streak
+	current, longest := stats.Streaks(habit, now)
+	assert.Equal(t, 7, current)
+	assert.Equal(t, 7, longest)
+
+	rate := stats.CompletionRate(habit, habit.Start, now)
+	assert.Equal(t, 7, rate.ExpectedCompletions)
+	assert.Equal(t, 1.0, rate.CompletionRate)
+
+	// An ongoing pause freezes the streak
+	habit.Pauses = append(habit.Pauses, stats.Pause{Start: date(2024, time.May, 10, 21)})
+	current, _ = stats.Streaks(habit, date(2024, time.May, 20, 12))
+	assert.Equal(t, 7, current)
+}
+
+func TestSummarize(t *testing.T) {
+	now := date(2024, time.May, 15, 20)
+	habit := habitOf(db.FrequencyDaily,
+		date(2024, time.May, 13, 8),
+		date(2024, time.May, 14, 8),
+		date(2024, time.May, 15, 8),
+	)
+	habit.Start = date(2024, time.May, 13, 0)
+
+	summary := stats.Summarize(habit, now)
+	assert.Equal(t, 3, summary.TotalEntries)
+	assert.Equal(t, 3, summary.CurrentStreak)
+	assert.Equal(t, 3, summary.LongestStreak)
+	assert.Equal(t, 1.0, summary.CompletionRate)
+	assert.Equal(t, date(2024, time.May, 15, 8), summary.LastCompleted)
+}
+
+func TestOverall(t *testing.T) {
+	now := date(2024, time.May, 31, 20)
+	habits := []stats.Habit{
+		habitOf(db.FrequencyDaily, date(2024, time.May, 31, 8), date(2024, time.May, 27, 8)),
+		habitOf(db.FrequencyWeekly, date(2024, time.May, 10, 8), date(2024, time.March, 1, 8)),
+	}
+
+	overview := stats.Overall(habits, now)
+	assert.Equal(t, 2, overview.TotalHabits)
+	assert.Equal(t, 4, overview.TotalEntries)
+	assert.Equal(t, 1, overview.EntriesToday)
+	assert.Equal(t, 2, overview.EntriesThisWeek)
+	assert.InDelta(t, 3.0/30.0, overview.AvgEntriesPerDay, 0.0001)
+}
+
+func TestDailyCounts(t *testing.T) {
+	now := date(2024, time.May, 31, 20)
+	completions := []stats.Completion{
+		{Time: date(2024, time.May, 31, 8), Value: 2},
+		{Time: date(2024, time.May, 31, 9), Value: 3},
+		{Time: date(2024, time.May, 29, 8)},
+		{Time: date(2024, time.May, 1, 8)}, // outside the window
+	}
+
+	counts := stats.DailyCounts(completions, 7, now)
+	assert.Equal(t, []stats.DayCount{
+		{Date: "2024-05-29", Count: 1},
+		{Date: "2024-05-31", Count: 2, Value: 5},
+	}, counts)
+}
+
+func TestAggregate(t *testing.T) {
+	values := []float64{2, 5, 1}
+	assert.Equal(t, 8.0, stats.Aggregate(stats.AggregationSum, values))
+	assert.Equal(t, 8.0, stats.Aggregate("", values))
+	assert.Equal(t, 3.0, stats.Aggregate(stats.AggregationCount, values))
+	assert.Equal(t, 5.0, stats.Aggregate(stats.AggregationMax, values))
+}
+
+func TestStreaksWithTarget(t *testing.T) {
+	// 8 glasses of water per day
+	habit := stats.Habit{
+		Cadence: db.FrequencyDaily,
+		Target:  8,
+		Completions: []stats.Completion{
+			{Time: date(2024, time.May, 13, 8), Value: 5},
+			{Time: date(2024, time.May, 13, 18), Value: 3},
+			{Time: date(2024, time.May, 14, 8), Value: 6}, // short of the target
+			{Time: date(2024, time.May, 15, 8), Value: 8},
+		},
+	}
+
+	current, longest := stats.Streaks(habit, date(2024, time.May, 15, 20))
+	assert.Equal(t, 1, current)
+	assert.Equal(t, 1, longest)
+
+	// A partly done current period does not break the streak yet
+	current, _ = stats.Streaks(habit, date(2024, time.May, 14, 20))
+	assert.Equal(t, 1, current)
+}
+
+func TestCompletionRateWithCountTarget(t *testing.T) {
+	// Read three times a week
+	habit := stats.Habit{
+		Cadence:     db.FrequencyWeekly,
+		Start:       date(2024, time.May, 6, 0),
+		Target:      3,
+		Aggregation: stats.AggregationCount,
+		Completions: []stats.Completion{
+			{Time: date(2024, time.May, 6, 9)},
+			{Time: date(2024, time.May, 7, 9)},
+			{Time: date(2024, time.May, 8, 9)},
+			{Time: date(2024, time.May, 14, 9)},
+		},
+	}
+
+	rate := stats.CompletionRate(habit, habit.Start, date(2024, time.May, 20, 9))
+	assert.Equal(t, 4, rate.ActualCompletions)
+	assert.Equal(t, 2, rate.ExpectedCompletions)
+	assert.Equal(t, 0.5, rate.CompletionRate)
+}
@@ -1,7 +1,7 @@
 "use client";
 
 import React, { createContext, useContext, useState, ReactNode, useCallback } from 'react';
-import { Habit, TrackingEntry } from '@/types';
+import { Habit, SyncEvent, TrackingEntry } from '@/types';
 import { api } from '@/lib/api';
 import { toast } from 'sonner';
 import { useReminders } from './RemindersContext';
@@ -22,6 +22,7 @@ interface HabitsContextType {
   deleteHabit: (id: string) => Promise<void>;
   enrichHabitWithTracking: (habitId: string) => Promise<void>;
   addTrackingEntry: (habitId: string, entry: Parameters<typeof api.createTrackingEntry>[1]) => Promise<void>;
+  applySyncEvent: (event: SyncEvent) => void;
 }
 
 const HabitsContext = createContext<HabitsContextType | undefined>(undefined);
@@ -135,6 +136,53 @@ function HabitsProviderInternal({ children }: HabitsProviderProps) {
     }
   }, [removeReminder]);
 
+  // Applies a change made on any of the user's devices, including this one, so
+  // every update has to be idempotent
+  const applySyncEvent = useCallback((event: SyncEvent) => {
+    switch (event.type) {
+      case "habit.created":
+      case "habit.updated": {
+        const habit = event.data;
+        setHabits((prev) => {
+          if (!prev) return prev;
+          if (!prev.some((h) => h.id === habit.id)) return [...prev, habit];
+          return prev.map((h) => (h.id === habit.id ? { ...h, ...habit } : h));
+        });
+        break;
+      }
+      case "habit.deleted":
+        setHabits((prev) => prev?.filter((habit) => habit.id !== event.data.id) ?? prev);
+        removeReminder(event.data.id);
+        break;
+      case "tracking.created":
+      case "tracking.updated": {
+        const entry = event.data;
+        setHabits((prev) =>
+          prev?.map((habit) => {
+            // Entries that were never loaded are fetched on demand instead
+            if (habit.id !== entry.habitId || !habit.trackingEntries) return habit;
+            const exists = habit.trackingEntries.some((e) => e.id === entry.id);
+            const trackingEntries = exists
+              ? habit.trackingEntries.map((e) => (e.id === entry.id ? entry : e))
+              : [...habit.trackingEntries, entry];
+            return { ...habit, trackingEntries };
+          }) ?? prev
+        );
+        if (event.type === "tracking.created") removeReminder(entry.habitId);
+        break;
+      }
+      case "tracking.deleted":
+        setHabits((prev) =>
+          prev?.map((habit) =>
+            habit.id === event.data.habitId && habit.trackingEntries
+              ? { ...habit, trackingEntries: habit.trackingEntries.filter((e) => e.id !== event.data.id) }
+              : habit
+          ) ?? prev
+        );
+        break;
+    }
+  }, [removeReminder]);
+
   const value: HabitsContextType = {
     habits,
     loading,
@@ -146,6 +194,7 @@ function HabitsProviderInternal({ children }: HabitsProviderProps) {
     deleteHabit,
     enrichHabitWithTracking,
     addTrackingEntry,
+    applySyncEvent,
   };
 
   return (
@@ -1,13 +1,22 @@
 "use client";
 
-import { createContext, ReactNode, useContext, useEffect } from 'react';
+import { createContext, ReactNode, useCallback, useContext, useEffect, useRef } from 'react';
 import useWebSocket, { ReadyState } from 'react-use-websocket';
 import { useMessageHandler } from '../../hooks/useMessageHandler';
 import { useAuth } from './AuthContext';
+import { getAuthToken } from '@/lib/auth';
+import { AuthMessage, SocketReply, SocketRequest } from '@/types';
 
 interface SocketContextType {
   sendJsonMessage: ReturnType<typeof useWebSocket>['sendJsonMessage'];
   readyState: ReadyState;
+  // Calls an operation over the socket and resolves with its reply payload
+  request: <T>(type: string, payload?: unknown) => Promise<T>;
+}
+
+interface PendingRequest {
+  resolve: (payload: unknown) => void;
+  reject: (error: Error) => void;
 }
 
 const SocketContext = createContext<SocketContextType | undefined>(undefined);
@@ -17,26 +26,67 @@ const socketUrl = 'ws://localhost:8080/ws';
 export function SocketProvider({ children }: { children: ReactNode }) {
   const { handleMessage } = useMessageHandler();
   const { user } = useAuth();
+  const pending = useRef(new Map<string, PendingRequest>());
+  const nextId = useRef(0);
+
+  // Replies settle their request; everything else is a server push
+  const onMessage = useCallback((event: MessageEvent) => {
+    try {
+      const reply = JSON.parse(event.data) as SocketReply;
+      const request = reply.id ? pending.current.get(reply.id) : undefined;
+      if (request) {
+        pending.current.delete(reply.id);
+        if (reply.error) {
+          request.reject(new Error(reply.error.message));
+        } else {
+          request.resolve(reply.payload);
+        }
+        return;
+      }
+    } catch {
+      // Left to the message handler to report
+    }
+    handleMessage(event);
+  }, [handleMessage]);
 
   const {
     sendJsonMessage,
     readyState,
   } = useWebSocket(socketUrl, {
-    onMessage: handleMessage,
+    onMessage,
   }, !!user);
 
   useEffect(() => {
     if (readyState === ReadyState.OPEN) {
-      sendJsonMessage({
+      const message: AuthMessage = {
+        v: 1,
         type: "auth",
-        data: {
-          userId: user?.id,
+        payload: {
+          token: getAuthToken() ?? "",
         },
-      });
+      };
+      sendJsonMessage(message);
     }
-  }, [readyState, sendJsonMessage]);
+  }, [readyState, sendJsonMessage, user]);
+
+  // Requests in flight when the socket drops are never answered
+  useEffect(() => {
+    if (readyState === ReadyState.CLOSED) {
+      pending.current.forEach((request) => request.reject(new Error('Socket closed')));
+      pending.current.clear();
+    }
+  }, [readyState]);
+
+  const request = useCallback(<T,>(type: string, payload?: unknown) => {
+    const id = String(++nextId.current);
+    const message: SocketRequest = { v: 1, id, type, payload };
+    return new Promise<T>((resolve, reject) => {
+      pending.current.set(id, { resolve: (value) => resolve(value as T), reject });
+      sendJsonMessage(message);
+    });
+  }, [sendJsonMessage]);
 
-  return <SocketContext.Provider value={{ sendJsonMessage, readyState }}>{children}</SocketContext.Provider>;
+  return <SocketContext.Provider value={{ sendJsonMessage, readyState, request }}>{children}</SocketContext.Provider>;
 }
 
 export const useSocket = () => {
@@ -45,4 +95,4 @@ export const useSocket = () => {
     throw new Error('useSocket must be used within a SocketProvider');
   }
   return context;
-};
\ No newline at end of file
+};
@@ -1,6 +1,6 @@
 "use client";
 
-import React, { createContext, useContext, useState, ReactNode, useCallback } from 'react';
+import React, { createContext, useContext, useState, ReactNode, useCallback, useRef } from 'react';
 import { HabitStats, ProgressPoint, OverallStats, HabitCompletionRate, DailyCompletion } from '@/types';
 import { api } from '@/lib/api';
 import { toast } from 'sonner';
@@ -18,6 +18,7 @@ interface StatisticsContextType {
   fetchHabitStats: (habitId: string) => Promise<HabitStats>;
   fetchHabitProgress: (habitId: string, days?: number) => Promise<ProgressPoint[]>;
   fetchAllStatistics: (days?: number) => Promise<void>;
+  refreshStatistics: () => Promise<void>;
 }
 
 const StatisticsContext = createContext<StatisticsContextType | undefined>(undefined);
@@ -32,6 +33,9 @@ export function StatisticsProvider({ children }: StatisticsProviderProps) {
   const [dailyCompletions, setDailyCompletions] = useState<DailyCompletion[] | null>(null);
   const [statisticsLoading, setStatisticsLoading] = useState(false);
   const [statisticsError, setStatisticsError] = useState<string | null>(null);
+  // Remembered so a refresh reloads the same ranges
+  const completionRatesDays = useRef<number | undefined>(undefined);
+  const dailyCompletionsDays = useRef<number | undefined>(undefined);
 
   const fetchOverallStats = useCallback(async () => {
     try {
@@ -51,6 +55,7 @@ export function StatisticsProvider({ children }: StatisticsProviderProps) {
     try {
       setStatisticsLoading(true);
       setStatisticsError(null);
+      completionRatesDays.current = days;
       const rates = await api.getHabitCompletionRates(days);
       setHabitCompletionRates(rates);
     } catch (err) {
@@ -65,6 +70,7 @@ export function StatisticsProvider({ children }: StatisticsProviderProps) {
     try {
       setStatisticsLoading(true);
       setStatisticsError(null);
+      dailyCompletionsDays.current = days;
       const completions = await api.getDailyCompletions(days);
       setDailyCompletions(completions);
     } catch (err) {
@@ -122,6 +128,15 @@ export function StatisticsProvider({ children }: StatisticsProviderProps) {
     }
   }, [fetchOverallStats, fetchHabitCompletionRates, fetchDailyCompletions]);
 
+  // Reloads whichever statistics have been loaded, after the user's data changed
+  const refreshStatistics = useCallback(async () => {
+    await Promise.all([
+      overallStats ? fetchOverallStats() : undefined,
+      habitCompletionRates ? fetchHabitCompletionRates(completionRatesDays.current) : undefined,
+      dailyCompletions ? fetchDailyCompletions(dailyCompletionsDays.current) : undefined,
+    ]);
+  }, [overallStats, habitCompletionRates, dailyCompletions, fetchOverallStats, fetchHabitCompletionRates, fetchDailyCompletions]);
+
   const value: StatisticsContextType = {
     overallStats,
     habitCompletionRates,
@@ -134,6 +149,7 @@ export function StatisticsProvider({ children }: StatisticsProviderProps) {
     fetchHabitStats,
     fetchHabitProgress,
     fetchAllStatistics,
+    refreshStatistics,
   };
 
   return (
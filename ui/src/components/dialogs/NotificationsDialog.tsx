@@ -1,7 +1,7 @@
 "use client"
 
 import { useState, useEffect } from "react"
-import { IconBell, IconBellOff } from "@tabler/icons-react"
+import { IconBell, IconBellOff, IconCheck, IconX } from "@tabler/icons-react"
 
 import {
   Dialog,
@@ -19,6 +19,8 @@ import {
   isNotificationSupported,
 } from "@/lib/notifications"
 import { Switch } from "../ui/switch"
+import { api } from "@/lib/api"
+import { InboxNotification } from "@/types"
 
 interface NotificationsDialogProps {
   open: boolean
@@ -28,15 +30,41 @@ interface NotificationsDialogProps {
 export function NotificationsDialog({ open, onOpenChange }: NotificationsDialogProps) {
   const [notificationsEnabled, setNotificationsEnabled] = useState(false)
   const [isLoading, setIsLoading] = useState(false)
+  const [inbox, setInbox] = useState<InboxNotification[]>([])
 
   useEffect(() => {
     if (open) {
       // Check current notification permission status when dialog opens
       const permission = getNotificationPermission()
       setNotificationsEnabled(permission === 'granted')
+
+      // Reminders are kept in the inbox even when they were sent while offline
+      api.getNotifications()
+        .then(setInbox)
+        .catch((error) => console.error('Error loading notifications:', error))
     }
   }, [open])
 
+  const handleUpdateNotification = async (id: string, updates: { read?: boolean; dismissed?: boolean }) => {
+    try {
+      const updated = await api.updateNotification(id, updates)
+      setInbox((current) => updated.dismissed
+        ? current.filter((notification) => notification.id !== id)
+        : current.map((notification) => notification.id === id ? updated : notification))
+    } catch (error) {
+      console.error('Error updating notification:', error)
+    }
+  }
+
+  const handleMarkAllRead = async () => {
+    try {
+      await api.markAllNotificationsRead()
+      setInbox((current) => current.map((notification) => ({ ...notification, read: true })))
+    } catch (error) {
+      console.error('Error marking notifications read:', error)
+    }
+  }
+
   const handleToggleNotifications = async (enabled: boolean) => {
     if (!isNotificationSupported()) {
       toast("Not Supported", {
@@ -138,6 +166,60 @@ export function NotificationsDialog({ open, onOpenChange }: NotificationsDialogP
             </div>
           )}
 
+          <div className="space-y-2">
+            <div className="flex items-center justify-between">
+              <Label className="text-base">Inbox</Label>
+              <Button
+                variant="ghost"
+                size="sm"
+                onClick={handleMarkAllRead}
+                disabled={!inbox.some((notification) => !notification.read)}
+              >
+                Mark all read
+              </Button>
+            </div>
+            {inbox.length === 0 ? (
+              <p className="text-sm text-muted-foreground">No notifications yet.</p>
+            ) : (
+              <ul className="max-h-64 space-y-2 overflow-y-auto">
+                {inbox.map((notification) => (
+                  <li
+                    key={notification.id}
+                    className={`flex items-start justify-between gap-2 rounded-md border p-2 ${notification.read ? 'opacity-60' : ''}`}
+                  >
+                    <div>
+                      <p className="text-sm font-medium">{notification.subject}</p>
+                      <p className="text-xs text-muted-foreground">{notification.body}</p>
+                      <p className="text-xs text-muted-foreground">
+                        {new Date(notification.createdAt).toLocaleString()}
+                      </p>
+                    </div>
+                    <div className="flex gap-1">
+                      {!notification.read && (
+                        <Button
+                          variant="ghost"
+                          size="icon"
+                          aria-label="Mark as read"
+                          onClick={() => handleUpdateNotification(notification.id, { read: true })}
+                        >
+                          <IconCheck className="h-4 w-4" />
+                        </Button>
+                      )}
+                      <Button
+                        variant="ghost"
+                        size="icon"
+                        aria-label="Dismiss"
+                        onClick={() => handleUpdateNotification(notification.id, { dismissed: true })}
+                      >
+                        <IconX className="h-4 w-4" />
+                      </Button>
+                    </div>
+                  </li>
+                ))}
+              </ul>
+            )}
+          </div>
+
           <div className="flex justify-end">
             <Button variant="outline" onClick={() => onOpenChange(false)}>
               Close
@@ -1,11 +1,15 @@
 import { toast } from 'sonner';
 import { requestNotificationPermission, showBrowserNotification, getNotificationPermission } from '../lib/notifications';
-import { ReminderMessage } from '../types';
+import { ReminderActionMessage, ReminderMessage, SyncEvent, syncEventTypes } from '../types';
 import { useReminders } from '../components/contexts/RemindersContext';
+import { useHabits } from '../components/contexts/HabitsContext';
+import { useStatistics } from '../components/contexts/StatisticsContext';
 import { api } from '../lib/api';
 
 export const useMessageHandler = () => {
-  const { addReminder } = useReminders();
+  const { addReminder, removeReminder } = useReminders();
+  const { applySyncEvent } = useHabits();
+  const { refreshStatistics } = useStatistics();
 
   const handleMessage = async (event: MessageEvent) => {
     console.log('message', event.data);
@@ -15,6 +19,12 @@ export const useMessageHandler = () => {
       
       if (message.type === "reminder") {
         await handleReminderMessage(message as ReminderMessage);
+      } else if (message.type === "reminder.snoozed" || message.type === "reminder.dismissed") {
+        // Handled on another device
+        removeReminder((message as ReminderActionMessage).data.habitId);
+      } else if (syncEventTypes.includes(message.type)) {
+        applySyncEvent(message as SyncEvent);
+        await refreshStatistics();
       }
     } catch (error) {
       console.error('Error parsing websocket message:', error);
@@ -23,28 +33,39 @@ export const useMessageHandler = () => {
 
   const handleReminderMessage = async (reminderMessage: ReminderMessage) => {
     const { habitId, habitName, frequency } = reminderMessage.data;
+    const notificationId = reminderMessage.id;
     const notificationPermission = getNotificationPermission();
     
-    
-    try {
-      await api.updateReminder(habitId);
-    } catch (error) {
-      console.error('Error updating reminder on server:', error);
+    // Replayed reminders come from the inbox and were already recorded as sent
+    if (!reminderMessage.replayed) {
+      try {
+        await api.updateReminder(habitId);
+      } catch (error) {
+        console.error('Error updating reminder on server:', error);
+      }
     }
     
     
     addReminder(habitId);
     
+    const act = async (action: () => Promise<unknown>, message: string) => {
+      try {
+        await action();
+        removeReminder(habitId);
+        toast.success(message);
+      } catch (error) {
+        console.error('Error updating reminder:', error);
+        toast.error('Failed to update reminder');
+      }
+    };
+
     toast(habitName, {
       description: `It's time to track this habit - should be tracked ${frequency}`,
       duration: 10000,
-      cancel: notificationPermission === 'default' ? 
-        undefined : {
-          label: 'Close',
-          onClick: () => {
-            toast.dismiss();
-          },
-        },
+      cancel: {
+        label: 'Dismiss',
+        onClick: () => act(() => api.dismissReminder(habitId, notificationId), 'Reminder dismissed for this period'),
+      },
       action: notificationPermission === 'default' ? {
         label: 'Enable notifications',
         onClick: async () => {
@@ -54,7 +75,10 @@ export const useMessageHandler = () => {
             showBrowserNotification(habitName, frequency);
           }
         },
-      } : undefined,
+      } : {
+        label: 'Snooze 10 min',
+        onClick: () => act(() => api.snoozeReminder(habitId, { minutes: 10, notificationId }), 'Reminder snoozed for 10 minutes'),
+      },
     });
 
     
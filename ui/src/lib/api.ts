@@ -1,88 +1,119 @@
-import { Habit, TrackingEntry, CreateHabitRequest, CreateTrackingRequest, HabitStats, ProgressPoint, OverallStats, HabitCompletionRate, DailyCompletion } from '@/types';
+import { Habit, HabitStatus, TrackingEntry, CreateHabitRequest, CreateTrackingRequest, HabitStats, ProgressPoint, OverallStats, HabitCompletionRate, DailyCompletion, InboxNotification, ReminderAction, SnoozeRequest, FieldError } from '@/types';
+import { authFetch } from './auth';
+import { readProblem } from './problem';
 
 const API_BASE_URL = 'http://localhost:8080';
 
-class ApiError extends Error {
-  constructor(message: string, public status: number) {
+export class ApiError extends Error {
+  constructor(
+    message: string,
+    public status: number,
+    public code?: string,
+    public requestId?: string,
+    public errors: FieldError[] = [],
+  ) {
     super(message);
     this.name = 'ApiError';
   }
 }
 
+// apiError builds an ApiError from a failed response's problem details
+async function apiError(response: Response): Promise<ApiError> {
+  const problem = await readProblem(response);
+  return new ApiError(
+    problem?.detail || `HTTP error! status: ${response.status}`,
+    response.status,
+    problem?.code,
+    problem?.requestId,
+    problem?.errors,
+  );
+}
+
 async function handleResponse<T>(response: Response): Promise<T> {
   if (!response.ok) {
-    throw new ApiError(`HTTP error! status: ${response.status}`, response.status);
+    throw await apiError(response);
   }
   return response.json();
 }
 
 export const api = {
   
-  async getHabits(): Promise<Habit[]> {
-    const response = await fetch(`${API_BASE_URL}/habits`);
+  async getHabits(status?: HabitStatus[]): Promise<Habit[]> {
+    const query = status && status.length > 0 ? `?status=${status.join(',')}` : '';
+    const response = await authFetch(`${API_BASE_URL}/habits${query}`);
     return handleResponse<Habit[]>(response);
   },
 
   async getHabit(id: string): Promise<Habit> {
-    const response = await fetch(`${API_BASE_URL}/habits/${id}`);
+    const response = await authFetch(`${API_BASE_URL}/habits/${id}`);
     return handleResponse<Habit>(response);
   },
 
   async createHabit(habit: CreateHabitRequest): Promise<Habit> {
-    const response = await fetch(`${API_BASE_URL}/habits`, {
+    const response = await authFetch(`${API_BASE_URL}/habits`, {
       method: 'POST',
-      headers: {
-        'Content-Type': 'application/json',
-      },
       body: JSON.stringify(habit),
     });
     return handleResponse<Habit>(response);
   },
 
   async updateHabit(id: string, habit: Partial<Omit<Habit, 'id'>>): Promise<Habit> {
-    const response = await fetch(`${API_BASE_URL}/habits/${id}`, {
+    const response = await authFetch(`${API_BASE_URL}/habits/${id}`, {
       method: 'PATCH',
-      headers: {
-        'Content-Type': 'application/json',
-      },
       body: JSON.stringify(habit),
     });
     return handleResponse<Habit>(response);
   },
 
   async deleteHabit(id: string): Promise<void> {
-    const response = await fetch(`${API_BASE_URL}/habits/${id}`, {
+    const response = await authFetch(`${API_BASE_URL}/habits/${id}`, {
       method: 'DELETE',
     });
     console.log(response);
     if (!response.ok) {
-      throw new ApiError(`HTTP error! status: ${response.status}`, response.status);
+      throw await apiError(response);
     }
   },
 
   async getTrackingEntries(habitId: string): Promise<TrackingEntry[]> {
-    const response = await fetch(`${API_BASE_URL}/habits/${habitId}/tracking`);
+    const response = await authFetch(`${API_BASE_URL}/habits/${habitId}/tracking`);
     return handleResponse<TrackingEntry[]>(response);
   },
 
   async createTrackingEntry(habitId: string, entry: CreateTrackingRequest): Promise<TrackingEntry> {
-    const response = await fetch(`${API_BASE_URL}/habits/${habitId}/tracking`, {
+    const response = await authFetch(`${API_BASE_URL}/habits/${habitId}/tracking`, {
       method: 'POST',
-      headers: {
-        'Content-Type': 'application/json',
-      },
       body: JSON.stringify(entry),
     });
     return handleResponse<TrackingEntry>(response);
   },
 
+  async getTrackingEntry(habitId: string, entryId: string): Promise<TrackingEntry> {
+    const response = await authFetch(`${API_BASE_URL}/habits/${habitId}/tracking/${entryId}`);
+    return handleResponse<TrackingEntry>(response);
+  },
+
+  async updateTrackingEntry(habitId: string, entryId: string, entry: CreateTrackingRequest): Promise<TrackingEntry> {
+    const response = await authFetch(`${API_BASE_URL}/habits/${habitId}/tracking/${entryId}`, {
+      method: 'PATCH',
+      body: JSON.stringify(entry),
+    });
+    return handleResponse<TrackingEntry>(response);
+  },
+
+  async deleteTrackingEntry(habitId: string, entryId: string): Promise<void> {
+    const response = await authFetch(`${API_BASE_URL}/habits/${habitId}/tracking/${entryId}`, {
+      method: 'DELETE',
+    });
+    if (!response.ok) {
+      throw await apiError(response);
+    }
+  },
+
   
   async updateReminder(habitId: string): Promise<void> {
-    const response = await fetch(`${API_BASE_URL}/reminders/${habitId}`, {
+    const response = await authFetch(`${API_BASE_URL}/reminders/${habitId}`, {
       method: 'PATCH',
-      headers: {
-        'Content-Type': 'application/json',
-      },
       body: JSON.stringify({
         id: habitId + "-reminder",
         habitId: habitId,
@@ -90,33 +121,76 @@ export const api = {
       }),
     });
     if (!response.ok) {
-      throw new ApiError(`HTTP error! status: ${response.status}`, response.status);
+      throw await apiError(response);
     }
   },
 
+  async snoozeReminder(habitId: string, snooze: SnoozeRequest): Promise<ReminderAction> {
+    const response = await authFetch(`${API_BASE_URL}/habits/${habitId}/reminder/snooze`, {
+      method: 'POST',
+      body: JSON.stringify(snooze),
+    });
+    return handleResponse<ReminderAction>(response);
+  },
+
+  async dismissReminder(habitId: string, notificationId?: string): Promise<ReminderAction> {
+    const response = await authFetch(`${API_BASE_URL}/habits/${habitId}/reminder/dismiss`, {
+      method: 'POST',
+      body: JSON.stringify({ notificationId }),
+    });
+    return handleResponse<ReminderAction>(response);
+  },
+
+  async getReminderHistory(habitId: string): Promise<ReminderAction[]> {
+    const response = await authFetch(`${API_BASE_URL}/habits/${habitId}/reminder/history`);
+    return handleResponse<ReminderAction[]>(response);
+  },
+
+  // Notification inbox endpoints
+  async getNotifications(unreadOnly: boolean = false): Promise<InboxNotification[]> {
+    const query = unreadOnly ? '?unread=true' : '';
+    const response = await authFetch(`${API_BASE_URL}/notifications${query}`);
+    return handleResponse<InboxNotification[]>(response);
+  },
+
+  async updateNotification(id: string, updates: { read?: boolean; dismissed?: boolean }): Promise<InboxNotification> {
+    const response = await authFetch(`${API_BASE_URL}/notifications/${id}`, {
+      method: 'PATCH',
+      body: JSON.stringify(updates),
+    });
+    return handleResponse<InboxNotification>(response);
+  },
+
+  async markAllNotificationsRead(): Promise<{ marked: number }> {
+    const response = await authFetch(`${API_BASE_URL}/notifications/read-all`, {
+      method: 'POST',
+    });
+    return handleResponse<{ marked: number }>(response);
+  },
+
   // Statistics endpoints
   async getHabitStats(habitId: string): Promise<HabitStats> {
-    const response = await fetch(`${API_BASE_URL}/habits/${habitId}/stats`);
+    const response = await authFetch(`${API_BASE_URL}/habits/${habitId}/stats`);
     return handleResponse<HabitStats>(response);
   },
 
   async getHabitProgress(habitId: string, days: number = 30): Promise<ProgressPoint[]> {
-    const response = await fetch(`${API_BASE_URL}/habits/${habitId}/progress?days=${days}`);
+    const response = await authFetch(`${API_BASE_URL}/habits/${habitId}/progress?days=${days}`);
     return handleResponse<ProgressPoint[]>(response);
   },
 
   async getOverallStats(): Promise<OverallStats> {
-    const response = await fetch(`${API_BASE_URL}/stats/overview`);
+    const response = await authFetch(`${API_BASE_URL}/stats/overview`);
     return handleResponse<OverallStats>(response);
   },
 
   async getHabitCompletionRates(days: number = 30): Promise<HabitCompletionRate[]> {
-    const response = await fetch(`${API_BASE_URL}/stats/completion-rates?days=${days}`);
+    const response = await authFetch(`${API_BASE_URL}/stats/completion-rates?days=${days}`);
     return handleResponse<HabitCompletionRate[]>(response);
   },
 
   async getDailyCompletions(days: number = 30): Promise<DailyCompletion[]> {
-    const response = await fetch(`${API_BASE_URL}/stats/daily-completions?days=${days}`);
+    const response = await authFetch(`${API_BASE_URL}/stats/daily-completions?days=${days}`);
     return handleResponse<DailyCompletion[]>(response);
   },
 }; 
\ No newline at end of file
@@ -1,9 +1,15 @@
+import { problemMessage } from './problem';
+
 const API_BASE_URL = process.env.NEXT_PUBLIC_API_URL || 'http://localhost:8080';
 
 export interface User {
   id: string;
   email: string;
   username: string;
+  timezone?: string;
+  weekStart?: string;
+  quietHoursStart?: string;
+  quietHoursEnd?: string;
   created_at: string;
 }
 
@@ -21,10 +27,22 @@ export interface RegisterCredentials {
 export interface AuthResponse {
   user: User;
   token: string;
+  refreshToken?: string;
+  expiresIn?: number;
+}
+
+// Store the token pair returned by login and refresh
+function storeTokens(data: { token?: string; refreshToken?: string }): void {
+  if (data.token) {
+    localStorage.setItem('auth_token', data.token);
+  }
+  if (data.refreshToken) {
+    localStorage.setItem('refresh_token', data.refreshToken);
+  }
 }
 
 // Helper function to get auth headers
-function getAuthHeaders(): Record<string, string> {
+export function getAuthHeaders(): Record<string, string> {
   const token = localStorage.getItem('auth_token');
   return {
     'Content-Type': 'application/json',
@@ -43,8 +61,7 @@ export async function register(credentials: RegisterCredentials): Promise<AuthRe
   });
 
   if (!response.ok) {
-    const error = await response.text();
-    throw new Error(error || 'Registration failed');
+    throw new Error(await problemMessage(response, 'Registration failed'));
   }
 
   const data = await response.json();
@@ -68,20 +85,66 @@ export async function login(credentials: LoginCredentials): Promise<AuthResponse
   });
 
   if (!response.ok) {
-    const error = await response.text();
-    throw new Error(error || 'Login failed');
+    throw new Error(await problemMessage(response, 'Login failed'));
   }
 
   const data = await response.json();
   
-  // Store token in localStorage
-  if (data.token) {
-    localStorage.setItem('auth_token', data.token);
-  }
+  // Store tokens in localStorage
+  storeTokens(data);
   
   return data;
 }
 
+// Exchange the stored refresh token for a new token pair
+let refreshInFlight: Promise<boolean> | null = null;
+
+export async function refreshSession(): Promise<boolean> {
+  const refreshToken = localStorage.getItem('refresh_token');
+  if (!refreshToken) {
+    return false;
+  }
+
+  // Refresh tokens are single use, so concurrent callers share one request
+  if (!refreshInFlight) {
+    refreshInFlight = (async () => {
+      try {
+        const response = await fetch(`${API_BASE_URL}/auth/refresh`, {
+          method: 'POST',
+          headers: {
+            'Content-Type': 'application/json',
+          },
+          body: JSON.stringify({ refreshToken }),
+        });
+
+        if (!response.ok) {
+          clearTokens();
+          return false;
+        }
+
+        storeTokens(await response.json());
+        return true;
+      } catch (error: unknown) {
+        console.error('Error refreshing session:', error);
+        return false;
+      } finally {
+        refreshInFlight = null;
+      }
+    })();
+  }
+
+  return refreshInFlight;
+}
+
+// Fetch with auth headers, refreshing the session once if the access token was rejected
+export async function authFetch(input: string, init: RequestInit = {}): Promise<Response> {
+  const response = await fetch(input, { ...init, headers: getAuthHeaders() });
+  if (response.status !== 401 || !(await refreshSession())) {
+    return response;
+  }
+  return fetch(input, { ...init, headers: getAuthHeaders() });
+}
+
 // Get user profile
 export async function getProfile(): Promise<User> {
   const response = await fetch(`${API_BASE_URL}/auth/profile`, {
@@ -95,6 +158,27 @@ export async function getProfile(): Promise<User> {
   return response.json();
 }
 
+// Update the user's time zone, week start and quiet hours
+export async function updateProfile(preferences: {
+  timezone?: string;
+  weekStart?: string;
+  quietHoursStart?: string;
+  quietHoursEnd?: string;
+}): Promise<User> {
+  const response = await fetch(`${API_BASE_URL}/auth/profile`, {
+    method: 'PATCH',
+    headers: getAuthHeaders(),
+    body: JSON.stringify(preferences),
+  });
+
+  if (!response.ok) {
+    throw new Error(await problemMessage(response, 'Failed to update profile'));
+  }
+
+  const data = await response.json();
+  return data.user;
+}
+
 // Validate token
 export async function validateToken(): Promise<{ valid: boolean; user?: User }> {
   const token = localStorage.getItem('auth_token');
@@ -119,9 +203,20 @@ export async function validateToken(): Promise<{ valid: boolean; user?: User }>
   }
 }
 
-// Logout user
-export function logout(): void {
+function clearTokens(): void {
   localStorage.removeItem('auth_token');
+  localStorage.removeItem('refresh_token');
+}
+
+// Logout user, revoking the session on the server
+export function logout(): void {
+  if (localStorage.getItem('auth_token')) {
+    fetch(`${API_BASE_URL}/auth/logout`, {
+      method: 'POST',
+      headers: getAuthHeaders(),
+    }).catch((error: unknown) => console.error('Error logging out:', error));
+  }
+  clearTokens();
 }
 
 // Check if user is authenticated
@@ -0,0 +1,20 @@
+import { Problem } from '@/types';
+
+// readProblem parses a problem+json error response, or returns null when the
+// body is not one
+export async function readProblem(response: Response): Promise<Problem | null> {
+  if (!response.headers.get('Content-Type')?.includes('application/problem+json')) {
+    return null;
+  }
+  try {
+    return (await response.json()) as Problem;
+  } catch {
+    return null;
+  }
+}
+
+// problemMessage returns the detail of a problem response, or fallback
+export async function problemMessage(response: Response, fallback: string): Promise<string> {
+  const problem = await readProblem(response);
+  return problem?.detail || problem?.title || fallback;
+}
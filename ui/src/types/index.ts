@@ -10,17 +10,42 @@ export enum Frequency {
 
 export interface Habit {
   id: string;
+  userId: string;
   name: string;
   description: string;
   frequency: 'hourly' | 'daily' | 'weekly' | 'biweekly' | 'monthly' | 'quarterly' | 'yearly';
   startDate: string;
+  target?: number;
+  unit?: string;
+  aggregation?: Aggregation;
+  schedule?: string;
+  status?: HabitStatus;
+  resumeDate?: string;
+  pauses?: HabitPause[];
+  channels?: ReminderChannel[];
+  fallbackChannel?: ReminderChannel;
+  reminderTimes?: string[];
+  version?: number;
+  updatedAt?: string;
 }
 
+export type ReminderChannel = 'websocket' | 'email' | 'webhook' | 'log';
+
+export type HabitStatus = 'active' | 'paused' | 'archived';
+
+export interface HabitPause {
+  start: string;
+  end?: string;
+}
+
+export type Aggregation = 'sum' | 'count' | 'max';
+
 export interface TrackingEntry {
   id: string;
   habitId: string;
   timestamp: string;
   note: string;
+  value?: number;
 }
 
 export interface CreateHabitRequest {
@@ -28,16 +53,29 @@ export interface CreateHabitRequest {
   description: string;
   frequency: Habit['frequency'];
   startDate: string;
+  target?: number;
+  unit?: string;
+  aggregation?: Aggregation;
+  schedule?: string;
+  status?: HabitStatus;
+  resumeDate?: string;
+  channels?: ReminderChannel[];
+  fallbackChannel?: ReminderChannel;
+  reminderTimes?: string[];
 }
 
 export interface CreateTrackingRequest {
   note?: string;
   timestamp?: string;
+  value?: number;
 }
 
 // WebSocket message types
 export interface ReminderMessage {
   type: "reminder";
+  // Inbox notification ID; replayed messages were stored while the user was offline
+  id?: string;
+  replayed?: boolean;
   data: {
     habitId: string;
     habitName: string;
@@ -47,13 +85,103 @@ export interface ReminderMessage {
   };
 }
 
+// Snooze for a number of minutes, or until an ISO time
+export interface SnoozeRequest {
+  minutes?: number;
+  until?: string;
+  notificationId?: string;
+}
+
+// An entry in a habit's reminder history
+export interface ReminderAction {
+  id: string;
+  userId: string;
+  habitId: string;
+  notificationId?: string;
+  action: 'snoozed' | 'dismissed';
+  until: string;
+  createdAt: string;
+}
+
+export interface ReminderActionMessage {
+  type: "reminder.snoozed" | "reminder.dismissed";
+  data: ReminderAction;
+}
+
+// Notification inbox entry
+export interface InboxNotification {
+  id: string;
+  userId: string;
+  habitId?: string;
+  type: string;
+  subject: string;
+  body: string;
+  data?: ReminderMessage['data'];
+  read: boolean;
+  dismissed: boolean;
+  createdAt: string;
+}
+
+// Sync events pushed after the user's data changes on any device
+export type SyncEvent =
+  | { type: "habit.created" | "habit.updated"; data: Habit }
+  | { type: "habit.deleted"; data: { id: string } }
+  | { type: "tracking.created" | "tracking.updated"; data: TrackingEntry }
+  | { type: "tracking.deleted"; data: { id: string; habitId: string } };
+
+export const syncEventTypes: SyncEvent['type'][] = [
+  "habit.created",
+  "habit.updated",
+  "habit.deleted",
+  "tracking.created",
+  "tracking.updated",
+  "tracking.deleted",
+];
+
 export interface AuthMessage {
+  v: 1;
   type: "auth";
-  data: {
-    userId: string;
+  payload: {
+    token: string;
   };
 }
 
+// Request/reply envelope for operations called over the socket
+export interface SocketRequest {
+  v: 1;
+  id: string;
+  type: string;
+  payload?: unknown;
+}
+
+export interface SocketReply {
+  v: number;
+  id: string;
+  type: string;
+  payload?: unknown;
+  error?: {
+    code: string;
+    message: string;
+  };
+}
+
+// Error responses (RFC 7807 application/problem+json)
+export interface FieldError {
+  field: string;
+  message: string;
+}
+
+export interface Problem {
+  type: string;
+  title: string;
+  status: number;
+  detail?: string;
+  instance?: string;
+  code: string;
+  requestId?: string;
+  errors?: FieldError[];
+}
+
 // Statistics Types
 export interface HabitStats {
   habitId: string;
@@ -70,6 +198,7 @@ export interface HabitStats {
 export interface ProgressPoint {
   date: string;
   count: number;
+  value: number;
 }
 
 export interface OverallStats {